@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/config"
+	"github.com/log-file-metric-exporter/pkg/kube"
+)
+
+// controller renders the flags for this node from a LogFileMetricExporterConfig resource into a
+// configuration file, for an exporter started with -config on the same file, e.g. in a shared volume.
+// The exporter reloads the file when it changes, see the -config flag for which flags take effect.
+func controller(args []string) {
+	var name, nodeName, out string
+	var interval time.Duration
+	var once bool
+	fs := flag.NewFlagSet("controller", flag.ExitOnError)
+	fs.StringVar(&name, "name", "default", "name of the LogFileMetricExporterConfig resource")
+	fs.StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"), "name of this node, to select flags by node labels")
+	fs.StringVar(&out, "config", "", "configuration file to write, the -config file of the exporter")
+	fs.DurationVar(&interval, "interval", 30*time.Second, "interval between gets of the resource and node")
+	fs.BoolVar(&once, "once", false, "write the file once and exit, e.g. in an init container so the file exists when the exporter starts")
+	_ = fs.Parse(args)
+	if out == "" || nodeName == "" {
+		fmt.Fprintln(os.Stderr, "controller: -config and -node-name or NODE_NAME are required")
+		fs.Usage()
+		os.Exit(2)
+	}
+	if interval <= 0 {
+		fmt.Fprintln(os.Stderr, "controller: -interval must be positive")
+		os.Exit(2)
+	}
+	client, err := kube.InCluster()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "controller:", err)
+		os.Exit(1)
+	}
+	if once {
+		flags, err := client.ExporterFlags(context.Background(), name, nodeName)
+		if err == nil {
+			err = writeConfig(out, flags)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "controller:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	log.Info("Rendering exporter configuration", "name", name, "node", nodeName, "config", out)
+	client.WatchExporterConfig(context.Background(), name, nodeName, interval, func(flags map[string]string) {
+		if err := writeConfig(out, flags); err != nil {
+			log.Error(err, "Error writing exporter configuration", "config", out)
+		}
+	})
+}
+
+// writeConfig replaces the configuration file at path with flags if they differ from its content.
+// The new file is renamed into place, so the exporter never loads a partly written file.
+func writeConfig(path string, flags map[string]string) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated from %v.%v resource, do not edit.\n", kube.ExporterConfigResource, kube.ExporterConfigGroup)
+	if err := config.Format(&b, flags); err != nil {
+		return err
+	}
+	if old, err := ioutil.ReadFile(path); err == nil && bytes.Equal(old, b.Bytes()) {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	log.V(1).Info("Writing exporter configuration", "config", path, "flags", len(flags))
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// diff prints per-container byte growth between two saved scrapes of /metrics, largest first.
+func diff(args []string) {
+	var rows int
+	var metric string
+	var elapsed time.Duration
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: diff [flags] BEFORE AFTER\n\nBEFORE and AFTER are saved scrapes of /metrics, e.g. from curl.")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&metric, "metric", logwatch.DefaultMetricName, "name of the exporter's byte counter")
+	fs.IntVar(&rows, "n", 0, "number of containers to show, 0 shows all")
+	fs.DurationVar(&elapsed, "elapsed", 0, "time between the scrapes, if set also print the byte rate")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var scrapes [2]map[string]*dto.MetricFamily
+	for i, name := range fs.Args() {
+		var err error
+		if scrapes[i], err = parseFile(name); err != nil {
+			fmt.Fprintln(os.Stderr, "diff:", err)
+			os.Exit(1)
+		}
+	}
+	printDiff(os.Stdout, containerGrowth(containerBytes(scrapes[0], metric), containerBytes(scrapes[1], metric)), rows, elapsed)
+}
+
+// parseFile parses a file of metrics in the prometheus text format.
+func parseFile(name string) (map[string]*dto.MetricFamily, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	families, err := parseMetrics(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+	return families, nil
+}
+
+// growth is the byte growth of a container between two scrapes.
+type growth struct {
+	container
+	before, after float64
+	growth        float64
+	status        string // "new" if only in after, "gone" if only in before, "reset" if the counter went down.
+}
+
+// containerGrowth computes growth between two scrapes, sorted by descending growth.
+func containerGrowth(before, after map[container]float64) []growth {
+	var list []growth
+	for c, n := range after {
+		g := growth{container: c, before: before[c], after: n, growth: n - before[c]}
+		if _, ok := before[c]; !ok {
+			g.status = "new"
+		} else if g.growth < 0 { // Series was reset.
+			g.growth, g.status = n, "reset"
+		}
+		list = append(list, g)
+	}
+	for c, n := range before {
+		if _, ok := after[c]; !ok {
+			list = append(list, growth{container: c, before: n, status: "gone"})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].growth != list[j].growth {
+			return list[i].growth > list[j].growth
+		}
+		return list[i].after > list[j].after
+	})
+	return list
+}
+
+// printDiff writes growth to out, with a rate column if elapsed is set.
+func printDiff(out io.Writer, list []growth, rows int, elapsed time.Duration) {
+	var total float64
+	for _, g := range list {
+		total += g.growth
+	}
+	fmt.Fprintf(out, "containers: %d  total growth: %s", len(list), humanBytes(total))
+	if elapsed > 0 {
+		fmt.Fprintf(out, "  rate: %s/s", humanBytes(total/elapsed.Seconds()))
+	}
+	fmt.Fprint(out, "\n\n")
+	rate := func(g growth) string {
+		if elapsed <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%12s ", humanBytes(g.growth/elapsed.Seconds()))
+	}
+	if elapsed > 0 {
+		fmt.Fprintf(out, "%12s ", "RATE/s")
+	}
+	fmt.Fprintf(out, "%12s %12s %12s  %-20s %-30s %-20s %s\n", "GROWTH", "BEFORE", "AFTER", "NAMESPACE", "POD", "CONTAINER", "STATUS")
+	if rows > 0 && len(list) > rows {
+		list = list[:rows]
+	}
+	for _, g := range list {
+		fmt.Fprintf(out, "%s%12s %12s %12s  %-20s %-30s %-20s %s\n", rate(g), humanBytes(g.growth), humanBytes(g.before), humanBytes(g.after),
+			truncate(g.namespace, 20), truncate(g.pod, 30), truncate(g.name, 20), g.status)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	beforeScrape = `# TYPE log_logged_bytes_total counter
+log_logged_bytes_total{namespace="ns",podname="a",containername="c",path="/a"} 100
+log_logged_bytes_total{namespace="ns",podname="b",containername="c",path="/b"} 2048
+log_logged_bytes_total{namespace="ns",podname="c",containername="c",path="/c"} 50
+`
+	afterScrape = `# TYPE log_logged_bytes_total counter
+log_logged_bytes_total{namespace="ns",podname="a",containername="c",path="/a"} 120
+log_logged_bytes_total{namespace="ns",podname="a",containername="c",path="/a.1"} 30
+log_logged_bytes_total{namespace="ns",podname="b",containername="c",path="/b"} 10
+log_logged_bytes_total{namespace="ns",podname="d",containername="c",path="/d"} 5
+`
+)
+
+func TestDiff(t *testing.T) {
+	before, err := parseMetrics(strings.NewReader(beforeScrape))
+	require.NoError(t, err)
+	after, err := parseMetrics(strings.NewReader(afterScrape))
+	require.NoError(t, err)
+	list := containerGrowth(containerBytes(before, "log_logged_bytes_total"), containerBytes(after, "log_logged_bytes_total"))
+	assert.Equal(t, []growth{
+		{container: container{"ns", "a", "c"}, before: 100, after: 150, growth: 50},
+		{container: container{"ns", "b", "c"}, before: 2048, after: 10, growth: 10, status: "reset"},
+		{container: container{"ns", "d", "c"}, after: 5, growth: 5, status: "new"},
+		{container: container{"ns", "c", "c"}, before: 50, status: "gone"},
+	}, list)
+	assert.Empty(t, containerBytes(after, "node_log_bytes_total"), "other metric name")
+
+	var out bytes.Buffer
+	printDiff(&out, list, 3, 5*time.Second)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 6, "gone container not shown with -n 3")
+	assert.Equal(t, "containers: 4  total growth: 65B  rate: 13B/s", lines[0])
+	assert.Equal(t, "", lines[1])
+	assert.Equal(t, []string{"RATE/s", "GROWTH", "BEFORE", "AFTER", "NAMESPACE", "POD", "CONTAINER", "STATUS"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"10B", "50B", "100B", "150B", "ns", "a", "c"}, strings.Fields(lines[3]))
+	assert.Equal(t, []string{"2B", "10B", "2.0KiB", "10B", "ns", "b", "c", "reset"}, strings.Fields(lines[4]))
+	assert.Equal(t, []string{"1B", "5B", "0B", "5B", "ns", "d", "c", "new"}, strings.Fields(lines[5]))
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/log-file-metric-exporter/pkg/mockkubelet"
+)
+
+// generate creates a mock kubelet log tree.
+func generate(args []string) {
+	var root string
+	var c mockkubelet.Config
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	fs.StringVar(&root, "root", "", "root directory of the tree, logs are created under <root>/var/log")
+	fs.IntVar(&c.Namespaces, "namespaces", 1, "number of namespaces")
+	fs.IntVar(&c.Pods, "pods", 10, "pods per namespace")
+	fs.IntVar(&c.Containers, "containers", 1, "containers per pod")
+	fs.IntVar(&c.Restarts, "restarts", 0, "restarts per container")
+	fs.IntVar(&c.Rotations, "rotations", 0, "rotated files per container")
+	fs.IntVar(&c.Size, "size", 1024, "approximate size of each log file in bytes")
+	_ = fs.Parse(args)
+	if root == "" {
+		fmt.Fprintln(os.Stderr, "generate: -root is required")
+		fs.Usage()
+		os.Exit(2)
+	}
+	tree, err := mockkubelet.Generate(root, c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "generate:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("generated %d container logs, run: log-file-metric-exporter -dir %s\n", len(tree.Logs), tree.Containers)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/log-file-metric-exporter/pkg/mockkubelet"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// loadtest runs the exporter against a mock log tree with a reproducible write load,
+// scraping its metrics while writing to report counting lag over time,
+// then reports exporter resource usage and final counting accuracy.
+func loadtest(args []string) {
+	var root string
+	var c mockkubelet.Config
+	var rate int
+	var duration, settle, interval time.Duration
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	fs.StringVar(&root, "root", "", "root directory for the mock log tree, default is a temporary directory")
+	fs.IntVar(&c.Namespaces, "namespaces", 1, "number of namespaces")
+	fs.IntVar(&c.Pods, "pods", 10, "pods per namespace")
+	fs.IntVar(&c.Containers, "containers", 1, "containers per pod")
+	fs.IntVar(&c.Size, "size", 1024, "initial size of each log file in bytes")
+	fs.IntVar(&rate, "rate", 10*1024, "bytes per second written to each container log")
+	fs.DurationVar(&duration, "duration", 30*time.Second, "duration of the write load")
+	fs.DurationVar(&settle, "settle", 2*time.Second, "time allowed for the exporter to catch up before the final scrape")
+	fs.DurationVar(&interval, "scrape-interval", 5*time.Second, "interval between scrapes during the write load, reporting the bytes not yet counted")
+	_ = fs.Parse(args)
+	if interval <= 0 {
+		fmt.Fprintln(os.Stderr, "loadtest: -scrape-interval must be positive")
+		os.Exit(2)
+	}
+
+	if err := runLoadtest(root, c, rate, duration, settle, interval); err != nil {
+		fmt.Fprintln(os.Stderr, "loadtest:", err)
+		os.Exit(1)
+	}
+}
+
+func runLoadtest(root string, c mockkubelet.Config, rate int, duration, settle, interval time.Duration) error {
+	tmp, err := ioutil.TempDir("", "loadtest")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	if root == "" {
+		root = filepath.Join(tmp, "root")
+	}
+	tree, err := mockkubelet.Generate(root, c)
+	if err != nil {
+		return err
+	}
+	crtFile, keyFile := filepath.Join(tmp, "tls.crt"), filepath.Join(tmp, "tls.key")
+	if err := selfSignedCert(crtFile, keyFile); err != nil {
+		return err
+	}
+	addr, err := freeAddr()
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exporter := exec.Command(exe, "-dir", tree.Containers, "-http", addr, "-crtFile", crtFile, "-keyFile", keyFile)
+	exporter.Stderr = os.Stderr
+	if err := exporter.Start(); err != nil {
+		return err
+	}
+	defer func() { _ = exporter.Process.Kill() }()
+
+	client := scrapeClient(true)
+	base := "https://" + addr
+	if err := waitReady(client, base+"/readyz", 10*time.Second); err != nil {
+		return err
+	}
+
+	fmt.Printf("writing %d bytes/s to each of %d container logs for %v\n", rate, len(tree.Logs), duration)
+	start := time.Now()
+	done := make(chan struct{})
+	lag := make(chan lagStats)
+	go func() { lag <- scrapeDuring(client, base+"/metrics", tree, start, interval, done) }()
+	written := writeLoad(tree, rate, duration)
+	close(done)
+	during := <-lag
+	time.Sleep(settle)
+
+	families, err := scrape(client, base+"/metrics")
+	if err != nil {
+		return err
+	}
+	counted := countedBytes(families)
+	var totalSize, totalCounted float64
+	mismatched := 0
+	for _, ct := range tree.Logs {
+		info, err := os.Stat(ct.Path)
+		if err != nil {
+			return err
+		}
+		size := float64(info.Size())
+		totalSize += size
+		totalCounted += counted[ct.Link]
+		if counted[ct.Link] != size {
+			mismatched++
+		}
+	}
+
+	_ = exporter.Process.Kill()
+	_ = exporter.Wait()
+	elapsed := time.Since(start)
+	state := exporter.ProcessState
+	cpu := state.UserTime() + state.SystemTime()
+	fmt.Printf("written: %d bytes (%.0f bytes/s)\n", written, float64(written)/duration.Seconds())
+	fmt.Printf("lag while writing: max %.0f bytes (%.2f%%), mean %.0f bytes over %d scrapes, %d failed\n",
+		during.max, during.maxPercent, during.mean(), during.scrapes, during.failed)
+	fmt.Printf("counted: %.0f of %.0f bytes, accuracy %.2f%%, mismatched files %d of %d\n",
+		totalCounted, totalSize, 100*totalCounted/totalSize, mismatched, len(tree.Logs))
+	fmt.Printf("exporter cpu: user %v system %v (%.1f%% of one core)\n",
+		state.UserTime(), state.SystemTime(), 100*cpu.Seconds()/elapsed.Seconds())
+	if rss, ok := maxRSS(state); ok {
+		fmt.Printf("exporter max rss: %.1f MiB\n", float64(rss)/(1024*1024))
+	}
+	return nil
+}
+
+// countedBytes returns the bytes counted by the exporter for each log file path.
+func countedBytes(families map[string]*dto.MetricFamily) map[string]float64 {
+	counted := map[string]float64{}
+	if mf := families[logwatch.DefaultMetricName]; mf != nil {
+		for _, m := range mf.GetMetric() {
+			counted[label(m, "path")] += m.GetCounter().GetValue()
+		}
+	}
+	return counted
+}
+
+// lagStats summarizes the bytes written but not yet counted, over the scrapes during the write load.
+type lagStats struct {
+	scrapes, failed int
+	max, maxPercent float64
+	total           float64
+}
+
+func (s lagStats) mean() float64 {
+	if s.scrapes == 0 {
+		return 0
+	}
+	return s.total / float64(s.scrapes)
+}
+
+// scrapeDuring scrapes url every interval until done is closed, printing the lag of each scrape:
+// the bytes in the logs of tree that were not counted yet, and its share of the log sizes.
+func scrapeDuring(client *http.Client, url string, tree *mockkubelet.Tree, start time.Time, interval time.Duration, done <-chan struct{}) (s lagStats) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return s
+		case <-ticker.C:
+		}
+		families, err := scrape(client, url)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "loadtest:", err)
+			s.failed++
+			continue
+		}
+		counted := countedBytes(families)
+		var size, lag float64
+		for _, ct := range tree.Logs {
+			if info, err := os.Stat(ct.Path); err == nil {
+				size += float64(info.Size())
+				if d := float64(info.Size()) - counted[ct.Link]; d > 0 {
+					lag += d
+				}
+			}
+		}
+		percent := 0.0
+		if size > 0 {
+			percent = 100 * lag / size
+		}
+		fmt.Printf("%6s lag %.0f bytes (%.2f%% of %.0f)\n", time.Since(start).Round(time.Second), lag, percent, size)
+		s.scrapes++
+		s.total += lag
+		if lag > s.max {
+			s.max, s.maxPercent = lag, percent
+		}
+	}
+}
+
+// writeLoad appends to every log in tree at rate bytes per second for duration,
+// returns the total bytes written.
+func writeLoad(tree *mockkubelet.Tree, rate int, duration time.Duration) int64 {
+	const tick = 100 * time.Millisecond
+	perTick := rate * int(tick) / int(time.Second)
+	var mu sync.Mutex
+	var total int64
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(duration)
+	for _, ct := range tree.Logs {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "loadtest:", err)
+				return
+			}
+			defer f.Close()
+			ticker := time.NewTicker(tick)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				if now.After(deadline) {
+					return
+				}
+				n, _ := mockkubelet.WriteLines(f, perTick)
+				mu.Lock()
+				total += int64(n)
+				mu.Unlock()
+			}
+		}(ct.Path)
+	}
+	wg.Wait()
+	return total
+}
+
+// waitReady polls url until it returns OK or timeout expires.
+func waitReady(client *http.Client, url string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("%v: %v", url, resp.Status)
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// freeAddr returns a free local TCP address.
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// selfSignedCert writes a self signed certificate and key for localhost.
+func selfSignedCert(crtFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(crtFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the maximum resident set size in bytes of an exited process.
+func maxRSS(state *os.ProcessState) (int64, bool) {
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return ru.Maxrss * 1024, true // Linux reports kilobytes.
+	}
+	return 0, false
+}
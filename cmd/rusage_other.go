@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "os"
+
+// maxRSS is not available on this platform.
+func maxRSS(state *os.ProcessState) (int64, bool) { return 0, false }
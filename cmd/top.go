@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ANSI terminal control sequences.
+const (
+	ansiClear  = "\033[H\033[2J"
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiRed    = "\033[31m"
+	ansiYellow = "\033[33m"
+	ansiGreen  = "\033[32m"
+	ansiGray   = "\033[90m"
+)
+
+// top shows live per-container byte rates from a running exporter, busiest first.
+func top(args []string) {
+	var url, metric string
+	var insecure, noColor bool
+	var interval time.Duration
+	var rows int
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	fs.StringVar(&url, "url", "https://localhost:2112/metrics", "metrics URL of the running exporter")
+	fs.BoolVar(&insecure, "insecure", true, "skip TLS certificate verification")
+	fs.StringVar(&metric, "metric", logwatch.DefaultMetricName, "name of the exporter's byte counter")
+	fs.DurationVar(&interval, "interval", 2*time.Second, "refresh interval")
+	fs.IntVar(&rows, "n", 20, "number of containers to show, 0 shows all")
+	fs.BoolVar(&noColor, "no-color", !isTerminal(os.Stdout), "disable colors and screen clearing")
+	_ = fs.Parse(args)
+	if interval <= 0 {
+		fmt.Fprintln(os.Stderr, "top: -interval must be positive")
+		os.Exit(2)
+	}
+
+	client := scrapeClient(insecure)
+	prev, err := scrape(client, url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "top:", err)
+		os.Exit(1)
+	}
+	last := time.Now()
+	for range time.Tick(interval) {
+		families, err := scrape(client, url)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "top:", err)
+			continue
+		}
+		now := time.Now()
+		rates := containerRates(containerBytes(prev, metric), containerBytes(families, metric), now.Sub(last))
+		prev, last = families, now
+		printTop(os.Stdout, url, rates, rows, !noColor)
+	}
+}
+
+// container identifies a container by namespace, pod and container name.
+type container struct{ namespace, pod, name string }
+
+// containerRate is the byte rate of a container.
+type containerRate struct {
+	container
+	bytes float64 // Total bytes counted.
+	rate  float64 // Bytes per second.
+}
+
+// containerBytes sums the byte counter named metric for each container.
+func containerBytes(families map[string]*dto.MetricFamily, metric string) map[container]float64 {
+	bytes := map[container]float64{}
+	if mf := families[metric]; mf != nil {
+		for _, m := range mf.GetMetric() {
+			c := container{label(m, "namespace"), label(m, "podname"), label(m, "containername")}
+			bytes[c] += m.GetCounter().GetValue()
+		}
+	}
+	return bytes
+}
+
+// containerRates computes rates between two scrapes, sorted by descending rate.
+func containerRates(prev, cur map[container]float64, elapsed time.Duration) []containerRate {
+	rates := make([]containerRate, 0, len(cur))
+	for c, n := range cur {
+		delta := n - prev[c]
+		if delta < 0 { // Series was reset.
+			delta = n
+		}
+		rates = append(rates, containerRate{container: c, bytes: n, rate: delta / elapsed.Seconds()})
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].rate != rates[j].rate {
+			return rates[i].rate > rates[j].rate
+		}
+		return rates[i].bytes > rates[j].bytes
+	})
+	return rates
+}
+
+// printTop writes one screen of rates to out.
+func printTop(out io.Writer, url string, rates []containerRate, rows int, color bool) {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	var total float64
+	for _, r := range rates {
+		total += r.rate
+	}
+	if color {
+		fmt.Fprint(out, ansiClear)
+	}
+	fmt.Fprintf(out, "%s  %s  containers: %d  total: %s/s\n\n",
+		time.Now().Format("15:04:05"), url, len(rates), humanBytes(total))
+	fmt.Fprintln(out, paint(ansiBold, fmt.Sprintf("%12s %12s  %-20s %-30s %s", "RATE/s", "TOTAL", "NAMESPACE", "POD", "CONTAINER")))
+	if rows > 0 && len(rates) > rows {
+		rates = rates[:rows]
+	}
+	for _, r := range rates {
+		line := fmt.Sprintf("%12s %12s  %-20s %-30s %s", humanBytes(r.rate), humanBytes(r.bytes), truncate(r.namespace, 20), truncate(r.pod, 30), r.name)
+		fmt.Fprintln(out, paint(rateColor(r.rate, total), line))
+	}
+	if !color {
+		fmt.Fprintln(out)
+	}
+}
+
+// rateColor picks a color for rate by its share of the total rate.
+func rateColor(rate, total float64) string {
+	switch {
+	case rate == 0:
+		return ansiGray
+	case rate >= total/2:
+		return ansiRed
+	case rate >= total/10:
+		return ansiYellow
+	default:
+		return ansiGreen
+	}
+}
+
+// humanBytes formats n bytes with a binary unit suffix.
+func humanBytes(n float64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%.0fB", n)
+	}
+	i := -1
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%ciB", n, units[i])
+}
+
+// isTerminal returns true if f is a character device, e.g. a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// truncate shortens s to n characters.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "~"
+}
@@ -6,5 +6,8 @@ require (
 	github.com/ViaQ/logerr v1.0.9
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/prometheus/client_golang v1.10.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.18.0
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/sys v0.0.0-20210309074719-68d13333faf2
 )
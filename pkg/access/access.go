@@ -0,0 +1,126 @@
+// package access checks at startup that the exporter can read the log files it watches,
+// so missing permissions fail fast with a precise error instead of producing no metrics.
+//
+// By default the exporter only lists directories and stats files, it does not read log content.
+// Options that parse log lines, such as counting lines or container instances, also need read permission on the files.
+// It does not need to run as root, it needs read and search permission on the log directory,
+// and search permission on every directory on the path to each log file, following symlinks.
+// A non-root process can get this by being in the group owning the log directories,
+// or with the capability CAP_DAC_READ_SEARCH.
+//
+package access
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxChecked limits the number of directory entries checked by Check.
+const maxChecked = 100
+
+// Error is a missing permission found by Check.
+type Error struct {
+	Path    string // Path that could not be accessed.
+	Blocked string // Directory or file that denied access, with its mode and owner.
+	Need    string // Permission needed on Blocked.
+	Process string // Identity and relevant capabilities of this process.
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cannot access %v: %v: need %v on %v; process %v; run as root, add the process to a group with access, or add capability CAP_DAC_READ_SEARCH",
+		e.Path, e.Err, e.Need, e.Blocked, e.Process)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Check returns an *Error if this process lacks permission to list a directory in paths,
+// or to stat a file in paths or in one of the directories, following symlinks.
+// Files that do not exist are not an error, they may be created later.
+// Only the first entries of a large directory are checked.
+func Check(paths ...string) error {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return denied(path, err)
+		}
+		if !info.IsDir() {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return denied(path, err)
+		}
+		names, err := f.Readdirnames(maxChecked)
+		_ = f.Close()
+		if err != nil && err != io.EOF && len(names) == 0 { // io.EOF: empty directory.
+			return denied(path, err)
+		}
+		for _, name := range names {
+			entry := filepath.Join(path, name)
+			if _, err := os.Stat(entry); err != nil && !os.IsNotExist(err) {
+				return denied(entry, err)
+			}
+		}
+	}
+	return nil
+}
+
+// denied returns an *Error for err accessing path, or err if it is not a permission error.
+func denied(path string, err error) error {
+	if !os.IsPermission(err) {
+		return err
+	}
+	e := &Error{Path: path, Err: err, Process: process()}
+	blocked, need := blocker(path)
+	e.Blocked, e.Need = describe(blocked), need
+	return e
+}
+
+// blocker finds the first directory on the path to path, following symlinks, that can't be searched.
+// Returns path itself if no directory blocks, it needs read permission.
+func blocker(path string) (blocked, need string) {
+	for depth := 0; depth < 8; depth++ {
+		for _, dir := range ancestors(path) {
+			if !searchable(dir) {
+				return dir, "search (x) permission"
+			}
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			break
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+	return path, "read (r) and search (x) permission"
+}
+
+// ancestors returns the directories containing path, outermost first.
+func ancestors(path string) []string {
+	path, _ = filepath.Abs(path)
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == filepath.Dir(dir) {
+			return dirs
+		}
+	}
+}
+
+// process describes this process: user, groups and capabilities.
+func process() string {
+	s := []string{identity()}
+	if caps := capabilities(); caps != "" {
+		s = append(s, caps)
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,67 @@
+//go:build !windows
+// +build !windows
+
+package access
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Linux capability bits that allow reading files regardless of permissions.
+const (
+	capDACOverride   = 1
+	capDACReadSearch = 2
+)
+
+// searchable returns true if this process can search directory dir.
+func searchable(dir string) bool { return syscall.Access(dir, 0x1) == nil } // X_OK
+
+// describe returns path with its mode and owner.
+func describe(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return path
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%v (mode %v, uid %v, gid %v)", path, info.Mode(), st.Uid, st.Gid)
+	}
+	return fmt.Sprintf("%v (mode %v)", path, info.Mode())
+}
+
+// identity returns the user and groups of this process.
+func identity() string {
+	groups, _ := os.Getgroups()
+	return fmt.Sprintf("uid %v, gid %v, groups %v", os.Geteuid(), os.Getegid(), groups)
+}
+
+// capabilities returns the effective capabilities that bypass file permissions,
+// or "" if they are not known on this platform.
+func capabilities() string {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "CapEff:" {
+			caps, err := strconv.ParseUint(fields[1], 16, 64)
+			if err != nil {
+				return ""
+			}
+			has := func(bit uint) string {
+				if caps&(1<<bit) != 0 {
+					return "yes"
+				}
+				return "no"
+			}
+			return fmt.Sprintf("CAP_DAC_READ_SEARCH %v, CAP_DAC_OVERRIDE %v", has(capDACReadSearch), has(capDACOverride))
+		}
+	}
+	return ""
+}
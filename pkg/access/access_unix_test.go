@@ -0,0 +1,69 @@
+//go:build !windows
+// +build !windows
+
+package access_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/access"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tree creates logs/link.log -> pods/sub/0.log and returns the root.
+func tree(t *testing.T) string {
+	t.Helper()
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Chmod(filepath.Join(root, "pods", "sub"), 0700)
+		_ = os.RemoveAll(root)
+	})
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "logs"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "pods", "sub"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "pods", "sub", "0.log"), nil, 0600))
+	require.NoError(t, os.Symlink(filepath.Join(root, "pods", "sub", "0.log"), filepath.Join(root, "logs", "link.log")))
+	return root
+}
+
+func TestCheck(t *testing.T) {
+	root := tree(t)
+	assert.NoError(t, access.Check(filepath.Join(root, "logs"), filepath.Join(root, "pods", "sub", "0.log")))
+	assert.NoError(t, access.Check(filepath.Join(root, "missing")), "missing paths may be created later")
+}
+
+func TestCheckDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root is never denied")
+	}
+	root := tree(t)
+	sub := filepath.Join(root, "pods", "sub")
+	require.NoError(t, os.Chmod(sub, 0600))
+	err := access.Check(filepath.Join(root, "logs"))
+	var e *access.Error
+	require.True(t, errors.As(err, &e), "%v", err)
+	assert.Equal(t, filepath.Join(root, "logs", "link.log"), e.Path)
+	assert.Contains(t, e.Blocked, sub)
+	assert.Contains(t, e.Need, "search")
+	assert.True(t, os.IsPermission(errors.Unwrap(err)))
+}
+
+func TestErrorMessage(t *testing.T) {
+	e := &access.Error{Path: "/logs/x.log", Blocked: "/pods (mode drwx------, uid 0, gid 0)", Need: "search (x) permission",
+		Process: "uid 1000, gid 1000, groups [] CAP_DAC_READ_SEARCH no, CAP_DAC_OVERRIDE no", Err: os.ErrPermission}
+	assert.Equal(t, "cannot access /logs/x.log: permission denied: need search (x) permission on /pods (mode drwx------, uid 0, gid 0); "+
+		"process uid 1000, gid 1000, groups [] CAP_DAC_READ_SEARCH no, CAP_DAC_OVERRIDE no; "+
+		"run as root, add the process to a group with access, or add capability CAP_DAC_READ_SEARCH", e.Error())
+}
+
+func TestCheckEmptyDir(t *testing.T) {
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(root) }()
+	assert.NoError(t, access.Check(root))
+}
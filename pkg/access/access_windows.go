@@ -0,0 +1,23 @@
+package access
+
+import (
+	"fmt"
+	"os"
+)
+
+// searchable always returns true, directories have no search permission on this platform.
+func searchable(dir string) bool { return true }
+
+// describe returns path with its mode.
+func describe(path string) string {
+	if info, err := os.Lstat(path); err == nil {
+		return fmt.Sprintf("%v (mode %v)", path, info.Mode())
+	}
+	return path
+}
+
+// identity returns the user of this process.
+func identity() string { return fmt.Sprintf("uid %v", os.Geteuid()) }
+
+// capabilities are not known on this platform.
+func capabilities() string { return "" }
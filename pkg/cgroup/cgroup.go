@@ -0,0 +1,129 @@
+// package cgroup reads CPU throttling statistics of Kubernetes container cgroups.
+//
+// Both cgroup v1 and v2 are supported, with the cgroupfs and systemd cgroup drivers of the kubelet:
+//
+//	<root>/cpu,cpuacct/kubepods/burstable/pod<uid>/<container-id>/cpu.stat
+//	<root>/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/crio-<container-id>.scope/cpu.stat
+//
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Find if there is no cgroup for the container.
+var ErrNotFound = errors.New("container cgroup not found")
+
+// maxDepth limits the directory levels below the root searched by Find.
+const maxDepth = 6
+
+// Throttling is the CPU throttling statistics of a cgroup, from its cpu.stat file.
+type Throttling struct {
+	Periods       uint64        // Enforcement periods of the CPU limit that have elapsed.
+	Throttled     uint64        // Periods in which the cgroup was throttled.
+	ThrottledTime time.Duration // Total time the cgroup was throttled.
+}
+
+// ReadThrottling reads the throttling statistics of cgroup directory dir.
+// Statistics missing from cpu.stat are 0, for example if the cgroup has no CPU limit.
+func ReadThrottling(dir string) (Throttling, error) {
+	f, err := os.Open(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return Throttling{}, err
+	}
+	defer f.Close()
+	var t Throttling
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "nr_periods":
+			t.Periods = n
+		case "nr_throttled":
+			t.Throttled = n
+		case "throttled_time": // cgroup v1, nanoseconds.
+			t.ThrottledTime = time.Duration(n)
+		case "throttled_usec": // cgroup v2.
+			t.ThrottledTime = time.Duration(n) * time.Microsecond
+		}
+	}
+	return t, scanner.Err()
+}
+
+// Find returns the cgroup directory of container id in pod uid under the cgroup file system at root,
+// the directory with a CPU controller for cgroup v1. The error wraps ErrNotFound if there is none.
+func Find(root, uid, id string) (string, error) {
+	pod := findDir(root, 0, func(name string) bool { return isPod(name, uid) })
+	if pod == "" {
+		return "", &os.PathError{Op: "find pod " + uid, Path: root, Err: ErrNotFound}
+	}
+	entries, err := ioutil.ReadDir(pod)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.Contains(e.Name(), id) {
+			return filepath.Join(pod, e.Name()), nil
+		}
+	}
+	return "", &os.PathError{Op: "find container " + id, Path: pod, Err: ErrNotFound}
+}
+
+// isPod returns true if name is the cgroup directory name of pod uid for the cgroupfs or systemd driver.
+func isPod(name, uid string) bool {
+	return name == "pod"+uid || strings.HasSuffix(name, "pod"+strings.ReplaceAll(uid, "-", "_")+".slice")
+}
+
+// findDir returns the first directory under dir for which match is true, "" if none.
+// Only the directories where the kubelet puts pod cgroups are searched.
+func findDir(dir string, depth int, match func(name string) bool) string {
+	if depth > maxDepth {
+		return ""
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if match(e.Name()) {
+			return filepath.Join(dir, e.Name())
+		}
+		if searched(e.Name(), depth) {
+			if found := findDir(filepath.Join(dir, e.Name()), depth+1, match); found != "" {
+				return found
+			}
+		}
+	}
+	return ""
+}
+
+// searched returns true if a directory called name at depth may contain pod cgroups:
+// a cgroup v1 CPU controller at the top, or a kubepods or QoS class directory.
+func searched(name string, depth int) bool {
+	switch {
+	case depth == 0 && (name == "cpu" || name == "cpu,cpuacct" || name == "cpuacct,cpu"):
+		return true
+	case strings.HasPrefix(name, "kubepods"):
+		return true
+	case name == "burstable" || name == "besteffort":
+		return true
+	}
+	return false
+}
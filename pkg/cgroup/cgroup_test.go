@@ -0,0 +1,66 @@
+package cgroup_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/cgroup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	uid = "0a1b2c3d-0000-1111-2222-333344445555"
+	id  = "f00dfeed"
+)
+
+func writeStat(t *testing.T, dir, stat string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cpu.stat"), []byte(stat), 0600))
+}
+
+func TestFindAndRead(t *testing.T) {
+	for _, x := range []struct {
+		layout, stat string
+		want         cgroup.Throttling
+	}{
+		{
+			layout: "cpu,cpuacct/kubepods/burstable/pod" + uid + "/" + id,
+			stat:   "nr_periods 10\nnr_throttled 4\nthrottled_time 2000000\n",
+			want:   cgroup.Throttling{Periods: 10, Throttled: 4, ThrottledTime: 2 * time.Millisecond},
+		},
+		{
+			layout: "kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0a1b2c3d_0000_1111_2222_333344445555.slice/crio-" + id + ".scope",
+			stat:   "usage_usec 100\nnr_periods 7\nnr_throttled 3\nthrottled_usec 5\n",
+			want:   cgroup.Throttling{Periods: 7, Throttled: 3, ThrottledTime: 5 * time.Microsecond},
+		},
+		{
+			layout: "kubepods.slice/kubepods-pod0a1b2c3d_0000_1111_2222_333344445555.slice/cri-containerd-" + id + ".scope",
+			stat:   "usage_usec 100\n",
+			want:   cgroup.Throttling{},
+		},
+	} {
+		root, err := ioutil.TempDir("", t.Name())
+		require.NoError(t, err)
+		defer os.RemoveAll(root)
+		writeStat(t, filepath.Join(root, x.layout), x.stat)
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "system.slice"), os.ModePerm))
+
+		dir, err := cgroup.Find(root, uid, id)
+		require.NoError(t, err, x.layout)
+		assert.Equal(t, filepath.Join(root, x.layout), dir)
+		got, err := cgroup.ReadThrottling(dir)
+		require.NoError(t, err)
+		assert.Equal(t, x.want, got, x.layout)
+
+		_, err = cgroup.Find(root, uid, "other")
+		assert.True(t, errors.Is(err, cgroup.ErrNotFound), "%v", err)
+		_, err = cgroup.Find(root, "other", id)
+		assert.True(t, errors.Is(err, cgroup.ErrNotFound), "%v", err)
+	}
+}
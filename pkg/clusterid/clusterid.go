@@ -0,0 +1,131 @@
+// package clusterid reads a cluster ID from a mounted file and adds it as a label to gathered metrics.
+//
+// The ID is read from a file, for example a key of a ConfigMap or downward API volume,
+// so no API server or DNS access is needed. The file is reloaded when it changes,
+// and the label is added when metrics are gathered, so the exporter can start
+// before the file is available.
+//
+package clusterid
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// coalesce merges events from non-atomic writes of the file.
+const coalesce = 100 * time.Millisecond
+
+// Labeler adds a cluster ID label to metrics.
+type Labeler struct {
+	name, path string
+
+	mu      sync.Mutex
+	value   string
+	watcher *symnotify.Watcher
+}
+
+// New returns a Labeler for label name with the ID in file path. Call Load or Watch to read it.
+func New(name, path string) *Labeler { return &Labeler{name: name, path: path} }
+
+// Value returns the cluster ID, "" if it has not been read.
+func (l *Labeler) Value() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.value
+}
+
+// Load reads the cluster ID from the file, leading and trailing white space is ignored.
+// If the file does not exist the ID is "" and Load returns the error.
+func (l *Labeler) Load() error {
+	data, err := ioutil.ReadFile(l.path)
+	value := strings.TrimSpace(string(data))
+	if err != nil {
+		value = ""
+	}
+	l.mu.Lock()
+	changed := value != l.value
+	l.value = value
+	l.mu.Unlock()
+	if changed {
+		log.Info("Cluster ID changed", "label", l.name, "value", value, "path", l.path)
+	}
+	return err
+}
+
+// Watch loads the file, and reloads it when anything in its directory changes,
+// which includes ConfigMap volume updates. A missing file is not an error,
+// it is loaded when it appears. Watch returns immediately.
+func (l *Labeler) Watch() error {
+	w, err := symnotify.NewWatcher(symnotify.Coalesce(coalesce), symnotify.NoFileInfo())
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(l.path)); err != nil {
+		_ = w.Close()
+		return err
+	}
+	l.mu.Lock()
+	l.watcher = w
+	l.mu.Unlock()
+	if err := l.Load(); err != nil && !os.IsNotExist(err) {
+		log.Error(err, "Error reading cluster ID", "path", l.path)
+	}
+	go func() {
+		for range w.Events() {
+			if err := l.Load(); err != nil && !os.IsNotExist(err) {
+				log.Error(err, "Error reading cluster ID", "path", l.path)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stops watching.
+func (l *Labeler) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watcher == nil {
+		return nil
+	}
+	return l.watcher.Close()
+}
+
+// Gatherer returns a Gatherer that adds the cluster ID label to metrics from g,
+// unless the ID is "" or the metric already has the label.
+func (l *Labeler) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		value := l.Value()
+		if value == "" {
+			return families, err
+		}
+		for _, mf := range families {
+			for _, m := range mf.Metric {
+				addLabel(m, l.name, value)
+			}
+		}
+		return families, err
+	})
+}
+
+// addLabel adds a label to m, keeping labels sorted by name, unless m has it already.
+func addLabel(m *dto.Metric, name, value string) {
+	i := sort.Search(len(m.Label), func(i int) bool { return m.Label[i].GetName() >= name })
+	if i < len(m.Label) && m.Label[i].GetName() == name {
+		return
+	}
+	lp := &dto.LabelPair{Name: &name, Value: &value}
+	m.Label = append(m.Label, nil)
+	copy(m.Label[i+1:], m.Label[i:])
+	m.Label[i] = lp
+}
@@ -0,0 +1,67 @@
+package clusterid_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/clusterid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestGatherer(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "cluster-id")
+	l := clusterid.New("cluster_id", path)
+	assert.True(t, os.IsNotExist(l.Load()))
+
+	r := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "x_total", Help: "x"}, []string{"a", "z"})
+	c.WithLabelValues("1", "2").Add(3)
+	r.MustRegister(c)
+	g := l.Gatherer(r)
+	expect := func(labels string) string {
+		return "# HELP x_total x\n# TYPE x_total counter\nx_total{" + labels + "} 3\n"
+	}
+	assert.NoError(t, testutil.GatherAndCompare(g, strings.NewReader(expect(`a="1",z="2"`))), "no ID, no label")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(" my-cluster\n"), 0600))
+	require.NoError(t, l.Load())
+	assert.Equal(t, "my-cluster", l.Value())
+	assert.NoError(t, testutil.GatherAndCompare(g, strings.NewReader(expect(`a="1",cluster_id="my-cluster",z="2"`))))
+}
+
+func TestWatchConfigMap(t *testing.T) {
+	// ConfigMap volume layout: cluster-id -> ..data/cluster-id, ..data -> ..v1
+	dir := tempDir(t)
+	version := func(name, id string) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0700))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name, "cluster-id"), []byte(id), 0600))
+		require.NoError(t, os.Symlink(name, filepath.Join(dir, "..tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..tmp"), filepath.Join(dir, "..data")))
+	}
+	l := clusterid.New("cluster_id", filepath.Join(dir, "cluster-id"))
+	require.NoError(t, l.Watch(), "missing file is not an error")
+	defer l.Close()
+	assert.Equal(t, "", l.Value())
+
+	version("..v1", "one")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "cluster-id"), filepath.Join(dir, "cluster-id")))
+	assert.Eventually(t, func() bool { return l.Value() == "one" }, time.Second, 10*time.Millisecond)
+	version("..v2", "two")
+	assert.Eventually(t, func() bool { return l.Value() == "two" }, time.Second, 10*time.Millisecond)
+}
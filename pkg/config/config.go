@@ -0,0 +1,232 @@
+// package config sets flags from a configuration file, and reloads them when the file changes.
+//
+// The file has one flag per line as name=value, blank lines and lines starting with # are ignored.
+// Values can refer to environment variables as ${NAME}, so one file can serve nodes with different
+// environments. Undefined variables are errors, use $${ for a literal ${.
+// Flags set on the command line take precedence over the file.
+//
+package config
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+)
+
+// configMapData is the symlink a Kubernetes ConfigMap volume swaps atomically on update.
+const configMapData = "..data"
+
+// coalesce merges events from non-atomic writes to a plain file, so a half written file is not loaded.
+const coalesce = 100 * time.Millisecond
+
+// Parse reads name=value lines from r, and expands environment variables in values, see Expand.
+func Parse(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %v: expecting name=value: %q", n, line)
+		}
+		value, err := Expand(strings.TrimSpace(line[i+1:]), os.LookupEnv)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", n, err)
+		}
+		values[strings.TrimSpace(line[:i])] = value
+	}
+	return values, scanner.Err()
+}
+
+// Format writes values as name=value lines sorted by name, that Parse reads back.
+// Values are not escaped, so they may refer to environment variables as ${NAME}.
+// It is an error if a name is empty or contains '=', or a name or value contains a newline
+// or leading or trailing spaces that Parse would remove.
+func Format(w io.Writer, values map[string]string) error {
+	names := make([]string, 0, len(values))
+	for name, value := range values {
+		if name == "" || strings.ContainsAny(name, "=\n") || name != strings.TrimSpace(name) || strings.HasPrefix(name, "#") {
+			return fmt.Errorf("invalid flag name %q", name)
+		}
+		if strings.Contains(value, "\n") || value != strings.TrimSpace(value) {
+			return fmt.Errorf("flag %v: invalid value %q", name, value)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%v=%v\n", name, values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expand replaces ${NAME} in s with the value of variable NAME from lookup, and $${ with a literal ${.
+// Other $ characters are left alone, so regular expressions need no escaping.
+// It is an error if a variable is not defined, or a name is missing or invalid.
+func Expand(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' { // Escaped, s[:i] ends with the first $.
+			b.WriteString(s[:i] + "{")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.Index(s[i:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("missing } in %q", s[i:])
+		}
+		name := s[i+2 : i+end]
+		if !validName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+		value, ok := lookup(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %v is not set", name)
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// validName returns true if name is a valid environment variable name for Expand.
+func validName(name string) bool {
+	for i, c := range name {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// File sets flags from a configuration file.
+type File struct {
+	path     string
+	flags    *flag.FlagSet
+	explicit map[string]bool // Flags set on the command line.
+
+	mu      sync.Mutex
+	loaded  map[string]bool // Flags set from the file.
+	watcher *symnotify.Watcher
+}
+
+// New returns a File for path that sets flags. Call New after parsing the command line.
+func New(flags *flag.FlagSet, path string) *File {
+	f := &File{path: path, flags: flags, explicit: map[string]bool{}, loaded: map[string]bool{}}
+	flags.Visit(func(fl *flag.Flag) { f.explicit[fl.Name] = true })
+	return f
+}
+
+// Load reads the file and sets flags that were not set on the command line.
+// Flags that were set by a previous Load but are no longer in the file are reset to their default.
+// If there is an error no flags are changed.
+func (f *File) Load() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	values, err := Parse(file)
+	if err != nil {
+		return fmt.Errorf("%v: %w", f.path, err)
+	}
+	for name := range values {
+		if f.flags.Lookup(name) == nil {
+			return fmt.Errorf("%v: unknown flag %q", f.path, name)
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set := map[string]string{}
+	for name := range f.loaded {
+		if _, ok := values[name]; !ok {
+			set[name] = f.flags.Lookup(name).DefValue
+		}
+	}
+	loaded := map[string]bool{}
+	for name, value := range values {
+		if !f.explicit[name] {
+			set[name] = value
+			loaded[name] = true
+		}
+	}
+	old := map[string]string{}
+	for name, value := range set {
+		old[name] = f.flags.Lookup(name).Value.String()
+		if err := f.flags.Set(name, value); err != nil {
+			for name, value := range old {
+				_ = f.flags.Set(name, value)
+			}
+			return fmt.Errorf("%v: flag %v: %w", f.path, name, err)
+		}
+	}
+	f.loaded = loaded
+	return nil
+}
+
+// Watch reloads the file when it changes, and calls reloaded with the result of Load.
+// If the file is in a Kubernetes ConfigMap volume it is reloaded once per update of the ConfigMap.
+// Watch returns immediately, reloaded is called from another goroutine until Close.
+func (f *File) Watch(reloaded func(error)) error {
+	w, err := symnotify.NewWatcher(symnotify.Coalesce(coalesce), symnotify.NoFileInfo())
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(f.path)
+	if err := w.Add(dir); err != nil {
+		_ = w.Close()
+		return err
+	}
+	f.mu.Lock()
+	f.watcher = w
+	f.mu.Unlock()
+	go func() {
+		for e := range w.Events() {
+			if f.changed(dir, e) {
+				log.V(2).Info("Reloading configuration...", "path", f.path, "event", e)
+				reloaded(f.Load())
+			}
+		}
+	}()
+	return nil
+}
+
+// changed returns true if event e in dir means the file has a new version.
+func (f *File) changed(dir string, e symnotify.Event) bool {
+	data := filepath.Join(dir, configMapData)
+	if _, err := os.Lstat(data); err == nil {
+		// ConfigMap volume: the new version is complete when ..data is swapped in.
+		return e.Name == data && e.Op&symnotify.Create != 0
+	}
+	return e.Name == filepath.Clean(f.path) && e.Op&(symnotify.Create|symnotify.Write) != 0
+}
+
+// Close stops watching.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.watcher == nil {
+		return nil
+	}
+	return f.watcher.Close()
+}
@@ -0,0 +1,180 @@
+package config_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	values, err := config.Parse(strings.NewReader("# comment\n\na=1\n b = x y \nc=\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "x y", "c": ""}, values)
+	_, err = config.Parse(strings.NewReader("a=1\nnonsense\n"))
+	assert.EqualError(t, err, `line 2: expecting name=value: "nonsense"`)
+}
+
+func TestFormat(t *testing.T) {
+	values := map[string]string{"b": "x y", "a": "1", "c": "", "path": "/var/log/${NODE}"}
+	var out strings.Builder
+	require.NoError(t, config.Format(&out, values))
+	assert.Equal(t, "a=1\nb=x y\nc=\npath=/var/log/${NODE}\n", out.String())
+	parsed, err := config.Parse(strings.NewReader(strings.Replace(out.String(), "${NODE}", "$${NODE}", 1)))
+	require.NoError(t, err)
+	assert.Equal(t, values, parsed)
+
+	assert.EqualError(t, config.Format(&out, map[string]string{"a=b": "1"}), `invalid flag name "a=b"`)
+	assert.EqualError(t, config.Format(&out, map[string]string{"a": "1\n2"}), `flag a: invalid value "1\n2"`)
+}
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{"NODE": "node-0", "POOL_1": "gpu", "EMPTY": ""}
+	lookup := func(name string) (string, bool) { v, ok := env[name]; return v, ok }
+	for _, x := range []struct{ in, out string }{
+		{"plain", "plain"},
+		{"/var/log/${NODE}/", "/var/log/node-0/"},
+		{"${POOL_1}-${NODE}${EMPTY}", "gpu-node-0"},
+		{`^/var/log/(?P<x>[^/]+)\.log$`, `^/var/log/(?P<x>[^/]+)\.log$`},
+		{"$${NODE} $$", "${NODE} $$"},
+	} {
+		out, err := config.Expand(x.in, lookup)
+		if assert.NoError(t, err, x.in) {
+			assert.Equal(t, x.out, out, x.in)
+		}
+	}
+	for in, msg := range map[string]string{
+		"${MISSING}": "environment variable MISSING is not set",
+		"${NODE":     `missing } in "${NODE"`,
+		"${}":        `invalid variable name ""`,
+		"${1X}":      `invalid variable name "1X"`,
+		"${A-B}":     `invalid variable name "A-B"`,
+	} {
+		_, err := config.Expand(in, lookup)
+		assert.EqualError(t, err, msg, in)
+	}
+
+	require.NoError(t, os.Setenv("CONFIG_TEST_NODE", "node-1"))
+	defer os.Unsetenv("CONFIG_TEST_NODE")
+	values, err := config.Parse(strings.NewReader("a=${CONFIG_TEST_NODE}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "node-1"}, values)
+	_, err = config.Parse(strings.NewReader("a=1\nb=${CONFIG_TEST_MISSING}\n"))
+	assert.EqualError(t, err, "line 2: environment variable CONFIG_TEST_MISSING is not set")
+}
+
+type flags struct {
+	*flag.FlagSet
+	a, b string
+	n    int
+}
+
+func newFlags(t *testing.T, args ...string) *flags {
+	f := &flags{FlagSet: flag.NewFlagSet(t.Name(), flag.ContinueOnError)}
+	f.StringVar(&f.a, "a", "default-a", "")
+	f.StringVar(&f.b, "b", "default-b", "")
+	f.IntVar(&f.n, "n", 0, "")
+	require.NoError(t, f.Parse(args))
+	return f
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(tempDir(t), "config")
+	f := newFlags(t, "-b", "command-line")
+	c := config.New(f.FlagSet, path)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("a=file\nb=file\nn=1\n"), 0600))
+	require.NoError(t, c.Load())
+	assert.Equal(t, []interface{}{"file", "command-line", 1}, []interface{}{f.a, f.b, f.n})
+
+	// Removed settings revert to the default.
+	require.NoError(t, ioutil.WriteFile(path, []byte("n=2\n"), 0600))
+	require.NoError(t, c.Load())
+	assert.Equal(t, []interface{}{"default-a", "command-line", 2}, []interface{}{f.a, f.b, f.n})
+
+	// Nothing changes on error.
+	require.NoError(t, ioutil.WriteFile(path, []byte("a=x\nn=notanumber\n"), 0600))
+	assert.Error(t, c.Load())
+	require.NoError(t, ioutil.WriteFile(path, []byte("nosuchflag=1\n"), 0600))
+	assert.EqualError(t, c.Load(), path+`: unknown flag "nosuchflag"`)
+	assert.Equal(t, []interface{}{"default-a", "command-line", 2}, []interface{}{f.a, f.b, f.n})
+}
+
+// watch starts watching, returns a channel of reload results.
+func watch(t *testing.T, c *config.File) chan error {
+	reloads := make(chan error, 10)
+	require.NoError(t, c.Watch(func(err error) { reloads <- err }))
+	t.Cleanup(func() { _ = c.Close() })
+	return reloads
+}
+
+func assertReloads(t *testing.T, reloads chan error, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-reloads:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatalf("expected %v reloads, got %v", n, i)
+		}
+	}
+	select {
+	case <-reloads:
+		t.Fatalf("expected %v reloads, got more", n)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(tempDir(t), "config")
+	require.NoError(t, ioutil.WriteFile(path, []byte("a=1\n"), 0600))
+	f := newFlags(t)
+	c := config.New(f.FlagSet, path)
+	require.NoError(t, c.Load())
+	reloads := watch(t, c)
+
+	// Replace the file atomically, as an editor would.
+	require.NoError(t, ioutil.WriteFile(path+".tmp", []byte("a=2\n"), 0600))
+	require.NoError(t, os.Rename(path+".tmp", path))
+	assertReloads(t, reloads, 1)
+	assert.Equal(t, "2", f.a)
+}
+
+// TestWatchConfigMap updates a directory the way kubelet updates a ConfigMap volume.
+func TestWatchConfigMap(t *testing.T) {
+	dir := tempDir(t)
+	version := func(name, content string) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name, "config"), []byte(content), 0600))
+		require.NoError(t, os.Symlink(name, filepath.Join(dir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	}
+	version("..2021_01_01_00_00_00.1", "a=1\n")
+	path := filepath.Join(dir, "config")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "config"), path))
+	f := newFlags(t)
+	c := config.New(f.FlagSet, path)
+	require.NoError(t, c.Load())
+	assert.Equal(t, "1", f.a)
+	reloads := watch(t, c)
+
+	version("..2021_01_01_00_00_00.2", "a=2\nb=2\n")
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "..2021_01_01_00_00_00.1")))
+	assertReloads(t, reloads, 1)
+	assert.Equal(t, "2", f.a)
+	assert.Equal(t, "2", f.b)
+}
@@ -0,0 +1,158 @@
+// package cri parses container log files in the CRI format written by the kubelet.
+//
+// Each line is "<RFC3339Nano time> <stream> <tag> <content>", where stream is stdout or stderr
+// and tag is F for a full line or P for a partial line. A long log record is split
+// into P lines followed by an F line, possibly interleaved with lines of the other stream.
+//
+package cri
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Tags of a CRI log line.
+const (
+	Full    = "F"
+	Partial = "P"
+)
+
+// Unknown is the Level of a record with no recognizable level.
+const Unknown = "unknown"
+
+// Record is a parsed CRI log line.
+type Record struct {
+	Time    time.Time
+	Stream  string // stdout or stderr.
+	Partial bool   // More fragments of the same record follow on this stream.
+	Level   string // Level of the record, taken from its first fragment.
+	Content []byte // Content of this fragment, without the newline.
+	Bytes   int    // Bytes of this line in the file, including the prefix and newline.
+}
+
+// Parser parses a CRI log file incrementally. Use one Parser per file.
+//
+// A continuation fragment gets the Level of the first fragment of its record,
+// since a level prefix only appears at the start of a record.
+type Parser struct {
+	pending []byte            // Incomplete last line.
+	levels  map[string]string // Level of the partial record in progress on each stream.
+}
+
+// Parse parses data appended to the file and returns the records for complete lines.
+// An incomplete last line is kept until the rest of it is parsed.
+// A malformed line returns an error, its bytes are skipped.
+func (p *Parser) Parse(data []byte) (records []Record, err error) {
+	if p.levels == nil {
+		p.levels = map[string]string{}
+	}
+	data = append(p.pending, data...)
+	p.pending = nil
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		r, perr := p.line(data[:i])
+		data = data[i+1:]
+		if perr != nil {
+			if err == nil {
+				err = perr
+			}
+			continue
+		}
+		records = append(records, r)
+	}
+	if len(data) > 0 {
+		p.pending = append([]byte(nil), data...)
+	}
+	return records, err
+}
+
+// Buffered returns the number of bytes of an incomplete line waiting for the rest of it.
+func (p *Parser) Buffered() int { return len(p.pending) }
+
+// Reset forgets all state, for example when the file is truncated or replaced.
+func (p *Parser) Reset() { *p = Parser{} }
+
+// line parses a single line without the newline.
+func (p *Parser) line(line []byte) (Record, error) {
+	fields := bytes.SplitN(line, []byte(" "), 4)
+	if len(fields) < 3 {
+		return Record{}, fmt.Errorf("malformed CRI log line: %q", line)
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(fields[0]))
+	if err != nil {
+		return Record{}, fmt.Errorf("malformed CRI log time: %w", err)
+	}
+	r := Record{Time: t, Stream: string(fields[1]), Bytes: len(line) + 1}
+	switch string(fields[2]) {
+	case Full:
+	case Partial:
+		r.Partial = true
+	default:
+		return Record{}, fmt.Errorf("malformed CRI log tag: %q", fields[2])
+	}
+	if len(fields) == 4 {
+		r.Content = fields[3]
+	}
+	level, continued := p.levels[r.Stream]
+	if !continued {
+		level = Level(r.Content)
+	}
+	r.Level = level
+	if r.Partial {
+		p.levels[r.Stream] = level
+	} else {
+		delete(p.levels, r.Stream)
+	}
+	return r, nil
+}
+
+// levelNames maps level spellings to level names.
+var levelNames = map[string]string{
+	"trace": "trace", "debug": "debug", "info": "info", "notice": "info",
+	"warn": "warning", "warning": "warning", "error": "error", "err": "error",
+	"fatal": "critical", "crit": "critical", "critical": "critical", "panic": "critical",
+}
+
+// Level guesses the level of a log record from the start of its content.
+// It recognizes a leading level word such as "ERROR" or "[warn]", klog prefixes such as "E0102",
+// and level=... or "level":"..." fields. Returns Unknown if there is no level.
+func Level(content []byte) string {
+	if len(content) > 0 && bytes.IndexByte([]byte("IWEF"), content[0]) >= 0 && len(content) >= 5 && isDigits(content[1:5]) {
+		// klog: Lmmdd hh:mm:ss...
+		return map[byte]string{'I': "info", 'W': "warning", 'E': "error", 'F': "critical"}[content[0]]
+	}
+	for _, key := range []string{`level=`, `"level":"`, `"level": "`, `lvl=`} {
+		if i := bytes.Index(content, []byte(key)); i >= 0 {
+			if level, ok := levelWord(content[i+len(key):]); ok {
+				return level
+			}
+		}
+	}
+	if level, ok := levelWord(bytes.TrimLeft(content, "[<")); ok {
+		return level
+	}
+	return Unknown
+}
+
+// levelWord returns the level named by the word at the start of b.
+func levelWord(b []byte) (string, bool) {
+	end := 0
+	for end < len(b) && (b[end] >= 'a' && b[end] <= 'z' || b[end] >= 'A' && b[end] <= 'Z') {
+		end++
+	}
+	level, ok := levelNames[string(bytes.ToLower(b[:end]))]
+	return level, ok
+}
+
+func isDigits(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
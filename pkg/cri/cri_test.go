@@ -0,0 +1,87 @@
+package cri_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/cri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// levelBytes sums the bytes of records by stream and level.
+func levelBytes(records []cri.Record) map[string]int {
+	m := map[string]int{}
+	for _, r := range records {
+		m[r.Stream+"/"+r.Level] += r.Bytes
+	}
+	return m
+}
+
+func TestPartialLinesKeepLevel(t *testing.T) {
+	lines := []string{
+		"2021-01-02T03:04:05.000000001Z stdout P ERROR first part of a long line",
+		"2021-01-02T03:04:05.000000002Z stderr F level=info interleaved",
+		"2021-01-02T03:04:05.000000003Z stdout P middle part, INFO looks like a level but is not",
+		"2021-01-02T03:04:05.000000004Z stdout F last part",
+		"2021-01-02T03:04:05.000000005Z stdout F no level",
+	}
+	var p cri.Parser
+	records, err := p.Parse([]byte(strings.Join(lines, "\n") + "\n"))
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	var levels []string
+	for _, r := range records {
+		levels = append(levels, r.Level)
+	}
+	assert.Equal(t, []string{"error", "info", "error", "error", cri.Unknown}, levels)
+	assert.True(t, records[0].Partial)
+	assert.False(t, records[3].Partial)
+	assert.Equal(t, "last part", string(records[3].Content))
+	assert.Equal(t, map[string]int{
+		"stdout/error":   len(lines[0]) + len(lines[2]) + len(lines[3]) + 3,
+		"stderr/info":    len(lines[1]) + 1,
+		"stdout/unknown": len(lines[4]) + 1,
+	}, levelBytes(records))
+}
+
+func TestPartialWrites(t *testing.T) {
+	data := "2021-01-02T03:04:05Z stdout P W0102 03:04:05 klog warning\n2021-01-02T03:04:06Z stdout F continued\n"
+	var p cri.Parser
+	var records []cri.Record
+	for i := 0; i < len(data); i += 7 { // Split lines across writes.
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		r, err := p.Parse([]byte(data[i:end]))
+		require.NoError(t, err)
+		records = append(records, r...)
+	}
+	assert.Equal(t, 0, p.Buffered())
+	assert.Equal(t, map[string]int{"stdout/warning": len(data)}, levelBytes(records))
+}
+
+func TestMalformed(t *testing.T) {
+	var p cri.Parser
+	records, err := p.Parse([]byte("garbage\n2021-01-02T03:04:05Z stdout X tag\n2021-01-02T03:04:05Z stdout F ok\npartial"))
+	assert.Error(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "ok", string(records[0].Content))
+	assert.Equal(t, len("partial"), p.Buffered())
+	p.Reset()
+	assert.Equal(t, 0, p.Buffered())
+}
+
+func TestLevel(t *testing.T) {
+	for content, level := range map[string]string{
+		`E0102 03:04:05.000000 1 main.go:1] failed`: "error",
+		`{"level":"warn","msg":"x"}`:                "warning",
+		`time=now level=debug msg=x`:                "debug",
+		`[Critical] disk full`:                      "critical",
+		`Everything is fine`:                        cri.Unknown,
+		``:                                          cri.Unknown,
+	} {
+		assert.Equal(t, level, cri.Level([]byte(content)), content)
+	}
+}
@@ -0,0 +1,298 @@
+// package exporter runs the log file metric exporter, so it can be embedded in other Go programs.
+//
+// Config has a field for each command line flag of the exporter, and Run does what the command does.
+// A Config parsed from flags and one filled in directly behave the same.
+//
+package exporter
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+)
+
+// Config configures the exporter, each field is set by the flag named in its comment.
+// Lists are comma separated strings, as in the flags. See the flag usage for details of each field.
+type Config struct {
+	Dir                   string        // -dir
+	Dirs                  string        // -dirs
+	PodUID                string        // -pod-uid
+	PodsDir               string        // -pods-dir
+	Docker                bool          // -docker
+	DockerLinks           string        // -docker-links
+	Verbosity             int           // -verbosity
+	Addr                  string        // -http
+	CrtFile               string        // -crtFile
+	KeyFile               string        // -keyFile
+	PlainHTTP             bool          // -plain-http
+	TailMetrics           bool          // -tail-metrics
+	DecisionLog           string        // -decision-log
+	DecisionLogFormat     string        // -decision-log-format
+	CountDeleted          bool          // -count-deleted
+	DeletedInterval       time.Duration // -deleted-interval
+	IncludeContainers     string        // -include-containers
+	ExcludeContainers     string        // -exclude-containers
+	IncludeContainerGlobs string        // -include-container-globs
+	ExcludeContainerGlobs string        // -exclude-container-globs
+	IncludeNamespaces     string        // -include-namespaces
+	ExcludeNamespaces     string        // -exclude-namespaces
+	IncludePods           string        // -include-pods
+	ExcludePods           string        // -exclude-pods
+	RescanInterval        time.Duration // -rescan-interval
+	RescanMaxAge          time.Duration // -rescan-max-age
+	ErrorBudget           float64       // -error-budget
+	ErrorBudgetWindow     time.Duration // -error-budget-window
+	PollNetwork           bool          // -poll-network
+	PollInterval          time.Duration // -poll-interval
+	StaleMarkers          bool          // -stale-markers
+	CoalesceWindow        time.Duration // -coalesce-window
+	MaxEventAge           time.Duration // -max-event-age
+	EventBuffer           int           // -event-buffer
+	EventDropPolicy       string        // -event-drop-policy
+	StormLimit            int           // -storm-limit
+	StormInterval         time.Duration // -storm-interval
+	MinUpdateInterval     time.Duration // -min-update-interval
+	Workers               int           // -workers
+	MaxWatches            int           // -max-watches
+	IgnoreHidden          bool          // -ignore-hidden
+	Fanotify              bool          // -fanotify
+	MaxPending            int           // -max-pending
+	StatRetries           int           // -stat-retries
+	StatRetryBackoff      time.Duration // -stat-retry-backoff
+	RemountCheck          time.Duration // -remount-check
+	TimeGap               time.Duration // -time-gap
+	Files                 string        // -files
+	PathLabels            string        // -path-labels
+	PathRegexp            string        // -path-regexp
+	AllowRiskyLabels      bool          // -allow-risky-labels
+	SidecarLabel          bool          // -sidecar-label
+	SidecarContainers     string        // -sidecar-containers
+	BackgroundPrime       bool          // -background-prime
+	CountLines            bool          // -count-lines
+	CountLevels           bool          // -count-levels
+	IngestLatency         bool          // -ingest-latency
+	StreamLabel           bool          // -stream-label
+	FileSizes             bool          // -file-sizes
+	CountArchives         bool          // -count-archives
+	ContainerInstances    bool          // -container-instances
+	RestartGaps           bool          // -restart-gaps
+	WriteTimes            bool          // -write-times
+	ClusterIDFile         string        // -cluster-id-file
+	ClusterIDLabel        string        // -cluster-id-label
+	NodeDrain             bool          // -node-drain
+	NodeName              string        // -node-name
+	NodeDrainInterval     time.Duration // -node-drain-interval
+	CPUThrottling         time.Duration // -cpu-throttling-interval
+	CgroupRoot            string        // -cgroup-root
+	DeleteGrace           time.Duration // -delete-grace
+	SeriesTTL             time.Duration // -series-ttl
+	Inventory             bool          // -inventory
+	InventoryMax          int           // -inventory-max
+	InventoryFile         string        // -inventory-file
+	CheckpointFile        string        // -checkpoint-file
+	CheckpointPeriod      time.Duration // -checkpoint-interval
+	HeapDumpDir           string        // -heap-dump-dir
+	HeapDumpRSSMiB        uint64        // -heap-dump-rss-mib
+	HeapDumpMinGap        time.Duration // -heap-dump-min-gap
+	// ConfigFile is a file of flags, -config. Fields that differ from DefaultConfig, or flags set
+	// on the command line if the Config came from Parse, take precedence over the file.
+	ConfigFile string
+
+	explicit map[string]bool // Flags set by Parse or Set.
+}
+
+// DefaultConfig returns the Config with the default value of each flag.
+func DefaultConfig() Config {
+	return Config{
+		Dir:               "/var/log/containers/",
+		PodsDir:           "/var/log/pods",
+		DockerLinks:       "/var/log/containers",
+		Addr:              ":2112",
+		CrtFile:           "/etc/fluent/metrics/tls.crt",
+		KeyFile:           "/etc/fluent/metrics/tls.key",
+		DecisionLogFormat: "json",
+		DeletedInterval:   10 * time.Second,
+		RescanInterval:    time.Minute,
+		ErrorBudgetWindow: 5 * time.Minute,
+		PollInterval:      10 * time.Second,
+		EventDropPolicy:   "block",
+		StormInterval:     time.Second,
+		MaxPending:        10000,
+		StatRetryBackoff:  5 * time.Millisecond,
+		RemountCheck:      time.Minute,
+		TimeGap:           time.Minute,
+		SidecarContainers: strings.Join(logwatch.DefaultSidecars, ","),
+		ClusterIDLabel:    "cluster_id",
+		NodeName:          os.Getenv("NODE_NAME"),
+		NodeDrainInterval: 30 * time.Second,
+		CgroupRoot:        "/sys/fs/cgroup",
+		InventoryMax:      10000,
+		CheckpointPeriod:  time.Minute,
+		HeapDumpMinGap:    time.Hour,
+	}
+}
+
+// RegisterFlags defines a flag in fs for each field of c, with the current value of the field as its default.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	//directory to be watched out where symlinks to all logs files are present e.g. /var/log/containers/
+	//debug option true or false
+	//listening port where this go-app push prometheus registered metrics for further collected or reading by end prometheus server
+	fs.StringVar(&c.Dir, "dir", c.Dir, "Directory containing log files")
+	fs.StringVar(&c.Dirs, "dirs", c.Dirs, "comma separated directories to watch in addition to -dir, with log files named like those in -dir, e.g. custom hostPath log locations")
+	fs.StringVar(&c.PodUID, "pod-uid", c.PodUID, "watch only the log directory of the pod with this UID in -pods-dir instead of -dir, e.g. a sidecar given its own pod UID by the downward API")
+	fs.StringVar(&c.PodsDir, "pods-dir", c.PodsDir, "directory of pod log directories, for -pod-uid")
+	fs.BoolVar(&c.Docker, "docker", c.Docker, "-dir is a docker json-file log directory <id>/<id>-json.log, e.g. /var/lib/docker/containers on dockershim nodes, labelled from the links in -docker-links")
+	fs.StringVar(&c.DockerLinks, "docker-links", c.DockerLinks, "directory of kubelet container log links, to find the pod of a container ID for -docker")
+	fs.IntVar(&c.Verbosity, "verbosity", c.Verbosity, "set verbosity level")
+	fs.StringVar(&c.Addr, "http", c.Addr, "HTTP service address where metrics are exposed")
+	fs.StringVar(&c.CrtFile, "crtFile", c.CrtFile, "cert file for log-file-metric-exporter service")
+	fs.StringVar(&c.KeyFile, "keyFile", c.KeyFile, "key file for log-file-metric-exporter service")
+	fs.BoolVar(&c.PlainHTTP, "plain-http", c.PlainHTTP, "serve metrics over plain HTTP without TLS, -crtFile and -keyFile are not used")
+	fs.BoolVar(&c.TailMetrics, "tail-metrics", c.TailMetrics, "print a line to stdout for each counted size delta")
+	fs.StringVar(&c.DecisionLog, "decision-log", c.DecisionLog, "file to append a line to for each counted delta, with the reason and sizes before and after")
+	fs.StringVar(&c.DecisionLogFormat, "decision-log-format", c.DecisionLogFormat, "format of -decision-log lines: json or logfmt")
+	fs.BoolVar(&c.CountDeleted, "count-deleted", c.CountDeleted, "count bytes written to deleted files that are still open, with label deleted=\"true\"")
+	fs.DurationVar(&c.DeletedInterval, "deleted-interval", c.DeletedInterval, "interval between scans of /proc for deleted files, with -count-deleted")
+	fs.StringVar(&c.IncludeContainers, "include-containers", c.IncludeContainers, "comma separated container names, if set only containers with these names are counted in all namespaces")
+	fs.StringVar(&c.ExcludeContainers, "exclude-containers", c.ExcludeContainers, "comma separated container names, e.g. 'istio-proxy,POD', containers with these names are never counted or watched in any namespace")
+	fs.StringVar(&c.IncludeContainerGlobs, "include-container-globs", c.IncludeContainerGlobs, "comma separated container name globs, e.g. 'app-*', matching containers are also included as for -include-containers")
+	fs.StringVar(&c.ExcludeContainerGlobs, "exclude-container-globs", c.ExcludeContainerGlobs, "comma separated container name globs, e.g. 'istio-*', matching containers are also excluded as for -exclude-containers")
+	fs.StringVar(&c.IncludeNamespaces, "include-namespaces", c.IncludeNamespaces, "comma separated namespaces, if set only containers in these namespaces are counted")
+	fs.StringVar(&c.ExcludeNamespaces, "exclude-namespaces", c.ExcludeNamespaces, "comma separated namespaces that are never counted")
+	fs.StringVar(&c.IncludePods, "include-pods", c.IncludePods, "comma separated pod name globs, e.g. 'fluentd-*', if set only matching pods are counted in all namespaces")
+	fs.StringVar(&c.ExcludePods, "exclude-pods", c.ExcludePods, "comma separated pod name globs, e.g. 'build-*', matching pods are never counted or watched in any namespace")
+	fs.DurationVar(&c.RescanInterval, "rescan-interval", c.RescanInterval, "interval between reconciliation scans that watch the log directories again and stat all log files directly, handling files created or removed without events, 0 disables")
+	fs.DurationVar(&c.RescanMaxAge, "rescan-max-age", c.RescanMaxAge, "make /readyz fail if no rescan succeeded within this time, needs a positive -rescan-interval, 0 disables")
+	fs.Float64Var(&c.ErrorBudget, "error-budget", c.ErrorBudget, "fraction of failed updates, e.g. 0.05, that makes /readyz fail, 0 disables")
+	fs.DurationVar(&c.ErrorBudgetWindow, "error-budget-window", c.ErrorBudgetWindow, "sliding window for -error-budget")
+	fs.BoolVar(&c.PollNetwork, "poll-network", c.PollNetwork, "also poll log files on network file systems, where file events are not reliable")
+	fs.DurationVar(&c.PollInterval, "poll-interval", c.PollInterval, "interval for polling log files that can't be watched, with -poll-network or when the watch limit is exhausted")
+	fs.BoolVar(&c.StaleMarkers, "stale-markers", c.StaleMarkers, "report series of removed pods with a stale NaN value until the next update after a scrape, before dropping them")
+	fs.DurationVar(&c.CoalesceWindow, "coalesce-window", c.CoalesceWindow, "delay file events by up to this time to merge repeated events for the same file, 0 disables")
+	fs.DurationVar(&c.MaxEventAge, "max-event-age", c.MaxEventAge, "drop file events older than this when processing falls behind, and stat the affected files once instead, 0 disables")
+	fs.IntVar(&c.EventBuffer, "event-buffer", c.EventBuffer, "number of file events buffered while log files are being counted, so bursts don't overflow the kernel event queue")
+	fs.StringVar(&c.EventDropPolicy, "event-drop-policy", c.EventDropPolicy, "what to do when -event-buffer is full: block, or drop the newest or oldest events and rescan all log files")
+	fs.IntVar(&c.StormLimit, "storm-limit", c.StormLimit, "write events per second for a single log file above which it is stat-ed every -storm-interval instead, 0 disables")
+	fs.DurationVar(&c.StormInterval, "storm-interval", c.StormInterval, "interval between stats of log files over -storm-limit")
+	fs.DurationVar(&c.MinUpdateInterval, "min-update-interval", c.MinUpdateInterval, "minimum interval between updates of a single log file from write events, bytes written meanwhile are counted by the next update, 0 disables")
+	fs.IntVar(&c.Workers, "workers", c.Workers, "number of goroutines updating log files from write and remove events in parallel, so a slow volume does not delay other files, 0 or 1 updates on the event loop")
+	fs.IntVar(&c.MaxWatches, "max-watches", c.MaxWatches, "maximum number of file watches, the least recently active log files are polled every -poll-interval beyond this, 0 means no limit")
+	fs.BoolVar(&c.IgnoreHidden, "ignore-hidden", c.IgnoreHidden, "ignore files in log directories with hidden or temporary names, starting with '.' or ending with .tmp, .swp or ~")
+	fs.BoolVar(&c.Fanotify, "fanotify", c.Fanotify, "watch whole file systems with fanotify instead of a file watch per directory, for nodes with very many log files. Needs Linux 5.9, CAP_SYS_ADMIN and CAP_DAC_READ_SEARCH")
+	fs.IntVar(&c.MaxPending, "max-pending", c.MaxPending, "maximum file events held inside the watcher, coalesced events are delivered early and pending rescans become a full rescan beyond this, 0 means no limit")
+	fs.IntVar(&c.StatRetries, "stat-retries", c.StatRetries, "retry a stat that fails with an error other than the file not existing this many times before reporting it, e.g. during pod teardown")
+	fs.DurationVar(&c.StatRetryBackoff, "stat-retry-backoff", c.StatRetryBackoff, "delay before the first retry for -stat-retries, doubled for each retry")
+	fs.DurationVar(&c.RemountCheck, "remount-check", c.RemountCheck, "interval to check that the log directory is still the one watched, and watch it again if a volume was mounted over it, 0 disables")
+	fs.DurationVar(&c.TimeGap, "time-gap", c.TimeGap, "rescan all log files after a pause longer than this, e.g. suspend and resume of the node, 0 disables")
+	fs.StringVar(&c.Files, "files", c.Files, "comma separated log files to count individually in addition to -dir, e.g. an audit log. Only the path label is set")
+	fs.StringVar(&c.PathLabels, "path-labels", c.PathLabels, "regexp matched against log file paths, each named group (?P<name>...) adds a label to log_logged_bytes_total")
+	fs.StringVar(&c.PathRegexp, "path-regexp", c.PathRegexp, "regexp matched against log file paths to get labels, with named groups (?P<namespace>...), (?P<podname>...) and (?P<containername>...), for log directories not in the kubelet layout")
+	fs.BoolVar(&c.AllowRiskyLabels, "allow-risky-labels", c.AllowRiskyLabels, "start even if -path-labels would label by file index or timestamp, creating a series per file")
+	fs.BoolVar(&c.SidecarLabel, "sidecar-label", c.SidecarLabel, "add a label sidecar=\"true\" to log_logged_bytes_total for containers in -sidecar-containers, \"false\" for others")
+	fs.StringVar(&c.SidecarContainers, "sidecar-containers", c.SidecarContainers, "comma separated container names of injected sidecars, for -sidecar-label")
+	fs.BoolVar(&c.BackgroundPrime, "background-prime", c.BackgroundPrime, "serve metrics while existing log files are counted at startup, most recently modified first, instead of before. Not ready until done")
+	fs.BoolVar(&c.CountLines, "count-lines", c.CountLines, "also count lines written to each log file as log_logged_lines_total, reading the bytes added. Needs read permission on log files")
+	fs.BoolVar(&c.CountLevels, "count-levels", c.CountLevels, "count lines by level with a level label on log_logged_lines_total, guessed from the content of CRI or docker JSON log lines, implies -count-lines")
+	fs.BoolVar(&c.IngestLatency, "ingest-latency", c.IngestLatency, "report the latency from the time stamp of the last CRI or docker JSON log line of each container to when it was counted, as log_ingest_latency_seconds. Needs read permission on log files")
+	fs.BoolVar(&c.StreamLabel, "stream-label", c.StreamLabel, "add a stream label, stdout or stderr, to log_logged_bytes_total and log_logged_lines_total, parsed from CRI or docker JSON log lines. Bytes of a line are counted when its newline is written. Needs read permission on log files")
+	fs.BoolVar(&c.CountArchives, "count-archives", c.CountArchives, "also report the uncompressed size of compressed rotated log files as log_archived_bytes_total, each archive counted once when its container's log is rotated")
+	fs.BoolVar(&c.FileSizes, "file-sizes", c.FileSizes, "also report the current size of each live log file as log_file_current_size_bytes, to alert on files approaching kubelet's containerLogMaxSize")
+	fs.BoolVar(&c.ContainerInstances, "container-instances", c.ContainerInstances, "also report bytes logged by the current instance of each container, reset when the container restarts")
+	fs.BoolVar(&c.RestartGaps, "restart-gaps", c.RestartGaps, "report a histogram of the time between the last log write of a container and its restart, an estimate of crash loop back-off")
+	fs.BoolVar(&c.WriteTimes, "write-times", c.WriteTimes, "report the time of the last write to the log files of each container as log_last_write_timestamp_seconds, to alert on silent containers")
+	fs.StringVar(&c.ClusterIDFile, "cluster-id-file", c.ClusterIDFile, "file containing a cluster ID to add as a label to all metrics, e.g. a mounted ConfigMap key. Reloaded when it changes, no label until it exists")
+	fs.StringVar(&c.ClusterIDLabel, "cluster-id-label", c.ClusterIDLabel, "label name for -cluster-id-file")
+	fs.BoolVar(&c.NodeDrain, "node-drain", c.NodeDrain, "get the node from the API server and keep series of removed pods until a drain ends, needs permission to get nodes")
+	fs.StringVar(&c.NodeName, "node-name", c.NodeName, "name of this node for -node-drain, e.g. from the downward API")
+	fs.DurationVar(&c.NodeDrainInterval, "node-drain-interval", c.NodeDrainInterval, "interval between gets of the node for -node-drain")
+	fs.DurationVar(&c.CPUThrottling, "cpu-throttling-interval", c.CPUThrottling, "sample the CPU throttling of each container's cgroup this often and report bytes logged per throttled period, 0 disables")
+	fs.StringVar(&c.CgroupRoot, "cgroup-root", c.CgroupRoot, "cgroup file system to read for -cpu-throttling-interval")
+	fs.DurationVar(&c.DeleteGrace, "delete-grace", c.DeleteGrace, "keep series of a removed pod this long, and continue counting if its log files reappear, e.g. a static pod restart. 0 deletes series immediately")
+	fs.DurationVar(&c.SeriesTTL, "series-ttl", c.SeriesTTL, "delete the series of a log file that had no activity for this long and no longer exists, e.g. containers removed while the exporter was down. 0 disables")
+	fs.BoolVar(&c.Inventory, "inventory", c.Inventory, "keep a record of each pod seen, with first and last seen times, containers and bytes, served at /debug/inventory")
+	fs.IntVar(&c.InventoryMax, "inventory-max", c.InventoryMax, "maximum pods kept by -inventory, the pods last seen longest ago are dropped first, 0 means no limit")
+	fs.StringVar(&c.InventoryFile, "inventory-file", c.InventoryFile, "write the -inventory as JSON to this file on SIGTERM or SIGINT before exiting")
+	fs.StringVar(&c.CheckpointFile, "checkpoint-file", c.CheckpointFile, "save counters and log file sizes to this file every -checkpoint-interval and before exiting, and restore them at startup so restarts don't count existing log files again. Use a directory on the host that survives restarts")
+	fs.DurationVar(&c.CheckpointPeriod, "checkpoint-interval", c.CheckpointPeriod, "interval between saves of -checkpoint-file")
+	fs.StringVar(&c.HeapDumpDir, "heap-dump-dir", c.HeapDumpDir, "directory for heap profiles written when resident memory exceeds -heap-dump-rss-mib")
+	fs.Uint64Var(&c.HeapDumpRSSMiB, "heap-dump-rss-mib", c.HeapDumpRSSMiB, "resident memory in MiB that triggers a heap profile in -heap-dump-dir, 0 disables")
+	fs.DurationVar(&c.HeapDumpMinGap, "heap-dump-min-gap", c.HeapDumpMinGap, "minimum time between heap profiles")
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "file with one flag per line as name=value, values may refer to environment variables as ${NAME}, command line flags take precedence. Filter flags are reloaded when the file changes, other changes need a restart")
+}
+
+// Parse registers flags for c in fs and parses args, see RegisterFlags.
+// The flags set in args take precedence over ConfigFile.
+func (c *Config) Parse(fs *flag.FlagSet, args []string) error {
+	c.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) { c.setExplicit(f.Name) })
+	return nil
+}
+
+// Set sets the field for flag name from value, as if the flag was on the command line.
+// A field set by Set takes precedence over ConfigFile, even if value is the default.
+func (c *Config) Set(name, value string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	c.RegisterFlags(fs)
+	if err := fs.Set(name, value); err != nil {
+		return err
+	}
+	c.setExplicit(name)
+	return nil
+}
+
+// setExplicit records that flag name was set explicitly.
+func (c *Config) setExplicit(name string) {
+	if c.explicit == nil {
+		c.explicit = map[string]bool{}
+	}
+	c.explicit[name] = true
+}
+
+// changed returns the names of flags set explicitly: by Parse or Set,
+// or by setting a field to a value that differs from DefaultConfig.
+func (c *Config) changed() map[string]bool {
+	d, cur := DefaultConfig(), *c
+	defaults, current := flag.NewFlagSet("defaults", flag.ContinueOnError), flag.NewFlagSet("current", flag.ContinueOnError)
+	d.RegisterFlags(defaults)
+	cur.RegisterFlags(current)
+	changed := map[string]bool{}
+	for name := range c.explicit {
+		changed[name] = true
+	}
+	current.VisitAll(func(f *flag.Flag) {
+		if f.Value.String() != defaults.Lookup(f.Name).Value.String() {
+			changed[f.Name] = true
+		}
+	})
+	return changed
+}
+
+// filter returns the log file filter from the filter fields.
+func (c *Config) filter() logwatch.Filter {
+	return logwatch.Filter{
+		IncludeNamespaces:     splitList(c.IncludeNamespaces),
+		ExcludeNamespaces:     splitList(c.ExcludeNamespaces),
+		IncludeContainers:     splitList(c.IncludeContainers),
+		ExcludeContainers:     splitList(c.ExcludeContainers),
+		IncludeContainerGlobs: splitList(c.IncludeContainerGlobs),
+		ExcludeContainerGlobs: splitList(c.ExcludeContainerGlobs),
+		IncludePods:           splitList(c.IncludePods),
+		ExcludePods:           splitList(c.ExcludePods),
+	}
+}
+
+// splitList splits a comma separated flag value, ignoring empty items.
+func splitList(s string) (list []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,489 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/access"
+	"github.com/log-file-metric-exporter/pkg/clusterid"
+	"github.com/log-file-metric-exporter/pkg/config"
+	"github.com/log-file-metric-exporter/pkg/heapdump"
+	"github.com/log-file-metric-exporter/pkg/kube"
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/log-file-metric-exporter/pkg/sdnotify"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+)
+
+// Run runs the exporter configured by c until ctx is done or it fails.
+// When ctx is done Run stops serving, writes the CheckpointFile and InventoryFile if set, and returns nil.
+// Run sets the global log level from Verbosity.
+func Run(ctx context.Context, c Config) error {
+	e, err := newExporter(&c)
+	if err != nil {
+		return err
+	}
+	defer e.close()
+	return e.run(ctx)
+}
+
+// exporter is a running exporter.
+type exporter struct {
+	c                          *Config
+	cf                         *config.File // Nil unless ConfigFile is set.
+	watcher                    *logwatch.Watcher
+	kubeClient                 *kube.Client // Nil unless NodeDrain is set.
+	internal                   *prometheus.Registry
+	gatherer, internalGatherer prometheus.Gatherer
+	closers                    []func()
+}
+
+// newExporter creates the watcher and counts existing log files, unless BackgroundPrime is set.
+func newExporter(c *Config) (_ *exporter, err error) {
+	e := &exporter{c: c}
+	defer func() {
+		if err != nil {
+			e.close()
+		}
+	}()
+	if c.ConfigFile != "" {
+		// The file sets fields through flags, flags set explicitly take precedence.
+		fs := flag.NewFlagSet("config", flag.ContinueOnError)
+		explicit := c.changed()
+		c.RegisterFlags(fs)
+		for name := range explicit {
+			if err := fs.Set(name, fs.Lookup(name).Value.String()); err != nil {
+				return nil, err
+			}
+		}
+		e.cf = config.New(fs, c.ConfigFile)
+		if err := e.cf.Load(); err != nil {
+			return nil, err
+		}
+	}
+
+	dir := c.Dir
+	if c.PodUID != "" {
+		podDir, err := logwatch.FindPodDir(c.PodsDir, c.PodUID)
+		if err != nil {
+			return nil, err
+		}
+		dir = podDir
+	}
+	// Paths from API requests are confined to the watched directories, they must be absolute.
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, d := range splitList(c.Dirs) {
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, abs)
+	}
+
+	if c.TailMetrics {
+		// Keep stdout for tail lines only.
+		log.InitWithOptions("log-file-metric-exporter", []log.Option{log.WithOutput(os.Stderr)})
+	}
+	log.SetLogLevel(c.Verbosity)
+
+	// Fail fast if log files can't be read, rather than silently reporting nothing.
+	if err := access.Check(append(append([]string{dir}, dirs...), splitList(c.Files)...)...); err != nil {
+		return nil, fmt.Errorf("log files are not accessible: %w", err)
+	}
+
+	log.V(2).Info("Watching out logfiles dir ...", "dir", dir, "dirs", dirs, "http", c.Addr)
+	log.V(2).Info("Crt and Key taken from...", c.CrtFile, c.KeyFile)
+
+	// Log file metrics and the exporter's own metrics are served on separate endpoints.
+	registry := prometheus.NewRegistry()
+	internal := prometheus.NewRegistry()
+	internal.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	// Gatherers for the endpoints, with the cluster ID label if configured.
+	e.internal = internal
+	e.gatherer, e.internalGatherer = registry, internal
+	if c.ClusterIDFile != "" {
+		if !model.LabelName(c.ClusterIDLabel).IsValid() {
+			return nil, fmt.Errorf("invalid -cluster-id-label %q", c.ClusterIDLabel)
+		}
+		clusterID := clusterid.New(c.ClusterIDLabel, c.ClusterIDFile)
+		if err := clusterID.Watch(); err != nil {
+			return nil, fmt.Errorf("can't watch cluster ID file %v: %w", c.ClusterIDFile, err)
+		}
+		e.closers = append(e.closers, func() { _ = clusterID.Close() })
+		e.gatherer, e.internalGatherer = clusterID.Gatherer(registry), clusterID.Gatherer(internal)
+	}
+
+	opts, err := e.options(registry, internal)
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) > 0 {
+		opts = append(opts, logwatch.Dirs(dirs...))
+	}
+	if c.NodeDrain {
+		if c.NodeName == "" {
+			return nil, errors.New("-node-drain needs -node-name or NODE_NAME")
+		}
+		if e.kubeClient, err = kube.InCluster(); err != nil {
+			return nil, fmt.Errorf("can't connect to the API server for -node-drain: %w", err)
+		}
+		opts = append(opts, logwatch.NodeDrain())
+	}
+	if e.watcher, err = logwatch.New(dir, opts...); err != nil {
+		return nil, fmt.Errorf("error creating log file watcher: %w", err)
+	}
+	e.closers = append(e.closers, func() { _ = e.watcher.Close() })
+	return e, nil
+}
+
+// options returns the watcher options for the configuration.
+func (e *exporter) options(registry, internal prometheus.Registerer) ([]logwatch.Option, error) {
+	c := e.c
+	dropPolicy, err := symnotify.ParseDropPolicy(c.EventDropPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -event-drop-policy: %w", err)
+	}
+	if c.ErrorBudget > 0 && c.ErrorBudgetWindow <= 0 {
+		return nil, errors.New("-error-budget-window must be positive")
+	}
+	if c.PollInterval <= 0 {
+		return nil, errors.New("-poll-interval must be positive")
+	}
+	if c.NodeDrain && c.NodeDrainInterval <= 0 {
+		return nil, errors.New("-node-drain-interval must be positive")
+	}
+	if c.CountDeleted && c.DeletedInterval <= 0 {
+		return nil, errors.New("-deleted-interval must be positive")
+	}
+	if !c.PlainHTTP && (c.CrtFile == "" || c.KeyFile == "") {
+		return nil, errors.New("-crtFile and -keyFile are required unless -plain-http is set")
+	}
+	if c.RescanMaxAge > 0 && c.RescanInterval <= 0 {
+		return nil, errors.New("-rescan-max-age needs a positive -rescan-interval")
+	}
+	opts := []logwatch.Option{
+		logwatch.Registry(registry),
+		logwatch.InternalRegistry(internal),
+		logwatch.WithFilter(c.filter()),
+		logwatch.ErrorBudget(c.ErrorBudget, c.ErrorBudgetWindow),
+		logwatch.MaxRescanAge(c.RescanMaxAge),
+		logwatch.TimeGaps(c.TimeGap),
+		logwatch.DeleteGrace(c.DeleteGrace),
+		logwatch.SeriesTTL(c.SeriesTTL),
+		logwatch.CPUThrottling(c.CgroupRoot, c.CPUThrottling),
+		logwatch.StormBreaker(c.StormLimit, c.StormInterval),
+		logwatch.MinUpdateInterval(c.MinUpdateInterval),
+		logwatch.Workers(c.Workers),
+		logwatch.WatchOptions(symnotify.PollInterval(c.PollInterval), symnotify.Coalesce(c.CoalesceWindow), symnotify.MaxEventAge(c.MaxEventAge), symnotify.Buffer(c.EventBuffer, dropPolicy), symnotify.MaxWatches(c.MaxWatches), symnotify.MaxPending(c.MaxPending), symnotify.RemountCheck(c.RemountCheck), symnotify.StatRetry(c.StatRetries, c.StatRetryBackoff)),
+	}
+	if c.PathLabels != "" {
+		re, risks, err := logwatch.CheckPathLabels(c.PathLabels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -path-labels: %w", err)
+		}
+		denied := false
+		for _, r := range risks {
+			log.Info("Warning: -path-labels may create too many series", "risk", r.String(), "denied", r.Deny && !c.AllowRiskyLabels)
+			denied = denied || r.Deny
+		}
+		if denied && !c.AllowRiskyLabels {
+			return nil, errors.New("refusing -path-labels with high cardinality labels, fix the regexp or set -allow-risky-labels")
+		}
+		opts = append(opts, logwatch.PathLabels(re))
+	}
+	if c.PathRegexp != "" {
+		parser, err := logwatch.RegexpPathParser(c.PathRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -path-regexp: %w", err)
+		}
+		opts = append(opts, logwatch.WithPathParser(parser))
+	}
+	if list := splitList(c.Files); len(list) > 0 {
+		opts = append(opts, logwatch.Files(list...))
+	}
+	if c.TailMetrics {
+		opts = append(opts, logwatch.Tail(os.Stdout))
+	}
+	if c.CountDeleted {
+		opts = append(opts, logwatch.CountDeleted())
+	}
+	if c.DecisionLog != "" {
+		format, err := logwatch.ParseDecisionFormat(c.DecisionLogFormat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -decision-log-format: %w", err)
+		}
+		out, err := os.OpenFile(c.DecisionLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			return nil, fmt.Errorf("can't open decision log: %w", err)
+		}
+		e.closers = append(e.closers, func() { _ = out.Close() })
+		opts = append(opts, logwatch.DecisionLog(out, format))
+	}
+	if c.StaleMarkers {
+		opts = append(opts, logwatch.StaleMarkers())
+	}
+	if c.ContainerInstances {
+		opts = append(opts, logwatch.ContainerInstances())
+	}
+	if c.CountLines {
+		opts = append(opts, logwatch.CountLines())
+	}
+	if c.CountLevels {
+		opts = append(opts, logwatch.CountLevels())
+	}
+	if c.StreamLabel {
+		opts = append(opts, logwatch.StreamLabel())
+	}
+	if c.IngestLatency {
+		opts = append(opts, logwatch.IngestLatency())
+	}
+	if c.FileSizes {
+		opts = append(opts, logwatch.FileSizes())
+	}
+	if c.CountArchives {
+		opts = append(opts, logwatch.CountArchives())
+	}
+	if c.BackgroundPrime {
+		opts = append(opts, logwatch.DeferPrime())
+	}
+	if c.PodUID != "" {
+		opts = append(opts, logwatch.PodDir())
+	}
+	if c.Docker {
+		opts = append(opts, logwatch.DockerDir(c.DockerLinks))
+	}
+	if c.Inventory {
+		opts = append(opts, logwatch.KeepInventory(c.InventoryMax))
+	}
+	if c.CheckpointFile != "" {
+		cp, err := logwatch.ReadCheckpoint(c.CheckpointFile)
+		switch {
+		case err == nil:
+			opts = append(opts, logwatch.RestoreCheckpoint(cp))
+		case !os.IsNotExist(err):
+			// Counting existing files again is better than not starting.
+			log.Error(err, "Ignoring checkpoint", "file", c.CheckpointFile)
+		}
+	}
+	if c.RestartGaps {
+		opts = append(opts, logwatch.RestartGaps())
+	}
+	if c.WriteTimes {
+		opts = append(opts, logwatch.WriteTimes())
+	}
+	if c.SidecarLabel {
+		opts = append(opts, logwatch.Sidecars(splitList(c.SidecarContainers)...))
+	}
+	if c.PollNetwork {
+		opts = append(opts, logwatch.WatchOptions(symnotify.PollNetwork()))
+	}
+	if c.IgnoreHidden {
+		opts = append(opts, logwatch.WatchOptions(symnotify.IgnoreHidden()))
+	}
+	if c.Fanotify {
+		opts = append(opts, logwatch.WatchOptions(symnotify.Fanotify()))
+	}
+	watchdog, err := sdnotify.WatchdogInterval()
+	if err != nil {
+		log.Error(err, "Ignoring systemd watchdog")
+	} else if watchdog > 0 {
+		log.Info("Sending systemd watchdog keepalives from the event loop", "timeout", watchdog.String())
+		opts = append(opts, logwatch.Heartbeat(watchdog/2, func() {
+			if _, err := sdnotify.Notify(sdnotify.Watchdog); err != nil {
+				log.Error(err, "Error sending systemd watchdog keepalive")
+			}
+		}))
+	}
+	return opts, nil
+}
+
+// close releases resources in reverse order of creation.
+func (e *exporter) close() {
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		e.closers[i]()
+	}
+}
+
+// run watches and serves metrics until ctx is done or there is an error.
+func (e *exporter) run(ctx context.Context) error {
+	c, w := e.c, e.watcher
+	errs := make(chan error, 3)
+	go func() { errs <- fmt.Errorf("Watcher.Event returning err: %w", w.Watch()) }()
+	if c.BackgroundPrime {
+		go func() {
+			start := time.Now()
+			if err := w.Prime(ctx, nil); err != nil {
+				if ctx.Err() == nil {
+					errs <- fmt.Errorf("error counting existing log files: %w", err)
+				}
+				return
+			}
+			log.Info("Counted existing log files", "duration", time.Since(start).String())
+		}()
+	}
+	if c.RescanInterval > 0 {
+		go every(ctx, c.RescanInterval, func() {
+			if err := w.Reconcile(); err != nil {
+				log.Error(err, "Error reconciling log files")
+			}
+		})
+	}
+	if c.CountDeleted {
+		go every(ctx, c.DeletedInterval, func() {
+			if err := w.UpdateDeleted("/proc"); err != nil {
+				log.Error(err, "Error scanning for deleted files")
+			}
+		})
+	}
+	if e.kubeClient != nil {
+		go e.kubeClient.WatchDrain(ctx, c.NodeName, c.NodeDrainInterval, w.SetDraining)
+	}
+	if c.CheckpointFile != "" && c.CheckpointPeriod > 0 {
+		go every(ctx, c.CheckpointPeriod, func() {
+			if err := logwatch.WriteCheckpoint(c.CheckpointFile, w.Checkpoint()); err != nil {
+				log.Error(err, "Error writing checkpoint", "file", c.CheckpointFile)
+			}
+		})
+	}
+	if c.HeapDumpDir != "" && c.HeapDumpRSSMiB > 0 {
+		go heapdump.New(c.HeapDumpDir, c.HeapDumpRSSMiB<<20, heapdump.MinGap(c.HeapDumpMinGap)).Run(ctx.Done())
+	}
+	server := &http.Server{Addr: c.Addr, Handler: e.handler()}
+	go func() {
+		var err error
+		if c.PlainHTTP {
+			err = server.ListenAndServe()
+		} else {
+			err = server.ListenAndServeTLS(c.CrtFile, c.KeyFile)
+		}
+		errs <- fmt.Errorf("error serving metrics: %w", err)
+	}()
+	if e.cf != nil {
+		// Started last, reloads change the filter fields of c.
+		err := e.cf.Watch(func(err error) {
+			if err == nil {
+				err = w.SetFilter(c.filter())
+			}
+			if err != nil {
+				log.Error(err, "Error reloading configuration", "config", c.ConfigFile)
+				return
+			}
+			log.Info("Reloaded configuration", "config", c.ConfigFile)
+		})
+		if err != nil {
+			_ = server.Close()
+			return fmt.Errorf("error watching configuration %v: %w", c.ConfigFile, err)
+		}
+		e.closers = append(e.closers, func() { _ = e.cf.Close() })
+	}
+	if _, err := sdnotify.Notify(sdnotify.Ready); err != nil {
+		log.Error(err, "Error notifying systemd of readiness")
+	}
+
+	select {
+	case err := <-errs:
+		_ = server.Close()
+		return err
+	case <-ctx.Done():
+	}
+	_, _ = sdnotify.Notify(sdnotify.Stopping)
+	_ = server.Close()
+	if c.CheckpointFile != "" {
+		log.Info("Writing checkpoint before exiting", "file", c.CheckpointFile)
+		if err := logwatch.WriteCheckpoint(c.CheckpointFile, w.Checkpoint()); err != nil {
+			return fmt.Errorf("error writing checkpoint %v: %w", c.CheckpointFile, err)
+		}
+	}
+	if c.Inventory && c.InventoryFile != "" {
+		log.Info("Writing inventory before exiting", "file", c.InventoryFile)
+		if err := writeInventory(c.InventoryFile, w.Inventory()); err != nil {
+			return fmt.Errorf("error writing inventory %v: %w", c.InventoryFile, err)
+		}
+	}
+	return nil
+}
+
+// handler returns the HTTP handler for metrics, readiness and debug endpoints.
+func (e *exporter) handler() http.Handler {
+	w := e.watcher
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(e.gatherer, promhttp.HandlerOpts{}))
+	mux.Handle("/metrics/internal", promhttp.InstrumentMetricHandler(e.internal, promhttp.HandlerFor(e.internalGatherer, promhttp.HandlerOpts{})))
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter, r *http.Request) {
+		if err := w.Ready(); err != nil {
+			http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(rw, "ok")
+	})
+	mux.HandleFunc("/debug/watches", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, w.Watches())
+	})
+	mux.HandleFunc("/debug/inventory", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, w.Inventory())
+	})
+	mux.HandleFunc("/debug/files", func(rw http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			writeJSON(rw, w.Files())
+			return
+		}
+		state, ok, err := w.File(path)
+		switch {
+		case err == logwatch.ErrOutsideRoot:
+			http.Error(rw, err.Error(), http.StatusForbidden)
+		case err != nil:
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+		case !ok:
+			http.Error(rw, "no state for file", http.StatusNotFound)
+		default:
+			writeJSON(rw, state)
+		}
+	})
+	return mux
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+// every calls f every interval until ctx is done.
+func every(ctx context.Context, interval time.Duration, f func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f()
+		}
+	}
+}
+
+// writeInventory writes pod records as indented JSON to path.
+func writeInventory(path string, records []logwatch.PodRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,202 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/log-file-metric-exporter/pkg/mockkubelet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+// parse returns the Config for command line args.
+func parse(t *testing.T, args ...string) Config {
+	t.Helper()
+	c := DefaultConfig()
+	require.NoError(t, c.Parse(flag.NewFlagSet("test", flag.ContinueOnError), args))
+	return c
+}
+
+func TestFlagForEachField(t *testing.T) {
+	c := DefaultConfig()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.RegisterFlags(fs)
+	flags := 0
+	fs.VisitAll(func(f *flag.Flag) { flags++ })
+	fields := 0
+	ct := reflect.TypeOf(c)
+	for i := 0; i < ct.NumField(); i++ {
+		if ct.Field(i).PkgPath == "" {
+			fields++
+		}
+	}
+	assert.Equal(t, fields, flags)
+
+	// Flag defaults are the DefaultConfig.
+	assert.Equal(t, DefaultConfig(), parse(t).withoutExplicit())
+}
+
+func TestParse(t *testing.T) {
+	c := parse(t, "-dir=/logs", "-http=:9000", "-exclude-namespaces=a,b", "-count-lines", "-storm-limit=10",
+		"-rescan-interval=5s", "-error-budget=0.5", "-heap-dump-rss-mib=100")
+	want := DefaultConfig()
+	want.Dir = "/logs"
+	want.Addr = ":9000"
+	want.ExcludeNamespaces = "a,b"
+	want.CountLines = true
+	want.StormLimit = 10
+	want.RescanInterval = 5 * time.Second
+	want.ErrorBudget = 0.5
+	want.HeapDumpRSSMiB = 100
+	assert.Equal(t, want, c.withoutExplicit())
+	assert.Equal(t, c.changed(), want.changed(), "explicit flags and changed fields")
+}
+
+// withoutExplicit returns c without the record of flags set by Parse.
+func (c Config) withoutExplicit() Config {
+	c.explicit = nil
+	return c
+}
+
+// inodeLines match metrics that may change between scrapes.
+var inodeLines = regexp.MustCompile(`(?m)^log_filesystem_inodes.*\n`)
+
+// scrape returns the /metrics page of an exporter for c.
+func scrape(t *testing.T, c Config) string {
+	t.Helper()
+	e, err := newExporter(&c)
+	require.NoError(t, err)
+	defer e.close()
+	server := httptest.NewServer(e.handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return inodeLines.ReplaceAllString(string(body), "")
+}
+
+func TestFlagsAndConfigEquivalent(t *testing.T) {
+	root := tempDir(t)
+	tree, err := mockkubelet.Generate(root, mockkubelet.Config{Namespaces: 2, Pods: 2, Containers: 2, Size: 100})
+	require.NoError(t, err)
+	configFile := filepath.Join(root, "flags.conf")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("exclude-containers=container-0\ncount-lines=true\n"), 0600))
+
+	fromFlags := parse(t, "-dir="+tree.Containers, "-plain-http", "-exclude-namespaces=namespace-1",
+		"-file-sizes", "-container-instances", "-config="+configFile)
+	fromStruct := DefaultConfig()
+	fromStruct.Dir = tree.Containers
+	fromStruct.PlainHTTP = true
+	fromStruct.ExcludeNamespaces = "namespace-1"
+	fromStruct.FileSizes = true
+	fromStruct.ContainerInstances = true
+	fromStruct.ConfigFile = configFile
+
+	got := scrape(t, fromFlags)
+	assert.Contains(t, got, "log_logged_lines_total", "set by the config file")
+	assert.NotContains(t, got, "container-0", "filtered by the config file")
+	assert.NotContains(t, got, `namespace="namespace-1",path=`, "filtered by a flag")
+	assert.Equal(t, got, scrape(t, fromStruct))
+
+	// Fields that were set take precedence over the config file.
+	fromFlags = parse(t, "-dir="+tree.Containers, "-plain-http", "-exclude-containers=container-1", "-config="+configFile)
+	fromStruct = DefaultConfig()
+	fromStruct.Dir = tree.Containers
+	fromStruct.PlainHTTP = true
+	fromStruct.ExcludeContainers = "container-1"
+	fromStruct.ConfigFile = configFile
+	got = scrape(t, fromFlags)
+	assert.Contains(t, got, "container-0")
+	assert.NotContains(t, got, "container-1")
+	assert.Equal(t, got, scrape(t, fromStruct))
+}
+
+func TestRun(t *testing.T) {
+	root := tempDir(t)
+	tree, err := mockkubelet.Generate(root, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100})
+	require.NoError(t, err)
+	c := DefaultConfig()
+	c.Dir = tree.Containers
+	c.Addr = "127.0.0.1:0"
+	c.PlainHTTP = true
+	c.Inventory = true
+	c.InventoryFile = filepath.Join(root, "inventory.json")
+	c.CheckpointFile = filepath.Join(root, "checkpoint.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Run(ctx, c) }()
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	data, err := ioutil.ReadFile(c.InventoryFile)
+	require.NoError(t, err)
+	var records []logwatch.PodRecord
+	require.NoError(t, json.Unmarshal(data, &records))
+	assert.Len(t, records, 2)
+	cp, err := logwatch.ReadCheckpoint(c.CheckpointFile)
+	require.NoError(t, err)
+	assert.Len(t, cp.Files, 2)
+
+	c.EventDropPolicy = "nonesuch"
+	assert.Error(t, Run(context.Background(), c))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	options := func(args ...string) error {
+		c := parse(t, args...)
+		_, err := (&exporter{c: &c}).options(nil, nil)
+		return err
+	}
+	for _, args := range [][]string{
+		{"-error-budget=0.1", "-error-budget-window=0"},
+		{"-error-budget=0.1", "-error-budget-window=-1s"},
+		{"-poll-interval=0"},
+		{"-node-drain", "-node-drain-interval=0"},
+		{"-count-deleted", "-deleted-interval=0"},
+		{"-count-deleted", "-deleted-interval=-1s"},
+		{"-rescan-max-age=1m", "-rescan-interval=0"},
+		{"-crtFile="},
+		{"-keyFile="},
+	} {
+		assert.Error(t, options(args...), "%v", args)
+	}
+	assert.NoError(t, options("-error-budget-window=0"), "no error budget")
+	assert.NoError(t, options("-crtFile=", "-keyFile=", "-plain-http"), "no TLS")
+}
+
+func TestChanged(t *testing.T) {
+	c := DefaultConfig()
+	assert.Empty(t, c.changed())
+	c.Dir = "/logs"
+	assert.Equal(t, map[string]bool{"dir": true}, c.changed())
+	// Set to the default, but set explicitly.
+	require.NoError(t, c.Set("rescan-interval", DefaultConfig().RescanInterval.String()))
+	assert.Equal(t, map[string]bool{"dir": true, "rescan-interval": true}, c.changed())
+	require.NoError(t, c.Set("count-lines", "true"))
+	assert.True(t, c.CountLines)
+	assert.Error(t, c.Set("nonesuch", "1"))
+}
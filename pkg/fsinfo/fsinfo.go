@@ -0,0 +1,24 @@
+// package fsinfo provides platform specific information about files.
+//
+package fsinfo
+
+// FileID identifies a file independently of the names that refer to it.
+type FileID struct {
+	Dev, Ino uint64
+}
+
+// File system type names returned by Type.
+const (
+	TmpFS   = "tmpfs"
+	Unknown = "unknown"
+)
+
+// IsNetwork returns true if fstype is a network file system.
+// Changes made by other hosts on a network file system are not reported by inotify.
+func IsNetwork(fstype string) bool {
+	switch fstype {
+	case "nfs", "cifs", "smb2", "ceph", "9p":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package fsinfo
+
+import (
+	"os"
+	"syscall"
+)
+
+// ID returns the FileID of info, ok is false if it is not available.
+func ID(info os.FileInfo) (id FileID, ok bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return FileID{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}, true
+	}
+	return FileID{}, false
+}
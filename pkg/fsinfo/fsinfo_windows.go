@@ -0,0 +1,6 @@
+package fsinfo
+
+import "os"
+
+// ID returns the FileID of info, ok is false if it is not available.
+func ID(info os.FileInfo) (id FileID, ok bool) { return FileID{}, false }
@@ -0,0 +1,43 @@
+package fsinfo
+
+import "syscall"
+
+// fsTypes maps statfs magic numbers to file system type names.
+var fsTypes = map[uint32]string{
+	0x01021994: TmpFS,
+	0x858458f6: "ramfs",
+	0xef53:     "ext4", // Also ext2 and ext3.
+	0x58465342: "xfs",
+	0x9123683e: "btrfs",
+	0x794c7630: "overlay",
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+	0x65735546: "fuse",
+	0x2fc12fc1: "zfs",
+	0x00c36400: "ceph",
+	0x9fa0:     "proc",
+}
+
+// Type returns the type of the file system containing path, for example "tmpfs".
+// Returns Unknown if the type is not recognized.
+func Type(path string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Unknown, err
+	}
+	if t, ok := fsTypes[uint32(st.Type)]; ok {
+		return t, nil
+	}
+	return Unknown, nil
+}
+
+// Inodes returns the total and free inodes of the file system containing path.
+func Inodes(path string) (total, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Files, st.Ffree, nil
+}
@@ -0,0 +1,26 @@
+package fsinfo_test
+
+import (
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestType(t *testing.T) {
+	fstype, err := fsinfo.Type("/proc/self")
+	assert.NoError(t, err)
+	assert.Equal(t, "proc", fstype)
+
+	_, err = fsinfo.Type("/no/such/file")
+	assert.Error(t, err)
+}
+
+func TestInodes(t *testing.T) {
+	total, free, err := fsinfo.Inodes(".")
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, free, total)
+
+	_, _, err = fsinfo.Inodes("/no/such/file")
+	assert.Error(t, err)
+}
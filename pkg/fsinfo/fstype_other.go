@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package fsinfo
+
+import "errors"
+
+// Type returns the type of the file system containing path, always Unknown on this platform.
+func Type(path string) (string, error) { return Unknown, nil }
+
+// Inodes is not supported on this platform, it always returns an error.
+func Inodes(path string) (total, free uint64, err error) {
+	return 0, 0, errors.New("inode usage is not supported on this platform")
+}
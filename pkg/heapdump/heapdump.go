@@ -0,0 +1,142 @@
+// package heapdump writes a heap profile when the resident memory of the process exceeds a limit.
+//
+// Profiles are written to a directory, they can be copied off a node and read with `go tool pprof`.
+// Dumps are rate limited and old dumps are removed, so a leak can't fill the disk.
+//
+package heapdump
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+)
+
+const (
+	prefix = "heap-"
+	suffix = ".pprof"
+
+	defaultInterval = 10 * time.Second
+	defaultMinGap   = time.Hour
+	defaultKeep     = 3
+)
+
+// Watchdog checks resident memory and writes heap profiles.
+type Watchdog struct {
+	dir      string
+	limit    uint64
+	interval time.Duration
+	minGap   time.Duration
+	keep     int
+	rss      func() (uint64, error) // Resident memory, replaced by tests.
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Option configures a Watchdog.
+type Option func(*Watchdog)
+
+// Interval sets the interval between memory checks in Run, default 10s.
+func Interval(d time.Duration) Option { return func(w *Watchdog) { w.interval = d } }
+
+// MinGap sets the minimum time between dumps, default 1h.
+func MinGap(d time.Duration) Option { return func(w *Watchdog) { w.minGap = d } }
+
+// Keep sets the number of dumps kept in the directory, older dumps are removed. Default 3.
+func Keep(n int) Option { return func(w *Watchdog) { w.keep = n } }
+
+// New returns a Watchdog that writes heap profiles to dir when resident memory exceeds limit bytes.
+func New(dir string, limit uint64, opts ...Option) *Watchdog {
+	w := &Watchdog{dir: dir, limit: limit, interval: defaultInterval, minGap: defaultMinGap, keep: defaultKeep, rss: RSS}
+	for _, o := range opts {
+		o(w)
+	}
+	return w
+}
+
+// Run checks memory every interval until done is closed.
+func (w *Watchdog) Run(done <-chan struct{}) {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if _, err := w.Check(); err != nil {
+				log.Error(err, "Heap dump failed", "dir", w.dir)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// Check writes a heap profile if resident memory is over the limit and no dump was written
+// within the minimum gap. Returns the path of the profile, "" if none was written.
+func (w *Watchdog) Check() (string, error) {
+	rss, err := w.rss()
+	if err != nil || rss <= w.limit {
+		return "", err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if !w.last.IsZero() && now.Sub(w.last) < w.minGap {
+		return "", nil
+	}
+	w.last = now
+	path, err := w.dump(now)
+	if err != nil {
+		return "", err
+	}
+	log.Info("Warning: memory limit exceeded, wrote heap profile", "rss", rss, "limit", w.limit, "path", path)
+	w.prune()
+	return path, nil
+}
+
+// dump writes a heap profile named for now, via a temporary file so readers never see a partial dump.
+func (w *Watchdog) dump(now time.Time) (string, error) {
+	f, err := ioutil.TempFile(w.dir, ".tmp-"+prefix)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	err = pprof.Lookup("heap").WriteTo(f, 0)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("writing heap profile: %w", err)
+	}
+	path := filepath.Join(w.dir, prefix+now.UTC().Format("20060102T150405.000Z")+suffix)
+	return path, os.Rename(f.Name(), path)
+}
+
+// prune removes the oldest dumps in excess of keep. Dump names sort by time.
+func (w *Watchdog) prune() {
+	infos, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		log.Error(err, "Can't list heap dumps", "dir", w.dir)
+		return
+	}
+	var dumps []string
+	for _, info := range infos {
+		if name := info.Name(); strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) {
+			dumps = append(dumps, name)
+		}
+	}
+	sort.Strings(dumps)
+	for len(dumps) > w.keep {
+		if err := os.Remove(filepath.Join(w.dir, dumps[0])); err != nil {
+			log.Error(err, "Can't remove old heap dump", "path", dumps[0])
+		}
+		dumps = dumps[1:]
+	}
+}
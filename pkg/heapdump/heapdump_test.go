@@ -0,0 +1,55 @@
+package heapdump
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	rss := uint64(100)
+	w := New(dir, 200, MinGap(time.Hour), Keep(2))
+	w.rss = func() (uint64, error) { return rss, nil }
+
+	path, err := w.Check()
+	require.NoError(t, err)
+	assert.Empty(t, path, "under the limit")
+
+	rss = 300
+	path, err = w.Check()
+	require.NoError(t, err)
+	require.NotEmpty(t, path)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1f, 0x8b}, data[:2], "gzipped profile")
+
+	path, err = w.Check()
+	require.NoError(t, err)
+	assert.Empty(t, path, "rate limited")
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		w.last = time.Time{}
+		path, err = w.Check()
+		require.NoError(t, err)
+		paths = append(paths, path)
+		time.Sleep(2 * time.Millisecond) // Distinct names.
+	}
+	found, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Equal(t, paths[1:], found, "oldest removed")
+}
+
+func TestRSS(t *testing.T) {
+	rss, err := RSS()
+	require.NoError(t, err)
+	assert.NotZero(t, rss)
+}
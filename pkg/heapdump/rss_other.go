@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package heapdump
+
+import "runtime"
+
+// RSS returns the memory obtained from the OS by the Go runtime,
+// an approximation of resident memory on platforms without /proc.
+func RSS() (uint64, error) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys, nil
+}
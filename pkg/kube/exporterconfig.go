@@ -0,0 +1,124 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+)
+
+// API group, version and resource of the LogFileMetricExporterConfig custom resource.
+const (
+	ExporterConfigGroup    = "logging.openshift.io"
+	ExporterConfigVersion  = "v1alpha1"
+	ExporterConfigResource = "logfilemetricexporterconfigs"
+)
+
+// ExporterConfig is a cluster scoped LogFileMetricExporterConfig resource.
+// It sets exporter flags for all nodes, or for nodes selected by label, so fleet-wide policy
+// such as filters, thresholds and labels is changed by editing the resource.
+type ExporterConfig struct {
+	Name string
+	Spec ExporterConfigSpec
+}
+
+// ExporterConfigSpec is the spec of an ExporterConfig.
+type ExporterConfigSpec struct {
+	// Flags are exporter flag values by name without the leading '-', for all nodes.
+	Flags map[string]string `json:"flags,omitempty"`
+	// Nodes set flags for nodes matching a selector, overriding Flags. Later entries take precedence.
+	Nodes []NodeFlags `json:"nodes,omitempty"`
+}
+
+// NodeFlags are flags for the nodes that have all the labels in NodeSelector.
+type NodeFlags struct {
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Flags        map[string]string `json:"flags,omitempty"`
+}
+
+// Matches returns true if node has all the labels in NodeSelector, an empty selector matches all nodes.
+func (n *NodeFlags) Matches(node *Node) bool {
+	for k, v := range n.NodeSelector {
+		if value, ok := node.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Render returns the flags for node: Flags, overridden by each matching entry of Nodes in turn.
+func (s *ExporterConfigSpec) Render(node *Node) map[string]string {
+	flags := map[string]string{}
+	for k, v := range s.Flags {
+		flags[k] = v
+	}
+	for _, n := range s.Nodes {
+		if n.Matches(node) {
+			for k, v := range n.Flags {
+				flags[k] = v
+			}
+		}
+	}
+	return flags
+}
+
+// ExporterConfig gets the ExporterConfig called name, the error wraps ErrNotFound if there is none.
+// Needs permission to get logfilemetricexporterconfigs.
+func (c *Client) ExporterConfig(ctx context.Context, name string) (*ExporterConfig, error) {
+	var obj struct {
+		Metadata metadata           `json:"metadata"`
+		Spec     ExporterConfigSpec `json:"spec"`
+	}
+	path := "/apis/" + ExporterConfigGroup + "/" + ExporterConfigVersion + "/" + ExporterConfigResource + "/" + url.PathEscape(name)
+	if err := c.get(ctx, path, &obj); err != nil {
+		return nil, err
+	}
+	return &ExporterConfig{Name: obj.Metadata.Name, Spec: obj.Spec}, nil
+}
+
+// WatchExporterConfig gets the ExporterConfig called name and node every interval, and calls changed
+// when the flags rendered for the node change, starting with the first successful get.
+// If the ExporterConfig does not exist the flags are empty, so the exporter uses its defaults.
+// Errors are logged and the last known flags are kept. The interval must be positive. Returns when ctx is done.
+func (c *Client) WatchExporterConfig(ctx context.Context, name, nodeName string, interval time.Duration, changed func(flags map[string]string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last map[string]string
+	for {
+		flags, err := c.ExporterFlags(ctx, name, nodeName)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				log.Error(err, "Error getting exporter configuration", "name", name, "node", nodeName)
+			}
+		case last == nil || !reflect.DeepEqual(flags, last):
+			last = flags
+			log.V(1).Info("Exporter configuration changed", "name", name, "node", nodeName, "flags", len(flags))
+			changed(flags)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExporterFlags returns the flags rendered for nodeName from the ExporterConfig called name,
+// empty if it does not exist.
+func (c *Client) ExporterFlags(ctx context.Context, name, nodeName string) (map[string]string, error) {
+	node, err := c.Node(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	config, err := c.ExporterConfig(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return config.Spec.Render(node), nil
+}
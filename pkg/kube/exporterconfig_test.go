@@ -0,0 +1,97 @@
+package kube_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConfig serves a labelled node and an ExporterConfig, the config spec can be changed while serving.
+type fakeConfig struct {
+	mu   sync.Mutex
+	spec string // Empty if there is no ExporterConfig.
+}
+
+func (f *fakeConfig) set(spec string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.spec = spec
+}
+
+func (f *fakeConfig) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/api/v1/nodes/node-0":
+		fmt.Fprint(rw, `{"kind":"Node","metadata":{"name":"node-0","labels":{"pool":"gpu","zone":"a"}},"spec":{}}`)
+	case "/apis/logging.openshift.io/v1alpha1/logfilemetricexporterconfigs/default":
+		if f.spec != "" {
+			fmt.Fprintf(rw, `{"kind":"LogFileMetricExporterConfig","metadata":{"name":"default"},"spec":%v}`, f.spec)
+			return
+		}
+		fallthrough
+	default:
+		http.Error(rw, "not found", http.StatusNotFound)
+	}
+}
+
+func TestExporterConfig(t *testing.T) {
+	fake := &fakeConfig{spec: `{"flags":{"include-namespaces":"app-*","storm-limit":"100"},"nodes":[
+		{"nodeSelector":{"pool":"gpu"},"flags":{"storm-limit":"1000","ignore-hidden":"true"}},
+		{"nodeSelector":{"pool":"infra"},"flags":{"storm-limit":"0"}},
+		{"nodeSelector":{"zone":"a"},"flags":{"ignore-hidden":"false"}}]}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	c := kube.New(server.URL, "", server.Client())
+	ctx := context.Background()
+
+	config, err := c.ExporterConfig(ctx, "default")
+	require.NoError(t, err)
+	assert.Equal(t, "default", config.Name)
+	node, err := c.Node(ctx, "node-0")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pool": "gpu", "zone": "a"}, node.Labels)
+	assert.Equal(t, map[string]string{"include-namespaces": "app-*", "storm-limit": "1000", "ignore-hidden": "false"}, config.Spec.Render(node))
+	assert.Equal(t, map[string]string{"include-namespaces": "app-*", "storm-limit": "100"}, config.Spec.Render(&kube.Node{}))
+
+	_, err = c.ExporterConfig(ctx, "missing")
+	assert.True(t, errors.Is(err, kube.ErrNotFound), "%v", err)
+}
+
+func TestWatchExporterConfig(t *testing.T) {
+	fake := &fakeConfig{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	c := kube.New(server.URL, "", server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan map[string]string, 10)
+	go c.WatchExporterConfig(ctx, "default", "node-0", 10*time.Millisecond, func(flags map[string]string) { changes <- flags })
+	next := func() map[string]string {
+		t.Helper()
+		select {
+		case flags := <-changes:
+			return flags
+		case <-time.After(time.Second):
+			require.FailNow(t, "timeout waiting for flags")
+			return nil
+		}
+	}
+	assert.Equal(t, map[string]string{}, next(), "no config, defaults")
+	fake.set(`{"flags":{"storm-limit":"10"}}`)
+	assert.Equal(t, map[string]string{"storm-limit": "10"}, next())
+	fake.set(`{"flags":{"storm-limit":"10"},"nodes":[{"nodeSelector":{"pool":"gpu"},"flags":{"storm-limit":"20"}}]}`)
+	assert.Equal(t, map[string]string{"storm-limit": "20"}, next())
+	fake.set("")
+	assert.Equal(t, map[string]string{}, next())
+}
@@ -0,0 +1,184 @@
+// package kube is a minimal client for the few Kubernetes API reads the exporter needs.
+//
+// It uses the pod's service account directly, rather than depending on client-go.
+// The exporter works without API access, features that use it are optional.
+//
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+)
+
+const (
+	// serviceAccount is where the pod's service account token and CA are mounted.
+	serviceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// UnschedulableTaint is set on cordoned nodes, including nodes being drained.
+	UnschedulableTaint = "node.kubernetes.io/unschedulable"
+)
+
+// ErrNotFound is wrapped by errors for objects that do not exist.
+var ErrNotFound = errors.New("not found")
+
+// Client reads from the API server.
+type Client struct {
+	url       string
+	token     string
+	tokenFile string // Re-read for each request, service account tokens are rotated.
+	http      *http.Client
+}
+
+// New returns a Client for the API server at url, using a bearer token if token is not "".
+func New(url, token string, client *http.Client) *Client {
+	return &Client{url: strings.TrimSuffix(url, "/"), token: token, http: client}
+}
+
+// InCluster returns a Client for the API server of the cluster the process runs in,
+// using the pod's service account.
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccount, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %v", filepath.Join(serviceAccount, "ca.crt"))
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	c := New("https://"+net.JoinHostPort(host, port), "", client)
+	c.tokenFile = filepath.Join(serviceAccount, "token")
+	return c, nil
+}
+
+// get decodes the JSON object at path into v.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	token := c.token
+	if c.tokenFile != "" {
+		data, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("GET %v: %w", path, ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("GET %v: %v: %v", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// metadata is the part of object metadata the exporter uses.
+type metadata struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+}
+
+// Taint is a node taint.
+type Taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// Node is the part of a node object the exporter uses.
+type Node struct {
+	Name          string
+	Labels        map[string]string
+	Unschedulable bool
+	Taints        []Taint
+}
+
+// Draining returns true if the node is cordoned, which is the first step of a drain.
+// Pods are then evicted, so their log files are removed in bulk.
+func (n *Node) Draining() bool {
+	if n.Unschedulable {
+		return true
+	}
+	for _, t := range n.Taints {
+		if t.Key == UnschedulableTaint {
+			return true
+		}
+	}
+	return false
+}
+
+// Node gets the node called name. Needs permission to get nodes.
+func (c *Client) Node(ctx context.Context, name string) (*Node, error) {
+	var obj struct {
+		Metadata metadata `json:"metadata"`
+		Spec     struct {
+			Unschedulable bool    `json:"unschedulable"`
+			Taints        []Taint `json:"taints"`
+		} `json:"spec"`
+	}
+	if err := c.get(ctx, "/api/v1/nodes/"+url.PathEscape(name), &obj); err != nil {
+		return nil, err
+	}
+	return &Node{Name: obj.Metadata.Name, Labels: obj.Metadata.Labels, Unschedulable: obj.Spec.Unschedulable, Taints: obj.Spec.Taints}, nil
+}
+
+// WatchDrain gets node name every interval, and calls changed when its Draining state changes,
+// starting with the first successful get. Errors are logged and the last known state is kept.
+// The interval must be positive. Returns when ctx is done.
+func (c *Client) WatchDrain(ctx context.Context, name string, interval time.Duration, changed func(draining bool)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	known, draining := false, false
+	for {
+		node, err := c.Node(ctx, name)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				log.Error(err, "Error getting node drain state", "node", name)
+			}
+		case !known || node.Draining() != draining:
+			known, draining = true, node.Draining()
+			log.V(1).Info("Node drain state", "node", name, "draining", draining)
+			changed(draining)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
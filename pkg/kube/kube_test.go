@@ -0,0 +1,103 @@
+package kube_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode serves a node object, its spec can be changed while serving.
+type fakeNode struct {
+	mu   sync.Mutex
+	spec string
+}
+
+func (f *fakeNode) set(spec string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.spec = spec
+}
+
+func (f *fakeNode) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/nodes/node-0" || r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(rw, "not found", http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Fprintf(rw, `{"kind":"Node","metadata":{"name":"node-0"},"spec":%v}`, f.spec)
+}
+
+func TestNode(t *testing.T) {
+	fake := &fakeNode{spec: `{}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	c := kube.New(server.URL, "secret", server.Client())
+	ctx := context.Background()
+
+	node, err := c.Node(ctx, "node-0")
+	require.NoError(t, err)
+	assert.Equal(t, &kube.Node{Name: "node-0"}, node)
+	assert.False(t, node.Draining())
+
+	fake.set(`{"unschedulable":true}`)
+	node, err = c.Node(ctx, "node-0")
+	require.NoError(t, err)
+	assert.True(t, node.Draining())
+
+	fake.set(`{"taints":[{"key":"node.kubernetes.io/unschedulable","effect":"NoSchedule"}]}`)
+	node, err = c.Node(ctx, "node-0")
+	require.NoError(t, err)
+	assert.Equal(t, []kube.Taint{{Key: kube.UnschedulableTaint, Effect: "NoSchedule"}}, node.Taints)
+	assert.True(t, node.Draining())
+
+	_, err = c.Node(ctx, "node-1")
+	assert.Error(t, err)
+	_, err = kube.New(server.URL, "wrong", server.Client()).Node(ctx, "node-0")
+	assert.Error(t, err)
+}
+
+func TestWatchDrain(t *testing.T) {
+	fake := &fakeNode{spec: `{}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	c := kube.New(server.URL, "secret", server.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan bool, 10)
+	done := make(chan struct{})
+	go func() {
+		c.WatchDrain(ctx, "node-0", 10*time.Millisecond, func(draining bool) { changes <- draining })
+		close(done)
+	}()
+	next := func() bool {
+		t.Helper()
+		select {
+		case draining := <-changes:
+			return draining
+		case <-time.After(time.Second):
+			require.FailNow(t, "timeout waiting for drain state")
+			return false
+		}
+	}
+	assert.False(t, next(), "initial state")
+	fake.set(`{"unschedulable":true}`)
+	assert.True(t, next())
+	fake.set(`{}`)
+	assert.False(t, next())
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail(t, "WatchDrain did not return")
+	}
+	assert.Empty(t, changes, "only changes are reported")
+}
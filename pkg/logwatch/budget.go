@@ -0,0 +1,74 @@
+package logwatch
+
+import (
+	"sync"
+	"time"
+)
+
+// budgetBuckets is the number of buckets in the sliding window.
+const budgetBuckets = 10
+
+// errorBudget tracks the fraction of failed operations over a sliding time window.
+type errorBudget struct {
+	limit  float64       // Maximum fraction of failures, 0 means no limit.
+	window time.Duration // Length of the sliding window.
+
+	mu      sync.Mutex
+	buckets [budgetBuckets]struct {
+		start       time.Time
+		total, fail int
+	}
+}
+
+func newErrorBudget(limit float64, window time.Duration) *errorBudget {
+	return &errorBudget{limit: limit, window: window}
+}
+
+// bucket returns the bucket for now, resetting it if it is stale.
+func (b *errorBudget) bucket(now time.Time) int {
+	width := b.window / budgetBuckets
+	if width <= 0 {
+		width = 1
+	}
+	start := now.Truncate(width)
+	i := int((start.UnixNano() / int64(width)) % budgetBuckets)
+	if !b.buckets[i].start.Equal(start) {
+		b.buckets[i].start, b.buckets[i].total, b.buckets[i].fail = start, 0, 0
+	}
+	return i
+}
+
+// record the result of an operation at time now.
+func (b *errorBudget) record(now time.Time, failed bool) {
+	if b.limit <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := b.bucket(now)
+	b.buckets[i].total++
+	if failed {
+		b.buckets[i].fail++
+	}
+}
+
+// exceeded returns the failed fraction in the window ending at now and whether it exceeds the limit.
+func (b *errorBudget) exceeded(now time.Time) (fraction float64, exceeded bool) {
+	if b.limit <= 0 {
+		return 0, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var total, fail int
+	for _, bk := range b.buckets {
+		if now.Sub(bk.start) < b.window {
+			total += bk.total
+			fail += bk.fail
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	fraction = float64(fail) / float64(total)
+	return fraction, fraction > b.limit
+}
@@ -0,0 +1,48 @@
+package logwatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorBudget(t *testing.T) {
+	b := newErrorBudget(0.1, time.Minute)
+	now := time.Unix(1000, 0)
+	for i := 0; i < 90; i++ {
+		b.record(now, false)
+	}
+	for i := 0; i < 10; i++ {
+		b.record(now, true)
+	}
+	f, exceeded := b.exceeded(now)
+	assert.InDelta(t, 0.1, f, 0.001)
+	assert.False(t, exceeded)
+
+	b.record(now.Add(time.Second), true)
+	_, exceeded = b.exceeded(now.Add(time.Second))
+	assert.True(t, exceeded)
+
+	// Failures expire when they leave the window.
+	later := now.Add(2 * time.Minute)
+	b.record(later, false)
+	f, exceeded = b.exceeded(later)
+	assert.Equal(t, 0.0, f)
+	assert.False(t, exceeded)
+}
+
+func TestErrorBudgetTinyWindow(t *testing.T) {
+	b := newErrorBudget(0.1, 5*time.Nanosecond)
+	now := time.Unix(1000, 0)
+	b.record(now, true)
+	_, exceeded := b.exceeded(now)
+	assert.True(t, exceeded)
+}
+
+func TestErrorBudgetDisabled(t *testing.T) {
+	b := newErrorBudget(0, time.Minute)
+	b.record(time.Now(), true)
+	_, exceeded := b.exceeded(time.Now())
+	assert.False(t, exceeded)
+}
@@ -0,0 +1,149 @@
+package logwatch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Checkpoint is the state of a Watcher saved across restarts, see RestoreCheckpoint.
+type Checkpoint struct {
+	Time     time.Time                 `json:"time"`
+	Files    map[string]CheckpointFile `json:"files"`    // Last known state of log files, by Key.String.
+	Counters []CheckpointCounter       `json:"counters"` // Series of log_logged_bytes_total.
+}
+
+// CheckpointFile is the last known state of a log file.
+type CheckpointFile struct {
+	Path string  `json:"path,omitempty"` // A watched path of the file.
+	Size float64 `json:"size"`
+	Dev  uint64  `json:"dev,omitempty"`
+	Ino  uint64  `json:"ino,omitempty"`
+}
+
+// CheckpointCounter is a series of log_logged_bytes_total.
+type CheckpointCounter struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// RestoreCheckpoint restores counters and file sizes from cp before existing files are counted,
+// so a restart counts only bytes written since cp was taken, instead of the whole file again.
+// Files and counters are restored only for paths that still exist, counters only with the same label names,
+// a file replaced while the exporter was down is counted from the start.
+func RestoreCheckpoint(cp Checkpoint) Option { return func(w *Watcher) { w.checkpoint = &cp } }
+
+// Checkpoint returns the current state of the live log files and their counters.
+func (w *Watcher) Checkpoint() Checkpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cp := Checkpoint{Time: time.Now(), Files: map[string]CheckpointFile{}}
+	for path, k := range w.keys {
+		size, ok := w.sizes.Get(k)
+		if !ok {
+			continue
+		}
+		id := w.ids[k]
+		cp.Files[k.String()] = CheckpointFile{Path: path, Size: size, Dev: id.Dev, Ino: id.Ino}
+	}
+	ch := make(chan prometheus.Metric)
+	go func() { w.metrics.Collect(ch); close(ch) }()
+	for m := range ch {
+		var d dto.Metric
+		if err := m.Write(&d); err != nil {
+			continue
+		}
+		c := CheckpointCounter{Labels: map[string]string{}, Value: d.GetCounter().GetValue()}
+		for _, l := range d.GetLabel() {
+			c.Labels[l.GetName()] = l.GetValue()
+		}
+		cp.Counters = append(cp.Counters, c)
+	}
+	return cp
+}
+
+// restoreCheckpoint applies the checkpoint set by RestoreCheckpoint, if any.
+func (w *Watcher) restoreCheckpoint() {
+	if w.checkpoint == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for s, f := range w.checkpoint.Files {
+		k, err := ParseKey(s)
+		if err != nil {
+			log.V(2).Info("Ignoring checkpoint file...", "key", s, "err", err)
+			continue
+		}
+		path := f.Path
+		if path == "" && k.PodUID == "" {
+			path = k.File // Checkpoint without paths, the key is the real path.
+		}
+		if path != "" {
+			if _, err := w.fs.Stat(path); err != nil {
+				continue // Gone while the exporter was down.
+			}
+		}
+		w.sizes.Set(k, f.Size)
+		if f.Ino != 0 {
+			w.ids[k] = fsinfo.FileID{Dev: f.Dev, Ino: f.Ino}
+		}
+	}
+	restored := 0
+	for _, c := range w.checkpoint.Counters {
+		if _, err := w.fs.Stat(c.Labels["path"]); err != nil {
+			continue // Gone while the exporter was down.
+		}
+		counter, err := w.metrics.GetMetricWith(c.Labels)
+		if err != nil {
+			continue // Label names changed.
+		}
+		counter.Add(c.Value)
+		restored++
+	}
+	log.Info("Restored checkpoint", "time", w.checkpoint.Time, "files", len(w.checkpoint.Files), "counters", restored)
+	w.checkpoint = nil
+}
+
+// ReadCheckpoint reads a checkpoint written by WriteCheckpoint.
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cp, err
+	}
+	return cp, json.Unmarshal(data, &cp)
+}
+
+// WriteCheckpoint writes cp to path. The file is renamed into place, so a crash never leaves
+// a partly written checkpoint.
+func WriteCheckpoint(path string, cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,142 @@
+package logwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+)
+
+// Reasons for a Decision.
+const (
+	// DecisionNewFile counts a file not seen before from 0.
+	DecisionNewFile = "new-file"
+	// DecisionReplace counts a file from 0 that has a different inode than the file last seen with the same key,
+	// the old file was rotated or replaced.
+	DecisionReplace = "replace"
+	// DecisionGrow counts the bytes a file grew by.
+	DecisionGrow = "grow"
+	// DecisionTruncate counts the whole size of a file that shrank, it was truncated and rewritten.
+	DecisionTruncate = "truncate"
+	// DecisionRotation carries the counted size of a renamed file to its new name, nothing is counted.
+	DecisionRotation = "rotation-carryover"
+	// DecisionDeletedGrow counts the bytes a deleted file grew by while still open, see CountDeleted.
+	DecisionDeletedGrow = "deleted-grow"
+)
+
+// Decision records why bytes were counted for a log file, see DecisionLog.
+type Decision struct {
+	Time          time.Time `json:"time"`
+	Reason        string    `json:"reason"`
+	Path          string    `json:"path"`
+	OldPath       string    `json:"oldPath,omitempty"` // Previous name, for DecisionRotation.
+	Namespace     string    `json:"namespace,omitempty"`
+	PodName       string    `json:"podname,omitempty"`
+	ContainerName string    `json:"containername,omitempty"`
+	Before        float64   `json:"before"` // Size counted before the decision.
+	After         float64   `json:"after"`  // Size counted after the decision.
+	Delta         float64   `json:"delta"`  // Bytes added to the counter.
+}
+
+// DecisionFormat is the output format of a DecisionLog.
+type DecisionFormat int
+
+const (
+	// JSONDecisions writes a JSON object per line.
+	JSONDecisions DecisionFormat = iota
+	// LogfmtDecisions writes name=value pairs per line.
+	LogfmtDecisions
+)
+
+var decisionFormatNames = []string{"json", "logfmt"}
+
+func (f DecisionFormat) String() string {
+	if f < 0 || int(f) >= len(decisionFormatNames) {
+		return fmt.Sprintf("DecisionFormat(%d)", int(f))
+	}
+	return decisionFormatNames[f]
+}
+
+// ParseDecisionFormat parses the String form of a DecisionFormat.
+func ParseDecisionFormat(s string) (DecisionFormat, error) {
+	for i, name := range decisionFormatNames {
+		if s == name {
+			return DecisionFormat(i), nil
+		}
+	}
+	return JSONDecisions, fmt.Errorf("invalid decision log format %q, must be one of %v", s, decisionFormatNames)
+}
+
+// DecisionLog writes a line to out for each Decision, to explain how counted bytes were derived
+// from file sizes. Lines are written while the Watcher is locked, out should not block.
+func DecisionLog(out io.Writer, format DecisionFormat) Option {
+	return func(w *Watcher) { w.decisions = &decisionLog{out: out, format: format} }
+}
+
+// decisionLog is where and how DecisionLog writes.
+type decisionLog struct {
+	out    io.Writer
+	format DecisionFormat
+}
+
+// decide writes d to the decision log if it is set. Must be called with w.mu locked.
+func (w *Watcher) decide(d Decision) {
+	if w.decisions == nil {
+		return
+	}
+	d.Time = time.Now().UTC()
+	var line []byte
+	switch w.decisions.format {
+	case LogfmtDecisions:
+		line = d.appendLogfmt(nil)
+	default:
+		line, _ = json.Marshal(d) // Can't fail, no unsupported types.
+	}
+	if _, err := w.decisions.out.Write(append(line, '\n')); err != nil {
+		log.V(2).Info("Error writing decision log", "err", err)
+	}
+}
+
+// appendLogfmt appends d as name=value pairs, quoting values where needed. Empty strings are omitted.
+func (d Decision) appendLogfmt(b []byte) []byte {
+	pair := func(name, value string) {
+		if value == "" {
+			return
+		}
+		if len(b) > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, name...)
+		b = append(b, '=')
+		if needsQuote(value) {
+			b = strconv.AppendQuote(b, value)
+		} else {
+			b = append(b, value...)
+		}
+	}
+	number := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	pair("time", d.Time.Format(time.RFC3339Nano))
+	pair("reason", d.Reason)
+	pair("path", d.Path)
+	pair("oldPath", d.OldPath)
+	pair("namespace", d.Namespace)
+	pair("podname", d.PodName)
+	pair("containername", d.ContainerName)
+	pair("before", number(d.Before))
+	pair("after", number(d.After))
+	pair("delta", number(d.Delta))
+	return b
+}
+
+// needsQuote returns true if s must be quoted in logfmt.
+func needsQuote(s string) bool {
+	for _, c := range s {
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' || c >= 0x7f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package logwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/mockkubelet"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	audit, rotated := filepath.Join(dir, "audit.log"), filepath.Join(dir, "audit.log.1")
+	require.NoError(t, ioutil.WriteFile(audit, []byte("hello\n"), 0600))
+	var out bytes.Buffer
+	f := NewFixture(t, mockkubelet.Config{}, Files(audit, rotated), DecisionLog(&out, JSONDecisions))
+
+	require.NoError(t, ioutil.WriteFile(audit, []byte("hello\nworld\n"), 0600))
+	f.Watcher.handle(symnotify.Event{Name: audit, Op: symnotify.Write})
+	require.NoError(t, ioutil.WriteFile(audit, []byte("x\n"), 0600))
+	f.Watcher.handle(symnotify.Event{Name: audit, Op: symnotify.Write})
+	f.Watcher.handle(symnotify.Event{Name: audit, Op: symnotify.Write}) // Nothing counted, no decision.
+	require.NoError(t, os.Rename(audit, rotated))
+	f.Watcher.handle(symnotify.Event{Name: rotated, Op: symnotify.Moved, OldName: audit})
+
+	var decisions []Decision
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var d Decision
+		require.NoError(t, json.Unmarshal([]byte(line), &d), line)
+		assert.WithinDuration(t, time.Now(), d.Time, time.Minute)
+		d.Time = time.Time{}
+		decisions = append(decisions, d)
+	}
+	assert.Equal(t, []Decision{
+		{Reason: DecisionNewFile, Path: audit, Before: 0, After: 6, Delta: 6},
+		{Reason: DecisionGrow, Path: audit, Before: 6, After: 12, Delta: 6},
+		{Reason: DecisionTruncate, Path: audit, Before: 12, After: 2, Delta: 2},
+		{Reason: DecisionRotation, Path: rotated, OldPath: audit, Before: 2, After: 2},
+	}, decisions)
+}
+
+func TestDecisionLogfmt(t *testing.T) {
+	var out bytes.Buffer
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, DecisionLog(&out, LogfmtDecisions))
+	c := f.Tree.Logs[0]
+	line := strings.TrimSpace(out.String())
+	assert.Regexp(t, `^time=\S+ reason=new-file path=`+c.Link+` namespace=namespace-0 podname=pod-0 containername=container-0 before=0 after=\d+ delta=\d+$`, line)
+
+	d := Decision{Reason: DecisionGrow, Path: "/a b", Namespace: `x"y`}
+	assert.Equal(t, `time=0001-01-01T00:00:00Z reason=grow path="/a b" namespace="x\"y" before=0 after=0 delta=0`, string(d.appendLogfmt(nil)))
+}
+
+func TestParseDecisionFormat(t *testing.T) {
+	for _, format := range []DecisionFormat{JSONDecisions, LogfmtDecisions} {
+		parsed, err := ParseDecisionFormat(format.String())
+		assert.NoError(t, err)
+		assert.Equal(t, format, parsed)
+	}
+	_, err := ParseDecisionFormat("xml")
+	assert.EqualError(t, err, `invalid decision log format "xml", must be one of [json logfmt]`)
+}
@@ -0,0 +1,60 @@
+package logwatch
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// diskUsage maintains the current size of live log files by namespace,
+// updated incrementally so scrapes do not stat any files.
+// Must be used with Watcher.mu locked.
+type diskUsage struct {
+	bytes *prometheus.GaugeVec
+	files map[string]diskFile // Live files by path.
+	count map[string]int      // Number of live files in each namespace.
+}
+
+type diskFile struct {
+	namespace string
+	size      float64
+}
+
+func newDiskUsage() diskUsage {
+	return diskUsage{
+		bytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "log_namespace_disk_bytes",
+			Help: "Current size in bytes of the live log files of a namespace, not including deleted or rotated files",
+		}, []string{"namespace"}),
+		files: map[string]diskFile{},
+		count: map[string]int{},
+	}
+}
+
+// set the current size of the live file path in namespace.
+func (d diskUsage) set(path, namespace string, size float64) {
+	if namespace == "" {
+		return // Individual files, see Files.
+	}
+	old, ok := d.files[path]
+	if ok && old.namespace != namespace {
+		d.remove(path)
+		old, ok = diskFile{}, false
+	}
+	if !ok {
+		d.count[namespace]++
+	}
+	d.files[path] = diskFile{namespace: namespace, size: size}
+	d.bytes.WithLabelValues(namespace).Add(size - old.size)
+}
+
+// remove path, it is no longer live. Deletes the namespace series with its last file.
+func (d diskUsage) remove(path string) {
+	f, ok := d.files[path]
+	if !ok {
+		return
+	}
+	delete(d.files, path)
+	if d.count[f.namespace]--; d.count[f.namespace] == 0 {
+		delete(d.count, f.namespace)
+		d.bytes.DeleteLabelValues(f.namespace)
+		return
+	}
+	d.bytes.WithLabelValues(f.namespace).Sub(f.size)
+}
@@ -0,0 +1,102 @@
+package logwatch
+
+import (
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+)
+
+var (
+	// dockerLogRegexp matches a docker json-file log <id>/<id>-json.log, capturing the container ID.
+	dockerLogRegexp = regexp.MustCompile(`/([a-f0-9]{64})/([a-f0-9]{64})-json\.log$`)
+	// containerLinkRegexp matches the name of a kubelet container log link, with the groups of kubernetesregexpCompiled.
+	containerLinkRegexp = regexp.MustCompile(`^` + containerLinkPattern)
+)
+
+// dockerRetry is the time before listing the link directory again for a container ID that was not found.
+const dockerRetry = 10 * time.Second
+
+// DockerDir watches a docker json-file log directory, usually /var/lib/docker/containers,
+// with a subdirectory <id> containing <id>-json.log for each container, on nodes that run dockershim.
+// Labels are resolved from the container ID with the kubelet container log links in links,
+// usually /var/log/containers, see DockerLogs.
+func DockerDir(links string) Option {
+	return func(w *Watcher) {
+		w.subdirs = true
+		w.parser = DockerLogs(links)
+		w.watchOpts = append(w.watchOpts, symnotify.Recursive())
+	}
+}
+
+// DockerLogs returns a PathParser for docker json-file logs <id>/<id>-json.log. It finds the labels
+// of container <id> from the name of the kubelet link <pod>_<namespace>_<container>-<id>.log in links.
+// Logs of containers with no link, not started by kubelet, are ignored. A container ID that is not
+// found is looked up again after a delay, its log is counted from the start when it is found.
+func DockerLogs(links string) PathParser {
+	return &dockerParser{links: links, fs: symnotify.OS, found: map[string]containerLabels{}, missed: map[string]time.Time{}}
+}
+
+// containerLabels are the labels of a container.
+type containerLabels struct{ namespace, podname, containername string }
+
+// dockerParser is the PathParser of DockerLogs.
+type dockerParser struct {
+	links string
+	fs    symnotify.FS
+
+	mu     sync.Mutex
+	found  map[string]containerLabels // By container ID.
+	missed map[string]time.Time       // Container IDs not found, by time of the last lookup.
+}
+
+func (p *dockerParser) ParsePath(path string) (namespace, podname, containername string, ok bool) {
+	m := dockerLogRegexp.FindStringSubmatch(filepath.ToSlash(path))
+	if m == nil || m[1] != m[2] {
+		return "", "", "", false
+	}
+	l, ok := p.lookup(m[1], time.Now())
+	return l.namespace, l.podname, l.containername, ok
+}
+
+// lookup returns the labels of container id, listing the link directory if it is not known.
+func (p *dockerParser) lookup(id string, now time.Time) (containerLabels, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if l, ok := p.found[id]; ok {
+		return l, true
+	}
+	if last, ok := p.missed[id]; ok && now.Sub(last) < dockerRetry {
+		return containerLabels{}, false
+	}
+	infos, err := p.fs.ReadDir(p.links)
+	if err != nil {
+		log.V(2).Info("Can't list container log links...", "dir", p.links, "err", err)
+	}
+	live := map[string]bool{}
+	for _, info := range infos {
+		if m := containerLinkRegexp.FindStringSubmatch(info.Name()); m != nil {
+			p.found[m[dockerIndex]] = containerLabels{namespace: m[namespaceIndex], podname: m[podNameIndex], containername: m[containerNameIndex]}
+			live[m[dockerIndex]] = true
+		}
+	}
+	// Forget containers whose links are gone, and misses that are found or expired.
+	for id := range p.found {
+		if !live[id] {
+			delete(p.found, id)
+		}
+	}
+	for id, last := range p.missed {
+		if live[id] || now.Sub(last) >= dockerRetry {
+			delete(p.missed, id)
+		}
+	}
+	l, ok := p.found[id]
+	if !ok {
+		p.missed[id] = now
+	}
+	return l, ok
+}
@@ -0,0 +1,75 @@
+package logwatch
+
+import (
+	"github.com/ViaQ/logerr/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NodeDrain makes the Watcher aware of node drains, see SetDraining.
+// While the node drains, series of removed pods are kept and then deleted together
+// when the drain ends, so the mass removal is a single step rather than a long trickle.
+// The logfilemetricexporter_node_draining metric lets alerts on disappearing series
+// tell a drain from a failure of the exporter.
+func NodeDrain() Option { return func(w *Watcher) { w.drain = &drain{pending: map[string]bool{}} } }
+
+// drain holds pod removals while the node drains. Must be used with w.mu locked.
+type drain struct {
+	draining bool
+	pending  map[string]bool // Pods removed during the drain, by UID.
+
+	gauge, pendingPods prometheus.Gauge
+}
+
+// newMetrics creates the metrics for NodeDrain.
+func (d *drain) newMetrics() []prometheus.Collector {
+	d.gauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logfilemetricexporter_node_draining",
+		Help: "1 while the node is cordoned or drained, expect series of removed pods to disappear in bulk when it ends",
+	})
+	d.pendingPods = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logfilemetricexporter_drain_pending_pods",
+		Help: "Number of removed pods with series kept until the node drain ends",
+	})
+	return []prometheus.Collector{d.gauge, d.pendingPods}
+}
+
+// hold defers removing pod uid if the node is draining, returns true if it was deferred.
+func (d *drain) hold(uid string) bool {
+	if d == nil || !d.draining {
+		return false
+	}
+	d.pending[uid] = true
+	d.pendingPods.Set(float64(len(d.pending)))
+	return true
+}
+
+// SetDraining records whether the node is draining, for example from kube.Client.WatchDrain.
+// When the drain ends the series of pods removed during it are deleted.
+// Does nothing unless the NodeDrain option was used.
+func (w *Watcher) SetDraining(draining bool) {
+	if w.drain == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d := w.drain
+	if draining == d.draining {
+		return
+	}
+	d.draining = draining
+	if draining {
+		d.gauge.Set(1)
+		log.Info("Node is draining, deleting series of removed pods when it ends")
+		return
+	}
+	pending := d.pending
+	d.pending = map[string]bool{}
+	for uid := range pending {
+		if p := w.pods[uid]; p != nil && p.gone() {
+			w.deletePod(uid) // Not held again by DeleteGrace, it was held for the drain.
+		}
+	}
+	d.gauge.Set(0)
+	d.pendingPods.Set(0)
+	log.Info("Node drain ended, deleted series of removed pods", "pods", len(pending))
+}
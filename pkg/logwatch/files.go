@@ -0,0 +1,136 @@
+package logwatch
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+)
+
+// ErrOutsideRoot is returned by Confine for paths that are not in the root directory.
+var ErrOutsideRoot = errors.New("path is outside the watched directory")
+
+// Confine returns the clean absolute path of name in directory root.
+// A relative name is relative to root. Returns ErrOutsideRoot if name has a ".." element,
+// is not under root, or its directory is reached through a symlink that leaves root.
+// The last element of name may be a symlink, log files in the watched directory usually are,
+// callers must not follow it to read or write the target.
+func Confine(root, name string) (string, error) { return confine(symnotify.OS, root, name) }
+
+// confine is Confine using fs.
+func confine(fs symnotify.FS, root, name string) (string, error) {
+	for _, elem := range strings.Split(filepath.ToSlash(name), "/") {
+		if elem == ".." {
+			return "", ErrOutsideRoot
+		}
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(root, name)
+	}
+	name = filepath.Clean(name)
+	if !within(root, name) || name == root {
+		return "", ErrOutsideRoot
+	}
+	realRoot, err := fs.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realDir, err := fs.EvalSymlinks(filepath.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	if !within(realRoot, realDir) {
+		return "", ErrOutsideRoot
+	}
+	return name, nil
+}
+
+// within returns true if clean path is dir or is under dir.
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// withinAny returns true if path is within one of dirs.
+func withinAny(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if within(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileState is the state the Watcher keeps for a log file path.
+type FileState struct {
+	Path    string  `json:"path"`
+	Key     string  `json:"key,omitempty"`     // Key of the file, see Key.String.
+	Matched *bool   `json:"matched,omitempty"` // Filter result, nil if not yet evaluated.
+	Size    float64 `json:"size"`              // Last size counted.
+	PodUID  string  `json:"podUID,omitempty"`
+	FSType  string  `json:"fstype,omitempty"`
+}
+
+// Files returns the sorted paths the Watcher has state for.
+func (w *Watcher) Files() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seen := map[string]bool{}
+	for path := range w.matched {
+		seen[path] = true
+	}
+	for path := range w.keys {
+		seen[path] = true
+	}
+	for path := range w.podOf {
+		seen[path] = true
+	}
+	list := make([]string, 0, len(seen))
+	for path := range seen {
+		list = append(list, path)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// File returns the state kept for path, which is confined to the watched directories, see Confine.
+// A relative path is relative to the directory passed to New.
+// It only reports what the Watcher already knows, it does not access the file.
+// The boolean is false if there is no state for path.
+func (w *Watcher) File(path string) (FileState, bool, error) {
+	path, err := w.confine(path)
+	if err != nil {
+		return FileState{}, false, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := FileState{Path: path, PodUID: w.podOf[path]}
+	matched, found := w.matched[path]
+	if found {
+		s.Matched = &matched
+	}
+	if key, ok := w.keys[path]; ok {
+		found = true
+		s.Key = key.String()
+		s.Size, _ = w.sizes.Get(key)
+		s.FSType = w.fstypes[key]
+	}
+	return s, found || s.PodUID != "", nil
+}
+
+// confine confines path to the first watched directory that contains it, see Confine.
+func (w *Watcher) confine(path string) (string, error) {
+	err := ErrOutsideRoot
+	for _, dir := range w.dirs {
+		var confined string
+		if confined, err = confine(w.fs, dir, path); err != ErrOutsideRoot {
+			return confined, err
+		}
+	}
+	return "", err
+}
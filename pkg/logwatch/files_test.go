@@ -0,0 +1,53 @@
+package logwatch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfine(t *testing.T) {
+	top, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(top)
+	root := filepath.Join(top, "containers")
+	outside := filepath.Join(top, "outside")
+	for _, dir := range []string{root, outside, filepath.Join(root, "sub")} {
+		require.NoError(t, os.MkdirAll(dir, 0700))
+	}
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "target.log"), filepath.Join(root, "link.log")))
+
+	for name, want := range map[string]string{
+		"a.log":                          filepath.Join(root, "a.log"),
+		"sub/b.log":                      filepath.Join(root, "sub", "b.log"),
+		"./sub//b.log":                   filepath.Join(root, "sub", "b.log"),
+		filepath.Join(root, "a.log"):     filepath.Join(root, "a.log"),
+		"link.log":                       filepath.Join(root, "link.log"), // Last element may be a symlink.
+		filepath.Join(root, "escape"):    filepath.Join(root, "escape"),
+		filepath.Join(root, "sub") + "/": filepath.Join(root, "sub"),
+	} {
+		got, err := logwatch.Confine(root, name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, want, got, name)
+		}
+	}
+	for _, name := range []string{
+		"../outside/x.log",
+		"sub/../../outside/x.log",
+		"sub/../a.log", // No ".." at all, even if it stays inside.
+		filepath.Join(outside, "x.log"),
+		root + "-other/x.log", // Prefix of root is not root.
+		"escape/x.log",        // Directory is a symlink leaving root.
+		root,
+		"",
+	} {
+		_, err := logwatch.Confine(root, name)
+		assert.Equal(t, logwatch.ErrOutsideRoot, err, name)
+	}
+}
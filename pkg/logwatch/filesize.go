@@ -0,0 +1,49 @@
+package logwatch
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// FileSizes also reports the current size of each live log file, with the same labels as the bytes counter.
+// Kubelet rotates a container log when it reaches containerLogMaxSize, so alerts on the size can
+// anticipate rotations. The series of a file is deleted when the file is deleted, moved or filtered out.
+func FileSizes() Option {
+	return func(w *Watcher) { w.fileSizes = &fileSizes{labels: map[string]prometheus.Labels{}} }
+}
+
+// fileSizes is the state of FileSizes, guarded by Watcher.mu.
+type fileSizes struct {
+	bytes  *prometheus.GaugeVec
+	labels map[string]prometheus.Labels // Labels of the series for each live path.
+}
+
+// newMetrics creates the gauge for FileSizes.
+func (s *fileSizes) newMetrics(labelNames []string) *prometheus.GaugeVec {
+	s.bytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_file_current_size_bytes",
+		Help: "Current size in bytes of a single live log file path",
+	}, labelNames)
+	return s.bytes
+}
+
+// set the current size of the live file path.
+func (s *fileSizes) set(path string, labels prometheus.Labels, size float64) {
+	if s == nil {
+		return
+	}
+	gauge, err := s.bytes.GetMetricWith(labels)
+	if err != nil {
+		return
+	}
+	s.labels[path] = labels
+	gauge.Set(size)
+}
+
+// remove the series of path, it is no longer live.
+func (s *fileSizes) remove(path string) {
+	if s == nil {
+		return
+	}
+	if labels, ok := s.labels[path]; ok {
+		s.bytes.Delete(labels)
+		delete(s.labels, path)
+	}
+}
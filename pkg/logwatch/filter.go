@@ -0,0 +1,181 @@
+package logwatch
+
+import (
+	"fmt"
+	"path"
+)
+
+// Filter selects which containers are counted.
+// Namespace rules are evaluated first, then pod rules, container lists apply across all namespaces.
+type Filter struct {
+	// IncludeNamespaces if not empty, only containers in these namespaces are counted.
+	IncludeNamespaces []string
+	// ExcludeNamespaces are never counted, even if included.
+	ExcludeNamespaces []string
+	// IncludeContainers if not empty, only containers with these names are counted.
+	IncludeContainers []string
+	// ExcludeContainers with these names are never counted, even if included,
+	// for example "istio-proxy" or "POD" sandbox containers.
+	ExcludeContainers []string
+	// IncludeContainerGlobs if not empty, containers with names matching one of these globs are also included,
+	// see path.Match.
+	IncludeContainerGlobs []string
+	// ExcludeContainerGlobs with names matching one of these globs are also excluded.
+	ExcludeContainerGlobs []string
+	// IncludePods if not empty, only pods with names matching one of these globs are counted, see path.Match.
+	IncludePods []string
+	// ExcludePods with names matching one of these globs are never counted, even if included.
+	ExcludePods []string
+}
+
+// Rule names used in filter metrics.
+const (
+	RuleIncludeNamespaces = "include-namespaces"
+	RuleExcludeNamespaces = "exclude-namespaces"
+	RuleIncludeContainers = "include-containers"
+	RuleExcludeContainers = "exclude-containers"
+	RuleIncludePods       = "include-pods"
+	RuleExcludePods       = "exclude-pods"
+)
+
+// rule is one step of a Filter.
+// An include rule drops files it does not match, an exclude rule drops files it matches.
+type rule struct {
+	name    string
+	include bool
+	match   func(namespace, podname, containername string) bool
+}
+
+// rules returns the enabled rules in evaluation order.
+func (f *Filter) rules() (rules []rule) {
+	return append(append(f.namespaceRules(), f.podRules()...), f.containerRules()...)
+}
+
+func (f *Filter) namespaceRules() (rules []rule) {
+	if len(f.IncludeNamespaces) > 0 {
+		rules = append(rules, rule{RuleIncludeNamespaces, true, func(ns, _, _ string) bool { return contains(f.IncludeNamespaces, ns) }})
+	}
+	if len(f.ExcludeNamespaces) > 0 {
+		rules = append(rules, rule{RuleExcludeNamespaces, false, func(ns, _, _ string) bool { return contains(f.ExcludeNamespaces, ns) }})
+	}
+	return rules
+}
+
+func (f *Filter) podRules() (rules []rule) {
+	if len(f.IncludePods) > 0 {
+		rules = append(rules, rule{RuleIncludePods, true, func(_, p, _ string) bool { return matchAny(f.IncludePods, p) }})
+	}
+	if len(f.ExcludePods) > 0 {
+		rules = append(rules, rule{RuleExcludePods, false, func(_, p, _ string) bool { return matchAny(f.ExcludePods, p) }})
+	}
+	return rules
+}
+
+func (f *Filter) containerRules() (rules []rule) {
+	if len(f.IncludeContainers) > 0 || len(f.IncludeContainerGlobs) > 0 {
+		rules = append(rules, rule{RuleIncludeContainers, true, func(_, _, c string) bool {
+			return contains(f.IncludeContainers, c) || matchAny(f.IncludeContainerGlobs, c)
+		}})
+	}
+	if len(f.ExcludeContainers) > 0 || len(f.ExcludeContainerGlobs) > 0 {
+		rules = append(rules, rule{RuleExcludeContainers, false, func(_, _, c string) bool {
+			return contains(f.ExcludeContainers, c) || matchAny(f.ExcludeContainerGlobs, c)
+		}})
+	}
+	return rules
+}
+
+// Match returns true if a log file for containername should be counted.
+func (f *Filter) Match(namespace, podname, containername string) bool {
+	return f.evaluate(namespace, podname, containername, func(string, bool, bool) {})
+}
+
+// Validate returns an error if a pod or container glob is malformed.
+func (f *Filter) Validate() error {
+	for _, globs := range [][]string{f.IncludePods, f.ExcludePods, f.IncludeContainerGlobs, f.ExcludeContainerGlobs} {
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("invalid glob %q: %w", glob, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FiltersPods returns true if f has pod rules.
+func (f *Filter) FiltersPods() bool {
+	return len(f.IncludePods) > 0 || len(f.ExcludePods) > 0
+}
+
+// MatchPod returns true if the pod rules do not drop podname.
+func (f *Filter) MatchPod(podname string) bool {
+	for _, r := range f.podRules() {
+		if r.match("", podname, "") != r.include {
+			return false
+		}
+	}
+	return true
+}
+
+// FiltersContainers returns true if f has container rules.
+func (f *Filter) FiltersContainers() bool {
+	return len(f.IncludeContainers) > 0 || len(f.ExcludeContainers) > 0 || len(f.IncludeContainerGlobs) > 0 || len(f.ExcludeContainerGlobs) > 0
+}
+
+// MatchContainer returns true if the container rules do not drop containername.
+func (f *Filter) MatchContainer(containername string) bool {
+	for _, r := range f.containerRules() {
+		if r.match("", "", containername) != r.include {
+			return false
+		}
+	}
+	return true
+}
+
+// FiltersNamespaces returns true if f has namespace rules.
+func (f *Filter) FiltersNamespaces() bool {
+	return len(f.IncludeNamespaces) > 0 || len(f.ExcludeNamespaces) > 0
+}
+
+// MatchNamespace returns true if the namespace rules do not drop namespace.
+func (f *Filter) MatchNamespace(namespace string) bool {
+	for _, r := range f.namespaceRules() {
+		if r.match(namespace, "", "") != r.include {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate rules in order, calling observe with each rule evaluated, whether it matched and
+// whether it dropped the file. Evaluation stops at the first rule that drops.
+func (f *Filter) evaluate(namespace, podname, containername string, observe func(rule string, hit, drop bool)) bool {
+	for _, r := range f.rules() {
+		hit := r.match(namespace, podname, containername)
+		drop := hit != r.include
+		observe(r.name, hit, drop)
+		if drop {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny returns true if s matches one of globs, malformed globs match nothing.
+func matchAny(globs []string, s string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package logwatch_test
+
+import (
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterContainers(t *testing.T) {
+	var f logwatch.Filter
+	assert.True(t, f.Match("ns", "pod", "foo"), "empty filter matches all")
+
+	f = logwatch.Filter{IncludeContainers: []string{"istio-proxy", "fluentd"}}
+	assert.True(t, f.Match("ns1", "pod", "istio-proxy"))
+	assert.True(t, f.Match("ns2", "pod", "fluentd"))
+	assert.False(t, f.Match("ns1", "pod", "foo"))
+
+	f = logwatch.Filter{ExcludeContainers: []string{"istio-proxy"}}
+	assert.False(t, f.Match("ns1", "pod", "istio-proxy"))
+	assert.True(t, f.Match("ns1", "pod", "foo"))
+
+	f = logwatch.Filter{IncludeContainers: []string{"foo", "bar"}, ExcludeContainers: []string{"bar"}}
+	assert.True(t, f.Match("ns", "pod", "foo"))
+	assert.False(t, f.Match("ns", "pod", "bar"))
+
+	f = logwatch.Filter{ExcludeContainerGlobs: []string{"istio-*"}, ExcludeContainers: []string{"POD"}}
+	assert.NoError(t, f.Validate())
+	assert.True(t, f.FiltersContainers())
+	assert.False(t, f.Match("ns", "pod", "istio-proxy"))
+	assert.False(t, f.Match("ns", "pod", "POD"))
+	assert.True(t, f.Match("ns", "pod", "app"))
+	assert.False(t, f.MatchContainer("POD"))
+	assert.True(t, f.MatchContainer("app"))
+	f = logwatch.Filter{IncludeContainerGlobs: []string{"["}}
+	assert.Error(t, f.Validate())
+
+	// Container names match exactly, even with glob characters.
+	f = logwatch.Filter{IncludeContainers: []string{"istio", "app-?", "["}}
+	assert.NoError(t, f.Validate())
+	assert.True(t, f.Match("ns", "pod", "istio"))
+	assert.False(t, f.Match("ns", "pod", "istio-proxy"))
+	assert.True(t, f.Match("ns", "pod", "app-?"))
+	assert.False(t, f.Match("ns", "pod", "app-1"))
+	assert.True(t, f.Match("ns", "pod", "["))
+
+	// Globs add to the names.
+	f = logwatch.Filter{IncludeContainers: []string{"istio"}, IncludeContainerGlobs: []string{"app-?"}}
+	assert.True(t, f.FiltersContainers())
+	assert.True(t, f.Match("ns", "pod", "istio"))
+	assert.True(t, f.Match("ns", "pod", "app-1"))
+	assert.False(t, f.Match("ns", "pod", "app-10"))
+}
+
+func TestFilterNamespaces(t *testing.T) {
+	var f logwatch.Filter
+	assert.False(t, f.FiltersNamespaces())
+	assert.True(t, f.MatchNamespace("ns"))
+
+	f = logwatch.Filter{IncludeNamespaces: []string{"app1", "app2"}, ExcludeNamespaces: []string{"app2"}, ExcludeContainers: []string{"foo"}}
+	assert.True(t, f.FiltersNamespaces())
+	assert.True(t, f.Match("app1", "pod", "bar"))
+	assert.False(t, f.Match("app1", "pod", "foo"))
+	assert.False(t, f.Match("app2", "pod", "bar"))
+	assert.False(t, f.Match("other", "pod", "bar"))
+	assert.True(t, f.MatchNamespace("app1"))
+	assert.False(t, f.MatchNamespace("app2"))
+	assert.False(t, f.MatchNamespace("other"))
+}
+
+func TestFilterPods(t *testing.T) {
+	f := logwatch.Filter{IncludePods: []string{"fluentd-*", "build-*"}, ExcludePods: []string{"build-??"}}
+	assert.True(t, f.FiltersPods())
+	assert.NoError(t, f.Validate())
+	assert.True(t, f.Match("ns", "fluentd-x1", "c"))
+	assert.True(t, f.Match("ns", "build-123", "c"))
+	assert.False(t, f.Match("ns", "build-12", "c"))
+	assert.False(t, f.Match("ns", "app", "c"))
+	assert.True(t, f.MatchPod("fluentd-x1"))
+	assert.False(t, f.MatchPod("app"))
+
+	f = logwatch.Filter{ExcludePods: []string{"[a-"}}
+	assert.Error(t, f.Validate())
+}
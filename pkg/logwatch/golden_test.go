@@ -0,0 +1,76 @@
+package logwatch
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/mockkubelet"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// fstypeLabel matches file system type labels, which depend on the test machine.
+var fstypeLabel = regexp.MustCompile(`fstype="[^"]*"`)
+
+// inodeValue matches the values of file system inode metrics, which depend on the test machine.
+var inodeValue = regexp.MustCompile(`(?m)^(log_filesystem_inodes\S*) \S+$`)
+
+// TestGoldenMetrics compares the metrics for a generated tree with testdata/*.golden.
+// Renamed metrics or labels and changed help text are API changes, update the golden
+// files deliberately with: go test ./pkg/logwatch -run TestGoldenMetrics -update
+func TestGoldenMetrics(t *testing.T) {
+	registry, internal := prometheus.NewRegistry(), prometheus.NewRegistry()
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 2, Pods: 1, Containers: 2, Restarts: 1, Size: 100},
+		Registry(registry), InternalRegistry(internal), ContainerInstances(), Sidecars("container-1"),
+		WithFilter(Filter{ExcludeContainers: []string{"container-0"}, ExcludeNamespaces: []string{"namespace-1"}}))
+
+	metrics := render(t, registry)
+	metrics = strings.ReplaceAll(metrics, f.Tree.Root, "/ROOT")
+	metrics = fstypeLabel.ReplaceAllString(metrics, `fstype="FSTYPE"`)
+	metrics = inodeValue.ReplaceAllString(metrics, `$1 INODES`)
+	golden(t, "metrics.golden", metrics)
+
+	// Internal metric values depend on timing, only compare the names, types and help.
+	var lines []string
+	for _, line := range strings.Split(render(t, internal), "\n") {
+		if strings.HasPrefix(line, "# ") {
+			lines = append(lines, line)
+		}
+	}
+	golden(t, "internal.golden", strings.Join(lines, "\n")+"\n")
+}
+
+// render gathers metrics from g in the Prometheus text format.
+func render(t *testing.T, g prometheus.Gatherer) string {
+	t.Helper()
+	families, err := g.Gather()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtText)
+	for _, mf := range families {
+		require.NoError(t, enc.Encode(mf))
+	}
+	return buf.String()
+}
+
+// golden compares got with testdata/name, or updates it with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, ioutil.WriteFile(path, []byte(got), 0644))
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), got, "metrics differ from %v, see TestGoldenMetrics", path)
+}
@@ -0,0 +1,101 @@
+package logwatch
+
+import (
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DeleteGrace keeps the series of a removed pod for period before deleting them.
+// If the pod's log files reappear within the period the deletion is cancelled and counting continues,
+// for example when a static pod or the kubelet restarts and recreates the pod's log directory.
+// A period <= 0 deletes series as soon as the pod is removed.
+func DeleteGrace(period time.Duration) Option {
+	return func(w *Watcher) {
+		if period > 0 {
+			w.grace = &deleteGrace{period: period, pending: map[string]*time.Timer{}}
+		}
+	}
+}
+
+// deleteGrace holds pod removals for a grace period. Must be used with w.mu locked.
+type deleteGrace struct {
+	period  time.Duration
+	pending map[string]*time.Timer // Removed pods waiting for the period to expire, by UID.
+
+	pendingPods prometheus.Gauge
+	cancelled   prometheus.Counter
+}
+
+// newMetrics creates the metrics for DeleteGrace.
+func (g *deleteGrace) newMetrics() []prometheus.Collector {
+	g.pendingPods = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logfilemetricexporter_delete_grace_pending_pods",
+		Help: "Number of removed pods with series kept until the delete grace period expires",
+	})
+	g.cancelled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_delete_grace_cancelled_total",
+		Help: "Number of pod series deletions cancelled because the pod's log files reappeared within the grace period",
+	})
+	return []prometheus.Collector{g.pendingPods, g.cancelled}
+}
+
+// hold defers removing pod uid for the grace period, returns true if it was deferred.
+// expire is called when the period ends.
+func (g *deleteGrace) hold(uid string, expire func()) bool {
+	if g == nil {
+		return false
+	}
+	if _, ok := g.pending[uid]; !ok {
+		g.pending[uid] = time.AfterFunc(g.period, expire)
+		g.pendingPods.Set(float64(len(g.pending)))
+	}
+	return true
+}
+
+// cancel a pending removal of pod uid, returns true if one was pending.
+func (g *deleteGrace) cancel(uid string) bool {
+	if g == nil {
+		return false
+	}
+	timer, ok := g.pending[uid]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(g.pending, uid)
+	g.pendingPods.Set(float64(len(g.pending)))
+	g.cancelled.Inc()
+	return true
+}
+
+// stop all pending removals, the series are kept.
+func (g *deleteGrace) stop() {
+	if g == nil {
+		return
+	}
+	for uid, timer := range g.pending {
+		timer.Stop()
+		delete(g.pending, uid)
+	}
+}
+
+// graceExpired deletes pod uid if its removal is still pending at the end of the grace period.
+// It does nothing after Close, stop can't stop a timer that already fired and waits for w.mu.
+func (w *Watcher) graceExpired(uid string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if _, ok := w.grace.pending[uid]; !ok {
+		return // Cancelled.
+	}
+	delete(w.grace.pending, uid)
+	w.grace.pendingPods.Set(float64(len(w.grace.pending)))
+	if p := w.pods[uid]; p != nil && p.gone() && !w.drain.hold(uid) {
+		log.V(3).Info("Pod delete grace period expired...", "poduid", uid)
+		w.deletePod(uid)
+	}
+}
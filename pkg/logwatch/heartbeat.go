@@ -0,0 +1,26 @@
+package logwatch
+
+import "time"
+
+// Heartbeat calls beat every interval from the event loop of Watch, between events.
+// If the loop hangs, for example blocked handling an event, beat is not called,
+// so it can drive a keepalive such as a systemd watchdog.
+func Heartbeat(interval time.Duration, beat func()) Option {
+	return func(w *Watcher) { w.heartbeat = &heartbeat{interval: interval, beat: beat} }
+}
+
+// heartbeat is the state of Heartbeat, used only by the Watch goroutine.
+type heartbeat struct {
+	interval time.Duration
+	beat     func()
+}
+
+// ticker returns a ticker channel for heartbeats and a function to stop it.
+// The channel is nil, so it never fires, if Heartbeat is not set.
+func (h *heartbeat) ticker() (<-chan time.Time, func()) {
+	if h == nil || h.interval <= 0 {
+		return nil, func() {}
+	}
+	t := time.NewTicker(h.interval)
+	return t.C, t.Stop
+}
@@ -0,0 +1,24 @@
+package logwatch
+
+// ignoreFile returns true for log files dropped by the pod or container rules of the filter,
+// the underlying watcher ignores them so they never get watches or events.
+// It does not lock w.mu, it is called by the underlying watcher while w.mu may be held.
+func (w *Watcher) ignoreFile(path string) bool {
+	f, _ := w.unwatched.Load().(Filter)
+	if !f.FiltersPods() && !f.FiltersContainers() {
+		return false
+	}
+	_, podname, containername, ok := w.parser.ParsePath(path)
+	return ok && !(f.MatchPod(podname) && f.MatchContainer(containername))
+}
+
+// setWatchFilter sets the filter for ignoreFile. If it had or has pod or container rules, the watched
+// directories are added again to watch log files that are no longer dropped.
+func (w *Watcher) setWatchFilter(f Filter) error {
+	old, _ := w.unwatched.Load().(Filter)
+	w.unwatched.Store(f)
+	if !old.FiltersPods() && !old.FiltersContainers() && !f.FiltersPods() && !f.FiltersContainers() {
+		return nil
+	}
+	return w.addDirs()
+}
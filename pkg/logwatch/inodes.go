@@ -0,0 +1,40 @@
+package logwatch
+
+import (
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// inodeCollector reports the inode usage of the file system of the watched directory when collected.
+// Rotation creates files, so kubelet can't rotate logs when the file system runs out of inodes
+// even if there is free space.
+type inodeCollector struct {
+	dir         string
+	total, free *prometheus.Desc
+}
+
+func newInodeCollector(dir string) *inodeCollector {
+	labels := prometheus.Labels{"dir": dir}
+	return &inodeCollector{
+		dir:   dir,
+		total: prometheus.NewDesc("log_filesystem_inodes", "Total number of inodes of the file system of the watched log directory", nil, labels),
+		free:  prometheus.NewDesc("log_filesystem_inodes_free", "Number of free inodes of the file system of the watched log directory", nil, labels),
+	}
+}
+
+func (c *inodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.total
+	ch <- c.free
+}
+
+// Collect stats the file system, nothing is reported if that fails.
+func (c *inodeCollector) Collect(ch chan<- prometheus.Metric) {
+	total, free, err := fsinfo.Inodes(c.dir)
+	if err != nil {
+		log.V(2).Info("Can't get inode usage...", "dir", c.dir, "err", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(total))
+	ch <- prometheus.MustNewConstMetric(c.free, prometheus.GaugeValue, float64(free))
+}
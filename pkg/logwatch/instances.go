@@ -0,0 +1,117 @@
+package logwatch
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/cri"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxFirstLine limits the bytes read to find the time of the first line of a log file.
+const maxFirstLine = 64 * 1024
+
+// ContainerInstances also reports bytes logged by the current instance of each container,
+// reset to 0 when the container restarts, and the start time of the instance.
+// Instances are detected by the kubelet log file name <restart>.log,
+// only files in the kubelet pod log layout are reported.
+func ContainerInstances() Option { return func(w *Watcher) { w.instances = map[Key]*instance{} } }
+
+// instance is the current instance of a container.
+type instance struct {
+	restart int
+	bytes   float64
+	labels  prometheus.Labels
+}
+
+// newInstanceMetrics creates the metrics for ContainerInstances.
+func (w *Watcher) newInstanceMetrics() []prometheus.Collector {
+	labelNames := []string{"namespace", "podname", "containername"}
+	w.instanceBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_container_instance_bytes",
+		Help: "Bytes logged by the current instance of a container, reset to 0 when the container restarts",
+	}, labelNames)
+	w.instanceStart = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_container_instance_start_time_seconds",
+		Help: "Start time of the current instance of a container, in seconds since the epoch, from its log file",
+	}, labelNames)
+	return []prometheus.Collector{w.instanceBytes, w.instanceStart}
+}
+
+// countInstance adds bytes written to the log file key of a container instance.
+// Bytes written to an earlier instance are ignored. For a new instance that was not just created,
+// returns a read of the first line of the file for the start time.
+// Must be called with w.mu locked.
+func (w *Watcher) countInstance(path string, key Key, namespace, podname, containername string, created bool, add float64) contentRead {
+	restart, err := strconv.Atoi(strings.TrimSuffix(key.File, ".log"))
+	if w.instances == nil || key.PodUID == "" || err != nil {
+		return nil
+	}
+	ck := Key{PodUID: key.PodUID, Container: key.Container}
+	inst := w.instances[ck]
+	if inst != nil && restart < inst.restart {
+		return nil
+	}
+	var read contentRead
+	if inst == nil || restart > inst.restart {
+		inst = &instance{restart: restart, labels: prometheus.Labels{"namespace": namespace, "podname": podname, "containername": containername}}
+		w.instances[ck] = inst
+		w.instanceStart.Delete(inst.labels)
+		if created {
+			w.setInstanceStart(ck, inst, time.Now())
+		} else {
+			read = func() func() {
+				start, ok := firstLineTime(w.fs, path)
+				if !ok {
+					return nil
+				}
+				return func() { w.setInstanceStart(ck, inst, start) }
+			}
+		}
+	}
+	inst.bytes += add
+	w.instanceBytes.With(inst.labels).Set(inst.bytes)
+	return read
+}
+
+// setInstanceStart sets the start time of inst, unless it is no longer the current instance of container ck.
+// Must be called with w.mu locked.
+func (w *Watcher) setInstanceStart(ck Key, inst *instance, start time.Time) {
+	if w.instances[ck] == inst {
+		w.instanceStart.With(inst.labels).Set(float64(start.UnixNano()) / float64(time.Second))
+	}
+}
+
+// removeInstances deletes the instances of pod uid and their series.
+// Must be called with w.mu locked.
+func (w *Watcher) removeInstances(uid string) {
+	for ck, inst := range w.instances {
+		if ck.PodUID == uid {
+			delete(w.instances, ck)
+			w.instanceBytes.Delete(inst.labels)
+			w.instanceStart.Delete(inst.labels)
+		}
+	}
+}
+
+// firstLineTime returns the time of the first line of a CRI log file.
+func firstLineTime(fs symnotify.FS, path string) (time.Time, bool) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	line, err := bufio.NewReaderSize(f, maxFirstLine).ReadSlice('\n')
+	if err != nil {
+		return time.Time{}, false
+	}
+	var p cri.Parser
+	records, err := p.Parse(line)
+	if err != nil || len(records) == 0 {
+		return time.Time{}, false
+	}
+	return records[0].Time, true
+}
@@ -0,0 +1,100 @@
+package logwatch
+
+import (
+	"sort"
+	"time"
+)
+
+// KeepInventory keeps a record of every pod with counted log files, see Inventory.
+// Records are kept after the pod is removed, for audits of what ran on the node
+// independent of the API server's history. At most max pods are kept, the pods last seen
+// longest ago are dropped first. A max <= 0 keeps all pods.
+func KeepInventory(max int) Option {
+	return func(w *Watcher) { w.inventory = &inventory{max: max, pods: map[string]*PodRecord{}} }
+}
+
+// PodRecord is the inventory record of a pod, see KeepInventory.
+type PodRecord struct {
+	UID        string    `json:"uid"`
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	FirstSeen  time.Time `json:"firstSeen"`         // First time a log file of the pod was counted.
+	LastSeen   time.Time `json:"lastSeen"`          // Last time a log file of the pod was counted.
+	Containers []string  `json:"containers"`        // Sorted names of containers with log files.
+	Bytes      float64   `json:"bytes"`             // Bytes counted for the pod while the exporter ran.
+	Removed    bool      `json:"removed,omitempty"` // The pod's log files are gone.
+}
+
+// inventory is the state of KeepInventory, guarded by Watcher.mu.
+type inventory struct {
+	max  int
+	pods map[string]*PodRecord
+}
+
+// record adds bytes counted for container of pod uid at now.
+func (inv *inventory) record(uid, namespace, podname, container string, add float64, now time.Time) {
+	if inv == nil || uid == "" {
+		return
+	}
+	r := inv.pods[uid]
+	if r == nil {
+		inv.evict()
+		r = &PodRecord{UID: uid, Namespace: namespace, Name: podname, FirstSeen: now}
+		inv.pods[uid] = r
+	}
+	r.LastSeen, r.Removed = now, false
+	r.Bytes += add
+	if i := sort.SearchStrings(r.Containers, container); i == len(r.Containers) || r.Containers[i] != container {
+		r.Containers = append(r.Containers, "")
+		copy(r.Containers[i+1:], r.Containers[i:])
+		r.Containers[i] = container
+	}
+}
+
+// evict drops the pod last seen longest ago if the inventory is full, preferring removed pods.
+func (inv *inventory) evict() {
+	if inv.max <= 0 || len(inv.pods) < inv.max {
+		return
+	}
+	var oldest *PodRecord
+	for _, r := range inv.pods {
+		if oldest == nil || (r.Removed && !oldest.Removed) ||
+			(r.Removed == oldest.Removed && r.LastSeen.Before(oldest.LastSeen)) {
+			oldest = r
+		}
+	}
+	delete(inv.pods, oldest.UID)
+}
+
+// removed marks pod uid as removed.
+func (inv *inventory) removed(uid string) {
+	if inv == nil {
+		return
+	}
+	if r := inv.pods[uid]; r != nil {
+		r.Removed = true
+	}
+}
+
+// Inventory returns the records of pods seen since the Watcher started, ordered by first seen.
+// It is empty unless KeepInventory is set.
+func (w *Watcher) Inventory() []PodRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.inventory == nil {
+		return []PodRecord{}
+	}
+	records := make([]PodRecord, 0, len(w.inventory.pods))
+	for _, r := range w.inventory.pods {
+		record := *r
+		record.Containers = append([]string(nil), r.Containers...)
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].FirstSeen.Equal(records[j].FirstSeen) {
+			return records[i].FirstSeen.Before(records[j].FirstSeen)
+		}
+		return records[i].UID < records[j].UID
+	})
+	return records
+}
@@ -0,0 +1,58 @@
+package logwatch
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+)
+
+// podsRegexp matches the kubelet pod log layout /var/log/pods/<namespace>_<pod>_<uid>/<container>/<N>.log
+var podsRegexp = regexp.MustCompile(`/[^/_]+_[^/_]+_([^/_]+)/([^/]+)/([0-9]+\.log)$`)
+
+// Key identifies a log file independently of the path used to reach it.
+//
+// Files in the kubelet pod log layout are keyed by pod UID, container name and file name.
+// Other files are keyed by their real path, with symlinks resolved.
+type Key struct {
+	PodUID, Container, File string
+}
+
+// String returns the persistent form of the key: "<poduid>/<container>/<file>",
+// or the real path for keys outside the kubelet pod log layout.
+func (k Key) String() string {
+	if k.PodUID == "" {
+		return k.File
+	}
+	return strings.Join([]string{k.PodUID, k.Container, k.File}, "/")
+}
+
+// ParseKey parses the string form of a key, it is the inverse of Key.String.
+func ParseKey(s string) (Key, error) {
+	if filepath.IsAbs(s) {
+		return Key{File: s}, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return Key{}, fmt.Errorf("invalid log file key: %q", s)
+	}
+	return Key{PodUID: parts[0], Container: parts[1], File: parts[2]}, nil
+}
+
+// KeyOf returns the key for the file at path, following symlinks.
+func KeyOf(path string) (Key, error) { return keyOf(symnotify.OS, path) }
+
+// keyOf is KeyOf using fs.
+func keyOf(fs symnotify.FS, path string) (Key, error) {
+	real, err := fs.EvalSymlinks(path)
+	if err != nil {
+		return Key{}, err
+	}
+	if m := podsRegexp.FindStringSubmatch(filepath.ToSlash(real)); m != nil {
+		return Key{PodUID: m[1], Container: m[2], File: m[3]}, nil
+	}
+	real, err = filepath.Abs(real)
+	return Key{File: real}, err
+}
@@ -0,0 +1,59 @@
+package logwatch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyString(t *testing.T) {
+	for _, k := range []logwatch.Key{
+		{PodUID: "1234-abcd", Container: "foo", File: "0.log"},
+		{File: "/var/log/audit/audit.log"},
+	} {
+		k2, err := logwatch.ParseKey(k.String())
+		assert.NoError(t, err)
+		assert.Equal(t, k, k2)
+	}
+	assert.Equal(t, "1234-abcd/foo/0.log", logwatch.Key{PodUID: "1234-abcd", Container: "foo", File: "0.log"}.String())
+	for _, s := range []string{"", "a/b", "a//c", "a/b/c/d"} {
+		_, err := logwatch.ParseKey(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestKeyOfFollowsSymlinks(t *testing.T) {
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(root) }()
+
+	podDir := filepath.Join(root, "pods", "ns_pod_1234-abcd", "foo")
+	require.NoError(t, os.MkdirAll(podDir, os.ModePerm))
+	target := filepath.Join(podDir, "0.log")
+	require.NoError(t, ioutil.WriteFile(target, nil, 0600))
+	link := filepath.Join(root, "pod_ns_foo-0123.log")
+	require.NoError(t, os.Symlink(target, link))
+
+	want := logwatch.Key{PodUID: "1234-abcd", Container: "foo", File: "0.log"}
+	for _, path := range []string{target, link} {
+		k, err := logwatch.KeyOf(path)
+		assert.NoError(t, err)
+		assert.Equal(t, want, k)
+	}
+
+	other := filepath.Join(root, "other.log")
+	require.NoError(t, ioutil.WriteFile(other, nil, 0600))
+	otherLink := filepath.Join(root, "other-link.log")
+	require.NoError(t, os.Symlink(other, otherLink))
+	k1, err := logwatch.KeyOf(other)
+	assert.NoError(t, err)
+	k2, err := logwatch.KeyOf(otherLink)
+	assert.NoError(t, err)
+	assert.Equal(t, k1, k2)
+	assert.Empty(t, k1.PodUID)
+}
@@ -0,0 +1,73 @@
+package logwatch
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IngestLatency reports the latency from the time stamp of the last line written to the log files
+// of each container, in CRI or docker json-file format, to the time the exporter counted it.
+// High latency shows buffering in the container runtime or a slow watcher, negative latency a clock
+// ahead of the node clock. Reads the bytes added like CountLines, and needs read permission on log files.
+// Lines in files that existed before Prime are not reported.
+// Only files in the kubelet pod log layout are reported.
+func IngestLatency() Option {
+	return func(w *Watcher) {
+		w.latencies = map[Key]*latency{}
+		if w.parsers == nil {
+			w.parsers = map[string]*lineParser{}
+		}
+	}
+}
+
+// latencyBuckets range from prompt writes to minutes of buffering.
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// latency is the ingestion latency of a container.
+type latency struct {
+	labels prometheus.Labels
+}
+
+// newLatencyMetrics creates the metrics for IngestLatency.
+func (w *Watcher) newLatencyMetrics() []prometheus.Collector {
+	labelNames := []string{"namespace", "podname", "containername"}
+	w.latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "log_ingest_latency_seconds",
+		Help:    "Time from the time stamp of the last line written to the log files of a container to when it was counted",
+		Buckets: latencyBuckets,
+	}, labelNames)
+	w.lastLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_ingest_last_latency_seconds",
+		Help: "Latest time from the time stamp of the last line written to the log files of a container to when it was counted, negative if the time stamp is in the future",
+	}, labelNames)
+	return []prometheus.Collector{w.latency, w.lastLatency}
+}
+
+// observeLatency observes the latency d of the last line written to the log file key of a container.
+// Must be called with w.mu locked.
+func (w *Watcher) observeLatency(key Key, namespace, podname, containername string, d time.Duration) {
+	if w.latencies == nil || key.PodUID == "" {
+		return
+	}
+	ck := Key{PodUID: key.PodUID, Container: key.Container}
+	l := w.latencies[ck]
+	if l == nil {
+		l = &latency{labels: prometheus.Labels{"namespace": namespace, "podname": podname, "containername": containername}}
+		w.latencies[ck] = l
+	}
+	w.latency.With(l.labels).Observe(d.Seconds())
+	w.lastLatency.With(l.labels).Set(d.Seconds())
+}
+
+// removeLatencies deletes the latencies of pod uid and their series.
+// Must be called with w.mu locked.
+func (w *Watcher) removeLatencies(uid string) {
+	for ck, l := range w.latencies {
+		if ck.PodUID == uid {
+			delete(w.latencies, ck)
+			w.latency.Delete(l.labels)
+			w.lastLatency.Delete(l.labels)
+		}
+	}
+}
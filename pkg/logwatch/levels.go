@@ -0,0 +1,190 @@
+package logwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/cri"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CountLevels counts lines by level, implies CountLines. log_logged_lines_total gets a "level" label,
+// guessed by cri.Level from the content of each line in CRI or docker json-file format.
+// Lines in neither format are counted with the level of the whole line.
+func CountLevels() Option {
+	return func(w *Watcher) {
+		w.countLines, w.levels = true, true
+		if w.parsers == nil {
+			w.parsers = map[string]*lineParser{}
+		}
+	}
+}
+
+// lineParser parses the lines of a log file in CRI or docker json-file format.
+type lineParser struct {
+	cri     cri.Parser
+	pending []byte // Start of the incomplete last line, up to lineBuffer bytes.
+	skipped int    // Bytes of the incomplete last line after pending.
+}
+
+// dockerLine is a line of a docker json-file log.
+type dockerLine struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// parse parses data appended to the file and calls f with the record of each complete line.
+// A line longer than lineBuffer is parsed from its first lineBuffer bytes, but counts all its bytes.
+func (p *lineParser) parse(data []byte, f func(cri.Record)) {
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			p.hold(data)
+			return
+		}
+		if p.incomplete() == 0 {
+			f(p.line(data[:i+1]))
+		} else {
+			p.hold(data[:i])
+			r := p.line(append(p.pending, '\n'))
+			r.Bytes += p.skipped
+			f(r)
+			p.pending, p.skipped = nil, 0
+		}
+		data = data[i+1:]
+	}
+}
+
+// hold keeps the start of the incomplete last line, up to lineBuffer bytes, and counts the rest.
+func (p *lineParser) hold(data []byte) {
+	n := lineBuffer - len(p.pending)
+	if n > len(data) {
+		n = len(data)
+	}
+	p.pending = append(p.pending, data[:n]...)
+	p.skipped += len(data) - n
+}
+
+// incomplete returns the number of bytes in the incomplete last line.
+func (p *lineParser) incomplete() int { return len(p.pending) + p.skipped }
+
+// line parses a single line including the newline.
+func (p *lineParser) line(line []byte) cri.Record {
+	var d dockerLine
+	if line[0] == '{' && json.Unmarshal(line, &d) == nil {
+		content := bytes.TrimSuffix([]byte(d.Log), []byte("\n"))
+		return cri.Record{Time: d.Time, Stream: d.Stream, Partial: !bytes.HasSuffix([]byte(d.Log), []byte("\n")),
+			Level: cri.Level(content), Content: content, Bytes: len(line)}
+	}
+	if records, err := p.cri.Parse(line); err == nil && len(records) == 1 {
+		return records[0]
+	}
+	content := bytes.TrimSuffix(line, []byte("\n"))
+	return cri.Record{Level: cri.Level(content), Content: content, Bytes: len(line)}
+}
+
+// parseFile parses n bytes of the file at path from offset and returns the number of bytes read.
+// A file that is shorter than expected is parsed up to its end.
+func (p *lineParser) parseFile(fs symnotify.FS, path string, offset, n int64, f func(cri.Record)) (int64, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := io.LimitReader(file, n)
+	buf := make([]byte, lineBuffer)
+	var read int64
+	for {
+		m, err := r.Read(buf)
+		read += int64(m)
+		p.parse(buf[:m], f)
+		if err == io.EOF {
+			return read, nil
+		} else if err != nil {
+			return read, err
+		}
+	}
+}
+
+// lineKind is the stream and level of a line.
+type lineKind struct{ stream, level string }
+
+// parseLines returns a read that parses the lines in the add bytes of path before size, to count them
+// by level for CountLevels, by stream for StreamLabel and observe their latency for IngestLatency.
+// The parser of path is only used with the path lock held. Must be called with w.mu locked.
+func (w *Watcher) parseLines(path string, key Key, namespace, podname, containername string, labels prometheus.Labels, fstype string, size, add float64) contentRead {
+	if w.parsers == nil || add <= 0 {
+		return nil
+	}
+	lines := map[lineKind]int{}
+	streamBytes := map[string]int{}
+	p := w.parsers[path]
+	if p == nil || size == add {
+		if p != nil {
+			streamBytes[streamUnknown] += p.incomplete() // Incomplete last line of the truncated file.
+		}
+		p = &lineParser{} // New or truncated file.
+		w.parsers[path] = p
+	}
+	return func() func() {
+		var last time.Time
+		read, err := p.parseFile(w.fs, path, int64(size-add), int64(add), func(r cri.Record) {
+			stream := r.Stream
+			if stream == "" {
+				stream = streamUnknown
+			}
+			lines[lineKind{stream: stream, level: r.Level}]++
+			streamBytes[stream] += r.Bytes
+			if !r.Time.IsZero() {
+				last = r.Time
+			}
+		})
+		if err != nil {
+			log.V(2).Info("Can't parse lines in log file...", "path", path, "err", err)
+			// Bytes not read, and the incomplete line that can't be completed, are counted without a stream.
+			streamBytes[streamUnknown] += int(int64(add)-read) + p.incomplete()
+			p.pending, p.skipped = nil, 0
+		}
+		return func() {
+			if w.streams {
+				for stream, n := range streamBytes {
+					w.countStream(labels, fstype, stream, float64(n))
+				}
+			}
+			if w.lines != nil && (w.levels || w.streams) {
+				w.addParsedLines(path, labels, lines)
+			}
+			if w.primed && !last.IsZero() { // Lines in existing files are not ingested late.
+				w.observeLatency(key, namespace, podname, containername, time.Since(last))
+			}
+		}
+	}
+}
+
+// addParsedLines adds line counts by stream and level to the lines counter of path.
+// Must be called with w.mu locked.
+func (w *Watcher) addParsedLines(path string, labels prometheus.Labels, lines map[lineKind]int) {
+	for kind, n := range lines {
+		lineLabels := prometheus.Labels{}
+		for k, v := range w.withStream(labels, kind.stream) {
+			lineLabels[k] = v
+		}
+		if w.levels {
+			lineLabels["level"] = kind.level
+		}
+		counter, err := w.lines.GetMetricWith(lineLabels)
+		if err != nil {
+			log.Error(err, "Error getting lines counter", "path", path)
+			return
+		}
+		counter.Add(float64(n))
+	}
+}
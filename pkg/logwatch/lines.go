@@ -0,0 +1,75 @@
+package logwatch
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lineBuffer is the size of reads when counting lines.
+const lineBuffer = 32 * 1024
+
+// CountLines also counts newline terminated lines written to each log file, with the same labels
+// as the bytes counter. Only the bytes added since the last update are read, a line is counted
+// when its newline is written. Needs read permission on log files, unlike counting bytes.
+// Lines written to deleted files are not counted, see CountDeleted.
+func CountLines() Option { return func(w *Watcher) { w.countLines = true } }
+
+// newLinesCounter creates the counter for CountLines.
+func newLinesCounter(labelNames []string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_logged_lines_total",
+		Help: "Total number of newline terminated lines written to a single log file path, accounting for rotations",
+	}, labelNames)
+}
+
+// addLines returns a read that counts the lines in the add bytes of path before size.
+// Must be called with w.mu locked.
+func (w *Watcher) addLines(path string, labels prometheus.Labels, size, add float64) contentRead {
+	if w.lines == nil || w.levels || w.streams || add <= 0 {
+		return nil // Lines by level or stream are counted by parseLines.
+	}
+	return func() func() {
+		n, err := countLines(w.fs, path, int64(size-add), int64(add))
+		if err != nil {
+			log.V(2).Info("Can't count lines in log file...", "path", path, "err", err)
+			return nil
+		}
+		return func() {
+			counter, err := w.lines.GetMetricWith(labels)
+			if err != nil {
+				log.Error(err, "Error getting lines counter", "path", path)
+				return
+			}
+			counter.Add(float64(n))
+		}
+	}
+}
+
+// countLines returns the number of newlines in n bytes of the file at path from offset.
+// A file that is shorter than expected, for example truncated since it was examined, is counted up to its end.
+func countLines(fs symnotify.FS, path string, offset, n int64) (int, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := io.LimitReader(f, n)
+	buf := make([]byte, lineBuffer)
+	lines := 0
+	for {
+		m, err := r.Read(buf)
+		lines += bytes.Count(buf[:m], []byte{'\n'})
+		if err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return lines, err
+		}
+	}
+}
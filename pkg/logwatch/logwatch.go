@@ -0,0 +1,1285 @@
+// package logwatch watches kubernetes container log files and counts the bytes written to them.
+//
+package logwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+	"github.com/log-file-metric-exporter/pkg/procfd"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	//Reference regexp https://github.com/fabric8io/fluent-plugin-kubernetes_metadata_filter/blob/master/lib/fluent/plugin/filter_kubernetes_metadata.rb#L56, https://github.com/kubernetes/kubernetes/blob/release-1.6/pkg/kubelet/dockertools/docker.go
+	//compile k8 logfilepathname pattern
+	kubernetesregexpCompiled = regexp.MustCompile(`.var.log.containers.` + containerLinkPattern)
+)
+
+// containerLinkPattern matches the name of a kubelet container log link <pod>_<namespace>_<container>-<id>.log.
+const containerLinkPattern = `([a-z0-9][-a-z0-9]*[a-z0-9])_([^_]+)_(.+)-([a-z0-9]{64})\.log$`
+
+// moveWindow is the time to wait for a renamed file to reappear, see symnotify.Moves.
+const moveWindow = 50 * time.Millisecond
+
+const (
+	podNameIndex = iota + 1
+	namespaceIndex
+	containerNameIndex
+	dockerIndex
+)
+
+// Watcher watches a directory of container log files and counts bytes written.
+type Watcher struct {
+	dirs       []string // Watched directories, the directory passed to New first.
+	watcher    symnotify.Interface
+	fs         symnotify.FS
+	metrics    *prometheus.CounterVec
+	stale      *staleCounterVec       // Collects metrics with stale markers, nil unless StaleMarkers is set.
+	lines      *prometheus.CounterVec // Nil unless CountLines is set.
+	byFSType   *prometheus.CounterVec
+	ruleHits   *prometheus.CounterVec
+	ruleDrops  *prometheus.CounterVec
+	nsFiltered *prometheus.GaugeVec
+	appeared   prometheus.Counter
+	vanished   prometheus.Counter
+	overflows  prometheus.Counter
+	resyncs    prometheus.Counter
+	gaps       *timeGaps    // Nil unless TimeGaps is set.
+	storms     *storms      // Nil unless StormBreaker is set.
+	drain      *drain       // Nil unless NodeDrain is set.
+	grace      *deleteGrace // Nil unless DeleteGrace is set.
+	throttling *throttling  // Nil unless CPUThrottling is set.
+	inventory  *inventory   // Nil unless KeepInventory is set.
+	fileSizes  *fileSizes   // Nil unless FileSizes is set.
+	heartbeat  *heartbeat   // Nil unless Heartbeat is set.
+	ttl        *seriesTTL   // Nil unless SeriesTTL is set.
+	limiter    *updateLimit // Nil unless MinUpdateInterval is set.
+	pool       *workerPool  // Nil unless Workers is set.
+	rescanTime prometheus.Gauge
+	rescanDur  prometheus.Gauge
+	primeRatio prometheus.Gauge
+	degraded   prometheus.GaugeFunc
+	watchStats watchStats
+	registered []registration // Registered by New, unregistered by Close.
+	registry   prometheus.Registerer
+	internal   prometheus.Registerer
+	sizes      Store
+	tail       io.Writer    // If not nil, write a line for each counted delta.
+	decisions  *decisionLog // Nil unless DecisionLog is set.
+	filter     Filter
+	unwatched  atomic.Value // Filter for ignoreFile.
+	budget     *errorBudget
+	rescanAge  time.Duration // Maximum time since the last rescan for Ready, 0 means no limit.
+	watchOpts  []symnotify.Option
+	staleMarks bool
+	countLines bool
+	levels     bool            // See CountLevels.
+	streams    bool            // See StreamLabel.
+	podDir     bool            // See PodDir.
+	subdirs    bool            // Log files are in subdirectories of watched directories, see PodDir and DockerDir.
+	parser     PathParser      // See WithPathParser.
+	pathLabels *regexp.Regexp  // Extra labels from named groups, see PathLabels.
+	files      map[string]bool // Individual files to count, see Files.
+	sidecars   map[string]bool // Sidecar container names, nil unless Sidecars is set.
+	deferPrime bool
+	archives   map[string]archive // Compressed log files counted, nil unless CountArchives is set.
+	checkpoint *Checkpoint        // See RestoreCheckpoint, nil once restored.
+
+	instanceBytes, instanceStart *prometheus.GaugeVec
+	restartGaps                  *prometheus.HistogramVec
+	lastWrite                    *prometheus.GaugeVec
+	latency                      *prometheus.HistogramVec
+	lastLatency                  *prometheus.GaugeVec
+	archived                     *prometheus.CounterVec
+
+	metricOpts  prometheus.CounterOpts // Name and help of the bytes counter, see MetricName.
+	constLabels prometheus.Labels      // See ConstLabels.
+
+	pathLocks    [numPathLocks]sync.Mutex // See pathLock.
+	mu           sync.Mutex
+	closed       bool                           // Set by Close, timers that already fired do nothing.
+	keys         map[string]Key                 // Cached key for each path.
+	matched      map[string]bool                // Cached filter result for each path.
+	countDeleted bool                           // Count bytes written to deleted files.
+	ids          map[Key]fsinfo.FileID          // Identity of each file.
+	fstypes      map[Key]string                 // File system type of each file.
+	deleted      map[fsinfo.FileID]*deletedFile // Deleted files that may still be open.
+	pods         map[string]*pod                // Pods by UID.
+	podOf        map[string]string              // Pod UID for each live path.
+	missing      missingFiles                   // Paths found missing, not yet handled as removed.
+	instances    map[Key]*instance              // Current instance of each container, nil unless ContainerInstances is set.
+	lastWrites   map[Key]*lastWrite             // Last write to each container, nil unless RestartGaps is set.
+	writeTimes   map[Key]*writeTime             // Last write to each container, nil unless WriteTimes is set.
+	latencies    map[Key]*latency               // Ingestion latency of each container, nil unless IngestLatency is set.
+	parsers      map[string]*lineParser         // Line parser of each file, nil unless CountLevels or IngestLatency is set.
+	lastRescan   time.Time                      // Completion of the last successful rescan.
+	disk         diskUsage                      // Size of live files by namespace.
+	primed       bool                           // Existing files have been counted, see Prime.
+}
+
+// registration of a collector with a registry.
+type registration struct {
+	registry  prometheus.Registerer
+	collector prometheus.Collector
+}
+
+// deletedFile is a file that was deleted while we were watching it.
+type deletedFile struct {
+	path, namespace, podname, containername string
+	podUID, fstype                          string
+	size                                    float64
+}
+
+// Option configures a Watcher.
+type Option func(*Watcher)
+
+// Tail writes a line to out for each counted delta.
+func Tail(out io.Writer) Option { return func(w *Watcher) { w.tail = out } }
+
+// CountDeleted counts bytes written to deleted files that are still open, see UpdateDeleted.
+// The counter gets an extra label deleted="true" or deleted="false".
+func CountDeleted() Option { return func(w *Watcher) { w.countDeleted = true } }
+
+// WithFilter only counts log files that match f.
+func WithFilter(f Filter) Option { return func(w *Watcher) { w.filter = f } }
+
+// ErrorBudget makes Ready fail if more than fraction of updates fail over window.
+// Missing files are not counted as failures, they are expected when logs are removed.
+func ErrorBudget(fraction float64, window time.Duration) Option {
+	return func(w *Watcher) { w.budget = newErrorBudget(fraction, window) }
+}
+
+// Registry registers log file metrics with r, the default is prometheus.DefaultRegisterer.
+func Registry(r prometheus.Registerer) Option { return func(w *Watcher) { w.registry = r } }
+
+// DefaultMetricName is the default name of the counter of bytes written to each log file.
+const DefaultMetricName = "log_logged_bytes_total"
+
+// MetricName sets the name of the counter of bytes written to each log file, the default is DefaultMetricName.
+func MetricName(name string) Option { return func(w *Watcher) { w.metricOpts.Name = name } }
+
+// MetricHelp sets the help text of the counter of bytes written to each log file.
+func MetricHelp(help string) Option { return func(w *Watcher) { w.metricOpts.Help = help } }
+
+// ConstLabels adds labels with fixed values to all log file metrics registered with the Registry,
+// for example to identify the node when several watchers share a registry.
+func ConstLabels(labels prometheus.Labels) Option {
+	return func(w *Watcher) { w.constLabels = labels }
+}
+
+// InternalRegistry registers the watcher's own operational metrics with r,
+// the default is prometheus.DefaultRegisterer.
+func InternalRegistry(r prometheus.Registerer) Option { return func(w *Watcher) { w.internal = r } }
+
+// DeferPrime makes New return without counting the existing log files,
+// the caller must call Prime. Ready fails until Prime succeeds.
+func DeferPrime() Option { return func(w *Watcher) { w.deferPrime = true } }
+
+// MaxRescanAge makes Ready fail if no rescan has succeeded within age.
+func MaxRescanAge(age time.Duration) Option { return func(w *Watcher) { w.rescanAge = age } }
+
+// WatchOptions are passed to the underlying symnotify.Watcher.
+func WatchOptions(opts ...symnotify.Option) Option {
+	return func(w *Watcher) { w.watchOpts = append(w.watchOpts, opts...) }
+}
+
+// StaleMarkers reports each series deleted for a removed pod with a Prometheus stale NaN value,
+// so downstream databases see the series end instead of a gap, reducing increase() artifacts.
+// The marker is reported until the next successful update after it was first collected.
+func StaleMarkers() Option { return func(w *Watcher) { w.staleMarks = true } }
+
+// Files also counts individual log files outside the watched directory, for example an audit log.
+// Their series only have the path label set, they are not filtered.
+func Files(paths ...string) Option {
+	return func(w *Watcher) {
+		for _, path := range paths {
+			w.files[filepath.Clean(path)] = true
+		}
+	}
+}
+
+// Dirs also watches dirs, in the same layout as the directory passed to New.
+// For example container log links in a custom hostPath location as well as /var/log/containers.
+// Paths in all directories are parsed by the same PathParser. A directory already watched is ignored.
+func Dirs(dirs ...string) Option {
+	return func(w *Watcher) {
+		for _, dir := range dirs {
+			if !w.watches(dir) {
+				w.dirs = append(w.dirs, filepath.Clean(dir))
+			}
+		}
+	}
+}
+
+// watches returns true if dir is one of the watched directories.
+func (w *Watcher) watches(dir string) bool {
+	dir = filepath.Clean(dir)
+	for _, d := range w.dirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// WithStore sets the Store used for file sizes, the default is NewMemoryStore().
+func WithStore(s Store) Option { return func(w *Watcher) { w.sizes = s } }
+
+// WithWatcher uses watcher for file events instead of a new symnotify.Watcher, WatchOptions are ignored.
+// It is closed by Close. With a symnotify.Fake and WithFS, tests need no real files.
+func WithWatcher(watcher symnotify.Interface) Option { return func(w *Watcher) { w.watcher = watcher } }
+
+// WithFS sets the file system used to examine log files, the default is symnotify.OS.
+func WithFS(fs symnotify.FS) Option { return func(w *Watcher) { w.fs = fs } }
+
+// New creates a Watcher for dir and registers its metrics. See Dirs to watch more directories.
+func New(dir string, opts ...Option) (*Watcher, error) {
+	w := &Watcher{
+		dirs:     []string{filepath.Clean(dir)},
+		budget:   newErrorBudget(0, time.Minute),
+		registry: prometheus.DefaultRegisterer,
+		internal: prometheus.DefaultRegisterer,
+		sizes:    NewMemoryStore(),
+		fs:       symnotify.OS,
+		keys:     make(map[string]Key),
+		matched:  make(map[string]bool),
+		ids:      make(map[Key]fsinfo.FileID),
+		fstypes:  make(map[Key]string),
+		deleted:  make(map[fsinfo.FileID]*deletedFile),
+		pods:     make(map[string]*pod),
+		podOf:    make(map[string]string),
+		missing:  missingFiles{delay: missingDelay, since: make(map[string]time.Time)},
+		files:    make(map[string]bool),
+		disk:     newDiskUsage(),
+		metricOpts: prometheus.CounterOpts{
+			Name: DefaultMetricName,
+			Help: "Total number of bytes written to a single log file path, accounting for rotations",
+		},
+	}
+	for _, o := range opts {
+		o(w)
+	}
+	if w.parser == nil {
+		w.parser = ContainerLogs
+		if w.podDir {
+			w.parser = PodLogs
+		}
+	}
+	if p, ok := w.parser.(*dockerParser); ok {
+		p.fs = w.fs // WithFS may come after DockerDir.
+	}
+	if err := w.filter.Validate(); err != nil {
+		return nil, err
+	}
+	w.unwatched.Store(w.filter)
+	labelNames := []string{"path", "namespace", "podname", "containername"}
+	if w.countDeleted {
+		labelNames = append(labelNames, "deleted")
+	}
+	labelNames = append(labelNames, w.sidecarLabelNames()...)
+	labelNames = append(labelNames, w.pathLabelNames()...)
+	if w.constLabels != nil {
+		w.registry = prometheus.WrapRegistererWith(w.constLabels, w.registry)
+	}
+	counterLabels := labelNames
+	if w.streams {
+		counterLabels = append(append([]string{}, labelNames...), "stream")
+	}
+	w.metrics = prometheus.NewCounterVec(w.metricOpts, counterLabels)
+	w.byFSType = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_logged_bytes_by_fstype_total",
+		Help: "Total number of bytes written to log files by the file system type of the log file, for example tmpfs",
+	}, []string{"fstype"})
+	w.ruleHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_filter_rule_hits_total",
+		Help: "Number of log files matched by each filter rule",
+	}, []string{"rule"})
+	w.ruleDrops = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_filter_rule_drops_total",
+		Help: "Number of log files dropped by each filter rule",
+	}, []string{"rule"})
+	w.appeared = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_files_appeared_nonempty_total",
+		Help: "Number of log files that already contained data when first created, for example files staged with O_TMPFILE and linked in",
+	})
+	w.vanished = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_files_vanished_total",
+		Help: "Number of log files found removed without an event by a rescan, for example after an event queue overflow",
+	})
+	w.nsFiltered = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_namespace_filtered",
+		Help: "1 if logs in the namespace are dropped by namespace filters, 0 if not. Only present for observed namespaces when namespace filters are set",
+	}, []string{"namespace"})
+	if w.countLines {
+		lineLabels := counterLabels
+		if w.levels {
+			lineLabels = append(append([]string{}, counterLabels...), "level")
+		}
+		w.lines = newLinesCounter(lineLabels)
+	}
+	var metrics prometheus.Collector = w.metrics
+	if w.staleMarks {
+		w.stale = newStaleCounterVec(w.metrics, counterLabels)
+		metrics = w.stale
+	}
+	w.overflows = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_watch_overflows_total",
+		Help: "Number of times file events were lost because the event queue overflowed, each triggers a rescan",
+	})
+	w.resyncs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_watch_resyncs_total",
+		Help: "Number of times the log directory was watched again after its file system was unmounted or replaced, each triggers a rescan",
+	})
+	if err := w.register(w.registry, metrics, w.byFSType, w.nsFiltered, w.disk.bytes); err != nil {
+		return nil, err
+	}
+	if err := w.register(w.registry, w.newTrackedGauges()...); err != nil {
+		return nil, err
+	}
+	for _, dir := range w.dirs {
+		if err := w.register(w.registry, newInodeCollector(dir)); err != nil {
+			return nil, err
+		}
+	}
+	if w.lines != nil {
+		if err := w.register(w.registry, w.lines); err != nil {
+			return nil, err
+		}
+	}
+	if w.fileSizes != nil {
+		if err := w.register(w.registry, w.fileSizes.newMetrics(labelNames)); err != nil {
+			return nil, err
+		}
+	}
+	if w.instances != nil {
+		if err := w.register(w.registry, w.newInstanceMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.lastWrites != nil {
+		if err := w.register(w.registry, w.newRestartGapMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.writeTimes != nil {
+		if err := w.register(w.registry, w.newWriteTimeMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.latencies != nil {
+		if err := w.register(w.registry, w.newLatencyMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.archives != nil {
+		if err := w.register(w.registry, w.newArchiveMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.throttling.enabled() {
+		if err := w.register(w.registry, w.throttling.newMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	w.rescanTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logfilemetricexporter_last_rescan_timestamp_seconds",
+		Help: "Time the last successful rescan of log files completed, in seconds since the epoch",
+	})
+	w.rescanDur = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logfilemetricexporter_last_rescan_duration_seconds",
+		Help: "Duration of the last successful rescan of log files",
+	})
+	w.primeRatio = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logfilemetricexporter_prime_progress_ratio",
+		Help: "Fraction of the existing log files counted by the initial scan, 1 when it is complete",
+	})
+	w.degraded = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "logfilemetricexporter_watch_degraded",
+		Help: "1 if some log files are polled because the file watch limit is exhausted, see fs.inotify.max_user_watches",
+	}, func() float64 {
+		if w.watcher != nil && w.watcher.Degraded() {
+			return 1
+		}
+		return 0
+	})
+	w.watchStats = newWatchStats()
+	if err := w.register(w.internal, w.ruleHits, w.ruleDrops, w.appeared, w.vanished, w.rescanTime, w.rescanDur, w.primeRatio, w.degraded, w.overflows, w.resyncs); err != nil {
+		return nil, err
+	}
+	if err := w.register(w.internal, w.watchStats.collectors()...); err != nil {
+		return nil, err
+	}
+	if err := w.register(w.internal, newQueueDepths(func() symnotify.Interface { return w.watcher })...); err != nil {
+		return nil, err
+	}
+	if w.gaps != nil {
+		w.gaps.count = newTimeGapsCounter()
+		if err := w.register(w.internal, w.gaps.count); err != nil {
+			return nil, err
+		}
+	}
+	if w.storms.enabled() {
+		if err := w.register(w.internal, w.storms.newMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.limiter != nil {
+		if err := w.register(w.internal, w.limiter.newMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.ttl != nil {
+		if err := w.register(w.internal, w.ttl.newMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.drain != nil {
+		if err := w.register(w.internal, w.drain.newMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	if w.grace != nil {
+		if err := w.register(w.internal, w.grace.newMetrics()...); err != nil {
+			return nil, err
+		}
+	}
+	w.restoreCheckpoint()
+	if w.watcher == nil {
+		// Hooks from WatchOptions replace the watcher metrics.
+		watchOpts := append([]symnotify.Option{symnotify.WithHooks(w.watchStats.hooks()), symnotify.Moves(moveWindow), symnotify.Ignore(w.ignoreFile)}, w.watchOpts...)
+		watcher, err := symnotify.NewWatcher(watchOpts...)
+		if err != nil {
+			w.unregister()
+			return nil, err
+		}
+		w.watcher = watcher
+	}
+	if err := w.addDirs(); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	for path := range w.files {
+		if err := w.watcher.AddFile(path, symnotify.Create, symnotify.Write, symnotify.Remove, symnotify.Rename); err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+	// Count existing files now, they will not get Create events.
+	if !w.deferPrime {
+		if err := w.Prime(context.Background(), nil); err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// register collectors with r, on error unregister any already registered.
+func (w *Watcher) register(r prometheus.Registerer, collectors ...prometheus.Collector) error {
+	for _, c := range collectors {
+		if err := r.Register(c); err != nil {
+			w.unregister()
+			return err
+		}
+		w.registered = append(w.registered, registration{r, c})
+	}
+	return nil
+}
+
+func (w *Watcher) unregister() {
+	for _, r := range w.registered {
+		r.registry.Unregister(r.collector)
+	}
+	w.registered = nil
+}
+
+// Close the watcher and unregister its metrics.
+func (w *Watcher) Close() error {
+	w.unregister()
+	w.mu.Lock()
+	w.closed = true
+	w.grace.stop()
+	w.mu.Unlock()
+	return w.watcher.Close()
+}
+
+// SetFilter replaces the filter and rescans, so files that now match are counted.
+// Series already counted for files that no longer match are kept.
+// The filter is not changed if it is not valid.
+func (w *Watcher) SetFilter(f Filter) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.filter = f
+	w.matched = make(map[string]bool)
+	w.nsFiltered.Reset()
+	w.mu.Unlock()
+	if err := w.setWatchFilter(f); err != nil {
+		return err
+	}
+	return w.Rescan()
+}
+
+// addDirs adds the watched directories to the underlying watcher. Adding a directory again
+// scans it, watching entries created since without an event.
+func (w *Watcher) addDirs() error {
+	// Chmod is not needed, it is mostly noise from symlink target swaps.
+	for _, dir := range w.dirs {
+		if err := w.watcher.Add(dir, symnotify.Create, symnotify.Write, symnotify.Remove, symnotify.Rename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watches returns the paths watched by the underlying file system watcher.
+func (w *Watcher) Watches() []string { return w.watcher.WatchList() }
+
+// labels for the metrics counter. The deleted label is only present if counting deleted files,
+// path labels are only present with PathLabels.
+func (w *Watcher) labels(path, namespace, podname, containername string, deleted bool) prometheus.Labels {
+	l := prometheus.Labels{"path": path, "namespace": namespace, "podname": podname, "containername": containername}
+	if w.countDeleted {
+		l["deleted"] = fmt.Sprint(deleted)
+	}
+	w.addSidecarLabel(l, containername)
+	w.addPathLabels(l, path)
+	return l
+}
+
+// key returns the cached Key for path, or computes and caches it.
+// Must be called with w.mu locked.
+func (w *Watcher) key(path string) (Key, error) {
+	if k, ok := w.keys[path]; ok {
+		return k, nil
+	}
+	k, err := keyOf(w.fs, path)
+	if err == nil {
+		w.keys[path] = k
+	}
+	return k, err
+}
+
+// moved carries the state of a log file renamed from old to new, so the bytes already
+// counted are not counted again under the new name. The series for old is kept.
+func (w *Watcher) moved(old, new string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	oldKey, ok := w.keys[old]
+	delete(w.keys, old)
+	w.disk.remove(old)
+	w.fileSizes.remove(old)
+	delete(w.matched, old)
+	if uid, tracked := w.podOf[old]; tracked {
+		delete(w.podOf, old)
+		delete(w.pods[uid].live, old)
+	}
+	newKey, err := keyOf(w.fs, new)
+	if !ok || err != nil || newKey == oldKey {
+		return // Unknown, or a symlink renamed with the same target.
+	}
+	if _, _, _, counted := w.parser.ParsePath(new); !counted && !w.files[new] && isRotated(old, new) {
+		return // Kubelet rotation, the state stays with the live file for rotatedTail.
+	}
+	size, known := w.sizes.Get(oldKey)
+	if _, exists := w.sizes.Get(newKey); !known || exists {
+		return
+	}
+	log.V(3).Info("Log file moved...", "from", old, "to", new, "size", size)
+	w.decide(Decision{Reason: DecisionRotation, Path: new, OldPath: old, Before: size, After: size})
+	w.sizes.Set(newKey, size)
+	w.sizes.Delete(oldKey)
+	if id, ok := w.ids[oldKey]; ok {
+		w.ids[newKey] = id
+		delete(w.ids, oldKey)
+	}
+	if fstype, ok := w.fstypes[oldKey]; ok {
+		w.fstypes[newKey] = fstype
+	}
+}
+
+// forget the cached key for path, the path may now refer to a different file.
+func (w *Watcher) forget(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.keys, path)
+	delete(w.matched, path)
+}
+
+// match applies the filter to a log file, counting rule hits and drops
+// the first time each path is seen.
+func (w *Watcher) match(path, namespace, podname, containername string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if ok, cached := w.matched[path]; cached {
+		return ok
+	}
+	ok := w.filter.evaluate(namespace, podname, containername, func(rule string, hit, drop bool) {
+		if hit {
+			w.ruleHits.WithLabelValues(rule).Inc()
+		}
+		if drop {
+			w.ruleDrops.WithLabelValues(rule).Inc()
+		}
+	})
+	w.matched[path] = ok
+	if !ok {
+		w.disk.remove(path) // Counted before the filter changed.
+		w.fileSizes.remove(path)
+	}
+	if w.filter.FiltersNamespaces() {
+		filtered := 0.0
+		if !w.filter.MatchNamespace(namespace) {
+			filtered = 1
+		}
+		w.nsFiltered.WithLabelValues(namespace).Set(filtered)
+	}
+	return ok
+}
+
+// Update the counter for the file at path with the bytes written since the last update.
+func (w *Watcher) Update(path string, namespace string, podname string, containername string) error {
+	return w.update(path, namespace, podname, containername, false, nil)
+}
+
+// update is Update with created set if path was just created.
+// A newly created file that is not the file last seen for its key is counted from 0.
+// If info is not nil it is the current stat of path, otherwise path is stat-ed.
+func (w *Watcher) update(path string, namespace string, podname string, containername string, created bool, info os.FileInfo) error {
+	// Stat and read without w.mu, a slow file system only delays updates of its own files.
+	// The path lock keeps updates of the same path in order.
+	pl := w.pathLock(path)
+	pl.Lock()
+	defer pl.Unlock()
+	stat := info
+	var err error
+	if stat == nil {
+		stat, err = w.fs.Stat(path)
+	}
+	var fstype string
+	if err == nil && !w.hasFSType(path) {
+		fstype, _ = w.fs.FSType(path)
+	}
+	w.mu.Lock()
+	u, err := w.updateStat(path, namespace, podname, containername, created, stat, fstype, err)
+	w.mu.Unlock()
+	if u != nil {
+		w.readContent(u)
+	}
+	if err == nil && w.stale != nil {
+		w.stale.updated()
+	}
+	return err
+}
+
+// contentRead reads log file content for an update with w.mu unlocked. It returns a function
+// that applies the result with w.mu locked, or nil if there is nothing to apply.
+type contentRead func() (apply func())
+
+// contentUpdate is the part of an update that reads the content of the file.
+type contentUpdate struct {
+	key   Key
+	size  float64
+	reads []contentRead
+}
+
+// readContent does the reads of an update, then applies their results unless the file was
+// forgotten or changed meanwhile, for example because its pod was deleted.
+// Must be called with the path lock held and w.mu unlocked.
+func (w *Watcher) readContent(u *contentUpdate) {
+	var applies []func()
+	for _, read := range u.reads {
+		if read == nil {
+			continue
+		}
+		if apply := read(); apply != nil {
+			applies = append(applies, apply)
+		}
+	}
+	if len(applies) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if size, ok := w.sizes.Get(u.key); !ok || size != u.size {
+		return
+	}
+	for _, apply := range applies {
+		apply()
+	}
+}
+
+// hasFSType returns true if the file system type of path is known.
+func (w *Watcher) hasFSType(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key, ok := w.keys[path]
+	if ok {
+		_, ok = w.fstypes[key]
+	}
+	return ok
+}
+
+// updateStat updates the counter for path from its stat, or the error from stat.
+// fstype is the file system type of path if it was not known before the update.
+// Returns the reads of the file's content still to do, if any.
+// Must be called with the path lock held and w.mu locked.
+func (w *Watcher) updateStat(path, namespace, podname, containername string, created bool, stat os.FileInfo, fstype string, err error) (*contentUpdate, error) {
+	var add float64
+	var lastSize float64
+	var size float64
+
+	if err != nil {
+		if os.IsNotExist(err) && w.removed(path, time.Now()) {
+			w.fileDeleted(path, namespace, podname, containername)
+		}
+		return nil, err
+	}
+	w.missing.found(path)
+	if stat.IsDir() {
+		return nil, nil // Ignore directories
+	}
+	// Get the counter after stat, don't create series for files that are gone.
+	labels := w.labels(path, namespace, podname, containername, false)
+	var counter prometheus.Counter
+	if !w.streams { // Counters by stream are created by parseLines.
+		if counter, err = w.counter(labels); err != nil {
+			return nil, err
+		}
+	}
+	key, err := w.key(path)
+	if err != nil {
+		return nil, err
+	}
+	w.trackPod(path, key)
+	lastSize, known := w.sizes.Get(key)
+	size = float64(stat.Size())
+	id, hasID := fsinfo.ID(stat)
+	if known, ok := w.fstypes[key]; ok {
+		fstype = known
+	} else if fstype != "" {
+		w.fstypes[key] = fstype
+	} else { // Forgotten since the update started, the next update gets the type.
+		fstype = fsinfo.Unknown
+	}
+	// A file with a different identity than the one last seen with the same key replaced it,
+	// for example it was rotated, even if it is larger and there was no Create event.
+	// A file truncated and written past its old size between updates can't be told from growth.
+	oldID, hadID := w.ids[key]
+	replaced := known && hasID && hadID && id != oldID
+	var rotated contentRead
+	if replaced {
+		rotated = w.rotatedTail(path, key, namespace, podname, containername, oldID, lastSize, func(tail float64) {
+			if w.streams {
+				w.countStream(labels, fstype, streamUnknown, tail)
+			} else {
+				w.count(counter, labels, fstype, tail)
+			}
+		})
+		lastSize, known = 0, false
+	}
+	if known && size == lastSize && hasID && id == w.ids[key] {
+		w.disk.set(path, namespace, size)
+		w.fileSizes.set(path, labels, size)
+		return nil, nil // Duplicate event for an unchanged file.
+	}
+	if created && !known && size > 0 {
+		// The file appeared fully formed, count its existing contents once.
+		log.V(3).Info("Log file created with data...", "path", path, "size", size)
+		w.appeared.Inc()
+	}
+	w.sizes.Set(key, size)
+	w.disk.set(path, namespace, size)
+	w.fileSizes.set(path, labels, size)
+	if hasID {
+		w.ids[key] = id
+	}
+	if size > lastSize {
+		// File has grown, add the difference to the counter.
+		add = size - lastSize
+	} else if size < lastSize {
+		// File truncated, starting over. Add the size.
+		add = size
+	}
+	log.V(3).Info("For logfile in...", "path", path, "key", key, "lastsize", lastSize, "currentsize", size, "addedbytes", add)
+	if add > 0 || !known {
+		reason := DecisionGrow
+		switch {
+		case replaced:
+			reason = DecisionReplace
+		case !known:
+			reason = DecisionNewFile
+		case size < lastSize:
+			reason = DecisionTruncate
+		}
+		w.decide(Decision{Reason: reason, Path: path, Namespace: namespace, PodName: podname, ContainerName: containername, Before: lastSize, After: size, Delta: add})
+	}
+	if !w.streams {
+		w.count(counter, labels, fstype, add)
+	}
+	w.countThrottled(path, key, namespace, podname, containername, add)
+	w.recordWrite(key, namespace, podname, containername, add, stat)
+	w.inventory.record(key.PodUID, namespace, podname, containername, add, time.Now())
+	return &contentUpdate{key: key, size: size, reads: []contentRead{
+		rotated,
+		w.addLines(path, labels, size, add),
+		w.parseLines(path, key, namespace, podname, containername, labels, fstype, size, add),
+		w.countInstance(path, key, namespace, podname, containername, created, add),
+		w.restartGap(path, key, namespace, podname, containername, created, stat),
+	}}, nil
+}
+
+// counter returns the counter for labels.
+func (w *Watcher) counter(labels prometheus.Labels) (prometheus.Counter, error) {
+	if w.stale != nil {
+		w.stale.revive(labels)
+	}
+	return w.metrics.GetMetricWith(labels)
+}
+
+// count adds bytes to counter and the file system type counter.
+// Must be called with w.mu locked.
+func (w *Watcher) count(counter prometheus.Counter, labels prometheus.Labels, fstype string, add float64) {
+	counter.Add(add)
+	w.ttl.touch(labels["path"], time.Now())
+	w.byFSType.WithLabelValues(fstype).Add(add)
+	w.tailDelta(labels, add)
+}
+
+// tailDelta writes a line for a counted delta if tail is set.
+func (w *Watcher) tailDelta(labels prometheus.Labels, add float64) {
+	if w.tail == nil || add <= 0 {
+		return
+	}
+	line := fmt.Sprintf("%s path=%s namespace=%s podname=%s containername=%s",
+		time.Now().UTC().Format(time.RFC3339Nano), labels["path"], labels["namespace"], labels["podname"], labels["containername"])
+	if deleted, ok := labels["deleted"]; ok {
+		line += " deleted=" + deleted
+	}
+	fmt.Fprintf(w.tail, "%s bytes=%v\n", line, add)
+}
+
+// fileDeleted remembers a deleted file so bytes written to it while still open can be counted.
+// Removes the pod if this was its last file.
+// Must be called with w.mu locked.
+func (w *Watcher) fileDeleted(path, namespace, podname, containername string) {
+	w.disk.remove(path)
+	w.fileSizes.remove(path)
+	uid, tracked := w.podOf[path]
+	if tracked {
+		delete(w.podOf, path)
+		delete(w.pods[uid].live, path)
+		defer w.removePod(uid)
+	}
+	key, ok := w.keys[path]
+	if !ok {
+		return
+	}
+	delete(w.keys, path)
+	fstype := w.fstypes[key]
+	if fstype == fsinfo.TmpFS {
+		// A tmpfs file that reappears is a new file, count it from 0 like a rotation, not a truncation.
+		defer func() {
+			w.sizes.Delete(key)
+			delete(w.ids, key)
+		}()
+	}
+	id, ok := w.ids[key]
+	if !ok || !w.countDeleted {
+		return
+	}
+	log.V(3).Info("Tracking deleted file...", "path", path, "key", key)
+	size, _ := w.sizes.Get(key)
+	w.deleted[id] = &deletedFile{path: path, namespace: namespace, podname: podname, containername: containername, podUID: uid, fstype: fstype, size: size}
+	if tracked {
+		w.pods[uid].deleted++
+	}
+	delete(w.ids, key)
+	w.sizes.Delete(key)
+}
+
+// UpdateDeleted counts bytes written to deleted files that are still held open,
+// by scanning the proc directory. Deleted files that are no longer open are forgotten.
+// Does nothing unless the CountDeleted option was used.
+func (w *Watcher) UpdateDeleted(proc string) error {
+	if !w.countDeleted {
+		return nil
+	}
+	files, err := procfd.Deleted(proc)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	open := map[fsinfo.FileID]bool{}
+	for _, f := range files {
+		d, ok := w.deleted[f.ID]
+		if !ok {
+			continue
+		}
+		open[f.ID] = true
+		if size := float64(f.Size); size > d.size {
+			labels := w.withStream(w.labels(d.path, d.namespace, d.podname, d.containername, true), streamUnknown)
+			counter, err := w.counter(labels)
+			if err != nil {
+				return err
+			}
+			log.V(3).Info("For deleted logfile in...", "path", d.path, "lastsize", d.size, "currentsize", size, "addedbytes", size-d.size)
+			w.decide(Decision{Reason: DecisionDeletedGrow, Path: d.path, Namespace: d.namespace, PodName: d.podname, ContainerName: d.containername, Before: d.size, After: size, Delta: size - d.size})
+			w.count(counter, labels, d.fstype, size-d.size)
+			d.size = size
+		}
+	}
+	for id, d := range w.deleted {
+		if !open[id] {
+			delete(w.deleted, id)
+			if p := w.pods[d.podUID]; p != nil {
+				p.deleted--
+				w.removePod(d.podUID)
+			}
+		}
+	}
+	return nil
+}
+
+// Ready returns an error if the watcher is not healthy.
+func (w *Watcher) Ready() error {
+	now := time.Now()
+	w.mu.Lock()
+	primed := w.primed
+	w.mu.Unlock()
+	if !primed {
+		return errors.New("existing log files have not been counted yet, see Prime")
+	}
+	if f, exceeded := w.budget.exceeded(now); exceeded {
+		return fmt.Errorf("error budget exceeded: %.1f%% of updates failed in the last %v", f*100, w.budget.window)
+	}
+	if w.rescanAge > 0 {
+		w.mu.Lock()
+		last := w.lastRescan
+		w.mu.Unlock()
+		if age := now.Sub(last); age > w.rescanAge {
+			return fmt.Errorf("last successful rescan was %v ago, limit is %v", age.Round(time.Second), w.rescanAge)
+		}
+	}
+	return nil
+}
+
+// Rescan stats every file in the watched directory and updates metrics.
+// Symlink targets are stat-ed directly, so growth is counted even if no event was
+// delivered for the link, for example when the target is written from another mount namespace.
+func (w *Watcher) Rescan() error { return w.rescan(context.Background(), nil, false) }
+
+// Reconcile repairs the state of the Watcher after missed events. The watched directories are added
+// again to the underlying watcher, so entries created without an event get watches, then all files are
+// rescanned. Files removed without an event are handled as if removed, deleting the series of pods
+// with no log files left. Series of files outside the pod log layout are kept, see SeriesTTL.
+func (w *Watcher) Reconcile() error {
+	if err := w.addDirs(); err != nil {
+		return err
+	}
+	return w.Rescan()
+}
+
+// Prime counts the existing log files, it is the initial Rescan done by New unless DeferPrime is set.
+// The most recently modified files are counted first, so active containers have accurate
+// metrics soonest while idle files are counted later.
+// If progress is not nil it is called after each file with the number of files done and the total.
+// Returns ctx.Err() if ctx is done first, Prime can be called again to finish.
+func (w *Watcher) Prime(ctx context.Context, progress func(done, total int)) error {
+	err := w.rescan(ctx, func(done, total int) {
+		w.primeRatio.Set(float64(done) / float64(total))
+		if progress != nil {
+			progress(done, total)
+		}
+	}, true)
+	if err != nil {
+		return err
+	}
+	w.primeRatio.Set(1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.primed = true
+	return nil
+}
+
+// rescan is Rescan with cancellation and progress, see Prime.
+// If newestFirst is set files are updated in order of modification time, most recent first.
+// A directory that can't be listed does not stop the rescan of the others, its files are not
+// handled as removed. The first such error is returned after the rescan, which is not successful.
+func (w *Watcher) rescan(ctx context.Context, progress func(done, total int), newestFirst bool) error {
+	start := time.Now()
+	var paths, failed []string
+	var dirErr error
+	seen := map[string]bool{}
+	for _, dir := range w.dirs {
+		infos, err := w.fs.ReadDir(dir)
+		if err != nil {
+			log.Error(err, "Error listing log directory for rescan", "dir", dir)
+			if dirErr == nil {
+				dirErr = err
+			}
+			failed = append(failed, dir)
+			continue
+		}
+		for _, info := range infos {
+			path := filepath.Join(dir, info.Name())
+			if !info.IsDir() {
+				seen[path] = true
+				paths = append(paths, path)
+			} else if w.subdirs {
+				// Container log directory.
+				logs, err := w.fs.ReadDir(path)
+				if err != nil {
+					continue // Removed since listed.
+				}
+				for _, l := range logs {
+					if !l.IsDir() {
+						seen[filepath.Join(path, l.Name())] = true
+						paths = append(paths, filepath.Join(path, l.Name()))
+					}
+				}
+			}
+		}
+	}
+	for path := range w.files {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	// Files removed without an event, e.g. after an event queue overflow.
+	var missing []string
+	w.mu.Lock()
+	for path := range w.keys {
+		if !seen[path] && !withinAny(failed, path) {
+			seen[path] = true
+			missing = append(missing, path)
+		}
+	}
+	for path := range w.podOf {
+		if !seen[path] && !withinAny(failed, path) {
+			missing = append(missing, path)
+		}
+	}
+	w.mu.Unlock()
+	paths = append(paths, missing...)
+	if newestFirst {
+		w.sortNewestFirst(paths)
+	}
+	for i, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		w.updatePath(path, false, nil)
+		if progress != nil {
+			progress(i+1, len(paths))
+		}
+	}
+	end := time.Now()
+	w.mu.Lock()
+	for _, path := range missing {
+		if _, ok := w.keys[path]; !ok {
+			w.vanished.Inc()
+			w.limiter.remove(path)
+		}
+	}
+	if dirErr == nil {
+		w.lastRescan = end
+	}
+	w.mu.Unlock()
+	if dirErr != nil {
+		return dirErr
+	}
+	w.rescanTime.Set(float64(end.UnixNano()) / float64(time.Second))
+	w.rescanDur.Set(end.Sub(start).Seconds())
+	w.watchStats.rescans.Inc()
+	w.watchStats.rescanTimes.Observe(end.Sub(start).Seconds())
+	return nil
+}
+
+// sortNewestFirst sorts paths by the modification time of the files they refer to, most recent first.
+// Paths that can't be stat-ed go last.
+func (w *Watcher) sortNewestFirst(paths []string) {
+	mtimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := w.fs.Stat(path); err == nil {
+			mtimes[path] = info.ModTime()
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool { return mtimes[paths[i]].After(mtimes[paths[j]]) })
+}
+
+// Watch for events and update metrics until the watcher is closed.
+// Watcher errors are logged and do not stop watching.
+func (w *Watcher) Watch() error {
+	tick, stop := w.gaps.ticker()
+	defer stop()
+	stormTick, stopStorms := w.storms.ticker()
+	defer stopStorms()
+	throttleTick, stopThrottle := w.throttling.ticker()
+	defer stopThrottle()
+	beatTick, stopBeats := w.heartbeat.ticker()
+	defer stopBeats()
+	ttlTick, stopTTL := w.ttl.ticker()
+	defer stopTTL()
+	limitTick, stopLimit := w.limiter.ticker()
+	defer stopLimit()
+	missingTick, stopMissing := w.missing.ticker()
+	defer stopMissing()
+	stopPool := w.pool.start(w.work)
+	defer stopPool()
+	for {
+		//All logfiles with containername are added to the watcher
+		//write event for these logfiles are being watched
+		//create event gets issued for all new logfiles appear under logfilepathname /var/log/containers/
+		//For the cases new log files added, old files moved, old files deleted, you need to add/remove them from watcher as whole dir added to the watcher
+		//For new log files added write event is not getting issued
+
+		var e symnotify.Event
+		select {
+		case err := <-w.watcher.Errors():
+			log.Error(err, "Watcher error")
+			continue
+		case now := <-tick:
+			w.checkGap(now)
+			continue
+		case now := <-stormTick:
+			w.statStorms(now)
+			continue
+		case <-throttleTick:
+			w.sampleThrottling()
+			continue
+		case <-beatTick:
+			w.heartbeat.beat()
+			continue
+		case now := <-ttlTick:
+			w.expireSeries(now)
+			continue
+		case now := <-limitTick:
+			w.updateDeferred(now)
+			continue
+		case now := <-missingTick:
+			w.recheckMissing(now)
+			continue
+		case ev, ok := <-w.watcher.Events():
+			if !ok {
+				return io.EOF
+			}
+			e = ev
+		}
+
+		w.handle(e)
+		if !e.Time.IsZero() {
+			w.watchStats.latency.Observe(time.Since(e.Time).Seconds())
+		}
+	}
+}
+
+// handle a single event.
+func (w *Watcher) handle(e symnotify.Event) {
+	log.V(3).Info("Events notified for...", "e.Name", e.Name, "Event", e.Op)
+	w.watchStats.events.WithLabelValues(opLabel(e.Op)).Inc()
+	parallel := e.Op == symnotify.Write || e.Op == symnotify.Remove
+	if !parallel {
+		w.pool.wait() // Keep the order of events that may affect more than one file, see Workers.
+	}
+	if e.Op == symnotify.Overflow {
+		// Events were lost, find changes by rescanning.
+		w.overflows.Inc()
+		if err := w.Rescan(); err != nil {
+			log.Error(err, "Error rescanning log files after event overflow")
+		}
+		return
+	}
+	if e.Op == symnotify.Resync {
+		// The file system was remounted, events were lost.
+		w.resyncs.Inc()
+		if err := w.Rescan(); err != nil {
+			log.Error(err, "Error rescanning log files after the log directory was remounted")
+		}
+		return
+	}
+	if e.Op == symnotify.Rescan && w.watches(e.Name) {
+		// The directory is a symlink that was re-pointed, its entries may all have changed.
+		if err := w.Rescan(); err != nil {
+			log.Error(err, "Error rescanning log files after the log directory changed")
+		}
+		return
+	}
+	if e.Op == symnotify.Write && w.storms.suppress(e.Name, time.Now()) {
+		return // Stat-ed periodically, see StormBreaker.
+	}
+	if e.Op == symnotify.Write && w.limiter.hold(e.Name, time.Now()) {
+		return // Updated later, see MinUpdateInterval.
+	}
+	if e.Op&(symnotify.Remove|symnotify.Rename) != 0 {
+		w.storms.remove(e.Name)
+		w.limiter.remove(e.Name)
+	}
+	if e.Op == symnotify.Moved {
+		w.storms.remove(e.OldName)
+		w.limiter.remove(e.OldName)
+		w.moved(e.OldName, e.Name)
+	}
+	if e.Op&(symnotify.Create|symnotify.Rename|symnotify.Moved|symnotify.Rescan) != 0 {
+		// Path may refer to a different file, don't use the cached key.
+		w.forget(e.Name)
+	}
+	if parallel && w.pool.dispatch(e) {
+		return // Updated by a worker, see Workers.
+	}
+	w.updatePath(e.Name, e.Op&symnotify.Create != 0, e.Info)
+}
+
+// updatePath gets labels from the log file path, filters and updates metrics.
+// Set created if the path was just created, info is the stat of path if known.
+func (w *Watcher) updatePath(path string, created bool, info os.FileInfo) {
+	if w.files[path] {
+		w.recordUpdate(w.update(path, "", "", "", created, info))
+		return
+	}
+	namespace, podname, containername, ok := w.parser.ParsePath(path)
+	if !ok {
+		log.V(2).Info("filename doesn't conform with k8 logfile path name ...", "filename", path)
+		return
+	}
+	w.updateContainer(path, namespace, podname, containername, created, info)
+}
+
+// updateContainer filters and updates metrics for a container log file.
+func (w *Watcher) updateContainer(path, namespace, podname, containername string, created bool, info os.FileInfo) {
+	if !w.match(path, namespace, podname, containername) {
+		log.V(3).Info("Filtered out log file...", "filename", path)
+		return
+	}
+	err := w.update(path, namespace, podname, containername, created, info)
+	w.recordUpdate(err)
+	if err != nil {
+		log.V(2).Info("file e.Name Stat can't be checked", "filename", path)
+	}
+}
+
+// recordUpdate records the result of an update for the error budget and update error metric.
+// A file that no longer exists is not an error.
+func (w *Watcher) recordUpdate(err error) {
+	failed := err != nil && !os.IsNotExist(err)
+	w.budget.record(time.Now(), failed)
+	if failed {
+		w.watchStats.updateErrors.Inc()
+	}
+}
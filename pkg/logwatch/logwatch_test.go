@@ -0,0 +1,1657 @@
+package logwatch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/cri"
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+	"github.com/log-file-metric-exporter/pkg/mockkubelet"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fixture is a Watcher on a mock kubelet tree with private registries.
+type Fixture struct {
+	T       *testing.T
+	Tree    *mockkubelet.Tree
+	Watcher *Watcher
+	Tail    bytes.Buffer
+}
+
+func NewFixture(t *testing.T, c mockkubelet.Config, opts ...Option) *Fixture {
+	t.Helper()
+	f := &Fixture{T: t}
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+	f.Tree, err = mockkubelet.Generate(root, c)
+	require.NoError(t, err)
+	opts = append([]Option{Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()), Tail(&f.Tail)}, opts...)
+	f.Watcher, err = New(f.Tree.Containers, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Watcher.Close() })
+	f.Watcher.missing.delay = 0 // Files removed by tests are gone at once, see TestBrieflyMissing.
+	return f
+}
+
+// Counted returns the bytes counted for container c.
+func (f *Fixture) Counted(c mockkubelet.Container) float64 {
+	f.T.Helper()
+	return testutil.ToFloat64(f.Watcher.metrics.With(f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false)))
+}
+
+// Append n bytes to the log of container c.
+func (f *Fixture) Append(c mockkubelet.Container, n int) {
+	f.T.Helper()
+	file, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(f.T, err)
+	defer file.Close()
+	_, err = mockkubelet.WriteLines(file, n)
+	require.NoError(f.T, err)
+}
+
+// TailLines returns and clears the tail output lines.
+func (f *Fixture) TailLines() []string {
+	s := strings.TrimSpace(f.Tail.String())
+	f.Tail.Reset()
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func TestCountsExistingFiles(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 2, Size: 100})
+	for _, c := range f.Tree.Logs {
+		assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), c.Link)
+	}
+	assert.Len(t, f.TailLines(), 4)
+}
+
+func TestDuplicateEventsAreIdempotent(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100})
+	c := f.Tree.Logs[0]
+	size := float64(fileSize(t, c.Path))
+	f.TailLines()
+
+	// Duplicate events for an unchanged file change nothing.
+	for _, op := range []symnotify.Op{symnotify.Create, symnotify.Create, symnotify.Write, symnotify.Write, symnotify.Chmod} {
+		f.Watcher.handle(symnotify.Event{Name: c.Link, Op: op})
+	}
+	assert.Equal(t, size, f.Counted(c))
+	assert.Empty(t, f.TailLines())
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.appeared))
+
+	// Duplicate events after a write count the write once.
+	f.Append(c, 50)
+	for i := 0; i < 3; i++ {
+		f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	}
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+	assert.Len(t, f.TailLines(), 1)
+
+	// A Rescan after dropped events counts the writes they missed.
+	f.Append(c, 50)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Rescan})
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+}
+
+func TestDuplicateCreateOfNewFile(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{})
+	tree, err := mockkubelet.Generate(f.Tree.Root, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100})
+	require.NoError(t, err)
+	c := tree.Logs[0]
+
+	// A file that appears with data is counted once, however many Create events arrive.
+	for i := 0; i < 3; i++ {
+		f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Create})
+	}
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.appeared))
+	assert.Len(t, f.TailLines(), 1)
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	return info.Size()
+}
+
+func TestNamespaceFiltered(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 3, Pods: 1, Containers: 1, Size: 100},
+		WithFilter(Filter{ExcludeNamespaces: []string{"namespace-1", "not-observed"}}))
+	assert.Equal(t, 3, testutil.CollectAndCount(f.Watcher.nsFiltered))
+	for ns, want := range map[string]float64{"namespace-0": 0, "namespace-1": 1, "namespace-2": 0} {
+		assert.Equal(t, want, testutil.ToFloat64(f.Watcher.nsFiltered.WithLabelValues(ns)), ns)
+	}
+	for _, c := range f.Tree.Logs {
+		if c.Namespace != "namespace-1" {
+			assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), c.Link)
+		}
+	}
+	assert.Len(t, f.TailLines(), 2)
+}
+
+func TestRemovedPodSeriesAreDeleted(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 2, Size: 100})
+	assert.Equal(t, 4, testutil.CollectAndCount(f.Watcher.metrics))
+	for _, c := range f.Tree.Logs {
+		if c.Pod == "pod-0" {
+			require.NoError(t, os.Remove(c.Link))
+			require.NoError(t, os.RemoveAll(filepath.Dir(filepath.Dir(c.Path))))
+		}
+	}
+	// Removed pods are found by the rescan even without events.
+	require.NoError(t, f.Watcher.Rescan())
+	assert.Equal(t, 2, testutil.CollectAndCount(f.Watcher.metrics))
+	for _, c := range f.Tree.Logs {
+		if c.Pod != "pod-0" {
+			assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), c.Link)
+		}
+	}
+	f.Watcher.mu.Lock()
+	defer f.Watcher.mu.Unlock()
+	assert.Len(t, f.Watcher.pods, 1)
+	assert.Len(t, f.Watcher.podOf, 2)
+}
+
+func TestReconcile(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100})
+	removed := f.Tree.Logs[0]
+	require.NoError(t, os.Remove(removed.Link))
+	require.NoError(t, os.RemoveAll(filepath.Dir(filepath.Dir(removed.Path))))
+	// Created without events.
+	path := filepath.Join(f.Tree.Pods, "namespace-0_pod-new_0000", "app", "0.log")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, ioutil.WriteFile(path, []byte("hello\n"), 0600))
+	c := mockkubelet.Container{Namespace: "namespace-0", Pod: "pod-new", Name: "app", Path: path,
+		Link: filepath.Join(f.Tree.Containers, "pod-new_namespace-0_app-"+strings.Repeat("0", 64)+".log")}
+	require.NoError(t, os.Symlink(path, c.Link))
+
+	require.NoError(t, f.Watcher.Reconcile())
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.vanished))
+	assert.Equal(t, 2, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, float64(fileSize(t, path)), f.Counted(c))
+	assert.Contains(t, f.Watcher.Watches(), c.Link, "new log file is watched")
+}
+
+func TestMetricOptions(t *testing.T) {
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	tree, err := mockkubelet.Generate(root, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100})
+	require.NoError(t, err)
+	registry := prometheus.NewRegistry()
+	w, err := New(tree.Containers, Registry(registry), InternalRegistry(prometheus.NewRegistry()),
+		MetricName("node_log_bytes_total"), MetricHelp("Bytes logged."), ConstLabels(prometheus.Labels{"node": "n1"}))
+	require.NoError(t, err)
+	defer w.Close()
+	w.missing.delay = 0
+	c := tree.Logs[0]
+	expect := fmt.Sprintf(`# HELP node_log_bytes_total Bytes logged.
+# TYPE node_log_bytes_total counter
+node_log_bytes_total{containername=%q,namespace=%q,node="n1",path=%q,podname=%q} %v
+`, c.Name, c.Namespace, c.Link, c.Pod, fileSize(t, c.Path))
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expect), "node_log_bytes_total"))
+
+	// Series are deleted with their pod.
+	require.NoError(t, os.Remove(c.Link))
+	require.NoError(t, os.RemoveAll(filepath.Dir(filepath.Dir(c.Path))))
+	require.NoError(t, w.Rescan())
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(""), "node_log_bytes_total"))
+
+	_, err = New(tree.Containers, Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()), MetricName("not a name"))
+	assert.Error(t, err)
+}
+
+func TestBrieflyMissing(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100})
+	f.Watcher.missing.delay = time.Hour
+	c := f.Tree.Logs[0]
+	size := float64(fileSize(t, c.Path))
+
+	// Rotated, the file is missing until the runtime creates a new one.
+	require.NoError(t, os.Rename(c.Path, c.Path+".20210101-000000"))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Rename})
+	assert.Equal(t, size, f.Counted(c), "series kept")
+	require.NoError(t, ioutil.WriteFile(c.Path, []byte("new\n"), 0600))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Create})
+	assert.Equal(t, size+4, f.Counted(c), "counting continues")
+	assert.Empty(t, f.Watcher.missing.since)
+
+	// Removed, the series is deleted when it is still missing after the delay.
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	require.NoError(t, f.Watcher.Rescan())
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+	f.Watcher.recheckMissing(time.Now())
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics), "not due")
+	f.Watcher.recheckMissing(time.Now().Add(time.Hour))
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Empty(t, f.Watcher.missing.since)
+}
+
+func TestNodeDrain(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100}, NodeDrain())
+	f.Watcher.SetDraining(true)
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.drain.gauge))
+	for _, c := range f.Tree.Logs {
+		require.NoError(t, os.Remove(c.Link))
+		require.NoError(t, os.RemoveAll(filepath.Dir(filepath.Dir(c.Path))))
+	}
+	require.NoError(t, f.Watcher.Rescan())
+	// Series are kept during the drain.
+	assert.Equal(t, 2, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, 2.0, testutil.ToFloat64(f.Watcher.drain.pendingPods))
+
+	// And deleted together when it ends.
+	f.Watcher.SetDraining(false)
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.drain.gauge))
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.drain.pendingPods))
+	f.Watcher.mu.Lock()
+	defer f.Watcher.mu.Unlock()
+	assert.Empty(t, f.Watcher.pods)
+}
+
+func TestDeleteGrace(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, DeleteGrace(time.Hour))
+	c := f.Tree.Logs[0]
+	podDir := filepath.Dir(filepath.Dir(c.Path))
+	backup := podDir + ".backup"
+	remove := func() {
+		require.NoError(t, os.Remove(c.Link))
+		require.NoError(t, os.Rename(podDir, backup))
+		f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	}
+	remove()
+	// Series are kept during the grace period.
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.grace.pendingPods))
+
+	// The pod reappears, deletion is cancelled and counting continues.
+	require.NoError(t, os.Rename(backup, podDir))
+	require.NoError(t, os.Symlink(c.Path, c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Create})
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.grace.pendingPods))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.grace.cancelled))
+	f.Append(c, 10)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+
+	// Removed for good, series are deleted when the period expires.
+	remove()
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+	f.Watcher.graceExpired(c.PodUID)
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.grace.pendingPods))
+	f.Watcher.mu.Lock()
+	defer f.Watcher.mu.Unlock()
+	assert.Empty(t, f.Watcher.pods)
+}
+
+func TestDeleteGraceClosed(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, DeleteGrace(time.Hour))
+	c := f.Tree.Logs[0]
+	require.NoError(t, os.Remove(c.Link))
+	require.NoError(t, os.RemoveAll(filepath.Dir(filepath.Dir(c.Path))))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+
+	// The timer fired and its callback waits for the lock held by Close.
+	f.Watcher.mu.Lock()
+	expired := make(chan struct{})
+	go func() {
+		defer close(expired)
+		f.Watcher.graceExpired(c.PodUID)
+	}()
+	f.Watcher.closed = true // As Close does with the lock held.
+	f.Watcher.grace.stop()
+	f.Watcher.mu.Unlock()
+	<-expired
+	require.NoError(t, f.Watcher.Close())
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics), "series not deleted after Close")
+	f.Watcher.mu.Lock()
+	defer f.Watcher.mu.Unlock()
+	assert.NotEmpty(t, f.Watcher.pods)
+}
+
+func TestCountsByFSType(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100})
+	fstype, err := fsinfo.Type(f.Tree.Root)
+	require.NoError(t, err)
+	var total float64
+	for _, c := range f.Tree.Logs {
+		total += f.Counted(c)
+	}
+	assert.Equal(t, total, testutil.ToFloat64(f.Watcher.byFSType.WithLabelValues(fstype)))
+}
+
+func TestTmpFSReplacedFileCountedFromZero(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100})
+	c := f.Tree.Logs[0]
+	size := float64(fileSize(t, c.Path))
+	key, err := KeyOf(c.Path)
+	require.NoError(t, err)
+	f.Watcher.mu.Lock()
+	f.Watcher.fstypes[key] = fsinfo.TmpFS // Pretend the log is on tmpfs.
+	f.Watcher.mu.Unlock()
+
+	// Replace the file with a larger new file, without a Create event.
+	file, err := os.Create(c.Path + ".new") // Create first, so the inode is not re-used.
+	require.NoError(t, err)
+	_, err = mockkubelet.WriteLines(file, 300)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.NoError(t, os.Rename(file.Name(), c.Path))
+	require.NoError(t, f.Watcher.Update(c.Link, c.Namespace, c.Pod, c.Name))
+	assert.Equal(t, size+float64(fileSize(t, c.Path)), f.Counted(c))
+}
+
+func TestReplacedFileCountedFromZero(t *testing.T) {
+	var decisions bytes.Buffer
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, DecisionLog(&decisions, JSONDecisions))
+	c := f.Tree.Logs[0]
+	size := float64(fileSize(t, c.Path))
+
+	// Rotated to a larger new file, without a Create event.
+	file, err := os.Create(c.Path + ".new") // Create first, so the inode is not re-used.
+	require.NoError(t, err)
+	_, err = mockkubelet.WriteLines(file, 300)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.NoError(t, os.Rename(file.Name(), c.Path))
+	decisions.Reset()
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, size+float64(fileSize(t, c.Path)), f.Counted(c))
+	assert.Contains(t, decisions.String(), `"reason":"replace"`)
+
+	// Truncated and rewritten in place, same inode.
+	require.NoError(t, os.Truncate(c.Path, 0))
+	f.Append(c, 10)
+	before := f.Counted(c)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, before+float64(fileSize(t, c.Path)), f.Counted(c))
+	assert.Contains(t, decisions.String(), `"reason":"truncate"`)
+}
+
+func TestRotatedTail(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, CountArchives())
+	c := f.Tree.Logs[0]
+	// An archive of an earlier rotation.
+	archive, err := os.Create(c.Path + ".20240101-000000.gz")
+	require.NoError(t, err)
+	gz := gzip.NewWriter(archive)
+	_, err = gz.Write(bytes.Repeat([]byte("hello\n"), 100))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, archive.Close())
+
+	// Written after the last update, then rotated and replaced by a new live file.
+	f.Append(c, 10)
+	rotated := c.Path + ".20240102-000000"
+	require.NoError(t, os.Rename(c.Path, rotated))
+	f.Watcher.handle(symnotify.Event{Name: rotated, Op: symnotify.Moved, OldName: c.Path})
+	require.NoError(t, ioutil.WriteFile(c.Path, []byte("new\n"), 0600))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Create})
+	assert.Equal(t, float64(fileSize(t, rotated)+fileSize(t, c.Path)), f.Counted(c), "rotated bytes counted once")
+	labels := prometheus.Labels{"namespace": c.Namespace, "podname": c.Pod, "containername": c.Name}
+	assert.Equal(t, 600.0, testutil.ToFloat64(f.Watcher.archived.With(labels)))
+
+	// The archive is counted once.
+	f.Append(c, 5)
+	require.NoError(t, os.Rename(c.Path, c.Path+".20240103-000000"))
+	require.NoError(t, ioutil.WriteFile(c.Path, []byte("new\n"), 0600))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, 600.0, testutil.ToFloat64(f.Watcher.archived.With(labels)))
+}
+
+func TestStaleMarkers(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100}, StaleMarkers())
+	removed := f.Tree.Logs[0]
+	require.NoError(t, os.Remove(removed.Link))
+	require.NoError(t, f.Watcher.Rescan())
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(f.Watcher.stale))
+	stale := func() (values []float64) {
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		for _, m := range families[0].GetMetric() {
+			if m.GetLabel()[2].GetValue() == removed.Link { // Labels are sorted by name.
+				values = append(values, m.GetCounter().GetValue())
+			}
+		}
+		return values
+	}
+	values := stale()
+	require.Len(t, values, 1)
+	assert.Equal(t, math.Float64bits(staleNaN), math.Float64bits(values[0]))
+	values = stale()
+	require.Len(t, values, 1, "stale marker is kept until the next update")
+	assert.Equal(t, math.Float64bits(staleNaN), math.Float64bits(values[0]))
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+
+	c := f.Tree.Logs[1]
+	f.Append(c, 10)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Empty(t, stale(), "stale marker dropped after an update")
+}
+
+func TestNamespaceDiskBytes(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 2, Pods: 1, Containers: 2, Size: 100})
+	diskBytes := func(namespace string) float64 {
+		t.Helper()
+		return testutil.ToFloat64(f.Watcher.disk.bytes.WithLabelValues(namespace))
+	}
+	onDisk := func(namespace string) (n float64) {
+		t.Helper()
+		for _, c := range f.Tree.Logs {
+			if c.Namespace == namespace {
+				n += float64(fileSize(t, c.Path))
+			}
+		}
+		return n
+	}
+	assert.Equal(t, onDisk("namespace-0"), diskBytes("namespace-0"))
+	assert.Equal(t, onDisk("namespace-1"), diskBytes("namespace-1"))
+
+	// Growth and truncation.
+	f.Append(f.Tree.Logs[0], 50)
+	require.NoError(t, os.Truncate(f.Tree.Logs[1].Path, 0))
+	require.NoError(t, f.Watcher.Rescan())
+	assert.Equal(t, onDisk("namespace-0"), diskBytes("namespace-0"))
+
+	// Removed files and filtered namespaces are not counted.
+	for _, c := range f.Tree.Logs {
+		if c.Namespace == "namespace-1" {
+			require.NoError(t, os.Remove(c.Link))
+		}
+	}
+	require.NoError(t, f.Watcher.SetFilter(Filter{ExcludeNamespaces: []string{"namespace-0"}}))
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.disk.bytes))
+	require.NoError(t, f.Watcher.SetFilter(Filter{}))
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.disk.bytes))
+	assert.Equal(t, onDisk("namespace-0"), diskBytes("namespace-0"))
+}
+
+func TestSetFilter(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 2, Pods: 1, Containers: 1, Size: 100},
+		WithFilter(Filter{ExcludeNamespaces: []string{"namespace-1"}}))
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+	require.NoError(t, f.Watcher.SetFilter(Filter{}))
+	assert.Equal(t, 2, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.nsFiltered))
+	for _, c := range f.Tree.Logs {
+		assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), c.Link)
+	}
+}
+
+func TestFilterRuleCounts(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100},
+		WithFilter(Filter{ExcludeContainerGlobs: []string{"istio-*"}}))
+	w := f.Watcher
+	hits := func(rule string) float64 { return testutil.ToFloat64(w.ruleHits.WithLabelValues(rule)) }
+	drops := func(rule string) float64 { return testutil.ToFloat64(w.ruleDrops.WithLabelValues(rule)) }
+
+	assert.True(t, w.match("/app", "ns", "pod", "app"))
+	assert.False(t, w.match("/istio", "ns", "pod", "istio-proxy"))
+	assert.Equal(t, 1.0, hits(RuleExcludeContainers))
+	assert.Equal(t, 1.0, drops(RuleExcludeContainers))
+	// Matches are cached, rules are counted once per path.
+	assert.False(t, w.match("/istio", "ns", "pod", "istio-proxy"))
+	assert.Equal(t, 1.0, hits(RuleExcludeContainers))
+	// A forgotten path is matched again.
+	w.forget("/istio")
+	assert.False(t, w.match("/istio", "ns", "pod", "istio-proxy"))
+	assert.Equal(t, 2.0, hits(RuleExcludeContainers))
+	assert.Equal(t, 2.0, drops(RuleExcludeContainers))
+
+	// A new filter invalidates the cache.
+	require.NoError(t, w.SetFilter(Filter{IncludeContainers: []string{"app"}}))
+	h, d := hits(RuleIncludeContainers), drops(RuleIncludeContainers) // Counted by the rescan of the fixture.
+	assert.True(t, w.match("/app", "ns", "pod", "app"))
+	assert.False(t, w.match("/istio", "ns", "pod", "istio-proxy"))
+	assert.Equal(t, h+1, hits(RuleIncludeContainers))
+	assert.Equal(t, d+1, drops(RuleIncludeContainers))
+	assert.Equal(t, 2.0, hits(RuleExcludeContainers))
+}
+
+func TestOverflowRescans(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100})
+	for _, c := range f.Tree.Logs {
+		f.Append(c, 50)
+	}
+	f.Watcher.handle(symnotify.Event{Op: symnotify.Overflow})
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.overflows))
+	for _, c := range f.Tree.Logs {
+		assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), c.Link)
+	}
+}
+
+func TestResyncRescans(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100})
+	for _, c := range f.Tree.Logs {
+		f.Append(c, 50)
+	}
+	f.Watcher.handle(symnotify.Event{Name: f.Tree.Containers, Op: symnotify.Resync})
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.resyncs))
+	for _, c := range f.Tree.Logs {
+		assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), c.Link)
+	}
+}
+
+func TestDirectoryRescan(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100})
+	for _, c := range f.Tree.Logs {
+		f.Append(c, 50)
+	}
+	f.Watcher.handle(symnotify.Event{Name: f.Tree.Containers, Op: symnotify.Rescan})
+	for _, c := range f.Tree.Logs {
+		assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), c.Link)
+	}
+}
+
+func TestRescanAddsAndRemoves(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100})
+	kept, gone := f.Tree.Logs[0], f.Tree.Logs[1]
+	uid := "00000000-0000-4000-8000-000000000009"
+	added := mockkubelet.Container{Namespace: "namespace-0", Pod: "pod-9", PodUID: uid, Name: "container-0", ID: strings.Repeat("9", 64)}
+	added.Path = filepath.Join(f.Tree.Pods, "namespace-0_pod-9_"+uid, "container-0", "0.log")
+	added.Link = filepath.Join(f.Tree.Containers, "pod-9_namespace-0_container-0-"+added.ID+".log")
+
+	// Changes with no events, e.g. lost in an overflow.
+	require.NoError(t, os.Remove(gone.Link))
+	require.NoError(t, os.RemoveAll(filepath.Dir(filepath.Dir(gone.Path))))
+	require.NoError(t, os.MkdirAll(filepath.Dir(added.Path), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(added.Path, []byte("hello\n"), 0600))
+	require.NoError(t, os.Symlink(added.Path, added.Link))
+	require.NoError(t, f.Watcher.Rescan())
+	assert.Equal(t, 2, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, float64(fileSize(t, kept.Path)), f.Counted(kept))
+	assert.Equal(t, 6.0, f.Counted(added))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.vanished))
+
+	require.NoError(t, os.Remove(added.Link))
+	require.NoError(t, os.RemoveAll(filepath.Dir(filepath.Dir(added.Path))))
+	f.Append(kept, 50)
+	require.NoError(t, f.Watcher.Rescan())
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, float64(fileSize(t, kept.Path)), f.Counted(kept))
+	assert.Equal(t, 2.0, testutil.ToFloat64(f.Watcher.vanished))
+}
+
+func TestStormBreaker(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, StormBreaker(3, time.Hour))
+	c := f.Tree.Logs[0]
+	write := func() {
+		f.Append(c, 1)
+		f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	}
+	for i := 0; i < 3; i++ {
+		write()
+	}
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+
+	// Too many events, switch to periodic mode.
+	write()
+	assert.Less(t, f.Counted(c), float64(fileSize(t, c.Path)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.storms.files))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.storms.suppressed))
+	f.Watcher.statStorms(time.Now())
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+
+	// A quiet window switches back to events.
+	f.Watcher.statStorms(time.Now().Add(stormWindow))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.storms.files), "storm window")
+	f.Watcher.statStorms(time.Now().Add(2 * stormWindow))
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.storms.files))
+	write()
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+}
+
+func TestMinUpdateInterval(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, MinUpdateInterval(time.Hour))
+	c := f.Tree.Logs[0]
+	write := func() {
+		f.Append(c, 1)
+		f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	}
+	write()
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), "first write")
+
+	// Writes within the interval are deferred and counted together.
+	before := f.Counted(c)
+	write()
+	write()
+	assert.Equal(t, before, f.Counted(c))
+	assert.Equal(t, 2.0, testutil.ToFloat64(f.Watcher.limiter.deferred))
+	f.Watcher.updateDeferred(time.Now())
+	assert.Equal(t, before, f.Counted(c), "not due")
+	f.Watcher.updateDeferred(time.Now().Add(time.Hour))
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+	assert.Empty(t, f.Watcher.limiter.pending)
+
+	// Removed files are forgotten.
+	write()
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	assert.Empty(t, f.Watcher.limiter.pending)
+	assert.Empty(t, f.Watcher.limiter.last)
+
+	// Also when removed without events.
+	write()
+	assert.NotEmpty(t, f.Watcher.limiter.last)
+	require.NoError(t, os.Remove(c.Link))
+	require.NoError(t, f.Watcher.Rescan())
+	assert.Empty(t, f.Watcher.limiter.last)
+}
+
+func TestMinUpdateIntervalTiny(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, MinUpdateInterval(time.Nanosecond))
+	tick, stop := f.Watcher.limiter.ticker() // Must not panic with a zero period.
+	defer stop()
+	<-tick
+}
+
+func TestWorkers(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 4, Containers: 1, Size: 100}, Workers(3))
+	stop := f.Watcher.pool.start(f.Watcher.work)
+	defer stop()
+	for i := 0; i < 10; i++ {
+		for _, c := range f.Tree.Logs {
+			f.Append(c, 10)
+			f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+		}
+	}
+	f.Watcher.pool.wait()
+	for _, c := range f.Tree.Logs {
+		assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), c.Link)
+	}
+
+	// Other events wait for dispatched events.
+	c := f.Tree.Logs[0]
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	f.Watcher.handle(symnotify.Event{Op: symnotify.Overflow})
+	assert.Equal(t, len(f.Tree.Logs)-1, testutil.CollectAndCount(f.Watcher.metrics))
+
+	// A queued event's stat is older than a later update by the Watch goroutine.
+	c = f.Tree.Logs[1]
+	stale, err := os.Stat(c.Path)
+	require.NoError(t, err)
+	f.Append(c, 10)
+	f.Watcher.updatePath(c.Link, false, nil)
+	f.Watcher.work(symnotify.Event{Name: c.Link, Op: symnotify.Write, Info: stale})
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), "not counted as truncated")
+}
+
+func TestWatchLoopMetrics(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100})
+	c := f.Tree.Logs[0]
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.watchStats.rescans), "prime")
+	f.Append(c, 10)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	f.Watcher.handle(symnotify.Event{Op: symnotify.Overflow})
+	assert.Equal(t, 2.0, testutil.ToFloat64(f.Watcher.watchStats.events.WithLabelValues("write")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.watchStats.events.WithLabelValues("overflow")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(f.Watcher.watchStats.rescans))
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.watchStats.updateErrors))
+	assert.Equal(t, "create|chmod", opLabel(symnotify.Create|symnotify.Chmod))
+
+	f.Watcher.recordUpdate(os.ErrNotExist)
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.watchStats.updateErrors), "file gone")
+	f.Watcher.recordUpdate(os.ErrPermission)
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.watchStats.updateErrors))
+}
+
+func TestTimeGaps(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, TimeGaps(time.Minute))
+	c := f.Tree.Logs[0]
+	start := time.Now()
+	f.Watcher.checkGap(start)
+	f.Watcher.checkGap(start.Add(30 * time.Second))
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.gaps.count), "regular check")
+
+	// A gap rescans and counts writes that had no events.
+	f.Append(c, 50)
+	f.Watcher.checkGap(start.Add(5 * time.Minute))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.gaps.count))
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+}
+
+func TestPrime(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 2, Size: 100}, DeferPrime())
+	c := f.Tree.Logs[0]
+	assert.Equal(t, 0.0, f.Counted(c))
+	assert.Error(t, f.Watcher.Ready())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, f.Watcher.Prime(ctx, nil))
+	assert.Error(t, f.Watcher.Ready())
+
+	var done, total int
+	require.NoError(t, f.Watcher.Prime(context.Background(), func(d, n int) { done, total = d, n }))
+	assert.Equal(t, 2, total)
+	assert.Equal(t, total, done)
+	assert.NoError(t, f.Watcher.Ready())
+	for _, c := range f.Tree.Logs {
+		assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+	}
+}
+
+func TestRescanGauges(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, MaxRescanAge(time.Hour))
+	first := testutil.ToFloat64(f.Watcher.rescanTime)
+	assert.NotZero(t, first)
+	assert.GreaterOrEqual(t, testutil.ToFloat64(f.Watcher.rescanDur), 0.0)
+	assert.NoError(t, f.Watcher.Ready())
+
+	before := float64(time.Now().UnixNano()) / float64(time.Second)
+	require.NoError(t, f.Watcher.Rescan())
+	last := testutil.ToFloat64(f.Watcher.rescanTime)
+	assert.GreaterOrEqual(t, last, before)
+	assert.GreaterOrEqual(t, last, first)
+	assert.LessOrEqual(t, testutil.ToFloat64(f.Watcher.rescanDur), float64(time.Now().UnixNano())/float64(time.Second)-before)
+
+	// A rescan older than the limit makes the watcher not ready.
+	f.Watcher.mu.Lock()
+	f.Watcher.lastRescan = time.Now().Add(-2 * time.Hour)
+	f.Watcher.mu.Unlock()
+	assert.Error(t, f.Watcher.Ready())
+	require.NoError(t, f.Watcher.Rescan())
+	assert.NoError(t, f.Watcher.Ready())
+}
+
+func TestPrimeNewestFirst(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 3, Containers: 1, Size: 100}, DeferPrime())
+	// Modified in reverse order of name.
+	now := time.Now()
+	var want []string
+	for i, c := range f.Tree.Logs {
+		mtime := now.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(c.Path, mtime, mtime))
+		want = append([]string{c.Link}, want...)
+	}
+	ratios := map[float64]bool{}
+	require.NoError(t, f.Watcher.Prime(context.Background(), func(int, int) { ratios[testutil.ToFloat64(f.Watcher.primeRatio)] = true }))
+	var got []string
+	for _, line := range f.TailLines() {
+		for _, field := range strings.Fields(line) {
+			if strings.HasPrefix(field, "path=") {
+				got = append(got, strings.TrimPrefix(field, "path="))
+			}
+		}
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, map[float64]bool{1.0 / 3: true, 2.0 / 3: true, 1: true}, ratios)
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.primeRatio))
+}
+
+func TestPathLabels(t *testing.T) {
+	re, risks, err := CheckPathLabels(`_(?P<kind>[a-z]+)-[0-9]+_container`)
+	require.NoError(t, err)
+	require.Empty(t, risks)
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, PathLabels(re))
+	c := f.Tree.Logs[0]
+	labels := f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false)
+	assert.Equal(t, "namespace", labels["kind"])
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+	assert.Equal(t, "", f.Watcher.labels("/no/match", "", "", "", false)["kind"])
+}
+
+func TestSidecars(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 2, Size: 100}, Sidecars("container-1"))
+	for _, c := range f.Tree.Logs {
+		labels := f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false)
+		assert.Equal(t, strconv.FormatBool(c.Name == "container-1"), labels["sidecar"], c.Name)
+		assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+	}
+}
+
+func TestFileState(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100})
+	c := f.Tree.Logs[0]
+	assert.Equal(t, []string{c.Link}, f.Watcher.Files())
+	s, ok, err := f.Watcher.File(filepath.Base(c.Link))
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, c.Link, s.Path)
+	assert.Equal(t, c.PodUID, s.PodUID)
+	assert.Equal(t, float64(fileSize(t, c.Path)), s.Size)
+	require.NotNil(t, s.Matched)
+	assert.True(t, *s.Matched)
+
+	_, ok, err = f.Watcher.File("missing.log")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, _, err = f.Watcher.File(c.Path)
+	assert.Equal(t, ErrOutsideRoot, err, "log file outside the watched directory")
+}
+
+func TestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	audit := filepath.Join(dir, "audit.log")
+	require.NoError(t, ioutil.WriteFile(audit, []byte("hello\n"), 0600))
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, Files(audit))
+	counted := func() float64 {
+		return testutil.ToFloat64(f.Watcher.metrics.With(f.Watcher.labels(audit, "", "", "", false)))
+	}
+	assert.Equal(t, 6.0, counted())
+	assert.Contains(t, f.Watcher.Watches(), audit)
+
+	file, err := os.OpenFile(audit, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("world\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	f.Watcher.handle(symnotify.Event{Name: audit, Op: symnotify.Write})
+	assert.Equal(t, 12.0, counted())
+}
+
+func TestMoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	audit, rotated := filepath.Join(dir, "audit.log"), filepath.Join(dir, "audit.log.1")
+	require.NoError(t, ioutil.WriteFile(audit, []byte("hello\n"), 0600))
+	f := NewFixture(t, mockkubelet.Config{}, Files(audit, rotated))
+	counted := func(path string) float64 {
+		return testutil.ToFloat64(f.Watcher.metrics.With(f.Watcher.labels(path, "", "", "", false)))
+	}
+	assert.Equal(t, 6.0, counted(audit))
+
+	// Bytes counted before the move are not counted again under the new name.
+	require.NoError(t, os.Rename(audit, rotated))
+	f.Watcher.handle(symnotify.Event{Name: rotated, Op: symnotify.Moved, OldName: audit})
+	file, err := os.OpenFile(rotated, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("world\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	f.Watcher.handle(symnotify.Event{Name: rotated, Op: symnotify.Write})
+	assert.Equal(t, 6.0, counted(audit))
+	assert.Equal(t, 6.0, counted(rotated))
+}
+
+func TestWatchStats(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 2, Size: 100})
+	// The directory and a symlink target per log.
+	assert.Equal(t, 3.0, testutil.ToFloat64(f.Watcher.watchStats.added))
+	c := f.Tree.Logs[0]
+	f.Append(c, 10)
+	go func() { _ = f.Watcher.Watch() }()
+	require.Eventually(t, func() bool { return f.Counted(c) == float64(fileSize(t, c.Path)) }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.watchStats.delivered))
+	var latency dto.Metric
+	require.NoError(t, f.Watcher.watchStats.latency.Write(&latency))
+	assert.Equal(t, uint64(1), latency.GetHistogram().GetSampleCount())
+	for _, c := range newQueueDepths(func() symnotify.Interface { return f.Watcher.watcher }) {
+		assert.Equal(t, 0.0, testutil.ToFloat64(c))
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	beats := make(chan struct{}, 1)
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, Heartbeat(time.Millisecond, func() {
+		select {
+		case beats <- struct{}{}:
+		default:
+		}
+	}))
+	go func() { _ = f.Watcher.Watch() }()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-beats:
+		case <-time.After(time.Second):
+			t.Fatal("no heartbeat")
+		}
+	}
+}
+
+func TestContainerInstances(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Restarts: 1, Size: 100}, ContainerInstances())
+	require.Len(t, f.Tree.Logs, 2)
+	old, cur := f.Tree.Logs[0], f.Tree.Logs[1]
+	labels := prometheus.Labels{"namespace": cur.Namespace, "podname": cur.Pod, "containername": cur.Name}
+	bytes := func() float64 { return testutil.ToFloat64(f.Watcher.instanceBytes.With(labels)) }
+	start := func() float64 { return testutil.ToFloat64(f.Watcher.instanceStart.With(labels)) }
+	assert.Equal(t, float64(fileSize(t, cur.Path)), bytes(), "only the current instance")
+	assert.Equal(t, float64(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Unix()), start(), "start from the first CRI line")
+
+	// Writes to an earlier instance are ignored.
+	f.Append(old, 10)
+	f.Watcher.handle(symnotify.Event{Name: old.Link, Op: symnotify.Write})
+	assert.Equal(t, float64(fileSize(t, cur.Path)), bytes())
+
+	// Restart: a new log file and link, counted from 0.
+	path := filepath.Join(filepath.Dir(cur.Path), "2.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("hello\n"), 0600))
+	link := strings.Replace(cur.Link, cur.ID, strings.Repeat("f", 64), 1)
+	require.NoError(t, os.Symlink(path, link))
+	before := time.Now()
+	f.Watcher.handle(symnotify.Event{Name: link, Op: symnotify.Create})
+	assert.Equal(t, 6.0, bytes())
+	assert.GreaterOrEqual(t, start(), float64(before.Unix()))
+
+	// Pod removed.
+	for _, c := range append(f.Tree.Logs, mockkubelet.Container{Link: link}) {
+		require.NoError(t, os.Remove(c.Link))
+		f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	}
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.instanceBytes))
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.instanceStart))
+}
+
+func TestRestartGaps(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Restarts: 1, Size: 100}, RestartGaps())
+	cur := f.Tree.Logs[1]
+	labels := prometheus.Labels{"namespace": cur.Namespace, "podname": cur.Pod, "containername": cur.Name}
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.restartGaps), "restarts before the exporter started are not observed")
+
+	// Last write a minute ago, then a restart.
+	lastWrite := time.Now().Add(-time.Minute)
+	f.Append(cur, 1)
+	require.NoError(t, os.Chtimes(cur.Path, lastWrite, lastWrite))
+	f.Watcher.handle(symnotify.Event{Name: cur.Link, Op: symnotify.Write})
+	path := filepath.Join(filepath.Dir(cur.Path), "2.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("hello\n"), 0600))
+	link := strings.Replace(cur.Link, cur.ID, strings.Repeat("f", 64), 1)
+	require.NoError(t, os.Symlink(path, link))
+	f.Watcher.handle(symnotify.Event{Name: link, Op: symnotify.Create})
+	f.Watcher.handle(symnotify.Event{Name: link, Op: symnotify.Write})
+	var m dto.Metric
+	require.NoError(t, f.Watcher.restartGaps.With(labels).(prometheus.Histogram).Write(&m))
+	assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+	assert.InDelta(t, 60.0, m.GetHistogram().GetSampleSum(), 5)
+
+	// A restart seen without a Create event starts at the time of its first line.
+	path3 := filepath.Join(filepath.Dir(cur.Path), "3.log")
+	start := time.Now().Add(30 * time.Second).UTC().Format(time.RFC3339Nano)
+	require.NoError(t, ioutil.WriteFile(path3, []byte(start+" stdout F hello\n"), 0600))
+	link3 := strings.Replace(cur.Link, cur.ID, strings.Repeat("e", 64), 1)
+	require.NoError(t, os.Symlink(path3, link3))
+	f.Watcher.handle(symnotify.Event{Name: link3, Op: symnotify.Write})
+	require.NoError(t, f.Watcher.restartGaps.With(labels).(prometheus.Histogram).Write(&m))
+	assert.Equal(t, uint64(2), m.GetHistogram().GetSampleCount())
+	assert.InDelta(t, 90.0, m.GetHistogram().GetSampleSum(), 5)
+
+	// Pod removed.
+	for _, c := range append(f.Tree.Logs, mockkubelet.Container{Link: link}, mockkubelet.Container{Link: link3}) {
+		require.NoError(t, os.Remove(c.Link))
+		f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	}
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.restartGaps))
+}
+
+func TestCPUThrottling(t *testing.T) {
+	cgroups, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(cgroups)
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, CPUThrottling(cgroups, time.Hour))
+	c := f.Tree.Logs[0]
+	dir := filepath.Join(cgroups, "kubepods.slice", "kubepods-pod"+strings.ReplaceAll(c.PodUID, "-", "_")+".slice", "crio-"+c.ID+".scope")
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	throttled := func(n int) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cpu.stat"), []byte("nr_periods 100\nnr_throttled "+strconv.Itoa(n)+"\n"), 0600))
+	}
+	ratio := f.Watcher.throttling.ratio
+
+	throttled(10)
+	f.Watcher.sampleThrottling()
+	assert.Equal(t, 0, testutil.CollectAndCount(ratio), "no earlier sample")
+
+	before := fileSize(t, c.Path)
+	f.Append(c, 100)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	throttled(14)
+	f.Watcher.sampleThrottling()
+	labels := prometheus.Labels{"namespace": c.Namespace, "podname": c.Pod, "containername": c.Name}
+	assert.Equal(t, float64(fileSize(t, c.Path)-before)/4, testutil.ToFloat64(ratio.With(labels)))
+
+	// Not throttled in the last interval.
+	f.Watcher.sampleThrottling()
+	assert.Equal(t, 0, testutil.CollectAndCount(ratio))
+
+	// Pod removed.
+	throttled(20)
+	f.Append(c, 10)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	f.Watcher.sampleThrottling()
+	assert.Equal(t, 1, testutil.CollectAndCount(ratio))
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	assert.Equal(t, 0, testutil.CollectAndCount(ratio))
+}
+
+func TestInventory(t *testing.T) {
+	start := time.Now()
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 2, Size: 100}, KeepInventory(2))
+	records := f.Watcher.Inventory()
+	require.Len(t, records, 2)
+	var total float64
+	for _, r := range records {
+		assert.Equal(t, []string{"container-0", "container-1"}, r.Containers)
+		assert.False(t, r.FirstSeen.Before(start))
+		assert.False(t, r.LastSeen.Before(r.FirstSeen))
+		assert.False(t, r.Removed)
+		total += r.Bytes
+	}
+	var size int64
+	for _, c := range f.Tree.Logs {
+		size += fileSize(t, c.Path)
+	}
+	assert.Equal(t, float64(size), total)
+
+	// Removed pods are kept.
+	c := f.Tree.Logs[0]
+	for _, l := range f.Tree.Logs {
+		if l.PodUID == c.PodUID {
+			require.NoError(t, os.Remove(l.Link))
+			f.Watcher.handle(symnotify.Event{Name: l.Link, Op: symnotify.Remove})
+		}
+	}
+	for _, r := range f.Watcher.Inventory() {
+		assert.Equal(t, r.UID == c.PodUID, r.Removed, r.UID)
+	}
+
+	// A new pod replaces the removed pod when full.
+	path := filepath.Join(f.Tree.Pods, "namespace-0_new_uid-new", "app", "0.log")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(path, []byte("hello\n"), 0600))
+	link := filepath.Join(f.Tree.Containers, "new_namespace-0_app-"+strings.Repeat("a", 64)+".log")
+	require.NoError(t, os.Symlink(path, link))
+	f.Watcher.handle(symnotify.Event{Name: link, Op: symnotify.Create})
+	records = f.Watcher.Inventory()
+	require.Len(t, records, 2)
+	assert.NotEqual(t, c.PodUID, records[0].UID)
+	assert.Equal(t, PodRecord{UID: "uid-new", Namespace: "namespace-0", Name: "new", Containers: []string{"app"}, Bytes: 6},
+		PodRecord{UID: records[1].UID, Namespace: records[1].Namespace, Name: records[1].Name, Containers: records[1].Containers, Bytes: records[1].Bytes})
+}
+
+func TestCountLines(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 1000}, CountLines())
+	c := f.Tree.Logs[0]
+	lines := func() float64 {
+		return testutil.ToFloat64(f.Watcher.lines.With(f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false)))
+	}
+	data, err := ioutil.ReadFile(c.Path)
+	require.NoError(t, err)
+	assert.Equal(t, float64(bytes.Count(data, []byte("\n"))), lines(), "existing lines")
+
+	// A partial line is counted when its newline is written.
+	before := lines()
+	file, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.WriteString("one\ntwo\nthr")
+	require.NoError(t, err)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, before+2, lines())
+	_, err = file.WriteString("ee\n")
+	require.NoError(t, err)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, before+3, lines())
+
+	// Truncated, lines are counted from the start.
+	require.NoError(t, ioutil.WriteFile(c.Path, []byte("a\n"), 0600))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, before+4, lines())
+
+	// Pod removed.
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.lines))
+}
+
+func TestLineParserLongLine(t *testing.T) {
+	line := "2021-01-01T00:00:00.000000000Z stderr F level=error " + strings.Repeat("x", 3*lineBuffer) + "\n"
+	var p lineParser
+	var records []cri.Record
+	for data := []byte(line + "2021-01-01T00:00:00.000000000Z stdout F ok\n"); len(data) > 0; {
+		n := 1000
+		if n > len(data) {
+			n = len(data)
+		}
+		p.parse(data[:n], func(r cri.Record) { records = append(records, r) })
+		data = data[n:]
+		assert.LessOrEqual(t, len(p.pending), lineBuffer)
+	}
+	require.Len(t, records, 2)
+	assert.Equal(t, "stderr", records[0].Stream)
+	assert.Equal(t, "error", records[0].Level)
+	assert.Equal(t, len(line), records[0].Bytes)
+	assert.Equal(t, "stdout", records[1].Stream)
+	assert.Equal(t, 0, p.incomplete())
+}
+
+func TestCountLevels(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, CountLevels())
+	c := f.Tree.Logs[0]
+	lines := func(level string) float64 {
+		labels := f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false)
+		labels["level"] = level
+		return testutil.ToFloat64(f.Watcher.lines.With(labels))
+	}
+	unknown := lines("unknown") // Existing lines.
+	file, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.WriteString(
+		"2021-01-01T00:00:00.000000000Z stdout F {\"level\":\"ERROR\",\"msg\":\"x\"}\n" +
+			"2021-01-01T00:00:00.000000000Z stderr F time=now level=warning msg=x\n" +
+			`{"log":"I0101 00:00:00.000000       1 main.go:1] x\n","stream":"stderr"}` + "\n" +
+			"2021-01-01T00:00:00.000000000Z stdout F [DEBUG] x\n" +
+			"2021-01-01T00:00:00.000000000Z stdout F no level\n" +
+			"2021-01-01T00:00:00.000000000Z stdout F l")
+	require.NoError(t, err)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	for level, n := range map[string]float64{"error": 1, "warning": 1, "info": 1, "debug": 1, "unknown": unknown + 1, "critical": 0} {
+		assert.Equal(t, n, lines(level), level)
+	}
+
+	// A partial line is classified when its newline is written.
+	_, err = file.WriteString("evel=fatal\n")
+	require.NoError(t, err)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, float64(1), lines("critical"))
+
+	// Pod removed.
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.lines))
+	assert.Empty(t, f.Watcher.parsers)
+}
+
+func TestIngestLatency(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, IngestLatency())
+	c := f.Tree.Logs[0]
+	labels := prometheus.Labels{"namespace": c.Namespace, "podname": c.Pod, "containername": c.Name}
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.latency), "existing lines")
+
+	file, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	defer file.Close()
+	stamp := func(d time.Duration) string { return time.Now().Add(d).UTC().Format(time.RFC3339Nano) }
+	_, err = fmt.Fprintf(file, "%v stdout F old\n%v stdout F new\n", stamp(-time.Hour), stamp(-time.Minute))
+	require.NoError(t, err)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	last := testutil.ToFloat64(f.Watcher.lastLatency.With(labels))
+	assert.True(t, last >= 60 && last < 120, "latency of the last line: %v", last)
+
+	// Clock ahead.
+	_, err = fmt.Fprintf(file, "%v stdout F future\n", stamp(time.Minute))
+	require.NoError(t, err)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.True(t, testutil.ToFloat64(f.Watcher.lastLatency.With(labels)) < 0)
+
+	// Pod removed.
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.latency))
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.lastLatency))
+}
+
+func TestStreamLabel(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 1000}, StreamLabel(), CountLines())
+	c := f.Tree.Logs[0]
+	withStream := func(stream string) prometheus.Labels {
+		return f.Watcher.withStream(f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false), stream)
+	}
+	counted := func(stream string) float64 { return testutil.ToFloat64(f.Watcher.metrics.With(withStream(stream))) }
+	lines := func(stream string) float64 { return testutil.ToFloat64(f.Watcher.lines.With(withStream(stream))) }
+	size := float64(fileSize(t, c.Path))
+	assert.Equal(t, size, counted("stdout"), "existing lines")
+	stdoutLines := lines("stdout")
+
+	// A partial line is counted when its newline is written.
+	file, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	defer file.Close()
+	errLine, outLine := "2021-01-01T00:00:00.000000000Z stderr F oops\n", "2021-01-01T00:00:00.000000000Z stdout F ok\n"
+	_, err = file.WriteString(errLine + outLine[:10])
+	require.NoError(t, err)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, float64(len(errLine)), counted("stderr"))
+	assert.Equal(t, float64(1), lines("stderr"))
+	assert.Equal(t, size, counted("stdout"))
+	_, err = file.WriteString(outLine[10:] + "plain\n")
+	require.NoError(t, err)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, size+float64(len(outLine)), counted("stdout"))
+	assert.Equal(t, stdoutLines+1, lines("stdout"))
+	assert.Equal(t, float64(len("plain\n")), counted(streamUnknown))
+
+	// Pod removed.
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.lines))
+}
+
+func TestStreamLabelUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any file")
+	}
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 1000}, StreamLabel())
+	c := f.Tree.Logs[0]
+	counted := func(stream string) float64 {
+		return testutil.ToFloat64(f.Watcher.metrics.With(f.Watcher.withStream(f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false), stream)))
+	}
+	size := counted("stdout")
+	require.NoError(t, os.Chmod(c.Path, 0200))
+	f.Append(c, 100)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, size, counted("stdout"))
+	assert.Equal(t, float64(fileSize(t, c.Path))-size, counted(streamUnknown), "unread bytes")
+}
+
+func TestStreamLabelRemoved(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 1000}, StreamLabel())
+	c := f.Tree.Logs[0]
+	labels := f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false)
+	counted := func(stream string) float64 {
+		return testutil.ToFloat64(f.Watcher.metrics.With(f.Watcher.withStream(labels, stream)))
+	}
+	size := counted("stdout")
+	require.NotNil(t, f.Watcher.parsers[c.Link])
+	f.Watcher.parsers[c.Link].pending = []byte("partial")
+	require.NoError(t, os.Remove(c.Path))
+
+	parse := func(size, add float64) {
+		f.Watcher.mu.Lock()
+		read := f.Watcher.parseLines(c.Link, Key{}, c.Namespace, c.Pod, c.Name, labels, "", size, add)
+		f.Watcher.mu.Unlock()
+		apply := read()
+		f.Watcher.mu.Lock()
+		apply()
+		f.Watcher.mu.Unlock()
+	}
+
+	// File removed before it is read.
+	parse(size+100, 100)
+	assert.Equal(t, size, counted("stdout"))
+	assert.Equal(t, float64(100+len("partial")), counted(streamUnknown), "unread bytes and incomplete line")
+
+	// Incomplete line dropped when the file is truncated.
+	f.Watcher.parsers[c.Link].pending = []byte("partial")
+	parse(10, 10)
+	assert.Equal(t, float64(100+len("partial")+10+len("partial")), counted(streamUnknown))
+}
+
+func TestDirs(t *testing.T) {
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	other, err := mockkubelet.Generate(root, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100})
+	require.NoError(t, err)
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 200}, Dirs(other.Containers, other.Containers))
+	assert.Equal(t, 2, len(f.Watcher.dirs), "duplicate ignored")
+	c, o := f.Tree.Logs[0], other.Logs[0]
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+	assert.Equal(t, float64(fileSize(t, o.Path)), f.Counted(o))
+
+	go func() { _ = f.Watcher.Watch() }()
+	f.Append(o, 50)
+	require.Eventually(t, func() bool { return f.Counted(o) == float64(fileSize(t, o.Path)) }, time.Second, 10*time.Millisecond)
+
+	state, ok, err := f.Watcher.File(o.Link)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, float64(fileSize(t, o.Path)), state.Size)
+	_, _, err = f.Watcher.File(filepath.Join(root, "elsewhere.log"))
+	assert.Equal(t, ErrOutsideRoot, err)
+}
+
+func TestRescanDirError(t *testing.T) {
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	other, err := mockkubelet.Generate(root, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100})
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(other.Logs[0].Link)) // Same pod UID as the fixture.
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 200}, Dirs(other.Containers))
+	c, o := f.Tree.Logs[0], other.Logs[1]
+	last := testutil.ToFloat64(f.Watcher.rescanTime)
+
+	// A directory that can't be listed does not stop the rescan of the others.
+	f.Append(c, 50)
+	require.NoError(t, os.RemoveAll(other.Containers))
+	assert.Error(t, f.Watcher.Rescan())
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+	assert.Equal(t, float64(fileSize(t, o.Path)), f.Counted(o), "not handled as removed")
+	assert.Equal(t, 0.0, testutil.ToFloat64(f.Watcher.vanished))
+	assert.Equal(t, last, testutil.ToFloat64(f.Watcher.rescanTime), "not successful")
+}
+
+func TestWriteTimes(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, WriteTimes())
+	c := f.Tree.Logs[0]
+	labels := prometheus.Labels{"namespace": c.Namespace, "podname": c.Pod, "containername": c.Name}
+	lastWrite := func() float64 { return testutil.ToFloat64(f.Watcher.lastWrite.With(labels)) }
+	mtime := func() float64 {
+		info, err := os.Stat(c.Path)
+		require.NoError(t, err)
+		return float64(info.ModTime().UnixNano()) / float64(time.Second)
+	}
+	assert.Equal(t, mtime(), lastWrite())
+
+	later := time.Now().Add(time.Hour)
+	f.Append(c, 10)
+	require.NoError(t, os.Chtimes(c.Path, later, later))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, mtime(), lastWrite())
+
+	// Pod removed.
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.lastWrite))
+}
+
+func TestTracked(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 2, Size: 100})
+	files, containers := f.Watcher.tracked()
+	assert.Equal(t, 4, files)
+	assert.Equal(t, 4, containers)
+
+	c := f.Tree.Logs[0]
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	files, containers = f.Watcher.tracked()
+	assert.Equal(t, 3, files)
+	assert.Equal(t, 3, containers)
+}
+
+func TestFileSizes(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 2, Size: 1000}, FileSizes())
+	c := f.Tree.Logs[0]
+	size := func(c mockkubelet.Container) float64 {
+		return testutil.ToFloat64(f.Watcher.fileSizes.bytes.With(f.Watcher.labels(c.Link, c.Namespace, c.Pod, c.Name, false)))
+	}
+	assert.Equal(t, 2, testutil.CollectAndCount(f.Watcher.fileSizes.bytes))
+	assert.Equal(t, float64(fileSize(t, c.Path)), size(c))
+
+	f.Append(c, 100)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, float64(fileSize(t, c.Path)), size(c))
+
+	// Truncated, the gauge goes down while the counter does not.
+	require.NoError(t, ioutil.WriteFile(c.Path, []byte("a\n"), 0600))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	assert.Equal(t, 2.0, size(c))
+
+	// Deleted, the series is removed.
+	require.NoError(t, os.Remove(c.Link))
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Remove})
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.fileSizes.bytes))
+}
+
+func TestPodDir(t *testing.T) {
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	tree, err := mockkubelet.Generate(root, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 2, Size: 100})
+	require.NoError(t, err)
+	c := tree.Logs[0]
+	dir, err := FindPodDir(tree.Pods, c.PodUID)
+	require.NoError(t, err)
+	_, err = FindPodDir(tree.Pods, "nonesuch")
+	assert.Error(t, err)
+
+	w, err := New(dir, Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()), PodDir())
+	require.NoError(t, err)
+	defer w.Close()
+	counted := func(c mockkubelet.Container) float64 {
+		return testutil.ToFloat64(w.metrics.With(w.labels(c.Path, c.Namespace, c.Pod, c.Name, false)))
+	}
+	assert.Equal(t, 2, testutil.CollectAndCount(w.metrics), "only the containers of the pod")
+	for _, l := range tree.Logs {
+		if l.PodUID == c.PodUID {
+			assert.Equal(t, float64(fileSize(t, l.Path)), counted(l), l.Path)
+		}
+	}
+	file, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.WriteString("hello\n")
+	require.NoError(t, err)
+	w.handle(symnotify.Event{Name: c.Path, Op: symnotify.Write})
+	assert.Equal(t, float64(fileSize(t, c.Path)), counted(c))
+}
+
+func TestDockerDir(t *testing.T) {
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	docker, links := filepath.Join(root, "docker"), filepath.Join(root, "containers")
+	require.NoError(t, os.Mkdir(links, 0700))
+	logs := map[string]string{}
+	for _, id := range []string{strings.Repeat("a", 64), strings.Repeat("b", 64)} {
+		logs[id] = filepath.Join(docker, id, id+"-json.log")
+		require.NoError(t, os.MkdirAll(filepath.Dir(logs[id]), 0700))
+		require.NoError(t, ioutil.WriteFile(logs[id], []byte(`{"log":"hello\n","stream":"stdout"}`+"\n"), 0600))
+	}
+	link := func(id, pod string) {
+		require.NoError(t, os.Symlink(logs[id], filepath.Join(links, pod+"_ns_app-"+id+".log")))
+	}
+	a, b := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	link(a, "pod-a")
+	w, err := New(docker, Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()), DockerDir(links))
+	require.NoError(t, err)
+	defer w.Close()
+	counted := func(id, pod string) float64 {
+		return testutil.ToFloat64(w.metrics.With(w.labels(logs[id], "ns", pod, "app", false)))
+	}
+	assert.Equal(t, float64(fileSize(t, logs[a])), counted(a, "pod-a"))
+	assert.Equal(t, 1, testutil.CollectAndCount(w.metrics), "container without a link is ignored")
+
+	// A container found later is counted from the start.
+	link(b, "pod-b")
+	w.handle(symnotify.Event{Name: logs[b], Op: symnotify.Write})
+	assert.Equal(t, 1, testutil.CollectAndCount(w.metrics), "not listed again before the retry delay")
+	w.parser.(*dockerParser).missed[b] = time.Now().Add(-dockerRetry)
+	w.handle(symnotify.Event{Name: logs[b], Op: symnotify.Write})
+	assert.Equal(t, float64(fileSize(t, logs[b])), counted(b, "pod-b"))
+}
+
+func TestPodGlobs(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 2, Containers: 1, Size: 100}, WithFilter(Filter{ExcludePods: []string{"*-1"}}))
+	watched := func(pod string) bool {
+		for _, path := range f.Watcher.Watches() {
+			if strings.Contains(path, pod) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range f.Tree.Logs {
+		if c.Pod == "pod-0" {
+			assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+		}
+	}
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.True(t, watched("pod-0"))
+	assert.False(t, watched("pod-1"), "excluded pods are not watched")
+
+	require.NoError(t, f.Watcher.SetFilter(Filter{}))
+	assert.Equal(t, 2, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.True(t, watched("pod-1"))
+
+	assert.Error(t, f.Watcher.SetFilter(Filter{IncludePods: []string{"["}}))
+	_, err := New(f.Tree.Containers, WithFilter(Filter{ExcludePods: []string{"["}}))
+	assert.Error(t, err)
+}
+
+func TestContainerGlobs(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 3, Size: 100}, WithFilter(Filter{ExcludeContainerGlobs: []string{"container-[12]"}}))
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+	for _, path := range f.Watcher.Watches() {
+		assert.NotRegexp(t, "container-[12]", path, "excluded containers are not watched")
+	}
+	c := f.Tree.Logs[0]
+	require.Equal(t, "container-0", c.Name)
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c))
+}
+
+func TestCheckpoint(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 2, Size: 100})
+	c, gone := f.Tree.Logs[0], f.Tree.Logs[1]
+	f.Append(c, 10)
+	f.Watcher.handle(symnotify.Event{Name: c.Link, Op: symnotify.Write})
+	path := filepath.Join(f.Tree.Root, "checkpoint.json")
+	require.NoError(t, WriteCheckpoint(path, f.Watcher.Checkpoint()))
+	cp, err := ReadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Len(t, cp.Files, 2)
+	assert.Len(t, cp.Counters, 2)
+	require.NoError(t, f.Watcher.Close())
+
+	// Written and removed while the exporter was down.
+	f.Append(c, 10)
+	require.NoError(t, os.Remove(gone.Link))
+	w, err := New(f.Tree.Containers, Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()), RestoreCheckpoint(cp))
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, float64(fileSize(t, c.Path)), testutil.ToFloat64(w.metrics.With(w.labels(c.Link, c.Namespace, c.Pod, c.Name, false))), "counted once")
+	assert.Equal(t, 1, testutil.CollectAndCount(w.metrics), "not restored for removed files")
+	for s, file := range cp.Files {
+		k, err := ParseKey(s)
+		require.NoError(t, err)
+		_, restored := w.sizes.Get(k)
+		assert.Equal(t, file.Path != gone.Link, restored, "size restored for %v", file.Path)
+	}
+
+	_, err = ReadCheckpoint(filepath.Join(f.Tree.Root, "nonesuch"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSeriesTTL(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 2, Size: 100}, SeriesTTL(time.Minute))
+	c, gone := f.Tree.Logs[0], f.Tree.Logs[1]
+	// Removed without events, e.g. while the exporter was down.
+	require.NoError(t, os.Remove(gone.Path))
+	now := time.Now()
+	f.Watcher.expireSeries(now.Add(30 * time.Second))
+	assert.Equal(t, 2, testutil.CollectAndCount(f.Watcher.metrics), "not expired before the TTL")
+	f.Watcher.expireSeries(now.Add(2 * time.Minute))
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, float64(fileSize(t, c.Path)), f.Counted(c), "log file still exists")
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.Watcher.ttl.expired))
+	f.Watcher.expireSeries(now.Add(10 * time.Minute))
+	assert.Equal(t, 1, testutil.CollectAndCount(f.Watcher.metrics))
+
+	// The backing directory removed without events.
+	require.NoError(t, os.RemoveAll(filepath.Dir(c.Path)))
+	f.Watcher.expireSeries(now.Add(20 * time.Minute))
+	assert.Equal(t, 0, testutil.CollectAndCount(f.Watcher.metrics))
+	assert.Equal(t, 2.0, testutil.ToFloat64(f.Watcher.ttl.expired))
+}
+
+func TestSeriesTTLTiny(t *testing.T) {
+	f := NewFixture(t, mockkubelet.Config{Namespaces: 1, Pods: 1, Containers: 1, Size: 100}, SeriesTTL(time.Nanosecond))
+	tick, stop := f.Watcher.ttl.ticker() // Must not panic with a zero period.
+	defer stop()
+	<-tick
+}
+
+func TestFakeWatcher(t *testing.T) {
+	fs := symnotify.NewMemFS()
+	fake := symnotify.NewFake(fs)
+	const (
+		containers = "/var/log/containers"
+		path       = "/var/log/pods/ns_pod_0000/app/0.log"
+	)
+	link := containers + "/pod_ns_app-" + strings.Repeat("0", 64) + ".log"
+	require.NoError(t, fs.MkdirAll(containers))
+	require.NoError(t, fs.MkdirAll(filepath.Dir(path)))
+	require.NoError(t, fs.WriteFile(path, []byte("hello\n")))
+	require.NoError(t, fs.Symlink(path, link))
+	w, err := New(containers, Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()), WithFS(fs), WithWatcher(fake))
+	require.NoError(t, err)
+	defer w.Close()
+	counted := func() float64 { return testutil.ToFloat64(w.metrics.With(w.labels(link, "ns", "pod", "app", false))) }
+	handle := func() {
+		for e, ok := fake.Next(); ok; e, ok = fake.Next() {
+			w.handle(e)
+		}
+	}
+	assert.Equal(t, 6.0, counted())
+	assert.Equal(t, []string{containers}, w.Watches())
+
+	require.NoError(t, fs.Append(path, []byte("world\n")))
+	handle()
+	assert.Equal(t, 12.0, counted())
+
+	// Rotated and replaced by a new file.
+	require.NoError(t, fs.Rename(path, path+".1"))
+	require.NoError(t, fs.WriteFile(path, []byte("x\n")))
+	handle()
+	assert.Equal(t, 14.0, counted())
+}
+
+func TestFakeWatcherFSType(t *testing.T) {
+	fs := symnotify.NewMemFS()
+	fs.Type = "nfs"
+	const (
+		containers = "/var/log/containers"
+		path       = "/var/log/pods/ns_pod_0000/app/0.log"
+	)
+	link := containers + "/pod_ns_app-" + strings.Repeat("0", 64) + ".log"
+	require.NoError(t, fs.MkdirAll(containers))
+	require.NoError(t, fs.MkdirAll(filepath.Dir(path)))
+	require.NoError(t, fs.WriteFile(path, []byte("hello\n")))
+	require.NoError(t, fs.Symlink(path, link))
+	w, err := New(containers, Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()), WithFS(fs), WithWatcher(symnotify.NewFake(fs)))
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, 6.0, testutil.ToFloat64(w.byFSType.WithLabelValues("nfs")), "type from the FS")
+}
+
+func TestFakeWatcherContent(t *testing.T) {
+	fs := symnotify.NewMemFS()
+	fake := symnotify.NewFake(fs)
+	const (
+		containers = "/var/log/containers"
+		path       = "/var/log/pods/ns_pod_0000/app/0.log"
+		line       = "2021-01-01T00:00:00.000000000Z stderr F level=error x\n"
+	)
+	link := containers + "/pod_ns_app-" + strings.Repeat("0", 64) + ".log"
+	require.NoError(t, fs.MkdirAll(containers))
+	require.NoError(t, fs.MkdirAll(filepath.Dir(path)))
+	require.NoError(t, fs.WriteFile(path, []byte(line)))
+	require.NoError(t, fs.Symlink(path, link))
+	w, err := New(containers, Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()), WithFS(fs), WithWatcher(fake),
+		CountLevels(), ContainerInstances())
+	require.NoError(t, err)
+	defer w.Close()
+	labels := w.labels(link, "ns", "pod", "app", false)
+	labels["level"] = "error"
+	assert.Equal(t, 1.0, testutil.ToFloat64(w.lines.With(labels)), "lines read from the FS")
+	start := testutil.ToFloat64(w.instanceStart.With(prometheus.Labels{"namespace": "ns", "podname": "pod", "containername": "app"}))
+	assert.Equal(t, float64(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Unix()), start, "first line read from the FS")
+
+	require.NoError(t, fs.MkdirAll("/var/lib/docker/containers"))
+	d, err := New("/var/lib/docker/containers", Registry(prometheus.NewRegistry()), InternalRegistry(prometheus.NewRegistry()),
+		DockerDir(containers), WithFS(fs), WithWatcher(symnotify.NewFake(fs)))
+	require.NoError(t, err)
+	defer d.Close()
+	assert.Equal(t, fs, d.parser.(*dockerParser).fs, "docker links listed from the FS")
+}
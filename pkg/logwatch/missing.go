@@ -0,0 +1,82 @@
+package logwatch
+
+import "time"
+
+// missingDelay is how long a log file must stay missing before it is handled as removed.
+// Kubelet renames a log file before the runtime creates the new one, a stat in between fails.
+const missingDelay = time.Second
+
+// missingFiles are log files found missing that are not yet handled as removed, so a file
+// that is briefly missing while it is rotated keeps its series. Must be used with w.mu locked.
+type missingFiles struct {
+	delay time.Duration
+	since map[string]time.Time // Time each path was first found missing, zero when due.
+}
+
+// ticker returns the channel for checks of missing files, nil if there is no delay.
+func (m *missingFiles) ticker() (<-chan time.Time, func()) {
+	if m.delay <= 0 {
+		return nil, func() {}
+	}
+	t := time.NewTicker(m.delay)
+	return t.C, t.Stop
+}
+
+// confirm returns true if path, found missing at now, was already missing the delay before or is due.
+// Otherwise path is recorded as missing since now, if it was not already.
+func (m *missingFiles) confirm(path string, now time.Time) bool {
+	if m.delay <= 0 {
+		return true
+	}
+	since, ok := m.since[path]
+	if !ok {
+		m.since[path] = now
+		return false
+	}
+	if !since.IsZero() && now.Sub(since) < m.delay {
+		return false
+	}
+	delete(m.since, path)
+	return true
+}
+
+// found forgets path, it exists.
+func (m *missingFiles) found(path string) { delete(m.since, path) }
+
+// due returns the paths that have been missing for the delay at now, and records that they are due.
+func (m *missingFiles) due(now time.Time) []string {
+	var paths []string
+	for path, since := range m.since {
+		if now.Sub(since) >= m.delay {
+			paths = append(paths, path)
+			m.since[path] = time.Time{}
+		}
+	}
+	return paths
+}
+
+// removed returns true if the missing file at path is to be handled as removed, see missingFiles.
+// A path with no state is removed at once. Must be called with w.mu locked.
+func (w *Watcher) removed(path string, now time.Time) bool {
+	_, known := w.keys[path]
+	_, tracked := w.podOf[path]
+	if !known && !tracked {
+		w.missing.found(path)
+		return true
+	}
+	return w.missing.confirm(path, now)
+}
+
+// recheckMissing stats the missing files that are due at now again, they are handled as removed
+// if they are still missing.
+func (w *Watcher) recheckMissing(now time.Time) {
+	w.mu.Lock()
+	paths := w.missing.due(now)
+	w.mu.Unlock()
+	for _, path := range paths {
+		w.updatePath(path, false, nil)
+		w.mu.Lock()
+		w.missing.found(path) // Removed, found, or no longer updated, e.g. filtered.
+		w.mu.Unlock()
+	}
+}
@@ -0,0 +1,159 @@
+package logwatch
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// builtinLabels are the labels of log_logged_bytes_total that path labels must not replace.
+var builtinLabels = map[string]bool{"path": true, "namespace": true, "podname": true, "containername": true, "deleted": true, "sidecar": true}
+
+// wideClass is the number of runes above which a character class is considered free-form, e.g. [^/].
+const wideClass = 256
+
+// PathLabels adds a label to the bytes counter for each named capture group of re,
+// with the value matched in the log file path. Labels are empty if the path does not match.
+// Check re with CheckPathLabels first, labels with unbounded values can explode the number of series.
+func PathLabels(re *regexp.Regexp) Option { return func(w *Watcher) { w.pathLabels = re } }
+
+// LabelRisk is a cardinality risk of a label extracted by a path regexp.
+type LabelRisk struct {
+	Label  string
+	Reason string
+	Deny   bool // The label will almost certainly create a series per file or per rotation.
+}
+
+func (r LabelRisk) String() string { return fmt.Sprintf("label %q: %v", r.Label, r.Reason) }
+
+// CheckPathLabels compiles a PathLabels regexp and estimates the cardinality of each label.
+// Returns an error if the regexp is invalid or a group name is not a usable label name.
+//
+// A group that repeats digits, for example ([0-9]+) or (\d{8}), is denied: it captures
+// a file index, restart count or timestamp, a new series for every file or rotation.
+// A group that repeats a free-form class, for example (.*) or ([^_]+), is a warning:
+// its values are not bounded by the regexp, so they must be bounded by the file names.
+func CheckPathLabels(expr string) (*regexp.Regexp, []LabelRisk, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, nil, err
+	}
+	var risks []LabelRisk
+	named := 0
+	var check func(*syntax.Regexp) error
+	check = func(r *syntax.Regexp) error {
+		if r.Op == syntax.OpCapture && r.Name != "" {
+			named++
+			if !model.LabelName(r.Name).IsValid() {
+				return fmt.Errorf("path label %q is not a valid label name", r.Name)
+			}
+			if builtinLabels[r.Name] {
+				return fmt.Errorf("path label %q conflicts with a built-in label", r.Name)
+			}
+			switch {
+			case repeats(r, isDigitClass):
+				risks = append(risks, LabelRisk{Label: r.Name, Reason: "captures repeated digits, e.g. a file index or timestamp", Deny: true})
+			case repeats(r, isWideClass):
+				risks = append(risks, LabelRisk{Label: r.Name, Reason: "captures free-form text, values are unbounded"})
+			}
+		}
+		for _, sub := range r.Sub {
+			if err := check(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(tree); err != nil {
+		return nil, nil, err
+	}
+	if named == 0 {
+		return nil, nil, fmt.Errorf("path label regexp has no named groups: %q", expr)
+	}
+	return re, risks, nil
+}
+
+// repeats returns true if r contains a repetition of a single character class accepted by class.
+func repeats(r *syntax.Regexp, class func(*syntax.Regexp) bool) bool {
+	switch r.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		if class(r.Sub[0]) {
+			return true
+		}
+	case syntax.OpRepeat:
+		if (r.Max == -1 || r.Max > 1) && class(r.Sub[0]) {
+			return true
+		}
+	}
+	for _, sub := range r.Sub {
+		if repeats(sub, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDigitClass returns true if r only matches decimal digits.
+func isDigitClass(r *syntax.Regexp) bool {
+	if r.Op != syntax.OpCharClass || len(r.Rune) == 0 {
+		return false
+	}
+	for i := 0; i < len(r.Rune); i += 2 {
+		if r.Rune[i] < '0' || r.Rune[i+1] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isWideClass returns true if r matches any character, or a wide class such as [^/].
+func isWideClass(r *syntax.Regexp) bool {
+	switch r.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpCharClass:
+		n := 0
+		for i := 0; i < len(r.Rune); i += 2 {
+			n += int(r.Rune[i+1]-r.Rune[i]) + 1
+		}
+		return n > wideClass
+	}
+	return false
+}
+
+// pathLabelNames returns the names of the PathLabels groups.
+func (w *Watcher) pathLabelNames() (names []string) {
+	if w.pathLabels == nil {
+		return nil
+	}
+	for _, name := range w.pathLabels.SubexpNames() {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// addPathLabels sets the PathLabels labels in l from path.
+func (w *Watcher) addPathLabels(l prometheus.Labels, path string) {
+	if w.pathLabels == nil {
+		return
+	}
+	m := w.pathLabels.FindStringSubmatch(path)
+	for i, name := range w.pathLabels.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		l[name] = ""
+		if m != nil {
+			l[name] = m[i]
+		}
+	}
+}
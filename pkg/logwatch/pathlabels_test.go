@@ -0,0 +1,39 @@
+package logwatch_test
+
+import (
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPathLabels(t *testing.T) {
+	for _, x := range []struct {
+		expr  string
+		risks []logwatch.LabelRisk
+	}{
+		{`_(?P<tier>frontend|backend)-`, nil},
+		{`_(?P<team>[a-z]+)-`, nil},
+		{`_(?P<shard>[0-9])_`, nil},
+		{`(?P<index>[0-9]+)\.log$`, []logwatch.LabelRisk{{Label: "index", Reason: "captures repeated digits, e.g. a file index or timestamp", Deny: true}}},
+		{`\.log\.(?P<date>\d{8})`, []logwatch.LabelRisk{{Label: "date", Reason: "captures repeated digits, e.g. a file index or timestamp", Deny: true}}},
+		{`(?P<rotated>[0-9]{4}-[0-9]{2}-[0-9]{2})`, []logwatch.LabelRisk{{Label: "rotated", Reason: "captures repeated digits, e.g. a file index or timestamp", Deny: true}}},
+		{`_(?P<app>[^_]+)_`, []logwatch.LabelRisk{{Label: "app", Reason: "captures free-form text, values are unbounded"}}},
+		{`/(?P<any>.*)`, []logwatch.LabelRisk{{Label: "any", Reason: "captures free-form text, values are unbounded"}}},
+	} {
+		t.Run(x.expr, func(t *testing.T) {
+			re, risks, err := logwatch.CheckPathLabels(x.expr)
+			require.NoError(t, err)
+			assert.NotNil(t, re)
+			assert.Equal(t, x.risks, risks)
+		})
+	}
+}
+
+func TestCheckPathLabelsErrors(t *testing.T) {
+	for _, expr := range []string{`(`, `_([a-z]+)_`, `(?P<podname>[a-z]+)`, `(?P<deleted>x)`} {
+		_, _, err := logwatch.CheckPathLabels(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,73 @@
+package logwatch
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ViaQ/logerr/log"
+)
+
+// PathParser gets the labels of a container log file from its path, see WithPathParser.
+type PathParser interface {
+	// ParsePath returns the namespace, pod and container of the log file at path.
+	// ok is false if path is not a container log file, it is ignored.
+	ParsePath(path string) (namespace, podname, containername string, ok bool)
+}
+
+// PathParserFunc is a function that implements PathParser.
+type PathParserFunc func(path string) (namespace, podname, containername string, ok bool)
+
+func (f PathParserFunc) ParsePath(path string) (namespace, podname, containername string, ok bool) {
+	return f(path)
+}
+
+var (
+	// ContainerLogs parses kubelet container log links /var/log/containers/<pod>_<namespace>_<container>-<id>.log,
+	// it is the default PathParser.
+	ContainerLogs PathParser = PathParserFunc(parseContainerLog)
+	// PodLogs parses the pod log layout <namespace>_<pod>_<uid>/<container>/<N>.log, it is the default with PodDir.
+	PodLogs PathParser = PathParserFunc(parsePodLog)
+)
+
+// WithPathParser gets labels from log file paths with p, for directories with a different layout.
+// Files that p does not parse are ignored. Watched directories are not searched recursively,
+// except the container directories of PodDir and DockerDir.
+func WithPathParser(p PathParser) Option { return func(w *Watcher) { w.parser = p } }
+
+// RegexpPathParser returns a PathParser that matches expr against paths, with the labels
+// from named groups namespace, podname and containername. A group that is missing is an error.
+func RegexpPathParser(expr string) (PathParser, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			index[name] = i
+		}
+	}
+	for _, name := range []string{"namespace", "podname", "containername"} {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("path regexp has no group (?P<%v>...)", name)
+		}
+	}
+	return PathParserFunc(func(path string) (namespace, podname, containername string, ok bool) {
+		m := re.FindStringSubmatch(path)
+		if m == nil {
+			return "", "", "", false
+		}
+		return m[index["namespace"]], m[index["podname"]], m[index["containername"]], true
+	}), nil
+}
+
+// parseContainerLog returns namespace, pod and container for a kubelet container log link.
+func parseContainerLog(path string) (namespace, podname, containername string, ok bool) {
+	//Get namespace, podname, containername from path - log file path
+	r := kubernetesregexpCompiled.FindStringSubmatch(path)
+	if r == nil {
+		return "", "", "", false
+	}
+	log.V(3).Info("Namespace podname containername...", "namespace", r[namespaceIndex], "podname", r[podNameIndex], "containername", r[containerNameIndex], "dockerid", r[dockerIndex])
+	return r[namespaceIndex], r[podNameIndex], r[containerNameIndex], true
+}
@@ -0,0 +1,69 @@
+package logwatch_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathParsers(t *testing.T) {
+	id := strings.Repeat("a", 64)
+	for _, x := range []struct {
+		parser                    logwatch.PathParser
+		path                      string
+		namespace, pod, container string
+		ok                        bool
+	}{
+		{logwatch.ContainerLogs, "/var/log/containers/pod_ns_ctr-" + id + ".log", "ns", "pod", "ctr", true},
+		{logwatch.ContainerLogs, "/var/log/containers/nonsense.log", "", "", "", false},
+		{logwatch.PodLogs, "/var/log/pods/ns_pod_1234/ctr/0.log", "ns", "pod", "ctr", true},
+		{logwatch.PodLogs, "/var/log/pods/ns_pod_1234/ctr/x.log", "", "", "", false},
+	} {
+		ns, pod, container, ok := x.parser.ParsePath(x.path)
+		assert.Equal(t, []interface{}{x.namespace, x.pod, x.container, x.ok}, []interface{}{ns, pod, container, ok}, x.path)
+	}
+}
+
+func TestRegexpPathParser(t *testing.T) {
+	p, err := logwatch.RegexpPathParser(`/(?P<namespace>[^/]+)/(?P<podname>[^/]+)/(?P<containername>[^/.]+)\.log$`)
+	require.NoError(t, err)
+	ns, pod, container, ok := p.ParsePath("/logs/ns/pod/ctr.log")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ns", "pod", "ctr"}, []string{ns, pod, container})
+	_, _, _, ok = p.ParsePath("/logs/ctr.txt")
+	assert.False(t, ok)
+
+	_, err = logwatch.RegexpPathParser(`(?P<namespace>x)(?P<podname>y)`)
+	assert.EqualError(t, err, "path regexp has no group (?P<containername>...)")
+	_, err = logwatch.RegexpPathParser(`(`)
+	assert.Error(t, err)
+}
+
+func TestWithPathParser(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ns.pod.ctr.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("hello\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("ignored\n"), 0600))
+	p, err := logwatch.RegexpPathParser(`/(?P<namespace>[^/.]+)\.(?P<podname>[^/.]+)\.(?P<containername>[^/.]+)\.log$`)
+	require.NoError(t, err)
+	registry := prometheus.NewRegistry()
+	w, err := logwatch.New(dir, logwatch.Registry(registry), logwatch.InternalRegistry(prometheus.NewRegistry()), logwatch.WithPathParser(p))
+	require.NoError(t, err)
+	defer w.Close()
+	expect := fmt.Sprintf(`# HELP log_logged_bytes_total Total number of bytes written to a single log file path, accounting for rotations
+# TYPE log_logged_bytes_total counter
+log_logged_bytes_total{containername="ctr",namespace="ns",path=%q,podname="pod"} 6
+`, path)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expect), "log_logged_bytes_total"))
+}
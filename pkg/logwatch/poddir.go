@@ -0,0 +1,52 @@
+package logwatch
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+)
+
+// podLogRegexp matches a log file in the pod log layout, capturing namespace, pod and container:
+// <namespace>_<pod>_<uid>/<container>/<N>.log
+var podLogRegexp = regexp.MustCompile(`/([^/_]+)_([^/_]+)_[^/_]+/([^/]+)/[0-9]+\.log$`)
+
+// PodDir watches the log directory of a single pod, <pods>/<namespace>_<pod>_<uid> with a
+// subdirectory of log files for each container, instead of a directory of container log links.
+// Labels are taken from the pod log layout. It lets a sidecar count the logs of its own pod, see FindPodDir.
+func PodDir() Option {
+	return func(w *Watcher) {
+		w.podDir = true
+		w.subdirs = true
+		w.watchOpts = append(w.watchOpts, symnotify.Recursive())
+	}
+}
+
+// FindPodDir returns the log directory of the pod with uid in the pod log directory pods,
+// for example /var/log/pods.
+func FindPodDir(pods, uid string) (string, error) { return findPodDir(symnotify.OS, pods, uid) }
+
+// findPodDir is FindPodDir using fs.
+func findPodDir(fs symnotify.FS, pods, uid string) (string, error) {
+	infos, err := fs.ReadDir(pods)
+	if err != nil {
+		return "", err
+	}
+	for _, info := range infos {
+		if info.IsDir() && strings.HasSuffix(info.Name(), "_"+uid) {
+			return filepath.Join(pods, info.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("no log directory for pod %v in %v", uid, pods)
+}
+
+// parsePodLog returns namespace, pod and container for a path in the pod log layout.
+func parsePodLog(path string) (namespace, podname, containername string, ok bool) {
+	m := podLogRegexp.FindStringSubmatch(filepath.ToSlash(path))
+	if m == nil {
+		return "", "", "", false
+	}
+	return m[1], m[2], m[3], true
+}
@@ -0,0 +1,121 @@
+package logwatch
+
+import (
+	"github.com/ViaQ/logerr/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// pod tracks the log files of a pod, so its series can be deleted when the pod is removed.
+type pod struct {
+	paths   map[string]bool // Paths counted for the pod, existing or not.
+	keys    map[Key]bool    // Keys of the pod's log files.
+	live    map[string]bool // Paths that still exist.
+	deleted int             // Deleted files that are still tracked, see CountDeleted.
+}
+
+// gone returns true if the pod has no existing or open files.
+func (p *pod) gone() bool { return len(p.live) == 0 && p.deleted == 0 }
+
+// deleteMatching deletes all series in vec with labels accepted by match, returns their labels.
+// It emulates CounterVec.DeletePartialMatch which is not available in this client_golang version.
+// Unlike Delete it does not need the full label set, so it works even if label values were not recorded.
+func deleteMatching(vec *prometheus.CounterVec, match func(prometheus.Labels) bool) []prometheus.Labels {
+	var matched []prometheus.Labels
+	for _, labels := range seriesLabels(vec) {
+		if match(labels) {
+			matched = append(matched, labels)
+		}
+	}
+	// Delete after collecting, Collect holds the vec lock.
+	for _, labels := range matched {
+		vec.Delete(labels)
+	}
+	return matched
+}
+
+// seriesLabels returns the labels of all series in vec.
+func seriesLabels(vec *prometheus.CounterVec) []prometheus.Labels {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+	var series []prometheus.Labels
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for _, lp := range pb.GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		series = append(series, labels)
+	}
+	return series
+}
+
+// trackPod records path as a live log file of the pod in key.
+// Must be called with w.mu locked.
+func (w *Watcher) trackPod(path string, key Key) {
+	if key.PodUID == "" {
+		return
+	}
+	p := w.pods[key.PodUID]
+	if p == nil {
+		p = &pod{paths: map[string]bool{}, keys: map[Key]bool{}, live: map[string]bool{}}
+		w.pods[key.PodUID] = p
+	}
+	p.paths[path] = true
+	p.keys[key] = true
+	p.live[path] = true
+	w.podOf[path] = key.PodUID
+	if w.grace.cancel(key.PodUID) {
+		log.V(3).Info("Pod log files reappeared, cancelled series deletion...", "poduid", key.PodUID)
+	}
+}
+
+// removePod deletes the series and state of pod uid if it has no existing or open files,
+// unless the deletion is held by NodeDrain or DeleteGrace. Must be called with w.mu locked.
+func (w *Watcher) removePod(uid string) {
+	p := w.pods[uid]
+	if p == nil || !p.gone() || w.drain.hold(uid) || w.grace.hold(uid, func() { w.graceExpired(uid) }) {
+		return
+	}
+	w.deletePod(uid)
+}
+
+// deletePod deletes the series and state of pod uid. Must be called with w.mu locked.
+func (w *Watcher) deletePod(uid string) {
+	p := w.pods[uid]
+	delete(w.pods, uid)
+	deleted := deleteMatching(w.metrics, func(labels prometheus.Labels) bool { return p.paths[labels["path"]] })
+	if w.lines != nil {
+		deleteMatching(w.lines, func(labels prometheus.Labels) bool { return p.paths[labels["path"]] })
+	}
+	if w.stale != nil {
+		for _, labels := range deleted {
+			w.stale.markStale(labels)
+		}
+	}
+	for path := range p.paths {
+		delete(w.matched, path)
+		delete(w.parsers, path)
+		w.fileSizes.remove(path)
+		w.limiter.remove(path)
+	}
+	w.removeInstances(uid)
+	w.removeRestartGaps(uid)
+	w.removeThrottled(uid)
+	w.removeWriteTimes(uid)
+	w.removeLatencies(uid)
+	w.removeArchives(uid)
+	w.inventory.removed(uid)
+	for key := range p.keys {
+		w.sizes.Delete(key)
+		delete(w.ids, key)
+		delete(w.fstypes, key)
+	}
+	log.V(3).Info("Pod removed, deleted series...", "poduid", uid, "series", len(deleted))
+}
@@ -0,0 +1,68 @@
+package logwatch
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPodsCounterVec(pods, containers int) *prometheus.CounterVec {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"path", "namespace", "podname", "containername"})
+	for p := 0; p < pods; p++ {
+		addPodSeries(vec, p, containers)
+	}
+	return vec
+}
+
+func podSeriesLabels(p, c int) prometheus.Labels {
+	return prometheus.Labels{"path": fmt.Sprintf("pod-%d_ns_c-%d.log", p, c), "namespace": "ns", "podname": fmt.Sprintf("pod-%d", p), "containername": fmt.Sprintf("c-%d", c)}
+}
+
+func addPodSeries(vec *prometheus.CounterVec, p, containers int) {
+	for c := 0; c < containers; c++ {
+		vec.With(podSeriesLabels(p, c)).Add(1)
+	}
+}
+
+func TestDeleteMatching(t *testing.T) {
+	vec := newPodsCounterVec(3, 2)
+	assert.Len(t, deleteMatching(vec, func(l prometheus.Labels) bool { return l["podname"] == "pod-1" }), 2)
+	assert.Equal(t, 4, testutil.CollectAndCount(vec))
+	assert.Len(t, deleteMatching(vec, func(l prometheus.Labels) bool { return l["podname"] == "pod-1" }), 0)
+	assert.Len(t, deleteMatching(vec, func(prometheus.Labels) bool { return true }), 4)
+	assert.Equal(t, 0, testutil.CollectAndCount(vec))
+}
+
+// Compare deleting a pod's series one label set at a time, which requires recording every
+// label set, with deleteMatching.
+func BenchmarkDeletePod(b *testing.B) {
+	const pods, containers = 1000, 3
+	b.Run("label-sets", func(b *testing.B) {
+		vec := newPodsCounterVec(pods, containers)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			p := i % pods
+			for c := 0; c < containers; c++ {
+				vec.Delete(podSeriesLabels(p, c))
+			}
+			b.StopTimer()
+			addPodSeries(vec, p, containers)
+			b.StartTimer()
+		}
+	})
+	b.Run("partial-match", func(b *testing.B) {
+		vec := newPodsCounterVec(pods, containers)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			p := i % pods
+			podname := fmt.Sprintf("pod-%d", p)
+			deleteMatching(vec, func(l prometheus.Labels) bool { return l["podname"] == podname })
+			b.StopTimer()
+			addPodSeries(vec, p, containers)
+			b.StartTimer()
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package logwatch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MinUpdateInterval limits updates of a single log file from Write events to one per interval.
+// A Write event less than interval after the last update of its file is deferred, the bytes
+// written meanwhile are counted by the next update, at most interval after the last one.
+// Unlike symnotify.Coalesce, the first write to a quiet file is counted without delay.
+// An interval <= 0 disables the limit.
+func MinUpdateInterval(interval time.Duration) Option {
+	return func(w *Watcher) {
+		if interval > 0 {
+			w.limiter = &updateLimit{interval: interval, last: map[string]time.Time{}, pending: map[string]bool{}}
+		}
+	}
+}
+
+// updateLimit defers updates for MinUpdateInterval. Paths are removed with their series,
+// possibly with w.mu locked, so mu must not be held while updating.
+type updateLimit struct {
+	interval time.Duration
+	mu       sync.Mutex
+	last     map[string]time.Time // Time of the last update of each path.
+	pending  map[string]bool      // Paths with deferred updates.
+
+	deferred prometheus.Counter
+}
+
+// newMetrics creates the metrics for MinUpdateInterval.
+func (l *updateLimit) newMetrics() []prometheus.Collector {
+	l.deferred = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_updates_deferred_total",
+		Help: "Number of Write events not processed because their log file was updated less than the minimum update interval ago",
+	})
+	return []prometheus.Collector{l.deferred}
+}
+
+// minTick is the shortest period of a ticker derived from an interval option.
+const minTick = time.Millisecond
+
+// halfTick returns the period of a ticker that checks twice per interval, at least minTick.
+func halfTick(interval time.Duration) time.Duration {
+	if interval/2 < minTick {
+		return minTick
+	}
+	return interval / 2
+}
+
+// ticker returns the channel for deferred updates, nil if there is no limit.
+func (l *updateLimit) ticker() (<-chan time.Time, func()) {
+	if l == nil {
+		return nil, func() {}
+	}
+	t := time.NewTicker(halfTick(l.interval))
+	return t.C, t.Stop
+}
+
+// hold returns true if an update of path at now should be deferred,
+// otherwise records the update.
+func (l *updateLimit) hold(path string, now time.Time) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending[path] || now.Sub(l.last[path]) < l.interval {
+		l.pending[path] = true
+		l.deferred.Inc()
+		return true
+	}
+	l.last[path] = now
+	return false
+}
+
+// remove forgets path.
+func (l *updateLimit) remove(path string) {
+	if l != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.last, path)
+		delete(l.pending, path)
+	}
+}
+
+// updateDeferred updates paths with deferred updates that are due at now.
+func (w *Watcher) updateDeferred(now time.Time) {
+	for _, path := range w.limiter.due(now) {
+		w.updatePath(path, false, nil)
+	}
+}
+
+// due returns the paths with deferred updates that are due at now, and records their update.
+func (l *updateLimit) due(now time.Time) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var paths []string
+	for path := range l.pending {
+		if now.Sub(l.last[path]) >= l.interval {
+			delete(l.pending, path)
+			l.last[path] = now
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
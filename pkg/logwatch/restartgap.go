@@ -0,0 +1,88 @@
+package logwatch
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RestartGaps reports the time between the last write to the log file of a container instance
+// and the start of the next instance, an estimate of the time the container spent in restart
+// back-off, from log activity alone. Only restarts seen while the exporter runs are reported,
+// detected by the kubelet log file name <restart>.log as for ContainerInstances.
+// The gap includes the time the container ran before failing without logging.
+func RestartGaps() Option { return func(w *Watcher) { w.lastWrites = map[Key]*lastWrite{} } }
+
+// restartGapBuckets cover the kubelet crash loop back-off, which doubles from 10s to 5m.
+var restartGapBuckets = []float64{1, 5, 10, 20, 40, 80, 160, 300, 600, 1800}
+
+// lastWrite is the last write to the log file of the latest instance of a container.
+type lastWrite struct {
+	restart int
+	time    time.Time
+	labels  prometheus.Labels
+}
+
+// newRestartGapMetrics creates the metrics for RestartGaps.
+func (w *Watcher) newRestartGapMetrics() []prometheus.Collector {
+	w.restartGaps = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "container_restart_gap_seconds",
+		Help:    "Time from the last write to the log of a container instance to the start of the next instance, an estimate of time in restart back-off",
+		Buckets: restartGapBuckets,
+	}, []string{"namespace", "podname", "containername"})
+	return []prometheus.Collector{w.restartGaps}
+}
+
+// restartGap records the last write to the log file key of a container instance.
+// If it is the first file of a new instance, returns a read of its first line to observe the gap.
+// Must be called with w.mu locked.
+func (w *Watcher) restartGap(path string, key Key, namespace, podname, containername string, created bool, stat os.FileInfo) contentRead {
+	restart, err := strconv.Atoi(strings.TrimSuffix(key.File, ".log"))
+	if w.lastWrites == nil || key.PodUID == "" || err != nil {
+		return nil
+	}
+	ck := Key{PodUID: key.PodUID, Container: key.Container}
+	last := w.lastWrites[ck]
+	switch {
+	case last == nil:
+		// First sight of the container, an earlier restart is not observed.
+		w.lastWrites[ck] = &lastWrite{restart: restart, time: stat.ModTime(),
+			labels: prometheus.Labels{"namespace": namespace, "podname": podname, "containername": containername}}
+	case restart == last.restart:
+		last.time = stat.ModTime()
+	case restart > last.restart:
+		labels, lastTime := last.labels, last.time
+		last.restart, last.time = restart, stat.ModTime()
+		observe := func(start time.Time) {
+			if start.After(lastTime) {
+				w.restartGaps.With(labels).Observe(start.Sub(lastTime).Seconds())
+			}
+		}
+		if created {
+			observe(time.Now())
+			return nil
+		}
+		return func() func() {
+			start, ok := firstLineTime(w.fs, path)
+			if !ok {
+				return nil
+			}
+			return func() { observe(start) }
+		}
+	}
+	return nil
+}
+
+// removeRestartGaps deletes the containers of pod uid and their series.
+// Must be called with w.mu locked.
+func (w *Watcher) removeRestartGaps(uid string) {
+	for ck, last := range w.lastWrites {
+		if ck.PodUID == uid {
+			delete(w.lastWrites, ck)
+			w.restartGaps.Delete(last.labels)
+		}
+	}
+}
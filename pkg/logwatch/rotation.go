@@ -0,0 +1,132 @@
+package logwatch
+
+import (
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DecisionRotatedTail counts the bytes written to a rotated log file after it was last counted as the live file.
+const DecisionRotatedTail = "rotated-tail"
+
+// CountArchives counts the uncompressed size of compressed rotated log files, <name>.<time>.gz
+// next to the live log file, once for each archive as log_archived_bytes_total.
+// Archives are found when the live file is rotated, the bytes were already counted in
+// log_logged_bytes_total while they were written, this is a separate account of what is kept on disk.
+func CountArchives() Option { return func(w *Watcher) { w.archives = map[string]archive{} } }
+
+// archive is a compressed log file counted by CountArchives.
+type archive struct {
+	podUID string
+	labels prometheus.Labels
+}
+
+// newArchiveMetrics creates the metrics for CountArchives.
+func (w *Watcher) newArchiveMetrics() []prometheus.Collector {
+	w.archived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_archived_bytes_total",
+		Help: "Uncompressed bytes in compressed rotated log files of a container, each archive is counted once",
+	}, []string{"namespace", "podname", "containername"})
+	return []prometheus.Collector{w.archived}
+}
+
+// rotatedTail is called when the file at path replaced the file with oldID, that was counted up to counted bytes.
+// Kubelet rotates by renaming the live file to <name>.<time> before creating a new one, bytes written between
+// the last update and the rename are in the renamed file. Returns a read of the directory that finds those bytes
+// by the old file's identity and passes them to count, and counts compressed archives for CountArchives.
+// Must be called with w.mu locked.
+func (w *Watcher) rotatedTail(path string, key Key, namespace, podname, containername string, oldID fsinfo.FileID, counted float64, count func(tail float64)) contentRead {
+	return func() func() {
+		real, err := w.fs.EvalSymlinks(path)
+		if err != nil {
+			return nil
+		}
+		dir := filepath.Dir(real)
+		infos, err := w.fs.ReadDir(dir)
+		if err != nil {
+			return nil
+		}
+		var tail *Decision
+		archives := map[string]uint32{}
+		for _, info := range infos {
+			rotated := filepath.Join(dir, info.Name())
+			if !isRotated(real, rotated) || !info.Mode().IsRegular() {
+				continue
+			}
+			if strings.HasSuffix(rotated, ".gz") {
+				if w.archives != nil {
+					if size, err := gzipSize(w.fs, rotated); err != nil {
+						log.V(2).Info("Can't read size of compressed log file...", "path", rotated, "err", err)
+					} else {
+						archives[rotated] = size
+					}
+				}
+				continue
+			}
+			if id, ok := fsinfo.ID(info); ok && id == oldID && float64(info.Size()) > counted {
+				log.V(3).Info("Rotated log file grew after last update...", "path", rotated, "counted", counted, "size", info.Size())
+				tail = &Decision{Reason: DecisionRotatedTail, Path: rotated, OldPath: path, Namespace: namespace, PodName: podname, ContainerName: containername, Before: counted, After: float64(info.Size()), Delta: float64(info.Size()) - counted}
+			}
+		}
+		return func() {
+			if tail != nil {
+				w.decide(*tail)
+				count(tail.Delta)
+			}
+			for rotated, size := range archives {
+				w.countArchive(rotated, key, namespace, podname, containername, size)
+			}
+		}
+	}
+}
+
+// isRotated returns true if rotated is the name of live after rotation, <live>.<suffix> in the same directory.
+func isRotated(live, rotated string) bool {
+	return filepath.Dir(live) == filepath.Dir(rotated) && strings.HasPrefix(filepath.Base(rotated), filepath.Base(live)+".")
+}
+
+// countArchive counts the uncompressed size of a gzip archive once.
+// Must be called with w.mu locked.
+func (w *Watcher) countArchive(path string, key Key, namespace, podname, containername string, size uint32) {
+	if _, ok := w.archives[path]; ok {
+		return
+	}
+	labels := prometheus.Labels{"namespace": namespace, "podname": podname, "containername": containername}
+	w.archives[path] = archive{podUID: key.PodUID, labels: labels}
+	w.archived.With(labels).Add(float64(size))
+}
+
+// removeArchives forgets the archives of pod uid and deletes their series.
+// Must be called with w.mu locked.
+func (w *Watcher) removeArchives(uid string) {
+	for path, a := range w.archives {
+		if a.podUID == uid {
+			delete(w.archives, path)
+			w.archived.Delete(a.labels)
+		}
+	}
+}
+
+// gzipSize returns the uncompressed size of the gzip file at path from its trailer,
+// it is correct for single member files smaller than 4GiB, like rotated logs.
+func gzipSize(fs symnotify.FS, path string) (uint32, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var trailer [4]byte
+	if _, err := f.Seek(-4, io.SeekEnd); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(f, trailer[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(trailer[:]), nil
+}
@@ -0,0 +1,43 @@
+package logwatch
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultSidecars are container names injected by common service meshes and agents.
+var DefaultSidecars = []string{
+	"istio-proxy", "istio-init", "istio-validation",
+	"linkerd-proxy", "linkerd-init",
+	"consul-dataplane", "envoy-sidecar",
+	"kuma-sidecar", "kuma-init",
+	"vault-agent", "vault-agent-init",
+}
+
+// Sidecars adds a label sidecar="true" to the bytes counter for containers named in names,
+// and sidecar="false" for all others. Use it to compare the log volume of injected sidecars
+// with the applications, e.g. sum by (sidecar) (log_logged_bytes_total). See DefaultSidecars.
+func Sidecars(names ...string) Option {
+	return func(w *Watcher) {
+		w.sidecars = map[string]bool{}
+		for _, name := range names {
+			w.sidecars[name] = true
+		}
+	}
+}
+
+// sidecarLabelNames returns the label added by Sidecars, if set.
+func (w *Watcher) sidecarLabelNames() []string {
+	if w.sidecars == nil {
+		return nil
+	}
+	return []string{"sidecar"}
+}
+
+// addSidecarLabel sets the Sidecars label in l for containername.
+func (w *Watcher) addSidecarLabel(l prometheus.Labels, containername string) {
+	if w.sidecars != nil {
+		l["sidecar"] = fmt.Sprint(w.sidecars[containername])
+	}
+}
@@ -0,0 +1,88 @@
+package logwatch
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// staleNaN is the value Prometheus uses internally to mark a series as stale.
+// The bit pattern is only preserved by the protobuf exposition format, the text format shows NaN.
+var staleNaN = math.Float64frombits(0x7ff0000000000002)
+
+// staleCounterVec is a CounterVec that reports each deleted series with a staleNaN value until the
+// next successful update after it was collected, so every scraper sees the end of the series
+// instead of a gap, not only the first.
+type staleCounterVec struct {
+	*prometheus.CounterVec
+	desc       *prometheus.Desc
+	labelNames []string
+
+	mu    sync.Mutex
+	stale map[string]*staleMarker // Markers of deleted series by signature.
+}
+
+// staleMarker is the stale marker of a deleted series.
+type staleMarker struct {
+	values    []string
+	collected bool // Reported by Collect at least once.
+}
+
+func newStaleCounterVec(vec *prometheus.CounterVec, labelNames []string) *staleCounterVec {
+	ch := make(chan *prometheus.Desc, 1)
+	vec.Describe(ch)
+	return &staleCounterVec{CounterVec: vec, desc: <-ch, labelNames: labelNames, stale: map[string]*staleMarker{}}
+}
+
+func (v *staleCounterVec) values(labels prometheus.Labels) []string {
+	values := make([]string, len(v.labelNames))
+	for i, name := range v.labelNames {
+		values[i] = labels[name]
+	}
+	return values
+}
+
+// markStale reports the deleted series with labels as stale, see updated.
+func (v *staleCounterVec) markStale(labels prometheus.Labels) {
+	values := v.values(labels)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.stale[strings.Join(values, "\xff")] = &staleMarker{values: values}
+}
+
+// revive cancels a stale marker for labels, the series is in use again.
+func (v *staleCounterVec) revive(labels prometheus.Labels) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.stale) > 0 {
+		delete(v.stale, strings.Join(v.values(labels), "\xff"))
+	}
+}
+
+// updated drops the stale markers that were collected, after a successful update.
+func (v *staleCounterVec) updated() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for sig, m := range v.stale {
+		if m.collected {
+			delete(v.stale, sig)
+		}
+	}
+}
+
+// Collect live series, and stale markers until the next update after they are collected.
+func (v *staleCounterVec) Collect(ch chan<- prometheus.Metric) {
+	v.CounterVec.Collect(ch)
+	v.mu.Lock()
+	var stale [][]string
+	for _, m := range v.stale {
+		m.collected = true
+		stale = append(stale, m.values)
+	}
+	v.mu.Unlock()
+	for _, values := range stale {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.CounterValue, staleNaN, values...)
+	}
+}
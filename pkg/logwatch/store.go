@@ -0,0 +1,21 @@
+package logwatch
+
+// Store holds the last known size of each log file.
+// Implementations need not be safe for concurrent use, the Watcher serializes access.
+type Store interface {
+	// Get returns the size stored for k, ok is false if there is none.
+	Get(k Key) (size float64, ok bool)
+	// Set stores the size for k.
+	Set(k Key, size float64)
+	// Delete removes k.
+	Delete(k Key)
+}
+
+// NewMemoryStore returns a Store that keeps sizes in memory.
+func NewMemoryStore() Store { return memoryStore{} }
+
+type memoryStore map[Key]float64
+
+func (m memoryStore) Get(k Key) (float64, bool) { size, ok := m[k]; return size, ok }
+func (m memoryStore) Set(k Key, size float64)   { m[k] = size }
+func (m memoryStore) Delete(k Key)              { delete(m, k) }
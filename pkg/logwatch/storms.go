@@ -0,0 +1,112 @@
+package logwatch
+
+import (
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stormWindow is the period over which Write events are counted for StormBreaker.
+const stormWindow = time.Second
+
+// StormBreaker protects Watch from a single container monopolizing it with writes.
+// If a log file gets more than limit Write events in a second, its Write events are ignored
+// and it is stat-ed once per interval instead. It switches back to events after a second
+// with at most limit Write events. A limit <= 0 disables the breaker, an interval <= 0 is one second.
+func StormBreaker(limit int, interval time.Duration) Option {
+	if interval <= 0 {
+		interval = stormWindow
+	}
+	return func(w *Watcher) { w.storms = &storms{limit: limit, interval: interval} }
+}
+
+// storms tracks Write event rates for StormBreaker. Used only by the Watch goroutine.
+type storms struct {
+	limit    int
+	interval time.Duration
+	start    time.Time       // Start of the current window.
+	counts   map[string]int  // Write events for each path in the current window.
+	periodic map[string]bool // Paths in periodic mode.
+
+	files      prometheus.Gauge
+	suppressed prometheus.Counter
+}
+
+// newMetrics creates the metrics for StormBreaker.
+func (s *storms) newMetrics() []prometheus.Collector {
+	s.files = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logfilemetricexporter_storm_files",
+		Help: "Number of log files written too often to process each event, stat-ed periodically instead",
+	})
+	s.suppressed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_storm_events_suppressed_total",
+		Help: "Number of Write events ignored for log files in periodic mode",
+	})
+	return []prometheus.Collector{s.files, s.suppressed}
+}
+
+// enabled returns true if StormBreaker is set.
+func (s *storms) enabled() bool { return s != nil && s.limit > 0 }
+
+// ticker returns the channel for periodic stats, nil if the breaker is disabled.
+func (s *storms) ticker() (<-chan time.Time, func()) {
+	if !s.enabled() {
+		return nil, func() {}
+	}
+	t := time.NewTicker(s.interval)
+	return t.C, t.Stop
+}
+
+// roll starts a new window if the current one is over at now,
+// paths in periodic mode that had at most limit events return to event mode.
+func (s *storms) roll(now time.Time) {
+	if now.Sub(s.start) < stormWindow {
+		return
+	}
+	for path := range s.periodic {
+		if s.counts[path] <= s.limit {
+			log.V(2).Info("Log file write storm over, processing events again", "path", path)
+			s.remove(path)
+		}
+	}
+	s.start, s.counts = now, map[string]int{}
+}
+
+// suppress counts a Write event for path at now, returns true if it should be ignored.
+func (s *storms) suppress(path string, now time.Time) bool {
+	if !s.enabled() {
+		return false
+	}
+	s.roll(now)
+	s.counts[path]++
+	if !s.periodic[path] && s.counts[path] > s.limit {
+		log.V(2).Info("Log file write storm, stat-ing periodically instead of processing events", "path", path, "limit", s.limit, "interval", s.interval.String())
+		if s.periodic == nil {
+			s.periodic = map[string]bool{}
+		}
+		s.periodic[path] = true
+		s.files.Set(float64(len(s.periodic)))
+	}
+	if s.periodic[path] {
+		s.suppressed.Inc()
+		return true
+	}
+	return false
+}
+
+// remove path from periodic mode.
+func (s *storms) remove(path string) {
+	if s.enabled() && s.periodic[path] {
+		delete(s.periodic, path)
+		s.files.Set(float64(len(s.periodic)))
+	}
+}
+
+// statStorms updates the paths in periodic mode.
+func (w *Watcher) statStorms(now time.Time) {
+	w.storms.roll(now)
+	for path := range w.storms.periodic {
+		w.updatePath(path, false, nil)
+	}
+}
@@ -0,0 +1,50 @@
+package logwatch
+
+import (
+	"github.com/ViaQ/logerr/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// streamUnknown is the stream label of bytes and lines that can't be attributed to a stream.
+const streamUnknown = "unknown"
+
+// StreamLabel adds a "stream" label, stdout or stderr, to the bytes counter, and to the lines counter
+// if CountLines is set. Lines are parsed in CRI or docker json-file format as for CountLevels, the bytes
+// of a line are counted when its newline is written. Bytes of lines in neither format, and bytes written
+// to rotated or deleted files that are not read, are counted with stream "unknown".
+// Needs read permission on log files, unlike counting bytes.
+func StreamLabel() Option {
+	return func(w *Watcher) {
+		w.streams = true
+		if w.parsers == nil {
+			w.parsers = map[string]*lineParser{}
+		}
+	}
+}
+
+// withStream returns a copy of labels with the stream label if StreamLabel is set, otherwise labels.
+func (w *Watcher) withStream(labels prometheus.Labels, stream string) prometheus.Labels {
+	if !w.streams {
+		return labels
+	}
+	l := prometheus.Labels{"stream": stream}
+	for k, v := range labels {
+		l[k] = v
+	}
+	return l
+}
+
+// countStream adds bytes written to stream to the counter for labels.
+// Must be called with w.mu locked.
+func (w *Watcher) countStream(labels prometheus.Labels, fstype, stream string, add float64) {
+	if add <= 0 {
+		return
+	}
+	labels = w.withStream(labels, stream)
+	counter, err := w.counter(labels)
+	if err != nil {
+		log.Error(err, "Error getting bytes counter", "path", labels["path"])
+		return
+	}
+	w.count(counter, labels, fstype, add)
+}
@@ -0,0 +1,151 @@
+package logwatch
+
+import (
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/cgroup"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CPUThrottling reports the bytes logged by each container per CPU throttled period of its cgroup,
+// sampled every interval from the cgroup file system at root, for example /sys/fs/cgroup.
+// A high ratio suggests that logging contributes to the CPU pressure of the container.
+// The series is only present for containers that were throttled in the last interval.
+// Containers are found by pod UID and container ID, only files in the kubelet pod log layout are reported.
+// An interval <= 0 disables sampling.
+func CPUThrottling(root string, interval time.Duration) Option {
+	return func(w *Watcher) {
+		w.throttling = &throttling{root: root, interval: interval, containers: map[Key]*throttled{}}
+	}
+}
+
+// throttling samples cgroup CPU throttling for CPUThrottling.
+type throttling struct {
+	root       string
+	interval   time.Duration
+	containers map[Key]*throttled // Containers by pod UID and name, guarded by Watcher.mu.
+
+	ratio *prometheus.GaugeVec
+}
+
+// throttled is the sampling state of a container.
+type throttled struct {
+	id      string            // Container ID of the current instance.
+	dir     string            // Cgroup directory, "" until found.
+	last    cgroup.Throttling // Statistics at the last sample.
+	sampled bool              // last is set.
+	bytes   float64           // Bytes logged since the last sample.
+	labels  prometheus.Labels
+}
+
+// enabled returns true if CPUThrottling is set.
+func (t *throttling) enabled() bool { return t != nil && t.interval > 0 }
+
+// newMetrics creates the metrics for CPUThrottling.
+func (t *throttling) newMetrics() []prometheus.Collector {
+	t.ratio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_container_bytes_per_throttled_period",
+		Help: "Bytes logged by a container per CPU throttled period of its cgroup, over the last sampling interval. Only present for throttled containers",
+	}, []string{"namespace", "podname", "containername"})
+	return []prometheus.Collector{t.ratio}
+}
+
+// ticker returns the channel for samples, nil if sampling is disabled.
+func (t *throttling) ticker() (<-chan time.Time, func()) {
+	if !t.enabled() {
+		return nil, func() {}
+	}
+	tk := time.NewTicker(t.interval)
+	return tk.C, tk.Stop
+}
+
+// countThrottled adds bytes written to log file path of container key for CPUThrottling.
+// Must be called with w.mu locked.
+func (w *Watcher) countThrottled(path string, key Key, namespace, podname, containername string, add float64) {
+	if !w.throttling.enabled() || key.PodUID == "" {
+		return
+	}
+	r := kubernetesregexpCompiled.FindStringSubmatch(path)
+	if r == nil {
+		return
+	}
+	ck := Key{PodUID: key.PodUID, Container: key.Container}
+	c := w.throttling.containers[ck]
+	if c == nil {
+		c = &throttled{labels: prometheus.Labels{"namespace": namespace, "podname": podname, "containername": containername}}
+		w.throttling.containers[ck] = c
+	}
+	if id := r[dockerIndex]; id != c.id {
+		// Restarted, the new instance has a new cgroup. Bytes may be for either instance.
+		c.id, c.dir, c.sampled = id, "", false
+	}
+	c.bytes += add
+}
+
+// sampleThrottling reads the throttling statistics of each container and updates the ratio.
+func (w *Watcher) sampleThrottling() {
+	type sample struct {
+		key     Key
+		id, dir string
+	}
+	w.mu.Lock()
+	samples := make([]sample, 0, len(w.throttling.containers))
+	for ck, c := range w.throttling.containers {
+		samples = append(samples, sample{key: ck, id: c.id, dir: c.dir})
+	}
+	w.mu.Unlock()
+	stats := make([]*cgroup.Throttling, len(samples))
+	for i := range samples {
+		s := &samples[i]
+		if s.dir == "" {
+			dir, err := cgroup.Find(w.throttling.root, s.key.PodUID, s.id)
+			if err != nil {
+				log.V(3).Info("Can't find container cgroup...", "poduid", s.key.PodUID, "container", s.key.Container, "err", err)
+				continue
+			}
+			s.dir = dir
+		}
+		t, err := cgroup.ReadThrottling(s.dir)
+		if err != nil {
+			log.V(3).Info("Can't read container cgroup...", "dir", s.dir, "err", err)
+			s.dir = "" // The container may have restarted, find it again.
+			continue
+		}
+		stats[i] = &t
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, s := range samples {
+		c := w.throttling.containers[s.key]
+		if c == nil || c.id != s.id {
+			continue // Removed or restarted while sampling.
+		}
+		c.dir = s.dir
+		t := stats[i]
+		if t == nil {
+			w.throttling.ratio.Delete(c.labels)
+			continue
+		}
+		if c.sampled && t.Throttled > c.last.Throttled {
+			w.throttling.ratio.With(c.labels).Set(c.bytes / float64(t.Throttled-c.last.Throttled))
+		} else {
+			w.throttling.ratio.Delete(c.labels)
+		}
+		c.last, c.sampled, c.bytes = *t, true, 0
+	}
+}
+
+// removeThrottled deletes the containers of pod uid and their series.
+// Must be called with w.mu locked.
+func (w *Watcher) removeThrottled(uid string) {
+	if !w.throttling.enabled() {
+		return
+	}
+	for ck, c := range w.throttling.containers {
+		if ck.PodUID == uid {
+			delete(w.throttling.containers, ck)
+			w.throttling.ratio.Delete(c.labels)
+		}
+	}
+}
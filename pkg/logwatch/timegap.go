@@ -0,0 +1,73 @@
+package logwatch
+
+import (
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TimeGaps makes Watch rescan all log files after a gap in time longer than threshold,
+// for example when the node was suspended and resumed or the process was stopped,
+// since file events may have been lost without an overflow being reported.
+// A threshold <= 0 disables gap detection.
+func TimeGaps(threshold time.Duration) Option {
+	return func(w *Watcher) { w.gaps = &timeGaps{threshold: threshold, interval: threshold / 2} }
+}
+
+// timeGaps detects gaps between regular checks.
+type timeGaps struct {
+	threshold, interval time.Duration
+	last                time.Time
+	count               prometheus.Counter
+}
+
+// newTimeGapsCounter creates the counter for detected gaps.
+func newTimeGapsCounter() prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_time_gaps_total",
+		Help: "Number of gaps in time detected, for example by suspend and resume of the node, each triggers a rescan",
+	})
+}
+
+// check returns the time missed since the last check, 0 unless it exceeds the threshold.
+// The monotonic clock stops while the system is suspended on some platforms,
+// the wall clock does not, the larger of the two is used.
+func (g *timeGaps) check(now time.Time) time.Duration {
+	last := g.last
+	g.last = now
+	if last.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(last)
+	if wall := now.Round(0).Sub(last.Round(0)); wall > elapsed {
+		elapsed = wall
+	}
+	if missed := elapsed - g.interval; missed > g.threshold {
+		return missed
+	}
+	return 0
+}
+
+// ticker returns the channel for regular checks, nil if gap detection is disabled.
+func (g *timeGaps) ticker() (<-chan time.Time, func()) {
+	if g == nil || g.threshold <= 0 {
+		return nil, func() {}
+	}
+	t := time.NewTicker(g.interval)
+	g.last = time.Now()
+	return t.C, t.Stop
+}
+
+// checkGap rescans if a time gap is detected at now.
+func (w *Watcher) checkGap(now time.Time) {
+	missed := w.gaps.check(now)
+	if missed == 0 {
+		return
+	}
+	log.Info("Time gap detected, rescanning log files in case events were lost", "missed", missed.String())
+	w.gaps.count.Inc()
+	if err := w.Rescan(); err != nil {
+		log.Error(err, "Error rescanning log files after time gap")
+	}
+}
@@ -0,0 +1,39 @@
+package logwatch
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// newTrackedGauges creates gauges of the number of log files and containers being counted.
+// A drop to 0, or a value that stops changing while pods come and go, shows the exporter
+// has stopped discovering log files.
+func (w *Watcher) newTrackedGauges() []prometheus.Collector {
+	return []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "log_files_tracked",
+			Help: "Number of live log files being counted",
+		}, func() float64 {
+			files, _ := w.tracked()
+			return float64(files)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "log_containers_tracked",
+			Help: "Number of containers with live log files being counted",
+		}, func() float64 {
+			_, containers := w.tracked()
+			return float64(containers)
+		}),
+	}
+}
+
+// tracked returns the number of live log files and of containers they belong to.
+// Files outside the kubelet pod log layout are not containers.
+func (w *Watcher) tracked() (files, containers int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seen := map[Key]bool{}
+	for _, k := range w.keys {
+		if k.PodUID != "" {
+			seen[Key{PodUID: k.PodUID, Container: k.Container}] = true
+		}
+	}
+	return len(w.keys), len(seen)
+}
@@ -0,0 +1,134 @@
+package logwatch
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SeriesTTL deletes the series of a log file that had no activity for ttl and no longer exists,
+// for example a container whose log directory was removed while the exporter was down,
+// or a file outside the pod log layout that is not removed with its pod. A ttl <= 0 disables it.
+func SeriesTTL(ttl time.Duration) Option {
+	return func(w *Watcher) {
+		if ttl > 0 {
+			w.ttl = &seriesTTL{ttl: ttl, active: map[string]time.Time{}}
+		}
+	}
+}
+
+// seriesTTL is the state of SeriesTTL. Must be used with w.mu locked.
+type seriesTTL struct {
+	ttl    time.Duration
+	active map[string]time.Time // Last activity by path.
+
+	expired prometheus.Counter
+}
+
+// newMetrics creates the metrics for SeriesTTL.
+func (s *seriesTTL) newMetrics() []prometheus.Collector {
+	s.expired = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logfilemetricexporter_expired_series_total",
+		Help: "Number of log file series deleted after no activity for the series TTL with no file",
+	})
+	return []prometheus.Collector{s.expired}
+}
+
+// ticker returns the channel for expiry checks, nil if SeriesTTL is not set.
+func (s *seriesTTL) ticker() (<-chan time.Time, func()) {
+	if s == nil {
+		return nil, func() {}
+	}
+	t := time.NewTicker(halfTick(s.ttl))
+	return t.C, t.Stop
+}
+
+// touch records activity for path at now.
+func (s *seriesTTL) touch(path string, now time.Time) {
+	if s != nil {
+		s.active[path] = now
+	}
+}
+
+// expireSeries deletes the series of files with no activity for the TTL at now that do not exist.
+// Series with no recorded activity, e.g. restored from a checkpoint, start their TTL now.
+// Files are stat-ed without w.mu locked, a file whose directory is gone is not stat-ed.
+func (w *Watcher) expireSeries(now time.Time) {
+	w.mu.Lock()
+	idle := map[string]time.Time{}
+	for _, labels := range seriesLabels(w.metrics) {
+		path := labels["path"]
+		last, ok := w.ttl.active[path]
+		if !ok {
+			w.ttl.active[path] = now
+		} else if now.Sub(last) >= w.ttl.ttl {
+			idle[path] = last
+		}
+	}
+	w.mu.Unlock()
+
+	gone := map[string]bool{}
+	dirs := map[string]bool{} // Directories that exist, by name.
+	for path := range idle {
+		dir := filepath.Dir(path)
+		exists, ok := dirs[dir]
+		if !ok {
+			_, err := w.fs.Stat(dir)
+			exists = !os.IsNotExist(err)
+			dirs[dir] = exists
+		}
+		if exists {
+			_, err := w.fs.Stat(path)
+			exists = !os.IsNotExist(err)
+		}
+		gone[path] = !exists
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	expired := map[string]bool{}
+	for path, last := range idle {
+		if w.ttl.active[path] != last {
+			continue // Active while stat-ing.
+		}
+		if gone[path] {
+			expired[path] = true
+		} else {
+			w.ttl.active[path] = now // Still there, check again after the TTL.
+		}
+	}
+	deleted := deleteMatching(w.metrics, func(labels prometheus.Labels) bool { return expired[labels["path"]] })
+	if w.lines != nil {
+		deleteMatching(w.lines, func(labels prometheus.Labels) bool { return expired[labels["path"]] })
+	}
+	for _, labels := range deleted {
+		if w.stale != nil {
+			w.stale.markStale(labels)
+		}
+		w.ttl.expired.Inc()
+	}
+	for path := range expired {
+		log.V(2).Info("Series expired, no activity and no log file", "path", path, "ttl", w.ttl.ttl.String())
+		delete(w.ttl.active, path)
+		delete(w.matched, path)
+		delete(w.parsers, path)
+		w.disk.remove(path)
+		w.fileSizes.remove(path)
+		w.limiter.remove(path)
+		if k, ok := w.keys[path]; ok {
+			delete(w.keys, path)
+			w.sizes.Delete(k)
+			delete(w.ids, k)
+			delete(w.fstypes, k)
+		}
+	}
+	// Forget activity of series deleted some other way, e.g. with their pod.
+	for path, last := range w.ttl.active {
+		if now.Sub(last) >= 2*w.ttl.ttl {
+			delete(w.ttl.active, path)
+		}
+	}
+}
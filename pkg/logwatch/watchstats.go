@@ -0,0 +1,139 @@
+package logwatch
+
+import (
+	"strings"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// watchStats are metrics for the internals of the file watcher.
+type watchStats struct {
+	added, removed, evicted, delivered, statErrors prometheus.Counter
+	dropped                                        *prometheus.CounterVec
+	latency                                        prometheus.Histogram
+
+	// Metrics for the Watch loop.
+	events       *prometheus.CounterVec
+	updateErrors prometheus.Counter
+	rescans      prometheus.Counter
+	rescanTimes  prometheus.Histogram
+}
+
+func newWatchStats() watchStats {
+	return watchStats{
+		added: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_watches_added_total",
+			Help: "Number of file watches added, see fs.inotify.max_user_watches",
+		}),
+		removed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_watches_removed_total",
+			Help: "Number of file watches removed",
+		}),
+		evicted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_watches_evicted_total",
+			Help: "Number of file watches replaced by polling to stay within the watch limit",
+		}),
+		delivered: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_watch_events_delivered_total",
+			Help: "Number of file events processed",
+		}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_watch_events_dropped_total",
+			Help: "Number of file events dropped by the watcher, by reason",
+		}, []string{"reason"}),
+		statErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_watch_stat_errors_total",
+			Help: "Number of errors examining watched paths, other than paths that no longer exist",
+		}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "logfilemetricexporter_event_latency_seconds",
+			Help:    "Time from a file event being received from the kernel to log metrics being updated for it",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_events_total",
+			Help: "Number of file events handled by the log watcher, by operation",
+		}, []string{"op"}),
+		updateErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_update_errors_total",
+			Help: "Number of log file updates that failed, other than for files that no longer exist",
+		}),
+		rescans: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "logfilemetricexporter_rescans_total",
+			Help: "Number of completed rescans of the log directory",
+		}),
+		rescanTimes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "logfilemetricexporter_rescan_duration_seconds",
+			Help:    "Duration of completed rescans of the log directory",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+		}),
+	}
+}
+
+func (s watchStats) collectors() []prometheus.Collector {
+	return []prometheus.Collector{s.added, s.removed, s.evicted, s.delivered, s.dropped, s.statErrors, s.latency,
+		s.events, s.updateErrors, s.rescans, s.rescanTimes}
+}
+
+// hooks update the metrics from the watcher.
+func (s watchStats) hooks() symnotify.Hooks {
+	return symnotify.Hooks{
+		WatchAdded:     func(string) { s.added.Inc() },
+		WatchRemoved:   func(string) { s.removed.Inc() },
+		WatchEvicted:   func(string) { s.evicted.Inc() },
+		EventDelivered: func(symnotify.Event) { s.delivered.Inc() },
+		EventDropped:   func(_ symnotify.Event, reason string) { s.dropped.WithLabelValues(reason).Inc() },
+		StatError: func(path string, err error) {
+			log.V(2).Info("Error examining watched path", "path", path, "err", err)
+			s.statErrors.Inc()
+		},
+	}
+}
+
+// newQueueDepths creates gauges for the events held inside the file watcher, by queue.
+func newQueueDepths(watcher func() symnotify.Interface) []prometheus.Collector {
+	queues := map[string]func(symnotify.Depth) int{
+		"coalesce": func(d symnotify.Depth) int { return d.Coalesced },
+		"rescan":   func(d symnotify.Depth) int { return d.Rescans },
+		"buffer":   func(d symnotify.Depth) int { return d.Buffered },
+	}
+	var collectors []prometheus.Collector
+	for queue, depth := range queues {
+		depth := depth
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "logfilemetricexporter_watch_queue_depth",
+			Help:        "Number of file events held inside the watcher, by queue",
+			ConstLabels: prometheus.Labels{"queue": queue},
+		}, func() float64 {
+			if w := watcher(); w != nil {
+				return float64(depth(w.Depth()))
+			}
+			return 0
+		}))
+	}
+	return collectors
+}
+
+// opNames are the op label values of file events.
+var opNames = []struct {
+	op   symnotify.Op
+	name string
+}{
+	{symnotify.Create, "create"}, {symnotify.Write, "write"}, {symnotify.Remove, "remove"},
+	{symnotify.Rename, "rename"}, {symnotify.Chmod, "chmod"}, {symnotify.Overflow, "overflow"},
+	{symnotify.Moved, "moved"}, {symnotify.Rescan, "rescan"}, {symnotify.Error, "error"},
+	{symnotify.Resync, "resync"},
+}
+
+// opLabel returns the op label of op, the names of its operations joined by "|".
+func opLabel(op symnotify.Op) string {
+	var names []string
+	for _, o := range opNames {
+		if op&o.op != 0 {
+			names = append(names, o.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,99 @@
+package logwatch
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+)
+
+// workerQueue is the number of events queued for each worker before Watch blocks.
+const workerQueue = 64
+
+// Workers processes Write and Remove events on n goroutines, so a slow stat of a file on one volume
+// does not stall updates of files on others. Events for the same path are processed in order by the
+// same worker. Other events, which may affect more than one file, wait until queued events are processed.
+// The PathParser must be safe for concurrent use, as it already is for Rescan. An n <= 1 processes
+// events on the Watch goroutine.
+//
+// Files are stat-ed and read without the watcher lock, so workers wait for each other only to apply the results.
+func Workers(n int) Option {
+	return func(w *Watcher) {
+		if n > 1 {
+			w.pool = &workerPool{n: n}
+		}
+	}
+}
+
+// workerPool dispatches events to workers for Workers.
+type workerPool struct {
+	n       int
+	queues  []chan symnotify.Event // Nil unless Watch is running.
+	pending sync.WaitGroup         // Dispatched events not processed yet.
+}
+
+// numPathLocks is the number of locks that keep updates of the same path in order, see pathLock.
+const numPathLocks = 64
+
+// pathHash returns a hash of path to pick a worker or a lock.
+func pathHash(path string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(path))
+	return h.Sum32()
+}
+
+// pathLock returns the lock held while a path is stat-ed and updated.
+func (w *Watcher) pathLock(path string) *sync.Mutex {
+	return &w.pathLocks[pathHash(path)%numPathLocks]
+}
+
+// work processes a Write or Remove event dispatched to a worker. The path is stat-ed again, e.Info may be
+// older than an update of the path by the Watch goroutine, for example a deferred update, while e was queued.
+func (w *Watcher) work(e symnotify.Event) { w.updatePath(e.Name, false, nil) }
+
+// start starts the workers, they call handle for each event. Returns a function that
+// processes the queued events and stops the workers.
+func (p *workerPool) start(handle func(symnotify.Event)) func() {
+	if p == nil {
+		return func() {}
+	}
+	var running sync.WaitGroup
+	p.queues = make([]chan symnotify.Event, p.n)
+	for i := range p.queues {
+		q := make(chan symnotify.Event, workerQueue)
+		p.queues[i] = q
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			for e := range q {
+				handle(e)
+				p.pending.Done()
+			}
+		}()
+	}
+	return func() {
+		for _, q := range p.queues {
+			close(q)
+		}
+		running.Wait()
+		p.queues = nil
+	}
+}
+
+// dispatch queues e for the worker of its path, returns false if the workers are not running.
+// Called only by the Watch goroutine.
+func (p *workerPool) dispatch(e symnotify.Event) bool {
+	if p == nil || p.queues == nil {
+		return false
+	}
+	p.pending.Add(1)
+	p.queues[pathHash(e.Name)%uint32(p.n)] <- e
+	return true
+}
+
+// wait waits until the dispatched events are processed.
+func (p *workerPool) wait() {
+	if p != nil {
+		p.pending.Wait()
+	}
+}
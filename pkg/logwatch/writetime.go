@@ -0,0 +1,58 @@
+package logwatch
+
+import (
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WriteTimes also reports the time of the last write to the log files of each container,
+// from the modification time of the file when bytes were counted. Alerts on containers that
+// have been silent too long can find wedged applications.
+// Only files in the kubelet pod log layout are reported.
+func WriteTimes() Option { return func(w *Watcher) { w.writeTimes = map[Key]*writeTime{} } }
+
+// writeTime is the last write to a container.
+type writeTime struct {
+	time   time.Time
+	labels prometheus.Labels
+}
+
+// newWriteTimeMetrics creates the metrics for WriteTimes.
+func (w *Watcher) newWriteTimeMetrics() []prometheus.Collector {
+	w.lastWrite = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_last_write_timestamp_seconds",
+		Help: "Time of the last write to the log files of a container, in seconds since the epoch",
+	}, []string{"namespace", "podname", "containername"})
+	return []prometheus.Collector{w.lastWrite}
+}
+
+// recordWrite records add bytes written to the log file key of a container, last modified as in stat.
+// Must be called with w.mu locked.
+func (w *Watcher) recordWrite(key Key, namespace, podname, containername string, add float64, stat os.FileInfo) {
+	if w.writeTimes == nil || key.PodUID == "" || add <= 0 {
+		return
+	}
+	ck := Key{PodUID: key.PodUID, Container: key.Container}
+	wt := w.writeTimes[ck]
+	if wt == nil {
+		wt = &writeTime{labels: prometheus.Labels{"namespace": namespace, "podname": podname, "containername": containername}}
+		w.writeTimes[ck] = wt
+	}
+	if mtime := stat.ModTime(); mtime.After(wt.time) {
+		wt.time = mtime
+		w.lastWrite.With(wt.labels).Set(float64(mtime.UnixNano()) / float64(time.Second))
+	}
+}
+
+// removeWriteTimes deletes the write times of pod uid and their series.
+// Must be called with w.mu locked.
+func (w *Watcher) removeWriteTimes(uid string) {
+	for ck, wt := range w.writeTimes {
+		if ck.PodUID == uid {
+			delete(w.writeTimes, ck)
+			w.lastWrite.Delete(wt.labels)
+		}
+	}
+}
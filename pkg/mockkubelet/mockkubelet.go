@@ -0,0 +1,127 @@
+// package mockkubelet creates directory trees laid out like the kubelet's container logs,
+// for tests, load tests and demos.
+//
+// A tree has the kubelet layout under a root directory:
+//
+//	<root>/var/log/pods/<namespace>_<pod>_<uid>/<container>/<N>.log
+//	<root>/var/log/containers/<pod>_<namespace>_<container>-<id>.log -> <root>/var/log/pods/.../<N>.log
+//
+package mockkubelet
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Config describes a tree to generate.
+type Config struct {
+	Namespaces int // Number of namespaces.
+	Pods       int // Pods per namespace.
+	Containers int // Containers per pod.
+	Restarts   int // Restarts per container, each restart has a new N.log file and link.
+	Rotations  int // Rotated files for the current log of each container.
+	Size       int // Approximate size in bytes of each log file.
+}
+
+// Container is one container instance in a generated tree.
+type Container struct {
+	Namespace, Pod, PodUID, Name, ID string
+	Restart                          int
+	Path                             string // Log file under the pods directory.
+	Link                             string // Symlink to Path under the containers directory.
+}
+
+// Tree is a generated log tree.
+type Tree struct {
+	Root       string      // Root directory.
+	Pods       string      // Pod log directory <root>/var/log/pods.
+	Containers string      // Container log link directory <root>/var/log/containers.
+	Logs       []Container // All container instances, oldest restart first.
+}
+
+// Generate creates a tree under root, which need not exist.
+func Generate(root string, c Config) (*Tree, error) {
+	t := &Tree{
+		Root:       root,
+		Pods:       filepath.Join(root, "var", "log", "pods"),
+		Containers: filepath.Join(root, "var", "log", "containers"),
+	}
+	for _, dir := range []string{t.Pods, t.Containers} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	for n := 0; n < c.Namespaces; n++ {
+		namespace := fmt.Sprintf("namespace-%d", n)
+		for p := 0; p < c.Pods; p++ {
+			pod := fmt.Sprintf("pod-%d", p)
+			uid := fmt.Sprintf("%08x-0000-4000-8000-%012x", n, p)
+			for i := 0; i < c.Containers; i++ {
+				name := fmt.Sprintf("container-%d", i)
+				dir := filepath.Join(t.Pods, fmt.Sprintf("%s_%s_%s", namespace, pod, uid), name)
+				if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+					return nil, err
+				}
+				for r := 0; r <= c.Restarts; r++ {
+					ct := Container{Namespace: namespace, Pod: pod, PodUID: uid, Name: name, Restart: r}
+					ct.ID = fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d", uid, name, r))))
+					ct.Path = filepath.Join(dir, fmt.Sprintf("%d.log", r))
+					ct.Link = filepath.Join(t.Containers, fmt.Sprintf("%s_%s_%s-%s.log", pod, namespace, name, ct.ID))
+					if err := writeFile(ct.Path, c.Size); err != nil {
+						return nil, err
+					}
+					if err := os.Symlink(ct.Path, ct.Link); err != nil {
+						return nil, err
+					}
+					t.Logs = append(t.Logs, ct)
+				}
+				last := t.Logs[len(t.Logs)-1].Path
+				for j := 0; j < c.Rotations; j++ {
+					stamp := time.Date(2021, 1, 1, 0, 0, j, 0, time.UTC).Format("20060102-150405")
+					if err := writeFile(last+"."+stamp, c.Size); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+func writeFile(path string, size int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = WriteLines(f, size)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// WriteLines writes CRI formatted log lines totalling at least size bytes to out,
+// and returns the number of bytes written.
+func WriteLines(out io.Writer, size int) (int, error) {
+	const prefix = "2021-01-01T00:00:00.000000000Z stdout F "
+	written := 0
+	for written < size {
+		n := size - written - len(prefix) - 1
+		if n < 1 {
+			n = 1
+		} else if n > 80 {
+			n = 80
+		}
+		w, err := io.WriteString(out, prefix+strings.Repeat("x", n)+"\n")
+		written += w
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,41 @@
+package mockkubelet_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/log-file-metric-exporter/pkg/mockkubelet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	root, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(root) }()
+
+	tree, err := mockkubelet.Generate(root, mockkubelet.Config{
+		Namespaces: 2, Pods: 3, Containers: 2, Restarts: 1, Rotations: 2, Size: 1000,
+	})
+	require.NoError(t, err)
+	assert.Len(t, tree.Logs, 2*3*2*2)
+
+	links, err := ioutil.ReadDir(tree.Containers)
+	require.NoError(t, err)
+	assert.Len(t, links, len(tree.Logs))
+
+	for _, c := range tree.Logs {
+		info, err := os.Stat(c.Link)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, info.Size(), int64(1000))
+		k, err := logwatch.KeyOf(c.Link)
+		require.NoError(t, err)
+		assert.Equal(t, logwatch.Key{PodUID: c.PodUID, Container: c.Name, File: filepath.Base(c.Path)}, k)
+	}
+	rotated, err := filepath.Glob(tree.Logs[1].Path + ".*")
+	require.NoError(t, err)
+	assert.Len(t, rotated, 2)
+}
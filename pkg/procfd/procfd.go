@@ -0,0 +1,19 @@
+// package procfd finds files that have been deleted but are still held open by a process.
+//
+package procfd
+
+import (
+	"errors"
+
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+)
+
+// ErrUnsupported is returned on platforms without a /proc file system.
+var ErrUnsupported = errors.New("open file scanning is not supported on this platform")
+
+// File is a deleted file that is still open.
+type File struct {
+	Path string        // Path of the file before it was deleted.
+	ID   fsinfo.FileID // Identity of the file.
+	Size int64         // Current size of the file.
+}
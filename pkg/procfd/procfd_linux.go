@@ -0,0 +1,55 @@
+package procfd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+)
+
+const deletedSuffix = " (deleted)"
+
+// Deleted scans the file descriptors of all processes under the proc directory
+// and returns the deleted files that are still open.
+// Each file is returned once, even if it is open more than once.
+// Processes that can't be inspected are skipped.
+func Deleted(proc string) ([]File, error) {
+	pids, err := ioutil.ReadDir(proc)
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	seen := map[fsinfo.FileID]bool{}
+	for _, pid := range pids {
+		if _, err := strconv.Atoi(pid.Name()); err != nil {
+			continue // Not a process directory.
+		}
+		fdDir := filepath.Join(proc, pid.Name(), "fd")
+		fds, err := ioutil.ReadDir(fdDir)
+		if err != nil {
+			continue // Process exited or permission denied.
+		}
+		for _, fd := range fds {
+			fdPath := filepath.Join(fdDir, fd.Name())
+			target, err := os.Readlink(fdPath)
+			if err != nil || !strings.HasSuffix(target, deletedSuffix) {
+				continue
+			}
+			// Stat follows the /proc link to the deleted file itself.
+			info, err := os.Stat(fdPath)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			id, ok := fsinfo.ID(info)
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+			files = append(files, File{Path: strings.TrimSuffix(target, deletedSuffix), ID: id, Size: info.Size()})
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,47 @@
+package procfd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+	"github.com/log-file-metric-exporter/pkg/procfd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeletedFindsOpenFile(t *testing.T) {
+	file, err := ioutil.TempFile("", t.Name())
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.Write([]byte("hello"))
+	require.NoError(t, err)
+	info, err := file.Stat()
+	require.NoError(t, err)
+	id, ok := fsinfo.ID(info)
+	require.True(t, ok)
+
+	find := func() *procfd.File {
+		files, err := procfd.Deleted("/proc")
+		require.NoError(t, err)
+		for _, f := range files {
+			if f.ID == id {
+				return &f
+			}
+		}
+		return nil
+	}
+	assert.Nil(t, find(), "not deleted yet")
+	require.NoError(t, os.Remove(file.Name()))
+	f := find()
+	if assert.NotNil(t, f) {
+		assert.Equal(t, file.Name(), f.Path)
+		assert.Equal(t, int64(5), f.Size)
+	}
+	_, err = file.Write([]byte("world"))
+	require.NoError(t, err)
+	if f = find(); assert.NotNil(t, f) {
+		assert.Equal(t, int64(10), f.Size)
+	}
+}
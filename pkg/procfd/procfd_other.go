@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package procfd
+
+// Deleted is not supported on this platform.
+func Deleted(proc string) ([]File, error) { return nil, ErrUnsupported }
@@ -0,0 +1,60 @@
+// package sdnotify implements the systemd service notification protocol, see sd_notify(3).
+//
+// A service with Type=notify reports when it is ready, and with WatchdogSec= sends keepalives,
+// systemd restarts it if they stop. Messages are datagrams sent to the socket named by $NOTIFY_SOCKET,
+// when it is not set the service is not run by systemd and notifications are ignored.
+//
+package sdnotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// States that can be sent with Notify.
+const (
+	Ready    = "READY=1"    // Startup is complete.
+	Stopping = "STOPPING=1" // Shutdown has started.
+	Watchdog = "WATCHDOG=1" // Keepalive, see WatchdogInterval.
+)
+
+// Notify sends state to the service manager.
+// Returns false with no error if $NOTIFY_SOCKET is not set.
+func Notify(state string) (bool, error) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return false, nil
+	}
+	if name[0] == '@' {
+		name = "\x00" + name[1:] // Abstract socket.
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the watchdog timeout set by WatchdogSec=, or 0 if the watchdog is not enabled
+// for this process. Send Watchdog more often than the timeout, sd_watchdog_enabled(3) suggests half.
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil // Meant for another process.
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", usec)
+	}
+	return time.Duration(n) * time.Microsecond, nil
+}
@@ -0,0 +1,90 @@
+//go:build !windows
+// +build !windows
+
+package sdnotify_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/sdnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setenv sets environment variables for the duration of the test.
+func setenv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		require.NoError(t, os.Setenv(k, v))
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				_ = os.Setenv(k, old)
+			} else {
+				_ = os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	setenv(t, map[string]string{"NOTIFY_SOCKET": ""})
+	sent, err := sdnotify.Notify(sdnotify.Ready)
+	assert.NoError(t, err)
+	assert.False(t, sent, "not run by systemd")
+
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	setenv(t, map[string]string{"NOTIFY_SOCKET": name})
+	for _, state := range []string{sdnotify.Ready, sdnotify.Watchdog, sdnotify.Stopping} {
+		sent, err := sdnotify.Notify(state)
+		require.NoError(t, err)
+		assert.True(t, sent)
+		buf := make([]byte, 64)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, state, string(buf[:n]))
+	}
+
+	setenv(t, map[string]string{"NOTIFY_SOCKET": filepath.Join(dir, "nonesuch")})
+	_, err = sdnotify.Notify(sdnotify.Ready)
+	assert.Error(t, err)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	for _, x := range []struct {
+		usec, pid string
+		want      time.Duration
+		err       bool
+	}{
+		{"", "", 0, false},
+		{"30000000", "", 30 * time.Second, false},
+		{"30000000", pid, 30 * time.Second, false},
+		{"30000000", "1", 0, false},
+		{"nonsense", "", 0, true},
+		{"0", "", 0, true},
+	} {
+		setenv(t, map[string]string{"WATCHDOG_USEC": x.usec, "WATCHDOG_PID": x.pid})
+		d, err := sdnotify.WatchdogInterval()
+		if x.err {
+			assert.Error(t, err, "%+v", x)
+		} else {
+			assert.NoError(t, err, "%+v", x)
+		}
+		assert.Equal(t, x.want, d, "%+v", x)
+	}
+}
@@ -0,0 +1,105 @@
+package symnotify
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+)
+
+// MaxWatches limits the kernel watches used by the Watcher to n, leaving the rest of the
+// node-wide limit, e.g. fs.inotify.max_user_watches, for other processes. When a new watch
+// would exceed n, the least recently active watched path is polled instead, see PollInterval.
+// Directories watched only for symlink chains or AddFile count towards n but are not evicted,
+// if nothing can be evicted the new path is polled. Evicted paths are not watched again.
+// An n <= 0 means no limit.
+func MaxWatches(n int) Option { return func(w *Watcher) { w.budget.max = n } }
+
+// watchBudget tracks kernel watches and their last activity for MaxWatches.
+type watchBudget struct {
+	max int
+
+	mu      sync.Mutex
+	watches map[string]*watchUse // Kernel watches by path.
+}
+
+type watchUse struct {
+	last      time.Time // Last event for the path or an entry of it.
+	evictable bool      // Added by watch, see MaxWatches.
+}
+
+// added records a kernel watch for name.
+func (b *watchBudget) added(name string, evictable bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.watches == nil {
+		b.watches = map[string]*watchUse{}
+	}
+	if u := b.watches[name]; u != nil {
+		u.evictable = u.evictable && evictable
+		return
+	}
+	b.watches[name] = &watchUse{last: time.Now(), evictable: evictable}
+}
+
+// removed forgets the kernel watch for name.
+func (b *watchBudget) removed(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.watches, name)
+}
+
+// touch records activity for an event on name, for the watch on name or on its directory.
+func (b *watchBudget) touch(name string, now time.Time) {
+	if b.max <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, path := range []string{name, filepath.Dir(name)} {
+		if u := b.watches[path]; u != nil {
+			u.last = now
+		}
+	}
+}
+
+// victim returns the least recently active evictable watch if the budget is full, "" if there is none.
+// full is false if there is room for another watch.
+func (b *watchBudget) victim() (name string, full bool) {
+	if b.max <= 0 {
+		return "", false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.watches) < b.max {
+		return "", false
+	}
+	var oldest time.Time
+	for path, u := range b.watches {
+		if u.evictable && (name == "" || u.last.Before(oldest)) {
+			name, oldest = path, u.last
+		}
+	}
+	return name, true
+}
+
+// makeRoom evicts the least recently active watch if the budget is full, and polls it instead.
+// Returns false if the budget is full and nothing can be evicted.
+func (w *Watcher) makeRoom() bool {
+	victim, full := w.budget.victim()
+	if !full {
+		return true
+	}
+	if victim == "" {
+		return false
+	}
+	log.V(2).Info("Watch limit reached, polling least recently active path instead", "path", victim, "limit", w.budget.max)
+	// May fail if the kernel already dropped the watch.
+	_ = w.unwatch(victim)
+	w.poll(victim, false)
+	if w.hooks.WatchEvicted != nil {
+		w.hooks.WatchEvicted(victim)
+	}
+	return true
+}
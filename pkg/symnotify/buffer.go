@@ -0,0 +1,88 @@
+package symnotify
+
+import (
+	"fmt"
+	"time"
+)
+
+// DropPolicy decides what happens to an event when the event buffer is full, see Buffer.
+type DropPolicy int
+
+const (
+	// Block waits for the consumer. Events are not lost by the Watcher, but the kernel
+	// event queue can overflow while it waits, losing events for everything.
+	Block DropPolicy = iota
+	// DropNewest drops the event that does not fit.
+	DropNewest
+	// DropOldest drops the oldest buffered events to make room.
+	DropOldest
+)
+
+var dropPolicyNames = []string{"block", "newest", "oldest"}
+
+func (p DropPolicy) String() string {
+	if p < 0 || int(p) >= len(dropPolicyNames) {
+		return fmt.Sprintf("DropPolicy(%d)", int(p))
+	}
+	return dropPolicyNames[p]
+}
+
+// ParseDropPolicy parses the String form of a DropPolicy.
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	for i, name := range dropPolicyNames {
+		if s == name {
+			return DropPolicy(i), nil
+		}
+	}
+	return Block, fmt.Errorf("invalid drop policy %q, must be one of %v", s, dropPolicyNames)
+}
+
+// Buffer buffers up to size events for the consumer, so the Watcher keeps reading
+// the kernel event queue while the consumer is busy. By default events are not buffered.
+//
+// With DropNewest or DropOldest events are dropped when the buffer is full, and an Overflow
+// event is delivered when there is room again, so the consumer can rescan.
+// The buffer is at least 2 events with a drop policy, to make room for the Overflow event.
+// Close discards buffered events, CloseDrain waits for the consumer to receive them.
+func Buffer(size int, policy DropPolicy) Option {
+	return func(w *Watcher) {
+		if policy != Block && size < 2 {
+			size = 2
+		}
+		if size > 0 {
+			w.events = make(chan Event, size)
+		}
+		w.policy = policy
+	}
+}
+
+// enqueue sends e without blocking, applying the drop policy if the buffer is full.
+// Used only by the run goroutine, which is the only sender, so buffer space can only grow
+// while enqueue runs.
+func (w *Watcher) enqueue(e Event) {
+	need := 1
+	if w.lost {
+		need = 2
+	}
+	for cap(w.events)-len(w.events) < need {
+		if w.policy != DropOldest {
+			w.dropped(DropBuffer, e)
+			w.lost = true
+			return
+		}
+		select {
+		case old := <-w.events:
+			w.dropped(DropBuffer, old)
+			w.lost, need = true, 2
+		default: // The consumer made room.
+		}
+	}
+	if w.lost {
+		overflow := Event{Op: Overflow, Time: time.Now()}
+		w.events <- overflow
+		w.delivered(overflow)
+		w.lost = false
+	}
+	w.events <- e
+	w.delivered(e)
+}
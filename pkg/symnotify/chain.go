@@ -0,0 +1,117 @@
+package symnotify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/ViaQ/logerr/log"
+)
+
+// defaultMaxLinkDepth is the default limit on the length of a symlink chain, see MaxLinkDepth.
+const defaultMaxLinkDepth = 8
+
+// ErrLinkDepth is returned for a symlink chain longer than the MaxLinkDepth limit.
+var ErrLinkDepth = errors.New("too many chained symlinks")
+
+// MaxLinkDepth limits the number of symlinks in a chain starting at a watched symlink,
+// including the watched symlink. Longer chains, and symlink loops, are not watched.
+//
+// Writes to the final target of a chain are always notified on the watched symlink.
+// The directories of the other symlinks in the chain are also watched, so that if one
+// of them is changed to point elsewhere the watched symlink gets a Chmod event, as if its
+// own target was replaced.
+func MaxLinkDepth(n int) Option { return func(w *Watcher) { w.maxLinkDepth = n } }
+
+// chain returns the symlinks after name in the symlink chain starting at name,
+// and the final target if it does not exist, since it may be created later.
+// Returns ErrLinkDepth if the chain is longer than max.
+func chain(name string, max int) (links []string, err error) {
+	for depth := 1; ; depth++ {
+		target, err := os.Readlink(name)
+		if err != nil {
+			return links, err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+		info, err := os.Lstat(target)
+		if err == nil && !isSymlink(info) {
+			return links, nil
+		}
+		if depth >= max {
+			return links, ErrLinkDepth
+		}
+		links = append(links, target)
+		if err != nil {
+			return links, nil // Dangling, watch for the target to appear.
+		}
+		name = target
+	}
+}
+
+// setChain records the chain of watched symlink name and watches the directories in the chain.
+func (w *Watcher) setChain(name string, links []string) {
+	w.unchain(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(links) == 0 {
+		return
+	}
+	w.chains[name] = links
+	for _, link := range links {
+		if w.via[link] == nil {
+			w.via[link] = map[string]bool{}
+		}
+		w.via[link][name] = true
+		if err := w.refDir(filepath.Dir(link)); err != nil {
+			log.V(3).Info("Can't watch symlink chain directory...", "link", name, "dir", filepath.Dir(link), "err", err)
+		}
+	}
+}
+
+// unchain forgets the chain of watched symlink name, releasing directory watches no longer needed.
+func (w *Watcher) unchain(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, link := range w.chains[name] {
+		delete(w.via[link], name)
+		if len(w.via[link]) == 0 {
+			delete(w.via, link)
+		}
+		w.unrefDir(filepath.Dir(link))
+	}
+	delete(w.chains, name)
+}
+
+// chained returns the watched symlinks that have a chain, including those whose watch failed.
+// Must be called with w.mu locked.
+func (w *Watcher) chained() map[string]bool {
+	m := make(map[string]bool, len(w.chains))
+	for name := range w.chains {
+		m[name] = true
+	}
+	return m
+}
+
+// relink re-watches symlinks whose chain goes through e.Name if it changed, returns Chmod events for them.
+func (w *Watcher) relink(e Event) (events []Event) {
+	if e.Op&(Create|Remove|Rename|Chmod) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	var dependents []string
+	for name := range w.via[e.Name] {
+		dependents = append(dependents, name)
+	}
+	w.mu.Unlock()
+	for _, name := range dependents {
+		log.V(2).Info("Symlink chain changed...", "link", name, "changed", e.Name)
+		_ = w.unwatch(name)
+		if err := w.addLink(name); err != nil {
+			log.V(3).Info("Can't watch symlink...", "link", name, "err", err)
+		}
+		events = append(events, Event{Name: name, Op: Chmod, Info: w.info(name, nil)})
+	}
+	return events
+}
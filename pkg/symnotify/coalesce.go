@@ -0,0 +1,32 @@
+package symnotify
+
+// coalescer merges consecutive events with the same name and Op.
+type coalescer struct {
+	pending []Event
+	last    map[string]int // Index of the last pending event for each name.
+}
+
+// add events, dropping events that repeat the last pending event for their name.
+// The pending event gets the Info of the dropped event. Returns the dropped events.
+func (c *coalescer) add(events []Event) (dropped []Event) {
+	if c.last == nil {
+		c.last = map[string]int{}
+	}
+	for _, e := range events {
+		if i, ok := c.last[e.Name]; ok && c.pending[i].Op == e.Op {
+			c.pending[i].Info = e.Info // Keep the latest state.
+			dropped = append(dropped, e)
+			continue
+		}
+		c.last[e.Name] = len(c.pending)
+		c.pending = append(c.pending, e)
+	}
+	return dropped
+}
+
+// flush returns the pending events and resets the coalescer.
+func (c *coalescer) flush() []Event {
+	events := c.pending
+	c.pending, c.last = nil, nil
+	return events
+}
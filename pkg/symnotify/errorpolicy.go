@@ -0,0 +1,86 @@
+package symnotify
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrorAction is what the Watcher does about an error examining a path for an event, see ErrorPolicy.
+type ErrorAction int
+
+const (
+	// Skip delivers the event, a symlink or subdirectory that could not be examined is not watched.
+	Skip ErrorAction = iota
+	// Retry holds the event and processes it again after the RetryDelay.
+	Retry
+	// Surface delivers the event followed by an Error event with the error.
+	Surface
+)
+
+var errorActionNames = []string{"skip", "retry", "surface"}
+
+func (a ErrorAction) String() string {
+	if a < 0 || int(a) >= len(errorActionNames) {
+		return fmt.Sprintf("ErrorAction(%d)", int(a))
+	}
+	return errorActionNames[a]
+}
+
+// defaultRetryDelay is the default delay before retrying an event, see RetryDelay.
+const defaultRetryDelay = 100 * time.Millisecond
+
+// ErrorPolicy decides what to do about err examining path while processing an event,
+// for example a symlink whose target is briefly missing or unreadable while a pod is torn down.
+// attempt is 1 for the first error, and counts the retries of the same event.
+// The policy is called from the Watcher goroutine, it must be fast and must not call the Watcher.
+type ErrorPolicy func(path string, err error, attempt int) ErrorAction
+
+// WithErrorPolicy sets the ErrorPolicy for errors examining symlinks and new entries.
+// The default is to Skip. Errors are reported to Hooks.StatError whatever the policy.
+func WithErrorPolicy(p ErrorPolicy) Option { return func(w *Watcher) { w.errorPolicy = p } }
+
+// RetryDelay sets the delay before an event is processed again, see Retry.
+func RetryDelay(d time.Duration) Option { return func(w *Watcher) { w.retryDelay = d } }
+
+// RetryTransient returns an ErrorPolicy that retries errors for missing paths or denied permission
+// until attempt n, and then returns then. Other errors also return then.
+func RetryTransient(n int, then ErrorAction) ErrorPolicy {
+	return func(_ string, err error, attempt int) ErrorAction {
+		if attempt <= n && (os.IsNotExist(err) || os.IsPermission(err)) {
+			return Retry
+		}
+		return then
+	}
+}
+
+// onError applies the ErrorPolicy to err processing e. Returns true if e is held for a retry,
+// and the Error event to deliver if any. Used only by the run goroutine.
+func (w *Watcher) onError(e Event, err error) (held bool, surfaced []Event) {
+	if w.errorPolicy == nil {
+		return false, nil
+	}
+	if w.attempts == nil {
+		w.attempts = map[string]int{}
+	}
+	w.attempts[e.Name]++
+	switch w.errorPolicy(e.Name, err, w.attempts[e.Name]) {
+	case Retry:
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		time.AfterFunc(w.retryDelay, func() {
+			select {
+			case w.retryEvents <- e:
+			case <-w.done:
+			}
+		})
+		return true, nil
+	case Surface:
+		delete(w.attempts, e.Name)
+		return false, []Event{{Name: e.Name, Op: Error, Err: err}}
+	default:
+		delete(w.attempts, e.Name)
+		return false, nil
+	}
+}
@@ -0,0 +1,72 @@
+package symnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDeniedWatcher returns a Watcher watching dir/logs, where the first n watches for link return EACCES.
+func newDeniedWatcher(t *testing.T, n int, opts ...Option) (w *Watcher, link, target string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	logs := filepath.Join(dir, "logs")
+	require.NoError(t, os.Mkdir(logs, os.ModePerm))
+	link, target = filepath.Join(logs, "log"), filepath.Join(dir, "target")
+	require.NoError(t, ioutil.WriteFile(target, nil, 0600))
+
+	w, err = NewWatcher(append([]Option{NoFileInfo(), RetryDelay(time.Millisecond)}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	add := w.addWatch
+	w.addWatch = func(name string) error {
+		if name == link && n > 0 {
+			n--
+			return syscall.EACCES
+		}
+		return add(name)
+	}
+	require.NoError(t, w.Add(logs))
+	require.NoError(t, os.Symlink(target, link))
+	return w, link, target
+}
+
+func TestErrorPolicySkip(t *testing.T) {
+	w, link, target := newDeniedWatcher(t, 1)
+	assert.Equal(t, Event{Name: link, Op: Create}, nextEvent(t, w))
+	require.NoError(t, ioutil.WriteFile(target, []byte("x"), 0600))
+	_, err := w.EventTimeout(100 * time.Millisecond)
+	assert.Error(t, err, "target should not be watched")
+}
+
+func TestErrorPolicyRetry(t *testing.T) {
+	var attempts []int
+	w, link, target := newDeniedWatcher(t, 2, WithErrorPolicy(func(path string, err error, attempt int) ErrorAction {
+		attempts = append(attempts, attempt)
+		return RetryTransient(3, Skip)(path, err, attempt)
+	}))
+	assert.Equal(t, Event{Name: link, Op: Create}, nextEvent(t, w))
+	assert.Equal(t, []int{1, 2}, attempts)
+	require.NoError(t, ioutil.WriteFile(target, []byte("x"), 0600))
+	assert.Equal(t, Event{Name: link, Op: Write}, nextEvent(t, w))
+}
+
+func TestErrorPolicySurface(t *testing.T) {
+	w, link, _ := newDeniedWatcher(t, 1, WithErrorPolicy(RetryTransient(0, Surface)))
+	assert.Equal(t, Event{Name: link, Op: Create}, nextEvent(t, w))
+	e := nextEvent(t, w)
+	assert.Equal(t, Event{Name: link, Op: Error, Err: syscall.EACCES}, e)
+}
+
+func TestErrorActionString(t *testing.T) {
+	assert.Equal(t, "retry", Retry.String())
+	assert.Equal(t, "ErrorAction(9)", ErrorAction(9).String())
+}
@@ -0,0 +1,348 @@
+package symnotify
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var _ Interface = &Fake{}
+
+// Fake is an Interface for tests that reports changes made to a MemFS, without timing.
+// Each change is turned into events as it is made, so events are queued in a predictable order
+// before the change returns. Events are like those of a Watcher with Moves:
+//   - paths in an added directory, or added by AddFile, get events for their own changes;
+//   - symlinks in an added directory, or added by AddFile, get events for changes to their target;
+//   - a rename within watched paths is a Moved event, otherwise Rename and Create events;
+//   - Info is the MemFS Stat of Name, Time is MemFS.Now.
+//
+// Read events with Next to handle them synchronously, or with Events, but not both.
+type Fake struct {
+	fs *MemFS
+
+	mu       sync.Mutex
+	watches  map[string]fakeWatch // By resolved path.
+	links    map[string]string    // Resolved symlink targets by watched symlink name.
+	queue    []Event
+	degraded bool
+
+	events    chan Event
+	errors    chan error
+	ready     chan struct{} // Signals the queue is not empty.
+	done      chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+// fakeWatch is a path added to a Fake.
+type fakeWatch struct {
+	name string
+	ops  Op   // Ops to deliver, 0 for all.
+	dir  bool // Added by Add, entries are watched.
+}
+
+// NewFake returns a Fake that watches fs.
+func NewFake(fs *MemFS) *Fake {
+	f := &Fake{
+		fs:      fs,
+		watches: map[string]fakeWatch{},
+		links:   map[string]string{},
+		events:  make(chan Event),
+		errors:  make(chan error, errorBuffer),
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	fs.watch(f.notify)
+	return f
+}
+
+// Add watches name, and its entries if it is a directory.
+func (f *Fake) Add(name string, ops ...Op) error { return f.add(name, true, ops) }
+
+// AddFile watches name only.
+func (f *Fake) AddFile(name string, ops ...Op) error { return f.add(name, false, ops) }
+
+func (f *Fake) add(name string, dir bool, ops []Op) error {
+	name = filepath.Clean(name)
+	real, err := f.fs.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+	info, err := f.fs.Stat(real)
+	if err != nil {
+		return err
+	}
+	var mask Op
+	for _, op := range ops {
+		mask |= op
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.watches[real] = fakeWatch{name: name, ops: mask, dir: dir && info.IsDir()}
+	f.relink()
+	return nil
+}
+
+func (f *Fake) Remove(name string) error {
+	name = filepath.Clean(name)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for real, w := range f.watches {
+		if w.name == name {
+			delete(f.watches, real)
+			f.relink()
+			return nil
+		}
+	}
+	return fmt.Errorf("can't remove non-existent watch for: %s", name)
+}
+
+// Events starts delivering queued events on the returned channel, which is closed by Close.
+func (f *Fake) Events() <-chan Event {
+	f.startOnce.Do(func() { go f.run() })
+	return f.events
+}
+
+func (f *Fake) Errors() <-chan error { return f.errors }
+
+// WatchList returns the sorted names passed to Add and AddFile.
+func (f *Fake) WatchList() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, w := range f.watches {
+		names = append(names, w.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Degraded returns the value set by SetDegraded.
+func (f *Fake) Degraded() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.degraded
+}
+
+// SetDegraded sets the value returned by Degraded.
+func (f *Fake) SetDegraded(degraded bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.degraded = degraded
+}
+
+// Depth returns the number of queued events as Buffered.
+func (f *Fake) Depth() Depth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return Depth{Buffered: len(f.queue)}
+}
+
+func (f *Fake) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.done)
+		f.startOnce.Do(func() { close(f.events) }) // Not started, nothing else will close it.
+	})
+	return nil
+}
+
+// Next removes and returns the next queued event, false if there is none.
+func (f *Fake) Next() (Event, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queue) == 0 {
+		return Event{}, false
+	}
+	e := f.queue[0]
+	f.queue = f.queue[1:]
+	return e, true
+}
+
+// Inject queues e as if it was made by a Watcher, for example an Overflow or Rescan event.
+// Time is set to MemFS.Now if it is zero.
+func (f *Fake) Inject(e Event) {
+	if e.Time.IsZero() {
+		e.Time = f.fs.Now()
+	}
+	f.push(e)
+}
+
+// Fail delivers err on the Errors channel, it is dropped if the error buffer is full.
+func (f *Fake) Fail(err error) {
+	select {
+	case f.errors <- err:
+	default:
+	}
+}
+
+// run delivers queued events on the events channel until closed.
+func (f *Fake) run() {
+	defer close(f.events)
+	for {
+		e, ok := f.Next()
+		if !ok {
+			select {
+			case <-f.ready:
+				continue
+			case <-f.done:
+				return
+			}
+		}
+		select {
+		case f.events <- e:
+		case <-f.done:
+			return
+		}
+	}
+}
+
+func (f *Fake) push(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	f.mu.Lock()
+	f.queue = append(f.queue, events...)
+	f.mu.Unlock()
+	select {
+	case f.ready <- struct{}{}:
+	default:
+	}
+}
+
+// notify is called by the MemFS for each change, with resolved paths.
+func (f *Fake) notify(change Event) {
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+	f.mu.Lock()
+	var events []Event
+	if change.Op == Moved {
+		events = f.moved(change.OldName, change.Name)
+	} else {
+		events = f.match(change.Name, change.Op)
+	}
+	f.relink() // Symlinks or their targets may have changed.
+	f.mu.Unlock()
+	now := f.fs.Now()
+	for i := range events {
+		events[i].Time = now
+		if info, err := f.fs.Stat(events[i].Name); err == nil {
+			events[i].Info = info
+		}
+	}
+	f.push(events...)
+}
+
+// match returns the events for a change to resolved path real. Must be called with f.mu locked.
+func (f *Fake) match(real string, op Op) []Event {
+	var events []Event
+	for _, name := range f.names(real) {
+		if e, ok := f.filter(Event{Name: name, Op: op}); ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// moved returns the events for a rename from resolved path old to new. Must be called with f.mu locked.
+func (f *Fake) moved(old, new string) []Event {
+	oldNames, newNames := f.names(old), f.names(new)
+	if len(oldNames) == 1 && len(newNames) == 1 {
+		if e, ok := f.filter(Event{Name: newNames[0], Op: Moved, OldName: oldNames[0]}); ok {
+			return []Event{e}
+		}
+		return nil
+	}
+	return append(f.match(old, Rename), f.match(new, Create)...)
+}
+
+// names returns the sorted watched names for resolved path real: the path in a watched directory
+// or added file, and watched symlinks to it. Must be called with f.mu locked.
+func (f *Fake) names(real string) []string {
+	var names []string
+	if w, ok := f.watches[real]; ok && !w.dir {
+		names = append(names, w.name)
+	}
+	if w, ok := f.watches[filepath.Dir(real)]; ok && w.dir {
+		names = append(names, filepath.Join(w.name, filepath.Base(real)))
+	}
+	for link, target := range f.links {
+		if target == real && link != real {
+			names = append(names, link)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// filter applies the Ops of the nearest watch to e, see Watcher.Add.
+// Must be called with f.mu locked.
+func (f *Fake) filter(e Event) (Event, bool) {
+	var mask Op
+	for dir := e.Name; ; dir = filepath.Dir(dir) {
+		if w, ok := f.watch(dir); ok {
+			mask = w.ops
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	if mask == 0 {
+		return e, true
+	}
+	if e.Op == Moved && mask&Rename == 0 {
+		e.Op, e.OldName = Create, ""
+	}
+	if mask&Rename != 0 {
+		mask |= Moved
+	}
+	e.Op &= mask
+	return e, e.Op != 0
+}
+
+// watch returns the watch with the given name. Must be called with f.mu locked.
+func (f *Fake) watch(name string) (fakeWatch, bool) {
+	for _, w := range f.watches {
+		if w.name == name {
+			return w, true
+		}
+	}
+	return fakeWatch{}, false
+}
+
+// relink finds the targets of watched symlinks. A missing target is recorded by its path,
+// so it gets events when it is created. Must be called with f.mu locked.
+func (f *Fake) relink() {
+	f.links = map[string]string{}
+	for real, w := range f.watches {
+		if !w.dir {
+			f.link(w.name)
+			continue
+		}
+		infos, _ := f.fs.ReadDir(real)
+		for _, info := range infos {
+			f.link(filepath.Join(w.name, info.Name()))
+		}
+	}
+}
+
+// link records the target of name if it is a symlink. Must be called with f.mu locked.
+func (f *Fake) link(name string) {
+	if info, err := f.fs.Lstat(name); err != nil || !isSymlink(info) {
+		return
+	}
+	target, err := f.fs.EvalSymlinks(name)
+	if err != nil {
+		if target, err = f.fs.Readlink(name); err != nil {
+			return
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+	}
+	f.links[name] = target
+}
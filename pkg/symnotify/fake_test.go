@@ -0,0 +1,120 @@
+package symnotify_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEvents returns the queued events without Info, so they can be compared with expected events.
+func fakeEvents(t *testing.T, f *symnotify.Fake) []symnotify.Event {
+	t.Helper()
+	var events []symnotify.Event
+	for e, ok := f.Next(); ok; e, ok = f.Next() {
+		assert.False(t, e.Time.IsZero(), "event without time: %v", e)
+		e.Info, e.Time = nil, time.Time{}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestMemFS(t *testing.T) {
+	fs := symnotify.NewMemFS()
+	require.NoError(t, fs.MkdirAll("/targets/a"))
+	require.NoError(t, fs.WriteFile("/targets/a/file", []byte("hello")))
+	require.NoError(t, fs.Symlink("a", "/targets/dir"))
+	require.NoError(t, fs.Symlink("/targets/dir/file", "/link"))
+
+	info, err := fs.Stat("/link")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size())
+	info, err = fs.Lstat("/link")
+	require.NoError(t, err)
+	assert.True(t, info.Mode()&os.ModeSymlink != 0)
+	real, err := fs.EvalSymlinks("/link")
+	require.NoError(t, err)
+	assert.Equal(t, "/targets/a/file", real)
+
+	infos, err := fs.ReadDir("/targets")
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "a", infos[0].Name())
+	assert.Equal(t, "dir", infos[1].Name())
+
+	require.NoError(t, fs.Append("/link", []byte(" world")))
+	info, err = fs.Stat("/targets/a/file")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), info.Size())
+	file, err := fs.Open("/link")
+	require.NoError(t, err)
+	_, err = file.Seek(6, io.SeekStart)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+	require.NoError(t, file.Close())
+	_, err = fs.Open("/targets")
+	assert.Error(t, err, "directory")
+
+	assert.Error(t, fs.Remove("/targets/a"), "not empty")
+	require.NoError(t, fs.Rename("/targets/a", "/targets/b"))
+	_, err = fs.Stat("/link")
+	assert.True(t, os.IsNotExist(err), "%v", err)
+	_, err = fs.Stat("/targets/b/file")
+	assert.NoError(t, err)
+	require.NoError(t, fs.Symlink("/loop", "/loop"))
+	_, err = fs.Stat("/loop")
+	assert.Error(t, err)
+}
+
+func TestFake(t *testing.T) {
+	fs := symnotify.NewMemFS()
+	require.NoError(t, fs.MkdirAll("/logs"))
+	require.NoError(t, fs.MkdirAll("/targets"))
+	f := symnotify.NewFake(fs)
+	defer f.Close()
+	require.NoError(t, f.Add("/logs", symnotify.Create, symnotify.Write, symnotify.Remove, symnotify.Rename))
+	assert.Equal(t, []string{"/logs"}, f.WatchList())
+
+	require.NoError(t, fs.WriteFile("/targets/a", nil))
+	assert.Empty(t, fakeEvents(t, f), "not watched")
+	require.NoError(t, fs.Symlink("/targets/a", "/logs/a"))
+	require.NoError(t, fs.Append("/targets/a", []byte("x")))
+	require.NoError(t, fs.WriteFile("/logs/b", []byte("y")))
+	require.NoError(t, fs.Rename("/logs/b", "/logs/c"))
+	require.NoError(t, fs.Remove("/targets/a"))
+	require.NoError(t, fs.WriteFile("/targets/a", nil))
+	assert.Equal(t, []symnotify.Event{
+		{Name: "/logs/a", Op: symnotify.Create},
+		{Name: "/logs/a", Op: symnotify.Write},
+		{Name: "/logs/b", Op: symnotify.Create},
+		{Name: "/logs/b", Op: symnotify.Write},
+		{Name: "/logs/c", Op: symnotify.Moved, OldName: "/logs/b"},
+		{Name: "/logs/a", Op: symnotify.Remove},
+		{Name: "/logs/a", Op: symnotify.Create},
+		{Name: "/logs/a", Op: symnotify.Write},
+	}, fakeEvents(t, f))
+
+	require.NoError(t, fs.Rename("/logs/c", "/targets/c"))
+	assert.Equal(t, []symnotify.Event{{Name: "/logs/c", Op: symnotify.Rename}}, fakeEvents(t, f))
+
+	f.Inject(symnotify.Event{Op: symnotify.Overflow})
+	assert.Equal(t, symnotify.Depth{Buffered: 1}, f.Depth())
+	f.Fail(errors.New("oops"))
+	assert.EqualError(t, <-f.Errors(), "oops")
+	e := <-f.Events()
+	assert.Equal(t, symnotify.Overflow, e.Op)
+
+	require.NoError(t, f.Remove("/logs"))
+	require.NoError(t, fs.WriteFile("/logs/d", nil))
+	require.NoError(t, f.Close())
+	_, ok := <-f.Events()
+	assert.False(t, ok)
+}
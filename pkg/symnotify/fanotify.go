@@ -0,0 +1,14 @@
+package symnotify
+
+// Fanotify uses a single fanotify descriptor instead of an inotify watch per directory.
+// Each path passed to Add or AddFile, and each symlink target, marks the whole file system
+// containing it, events for paths that are not watched are discarded by the Watcher.
+// This avoids the per-watch kernel memory and fs.inotify.max_user_watches limit on nodes with
+// very many log files, but every change on the file system is read, so it suits a file system
+// that mostly holds logs.
+//
+// Only available on Linux 5.9 or later, and needs the CAP_SYS_ADMIN and CAP_DAC_READ_SEARCH
+// capabilities, NewWatcher returns an error otherwise. Events are reported for resolved paths
+// and translated back to symlinks, so symlink targets are watched the same way as with kqueue,
+// see targets.go. MaxWatches is not needed with fanotify.
+func Fanotify() Option { return func(w *Watcher) { w.fanotify = true } }
@@ -0,0 +1,285 @@
+package symnotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sys/unix"
+)
+
+// fanotifyMask are the events read by the fanotify backend, FAN_ONDIR includes directories.
+const fanotifyMask = unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO |
+	unix.FAN_MODIFY | unix.FAN_ATTRIB | unix.FAN_ONDIR
+
+// maxFanotifyDirs limits the cache of directory paths by file handle.
+const maxFanotifyDirs = 4096
+
+// fanotify is a backend with a file system mark for each file system containing an added path.
+// Events report the directory as a file handle and the entry name, directory handles are
+// opened to find their path, which needs CAP_DAC_READ_SEARCH.
+type fanotify struct {
+	fd      int      // Not the Fd of file, which would make file blocking.
+	file    *os.File // Non-blocking, so Close interrupts Read.
+	eventCh chan fsnotify.Event
+	errorCh chan error
+	done    chan struct{}
+	once    sync.Once
+
+	mu      sync.Mutex
+	watched map[string]bool   // Resolved paths added, events for other paths are dropped.
+	mounts  map[unix.Fsid]int // Directory descriptor in each marked file system, for open_by_handle_at.
+	dirs    map[string]string // Directory paths by file system ID and file handle.
+}
+
+func newFanotify() (backend, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK|unix.FAN_REPORT_DFID_NAME, unix.O_RDONLY|unix.O_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify_init: %w", err)
+	}
+	f := &fanotify{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "fanotify"),
+		eventCh: make(chan fsnotify.Event),
+		errorCh: make(chan error),
+		done:    make(chan struct{}),
+		watched: map[string]bool{},
+		mounts:  map[unix.Fsid]int{},
+		dirs:    map[string]string{},
+	}
+	go f.read()
+	return f, nil
+}
+
+func (f *fanotify) events() <-chan fsnotify.Event { return f.eventCh }
+func (f *fanotify) errors() <-chan error          { return f.errorCh }
+
+// Add delivers events for name, and its entries if it is a directory.
+// Marks the file system containing name if it is not marked yet.
+func (f *fanotify) Add(name string) error {
+	path, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.mounts[fs.Fsid]; !ok {
+		if err := unix.FanotifyMark(f.fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, fanotifyMask, unix.AT_FDCWD, path); err != nil {
+			return &os.PathError{Op: "fanotify_mark", Path: path, Err: err}
+		}
+		// open_by_handle_at does not accept an O_PATH descriptor.
+		dir := path
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		mount, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return &os.PathError{Op: "open", Path: dir, Err: err}
+		}
+		f.mounts[fs.Fsid] = mount
+	}
+	f.watched[path] = true
+	return nil
+}
+
+// Remove stops delivering events for name, file system marks are kept until Close.
+func (f *fanotify) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.watched[name] {
+		if path, err := filepath.EvalSymlinks(name); err == nil {
+			name = path
+		}
+	}
+	if !f.watched[name] {
+		return fmt.Errorf("can't remove non-existent fanotify watch for: %s", name)
+	}
+	delete(f.watched, name)
+	return nil
+}
+
+func (f *fanotify) Close() error {
+	var err error
+	f.once.Do(func() {
+		close(f.done)
+		err = f.file.Close()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, mount := range f.mounts {
+			_ = unix.Close(mount)
+		}
+	})
+	return err
+}
+
+// read events until Close.
+func (f *fanotify) read() {
+	defer close(f.errorCh)
+	defer close(f.eventCh)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				f.sendError(err)
+			}
+			return
+		}
+		for off := 0; off+unix.FAN_EVENT_METADATA_LEN <= n; {
+			meta := (*unix.FanotifyEventMetadata)(unsafe.Pointer(&buf[off]))
+			end := off + int(meta.Event_len)
+			if meta.Event_len < unix.FAN_EVENT_METADATA_LEN || end > n {
+				break
+			}
+			if meta.Fd >= 0 {
+				_ = unix.Close(int(meta.Fd))
+			}
+			if !f.event(meta.Mask, buf[off+int(meta.Metadata_len):end]) {
+				return
+			}
+			off = end
+		}
+	}
+}
+
+// event sends the events for an fanotify event with info records, returns false if closed.
+func (f *fanotify) event(mask uint64, info []byte) bool {
+	if mask&unix.FAN_Q_OVERFLOW != 0 {
+		return f.sendError(fsnotify.ErrEventOverflow)
+	}
+	path, ok := f.path(info)
+	if mask&unix.FAN_ONDIR != 0 && mask&(unix.FAN_DELETE|unix.FAN_MOVED_FROM|unix.FAN_MOVED_TO) != 0 {
+		f.clearDirs() // Cached paths may be wrong now.
+	}
+	if !ok || !f.isWatched(path) {
+		return true
+	}
+	for _, op := range []struct {
+		mask uint64
+		op   fsnotify.Op
+	}{
+		{unix.FAN_CREATE | unix.FAN_MOVED_TO, fsnotify.Create},
+		{unix.FAN_MODIFY, fsnotify.Write},
+		{unix.FAN_ATTRIB, fsnotify.Chmod},
+		{unix.FAN_MOVED_FROM, fsnotify.Rename},
+		{unix.FAN_DELETE, fsnotify.Remove},
+	} {
+		if mask&op.mask == 0 {
+			continue
+		}
+		select {
+		case f.eventCh <- fsnotify.Event{Name: path, Op: op.op}:
+		case <-f.done:
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fanotify) sendError(err error) bool {
+	select {
+	case f.errorCh <- err:
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+// isWatched returns true if path or its directory was added.
+func (f *fanotify) isWatched(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.watched[path] || f.watched[filepath.Dir(path)]
+}
+
+// path returns the path from a directory file handle and name info record.
+// Returns false if there is no such record, or the directory no longer exists.
+func (f *fanotify) path(info []byte) (string, bool) {
+	const (
+		headerLen = 4  // struct fanotify_event_info_header
+		handleAt  = 12 // header and fsid
+		handleLen = 8  // struct file_handle without f_handle
+	)
+	for len(info) >= headerLen {
+		infoType, infoLen := info[0], int(*(*uint16)(unsafe.Pointer(&info[2])))
+		if infoLen < headerLen || infoLen > len(info) {
+			return "", false
+		}
+		record := info[:infoLen]
+		info = info[infoLen:]
+		if (infoType != unix.FAN_EVENT_INFO_TYPE_DFID_NAME && infoType != unix.FAN_EVENT_INFO_TYPE_DFID) ||
+			len(record) < handleAt+handleLen {
+			continue
+		}
+		size := int(*(*uint32)(unsafe.Pointer(&record[handleAt])))
+		nameAt := handleAt + handleLen + size
+		if nameAt > len(record) {
+			return "", false
+		}
+		dir, ok := f.dir(record[headerLen:nameAt])
+		if !ok {
+			return "", false
+		}
+		name := ""
+		if infoType == unix.FAN_EVENT_INFO_TYPE_DFID_NAME {
+			name = string(record[nameAt:])
+			if i := strings.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+		}
+		if name == "" || name == "." {
+			return dir, true // Event on the directory itself.
+		}
+		return filepath.Join(dir, name), true
+	}
+	return "", false
+}
+
+// dir returns the path of a directory from its fsid and struct file_handle.
+func (f *fanotify) dir(id []byte) (string, bool) {
+	key := string(id)
+	fsid := unix.Fsid{Val: [2]int32{*(*int32)(unsafe.Pointer(&id[0])), *(*int32)(unsafe.Pointer(&id[4]))}}
+	f.mu.Lock()
+	dir, cached := f.dirs[key]
+	mount, marked := f.mounts[fsid]
+	f.mu.Unlock()
+	if cached {
+		return dir, true
+	}
+	if !marked {
+		return "", false
+	}
+	handleType := *(*int32)(unsafe.Pointer(&id[12]))
+	fd, err := unix.OpenByHandleAt(mount, unix.NewFileHandle(handleType, id[16:]), unix.O_PATH|unix.O_CLOEXEC)
+	if err != nil {
+		return "", false // Removed, or stale.
+	}
+	defer unix.Close(fd)
+	dir, err = os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+	if err != nil || strings.HasSuffix(dir, " (deleted)") {
+		return "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.dirs) >= maxFanotifyDirs {
+		f.dirs = map[string]string{}
+	}
+	f.dirs[key] = dir
+	return dir, true
+}
+
+func (f *fanotify) clearDirs() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dirs = map[string]string{}
+}
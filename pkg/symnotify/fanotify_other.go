@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package symnotify
+
+import "errors"
+
+func newFanotify() (backend, error) {
+	return nil, errors.New("fanotify is only available on Linux")
+}
@@ -0,0 +1,100 @@
+package symnotify
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AddFile watches a single file without delivering events for other entries of its directory.
+// The directory is watched, so the file can be created, removed and replaced.
+// If the file is a symlink, writes to its target are notified as for Add.
+// If ops are given, only events with those Ops are delivered.
+// Use Remove to stop watching the file.
+func (w *Watcher) AddFile(name string, ops ...Op) error {
+	name = filepath.Clean(name)
+	var mask Op
+	for _, op := range ops {
+		mask |= op
+	}
+	w.mu.Lock()
+	if _, ok := w.files[name]; ok {
+		w.files[name] = mask
+		w.mu.Unlock()
+		return nil
+	}
+	err := w.refDir(filepath.Dir(name))
+	if err == nil {
+		w.files[name] = mask
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(name)
+	if err == nil {
+		w.moves.record(name, info)
+		if w.snapshot {
+			w.queueSnapshot([]Event{{Name: name, Op: Create, Info: w.info(name, info)}})
+		}
+	}
+	if err == nil && isSymlink(info) {
+		_ = w.addLink(name)
+	}
+	return nil
+}
+
+// removeFile stops watching a file added by AddFile.
+func (w *Watcher) removeFile(name string) error {
+	w.removeLink(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.files, name)
+	w.unrefDir(filepath.Dir(name))
+	return nil
+}
+
+// ownWatch returns true if dir is watched for Add or Recursive, not only for its entries.
+// Must be called with w.mu locked.
+func (w *Watcher) ownWatch(dir string) bool {
+	_, added := w.added[dir]
+	return added || w.subdirs[dir]
+}
+
+// refDir watches dir to see some of its entries, counting references.
+// Must be called with w.mu locked.
+func (w *Watcher) refDir(dir string) error {
+	if w.innerDirs[dir] == 0 && !w.ownWatch(dir) {
+		if err := w.addWatch(dir); err != nil {
+			return err
+		}
+		w.watchAdded(dir)
+		w.budget.added(dir, false)
+	}
+	w.innerDirs[dir]++
+	return nil
+}
+
+// unrefDir releases a reference from refDir, and the watch on dir with the last reference.
+// Must be called with w.mu locked.
+func (w *Watcher) unrefDir(dir string) {
+	if w.innerDirs[dir]--; w.innerDirs[dir] > 0 {
+		return
+	}
+	delete(w.innerDirs, dir)
+	if !w.ownWatch(dir) {
+		// May fail if the kernel already dropped the watch.
+		_ = w.unwatch(dir)
+	}
+}
+
+// inner returns true if name is only watched as an entry of a directory watched for chains
+// or AddFile, or is such a directory. Events for it are not delivered.
+func (w *Watcher) inner(name string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.files[name]; ok {
+		return false
+	}
+	isInner := func(dir string) bool { return w.innerDirs[dir] > 0 && !w.ownWatch(dir) }
+	return isInner(filepath.Dir(name)) || isInner(name)
+}
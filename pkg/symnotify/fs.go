@@ -0,0 +1,42 @@
+package symnotify
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+)
+
+// File is an open file of an FS.
+type File interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// FS is the file system access needed by consumers of events, so they can be tested with a MemFS.
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	// ReadDir returns the entries of directory name sorted by name.
+	ReadDir(name string) ([]os.FileInfo, error)
+	EvalSymlinks(name string) (string, error)
+	// Open opens file name for reading.
+	Open(name string) (File, error)
+	// FSType returns the type of the file system containing name, see fsinfo.Type.
+	FSType(name string) (string, error)
+}
+
+// OS is the FS of the operating system.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Stat(name string) (os.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (os.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]os.FileInfo, error) { return ioutil.ReadDir(name) }
+func (osFS) EvalSymlinks(name string) (string, error)   { return filepath.EvalSymlinks(name) }
+func (osFS) Open(name string) (File, error)             { return os.Open(name) }
+func (osFS) FSType(name string) (string, error)         { return fsinfo.Type(name) }
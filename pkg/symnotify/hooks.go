@@ -0,0 +1,79 @@
+package symnotify
+
+import "os"
+
+// Reasons passed to Hooks.EventDropped.
+const (
+	DropFiltered  = "filtered"  // Op not requested by Add or AddFile.
+	DropInternal  = "internal"  // Entry of a directory only watched for chained symlinks or AddFile.
+	DropCoalesced = "coalesced" // Merged with an earlier event, see Coalesce.
+	DropUnknown   = "unknown"   // Event for a watch that was already removed.
+	DropDuplicate = "duplicate" // Repeated Create for a watched symlink, reported by kqueue.
+	DropStale     = "stale"     // Older than MaxEventAge, replaced by a Rescan event.
+	DropBuffer    = "buffer"    // Event buffer full, replaced by an Overflow event, see Buffer.
+	DropClosed    = "closed"    // Buffered when the Watcher was closed, see Buffer.
+	DropIgnored   = "ignored"   // Hidden or temporary name, see IgnoreHidden.
+)
+
+// Hooks report the internals of a Watcher, for example to update metrics.
+// Hooks are called synchronously from Watcher goroutines, they must be fast and must not call the Watcher.
+// Nil hooks are not called.
+type Hooks struct {
+	// WatchAdded is called when a kernel watch is added for path.
+	WatchAdded func(path string)
+	// WatchRemoved is called when a kernel watch for path is released.
+	WatchRemoved func(path string)
+	// WatchEvicted is called when the kernel watch for path is replaced by polling, see MaxWatches.
+	// WatchRemoved is also called.
+	WatchEvicted func(path string)
+	// EventDelivered is called for each event received by the consumer.
+	// With Buffer it is called when the event is buffered, an event later dropped
+	// from the buffer by DropOldest is also reported to EventDropped.
+	EventDelivered func(e Event)
+	// EventDropped is called for each event that is not delivered, with one of the Drop reasons.
+	EventDropped func(e Event, reason string)
+	// StatError is called for errors examining a path, other than the path not existing.
+	StatError func(path string, err error)
+}
+
+// WithHooks sets hooks to report Watcher internals.
+func WithHooks(h Hooks) Option { return func(w *Watcher) { w.hooks = h } }
+
+// unwatch releases the kernel watch for name.
+func (w *Watcher) unwatch(name string) error {
+	if w.hooks.WatchRemoved != nil {
+		w.hooks.WatchRemoved(name)
+	}
+	w.budget.removed(name)
+	return w.removeWatch(name)
+}
+
+// watchAdded reports a kernel watch added for name.
+func (w *Watcher) watchAdded(name string) {
+	if w.hooks.WatchAdded != nil {
+		w.hooks.WatchAdded(name)
+	}
+}
+
+// delivered reports a delivered event.
+func (w *Watcher) delivered(e Event) {
+	if w.hooks.EventDelivered != nil {
+		w.hooks.EventDelivered(e)
+	}
+}
+
+// dropped reports events that are not delivered.
+func (w *Watcher) dropped(reason string, events ...Event) {
+	if w.hooks.EventDropped != nil {
+		for _, e := range events {
+			w.hooks.EventDropped(e, reason)
+		}
+	}
+}
+
+// statError reports err examining path, unless path does not exist.
+func (w *Watcher) statError(path string, err error) {
+	if err != nil && !os.IsNotExist(err) && w.hooks.StatError != nil {
+		w.hooks.StatError(path, err)
+	}
+}
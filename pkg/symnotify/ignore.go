@@ -0,0 +1,47 @@
+package symnotify
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreHidden ignores entries with hidden or temporary names, see Hidden.
+// No events are delivered for them, and hidden symlinks and subdirectories are not watched.
+// Editors and container runtimes write such files in log directories and rename them into place,
+// renaming a hidden file to a visible name is delivered as a Create of the visible name.
+// Paths passed to Add or AddFile are not ignored, even if they have hidden names.
+func IgnoreHidden() Option { return func(w *Watcher) { w.ignoreHidden = true } }
+
+// Ignore ignores entries for which ignore returns true, like IgnoreHidden, for example
+// the log files of excluded pods, so they are never watched. ignore is called from the
+// goroutine delivering events and from Add, it must not block on the consumer of events.
+func Ignore(ignore func(name string) bool) Option { return func(w *Watcher) { w.ignore = ignore } }
+
+// temporarySuffixes are name endings of temporary files, see Hidden.
+var temporarySuffixes = []string{".tmp", ".swp", "~"}
+
+// Hidden returns true if the base name of path starts with '.', or ends with ".tmp", ".swp" or '~'.
+func Hidden(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") && name != "." && name != ".." {
+		return true
+	}
+	for _, suffix := range temporarySuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored returns true if events for name are ignored, see IgnoreHidden and Ignore.
+func (w *Watcher) ignored(name string) bool {
+	if !(w.ignoreHidden && Hidden(name)) && (w.ignore == nil || !w.ignore(name)) {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, added := w.added[name]
+	_, file := w.files[name]
+	return !added && !file
+}
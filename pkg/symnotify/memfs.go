@@ -0,0 +1,419 @@
+package symnotify
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+)
+
+// maxMemLinks limits the symlinks followed resolving a MemFS path, like the kernel limit.
+const maxMemLinks = 40
+
+// MemFS is an in-memory FS for tests, changes made by its methods are reported to a Fake.
+// Paths are absolute and use '/' separators, relative paths are taken relative to '/'.
+//
+// MemFS is safe for concurrent use, events are in order for changes made by one goroutine.
+type MemFS struct {
+	// Now returns the time for file modifications and events, time.Now by default.
+	// Set it before use for deterministic times.
+	Now func() time.Time
+	// Type is the file system type of all paths, fsinfo.Unknown if empty. Set it before use.
+	Type string
+
+	mu       sync.Mutex
+	nodes    map[string]*memNode // By clean absolute path.
+	watchers []func(Event)       // Called with events for resolved paths, see Fake.
+}
+
+// memNode is a file, directory or symlink in a MemFS.
+type memNode struct {
+	dir     bool
+	target  string // Symlink target, empty if not a symlink.
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemFS returns a MemFS containing only the root directory.
+func NewMemFS() *MemFS {
+	fs := &MemFS{Now: time.Now}
+	fs.nodes = map[string]*memNode{"/": {dir: true, modTime: fs.Now()}}
+	return fs
+}
+
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path, n, err := fs.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(filepath.Base(path)), nil
+}
+
+func (fs *MemFS) Lstat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path, n, err := fs.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(filepath.Base(path)), nil
+}
+
+func (fs *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	dir, n, err := fs.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.dir {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	var infos []os.FileInfo
+	for path, child := range fs.nodes {
+		if path != dir && filepath.Dir(path) == dir {
+			infos = append(infos, child.info(filepath.Base(path)))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (fs *MemFS) EvalSymlinks(name string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	path, _, err := fs.resolve("lstat", name, true)
+	return path, err
+}
+
+func (fs *MemFS) FSType(name string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, _, err := fs.resolve("statfs", name, true); err != nil {
+		return fsinfo.Unknown, err
+	}
+	if fs.Type == "" {
+		return fsinfo.Unknown, nil
+	}
+	return fs.Type, nil
+}
+
+// Open returns a copy of the content of file name, later changes are not seen.
+func (fs *MemFS) Open(name string) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, n, err := fs.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.dir {
+		return nil, &os.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	return memFile{bytes.NewReader(append([]byte(nil), n.data...))}, nil
+}
+
+// memFile is an open MemFS file.
+type memFile struct{ *bytes.Reader }
+
+func (memFile) Close() error { return nil }
+
+// Readlink returns the target of symlink name.
+func (fs *MemFS) Readlink(name string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, n, err := fs.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.target == "" {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return n.target, nil
+}
+
+// MkdirAll creates directory name and any missing parents.
+func (fs *MemFS) MkdirAll(name string) error {
+	var events []Event
+	err := fs.change(func() error {
+		path := "/"
+		for _, elem := range memSplit(name) {
+			next := filepath.Join(path, elem)
+			real, n, err := fs.resolve("mkdir", next, true)
+			switch {
+			case err == nil && !n.dir:
+				return &os.PathError{Op: "mkdir", Path: next, Err: syscall.ENOTDIR}
+			case os.IsNotExist(err):
+				real = filepath.Join(path, elem)
+				fs.nodes[real] = &memNode{dir: true, modTime: fs.Now()}
+				events = append(events, Event{Name: real, Op: Create})
+			case err != nil:
+				return err
+			}
+			path = real
+		}
+		return nil
+	})
+	fs.notify(events...)
+	return err
+}
+
+// WriteFile creates or truncates file name and writes data.
+func (fs *MemFS) WriteFile(name string, data []byte) error {
+	var events []Event
+	err := fs.change(func() error {
+		path, n, err := fs.resolve("open", name, true)
+		if os.IsNotExist(err) {
+			if path, err = fs.create("open", name, &memNode{}); err != nil {
+				return err
+			}
+			n = fs.nodes[path]
+			events = append(events, Event{Name: path, Op: Create})
+		} else if err != nil {
+			return err
+		} else if n.dir {
+			return &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		n.data, n.modTime = append([]byte(nil), data...), fs.Now()
+		events = append(events, Event{Name: path, Op: Write})
+		return nil
+	})
+	fs.notify(events...)
+	return err
+}
+
+// Append writes data to the end of existing file name.
+func (fs *MemFS) Append(name string, data []byte) error {
+	var events []Event
+	err := fs.change(func() error {
+		path, n, err := fs.resolve("open", name, true)
+		if err != nil {
+			return err
+		}
+		if n.dir {
+			return &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		n.data, n.modTime = append(n.data, data...), fs.Now()
+		events = append(events, Event{Name: path, Op: Write})
+		return nil
+	})
+	fs.notify(events...)
+	return err
+}
+
+// Symlink creates symlink link to target, target need not exist.
+func (fs *MemFS) Symlink(target, link string) error {
+	var events []Event
+	err := fs.change(func() error {
+		path, err := fs.create("symlink", link, &memNode{target: target})
+		if err != nil {
+			return err
+		}
+		events = append(events, Event{Name: path, Op: Create})
+		return nil
+	})
+	fs.notify(events...)
+	return err
+}
+
+// Remove removes file, symlink or empty directory name.
+func (fs *MemFS) Remove(name string) error {
+	var events []Event
+	err := fs.change(func() error {
+		path, n, err := fs.resolve("remove", name, false)
+		if err != nil {
+			return err
+		}
+		if n.dir && fs.hasChildren(path) {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+		delete(fs.nodes, path)
+		events = append(events, Event{Name: path, Op: Remove})
+		return nil
+	})
+	fs.notify(events...)
+	return err
+}
+
+// Rename renames oldName to newName, replacing newName if it is not a directory.
+// Reported as a Moved event, see Fake.
+func (fs *MemFS) Rename(oldName, newName string) error {
+	var events []Event
+	err := fs.change(func() error {
+		oldPath, n, err := fs.resolve("rename", oldName, false)
+		if err != nil {
+			return err
+		}
+		newPath, existing, err := fs.resolve("rename", newName, false)
+		if err == nil && existing.dir {
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: syscall.EEXIST}
+		} else if os.IsNotExist(err) {
+			if newPath, err = fs.parent("rename", newName); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		if n.dir && memWithin(oldPath, newPath) {
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: syscall.EINVAL}
+		}
+		for path, child := range fs.nodes {
+			if path != oldPath && memWithin(oldPath, path) {
+				delete(fs.nodes, path)
+				fs.nodes[newPath+strings.TrimPrefix(path, oldPath)] = child
+			}
+		}
+		delete(fs.nodes, oldPath)
+		fs.nodes[newPath] = n
+		events = append(events, Event{Name: newPath, Op: Moved, OldName: oldPath})
+		return nil
+	})
+	fs.notify(events...)
+	return err
+}
+
+// watch calls notify with an event for each change, Name and OldName are resolved paths.
+func (fs *MemFS) watch(notify func(Event)) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.watchers = append(fs.watchers, notify)
+}
+
+// change calls f with fs locked.
+func (fs *MemFS) change(f func() error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return f()
+}
+
+// notify watchers of events, fs must not be locked.
+func (fs *MemFS) notify(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	fs.mu.Lock()
+	watchers := fs.watchers
+	fs.mu.Unlock()
+	for _, e := range events {
+		for _, notify := range watchers {
+			notify(e)
+		}
+	}
+}
+
+// resolve returns the resolved path and node for name, following a final symlink if follow is true.
+// If the final element is missing, returns the path it would have with an error. Must be called with fs locked.
+func (fs *MemFS) resolve(op, name string, follow bool) (string, *memNode, error) {
+	path, links := "/", 0
+	rest := memSplit(name)
+	for len(rest) > 0 {
+		next := filepath.Join(path, rest[0])
+		rest = rest[1:]
+		n := fs.nodes[next]
+		switch {
+		case n == nil:
+			return next, nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		case n.target != "" && (follow || len(rest) > 0):
+			if links++; links > maxMemLinks {
+				return next, nil, &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+			}
+			target := n.target
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(path, target)
+			}
+			path, rest = "/", append(memSplit(target), rest...)
+			continue
+		case !n.dir && len(rest) > 0:
+			return next, nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		path = next
+	}
+	return path, fs.nodes[path], nil
+}
+
+// parent returns the resolved path for a new entry name, its parent directory must exist.
+// Must be called with fs locked.
+func (fs *MemFS) parent(op, name string) (string, error) {
+	dir, n, err := fs.resolve(op, filepath.Dir(memPath(name)), true)
+	if err != nil {
+		return "", err
+	}
+	if !n.dir {
+		return "", &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return filepath.Join(dir, filepath.Base(memPath(name))), nil
+}
+
+// create adds node n as new entry name, returns its resolved path. Must be called with fs locked.
+func (fs *MemFS) create(op, name string, n *memNode) (string, error) {
+	path, err := fs.parent(op, name)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := fs.nodes[path]; ok {
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrExist}
+	}
+	n.modTime = fs.Now()
+	fs.nodes[path] = n
+	return path, nil
+}
+
+// hasChildren returns true if directory path has entries. Must be called with fs locked.
+func (fs *MemFS) hasChildren(path string) bool {
+	for p := range fs.nodes {
+		if p != path && filepath.Dir(p) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *memNode) info(name string) os.FileInfo {
+	info := &memInfo{name: name, size: int64(len(n.data)), mode: 0644, modTime: n.modTime}
+	switch {
+	case n.dir:
+		info.mode = os.ModeDir | 0755
+	case n.target != "":
+		info.mode, info.size = os.ModeSymlink|0777, int64(len(n.target))
+	}
+	return info
+}
+
+// memInfo is the os.FileInfo of a MemFS entry, Sys returns nil.
+type memInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() os.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() interface{}   { return nil }
+
+// memPath returns name as a clean absolute path.
+func memPath(name string) string { return filepath.Join("/", filepath.ToSlash(name)) }
+
+// memSplit returns the elements of the clean absolute path of name.
+func memSplit(name string) []string {
+	path := strings.TrimPrefix(memPath(name), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// memWithin returns true if clean path is dir or is under dir.
+func memWithin(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
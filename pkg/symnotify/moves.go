@@ -0,0 +1,109 @@
+package symnotify
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+)
+
+// Moves correlates a Rename with a following Create of the same file, identified by device
+// and inode, and delivers a single Moved event with Event.OldName set to the old name.
+// The Rename is delayed for up to window waiting for the Create, and delivered unchanged
+// if the file does not reappear under a watched name. A window <= 0 disables correlation.
+//
+// Moved events are delivered for paths where Rename is requested, see Add,
+// for paths where only Create is requested the Moved event is delivered as a Create.
+// Files are identified by their own inode, a renamed symlink is correlated, not its target.
+// Identities are not available on all platforms, Moves has no effect where they are not.
+func Moves(window time.Duration) Option { return func(w *Watcher) { w.moves.window = window } }
+
+// mover pairs Rename and Create events for Moves.
+type mover struct {
+	window time.Duration
+
+	mu  sync.Mutex
+	ids map[string]fsinfo.FileID // Last known identity of watched names.
+
+	// Used only by the run goroutine.
+	pending *Event // Rename waiting for its Create.
+	from    fsinfo.FileID
+	timer   <-chan time.Time // Expires when pending must be delivered, nil if none.
+}
+
+// record the identity of name from its Lstat.
+func (m *mover) record(name string, lstat os.FileInfo) {
+	if m.window <= 0 || lstat == nil {
+		return
+	}
+	id, ok := fsinfo.ID(lstat)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ids == nil {
+		m.ids = map[string]fsinfo.FileID{}
+	}
+	m.ids[name] = id
+}
+
+// forget name, returns its last known identity.
+func (m *mover) forget(name string) (id fsinfo.FileID, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok = m.ids[name]
+	delete(m.ids, name)
+	return id, ok
+}
+
+// correlate replaces a Rename followed by a Create of the same file with a Moved event.
+// A Rename of a name that no longer exists is held back, see expire.
+func (m *mover) correlate(events []Event) []Event {
+	if m.window <= 0 {
+		return events
+	}
+	var out []Event
+	for _, e := range events {
+		switch e.Op {
+		case Create:
+			lstat, err := os.Lstat(e.Name)
+			if err != nil {
+				break
+			}
+			m.record(e.Name, lstat)
+			if id, _ := fsinfo.ID(lstat); m.pending != nil && id == m.from {
+				e = Event{Name: e.Name, Op: Moved, Info: e.Info, OldName: m.pending.Name, Raw: e.Raw, Time: e.Time}
+				m.pending, m.timer = nil, nil
+			}
+		case Remove:
+			m.forget(e.Name)
+		case Rename:
+			if _, err := os.Lstat(e.Name); err == nil {
+				break // Still exists, a symlink target was renamed.
+			}
+			if id, ok := m.forget(e.Name); ok {
+				out = append(out, m.expire()...)
+				pending := e
+				m.pending, m.from, m.timer = &pending, id, time.After(m.window)
+				continue
+			}
+		}
+		if e.Op != Moved {
+			out = append(out, m.expire()...)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// expire returns the pending Rename, if any, which was not followed by a Create.
+func (m *mover) expire() []Event {
+	if m.pending == nil {
+		return nil
+	}
+	e := *m.pending
+	m.pending, m.timer = nil, nil
+	return []Event{e}
+}
@@ -0,0 +1,200 @@
+package symnotify
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+)
+
+// defaultPollInterval is the default interval for polling paths that can't be watched.
+const defaultPollInterval = 10 * time.Second
+
+// PollInterval sets the interval for polling paths that can't be watched, see Degraded.
+// An interval <= 0 keeps the default.
+func PollInterval(d time.Duration) Option {
+	return func(w *Watcher) {
+		if d > 0 {
+			w.pollInterval = d
+		}
+	}
+}
+
+// PollNetwork also polls paths on network file systems, where inotify does not report
+// changes made by other hosts. Such paths are watched and polled, so changes made locally
+// may be reported twice.
+func PollNetwork() Option { return func(w *Watcher) { w.pollNetwork = true } }
+
+// polled is the last polled state of a path.
+type polled struct {
+	hybrid  bool                   // Path is also watched.
+	info    os.FileInfo            // Stat of the path following symlinks, nil if it does not exist.
+	entries map[string]os.FileInfo // Stat of each entry if the path is a directory.
+}
+
+// isNoSpace returns true if err means the inotify watch limit is exhausted.
+func isNoSpace(err error) bool { return errors.Is(err, syscall.ENOSPC) }
+
+// watch adds an fsnotify watch for name. If the watch limit is exhausted,
+// name is polled instead and watch returns nil, see also MaxWatches.
+// With PollNetwork, name is also polled if it is on a network file system.
+func (w *Watcher) watch(name string) error {
+	if !w.makeRoom() {
+		log.Info("Warning: MaxWatches limit reached, polling instead", "path", name, "limit", w.budget.max, "interval", w.pollInterval)
+		w.poll(name, false)
+		return nil
+	}
+	err := w.addWatch(name)
+	if err == nil {
+		w.watchAdded(name)
+		w.budget.added(name, true)
+		w.mu.Lock()
+		if p := w.polled[name]; p != nil && !p.hybrid {
+			delete(w.polled, name) // Polled before, watched now.
+		}
+		w.mu.Unlock()
+		if w.pollNetwork {
+			if fstype, _ := w.fsType(name); fsinfo.IsNetwork(fstype) {
+				log.V(2).Info("Polling file on network file system...", "path", name, "fstype", fstype)
+				w.poll(name, true)
+			}
+		}
+		return nil
+	}
+	if !isNoSpace(err) {
+		return err
+	}
+	log.Info("Warning: file watch limit reached, polling instead, see fs.inotify.max_user_watches", "path", name, "interval", w.pollInterval)
+	w.poll(name, false)
+	return nil
+}
+
+// poll starts polling name, hybrid if name is also watched.
+func (w *Watcher) poll(name string, hybrid bool) {
+	w.mu.Lock()
+	_, ok := w.polled[name]
+	w.mu.Unlock()
+	if !ok {
+		p := &polled{hybrid: hybrid}
+		p.update(name, w.statError) // Initial state, don't hold the lock for I/O.
+		w.mu.Lock()
+		if _, ok := w.polled[name]; !ok {
+			w.polled[name] = p
+		}
+		w.mu.Unlock()
+	}
+	w.pollOnce.Do(func() { go w.runPoll() })
+}
+
+// unpoll stops polling name, returns true if name was polled instead of watched.
+func (w *Watcher) unpoll(name string) (pollOnly bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, ok := w.polled[name]
+	delete(w.polled, name)
+	return ok && !p.hybrid
+}
+
+// Degraded returns true if some paths are polled because the watch limit was exhausted.
+// Events for polled paths are delayed by up to the poll interval, and changes between polls are merged.
+func (w *Watcher) Degraded() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, p := range w.polled {
+		if !p.hybrid {
+			return true
+		}
+	}
+	return false
+}
+
+// runPoll polls until the watcher is closed.
+func (w *Watcher) runPoll() {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+		w.mu.Lock()
+		paths := make(map[string]*polled, len(w.polled))
+		for name, p := range w.polled {
+			paths[name] = p
+		}
+		w.mu.Unlock()
+		// Only this goroutine updates polled state once it is added, don't hold the lock for I/O.
+		var events []Event
+		for name, p := range paths {
+			events = append(events, p.update(name, w.statError)...)
+		}
+		for _, e := range events {
+			if !w.fileInfo {
+				e.Info = nil
+			}
+			select {
+			case w.pollEvents <- e:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// update polls name, returns events for changes since the last update.
+// Directory entries get Create, Remove and Write events, other paths get Write and Remove events.
+// Events have the Info from the poll.
+// Errors other than a missing path are passed to statError.
+func (p *polled) update(name string, statError func(string, error)) (events []Event) {
+	info, err := os.Stat(name)
+	if err != nil {
+		statError(name, err)
+		info = nil
+	}
+	switch {
+	case info == nil && p.info != nil:
+		events = append(events, Event{Name: name, Op: Remove})
+	case info != nil && !info.IsDir() && changed(p.info, info):
+		events = append(events, Event{Name: name, Op: Write, Info: info})
+	}
+	if info != nil && info.IsDir() {
+		entries := map[string]os.FileInfo{}
+		infos, err := ioutil.ReadDir(name)
+		statError(name, err)
+		for _, entry := range infos {
+			path := filepath.Join(name, entry.Name())
+			if target, err := os.Stat(path); err == nil {
+				entry = target // Follow symlinks.
+			}
+			entries[path] = entry
+			if old, ok := p.entries[path]; !ok {
+				if p.entries != nil {
+					events = append(events, Event{Name: path, Op: Create, Info: entry})
+				}
+			} else if !entry.IsDir() && changed(old, entry) {
+				events = append(events, Event{Name: path, Op: Write, Info: entry})
+			}
+		}
+		for path := range p.entries {
+			if _, ok := entries[path]; !ok {
+				events = append(events, Event{Name: path, Op: Remove})
+			}
+		}
+		p.entries = entries
+	} else {
+		p.entries = nil
+	}
+	p.info = info
+	return events
+}
+
+// changed returns true if a file with stat now is different from old.
+func changed(old, now os.FileInfo) bool {
+	return old == nil || old.Size() != now.Size() || !old.ModTime().Equal(now.ModTime())
+}
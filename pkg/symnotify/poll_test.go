@@ -0,0 +1,173 @@
+package symnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newNoSpaceWatcher returns a polling Watcher where adding a watch for a path accepted by fail returns ENOSPC.
+func newNoSpaceWatcher(t *testing.T, fail func(string) bool) (w *Watcher, dir string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	w, err = NewWatcher(PollInterval(10 * time.Millisecond))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	add := w.addWatch
+	w.addWatch = func(name string) error {
+		if fail(name) {
+			return syscall.ENOSPC
+		}
+		return add(name)
+	}
+	return w, dir
+}
+
+// nextEvent returns the next event without Info, so it can be compared with expected events.
+func nextEvent(t *testing.T, w *Watcher) Event {
+	t.Helper()
+	e, err := w.EventTimeout(time.Second)
+	require.NoError(t, err)
+	e.Info, e.Time = nil, time.Time{}
+	return e
+}
+
+func TestPollDirectory(t *testing.T) {
+	w, dir := newNoSpaceWatcher(t, func(string) bool { return true })
+	logs := filepath.Join(dir, "logs")
+	require.NoError(t, os.Mkdir(logs, os.ModePerm))
+	require.NoError(t, w.Add(logs))
+	assert.True(t, w.Degraded())
+	assert.Equal(t, []string{logs}, w.WatchList())
+
+	log1 := filepath.Join(logs, "log1")
+	require.NoError(t, ioutil.WriteFile(log1, nil, 0600))
+	assert.Equal(t, Event{Name: log1, Op: Create}, nextEvent(t, w))
+	require.NoError(t, ioutil.WriteFile(log1, []byte("hello"), 0600))
+	assert.Equal(t, Event{Name: log1, Op: Write}, nextEvent(t, w))
+	require.NoError(t, os.Remove(log1))
+	assert.Equal(t, Event{Name: log1, Op: Remove}, nextEvent(t, w))
+
+	require.NoError(t, w.Remove(logs))
+	assert.False(t, w.Degraded())
+	require.NoError(t, ioutil.WriteFile(log1, nil, 0600))
+	_, err := w.EventTimeout(100 * time.Millisecond)
+	assert.Equal(t, os.ErrDeadlineExceeded, err)
+}
+
+func TestPollSymlinkTargets(t *testing.T) {
+	logs := ""
+	w, dir := newNoSpaceWatcher(t, func(name string) bool { return name != logs })
+	logs = filepath.Join(dir, "logs")
+	require.NoError(t, os.Mkdir(logs, os.ModePerm))
+	target := filepath.Join(dir, "target")
+	require.NoError(t, ioutil.WriteFile(target, nil, 0600))
+	link := filepath.Join(logs, "link")
+	require.NoError(t, os.Symlink(target, link))
+
+	require.NoError(t, w.Add(logs))
+	assert.True(t, w.Degraded())
+	require.NoError(t, ioutil.WriteFile(target, []byte("hello"), 0600))
+	assert.Equal(t, Event{Name: link, Op: Write}, nextEvent(t, w))
+
+	// The directory is still watched, removing the link stops polling its target.
+	require.NoError(t, os.Remove(link))
+	assert.Equal(t, Event{Name: link, Op: Remove}, nextEvent(t, w))
+	// The poller may report the Remove before the directory watch.
+	assert.Eventually(t, func() bool { return !w.Degraded() }, time.Second, 10*time.Millisecond)
+}
+
+func TestPollNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	logs, target := filepath.Join(dir, "logs"), filepath.Join(dir, "target")
+	link := filepath.Join(logs, "link")
+	require.NoError(t, os.Mkdir(logs, os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(target, nil, 0600))
+	require.NoError(t, os.Symlink(target, link))
+
+	w, err := NewWatcher(PollNetwork(), PollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	defer func() { _ = w.Close() }()
+	// The link target is on a network file system where inotify misses writes.
+	add := w.addWatch
+	w.addWatch = func(name string) error {
+		if name == link {
+			return nil
+		}
+		return add(name)
+	}
+	w.fsType = func(name string) (string, error) {
+		if name == link {
+			return "nfs", nil
+		}
+		return "ext4", nil
+	}
+	require.NoError(t, w.Add(logs))
+	assert.False(t, w.Degraded(), "network polling is not degraded")
+	require.NoError(t, ioutil.WriteFile(target, []byte("hello"), 0600))
+	assert.Equal(t, Event{Name: link, Op: Write}, nextEvent(t, w))
+
+	require.NoError(t, os.Remove(link))
+	assert.Equal(t, Event{Name: link, Op: Remove}, nextEvent(t, w))
+	assert.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.polled) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMaxWatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	evicted := make(chan string, 10)
+	w, err := NewWatcher(PollInterval(10*time.Millisecond), MaxWatches(2), WithHooks(Hooks{
+		WatchEvicted: func(path string) { evicted <- path },
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	logs := filepath.Join(dir, "logs")
+	require.NoError(t, os.Mkdir(logs, os.ModePerm))
+	link := func(name string) (link, target string) {
+		target, link = filepath.Join(dir, name), filepath.Join(logs, name)
+		require.NoError(t, ioutil.WriteFile(target, nil, 0600))
+		require.NoError(t, os.Symlink(target, link))
+		return link, target
+	}
+	a, aTarget := link("a")
+	require.NoError(t, w.Add(logs, Create, Write))
+	assert.False(t, w.Degraded())
+
+	// The directory was active more recently than a, a is polled instead.
+	b, _ := link("b")
+	assert.Equal(t, Event{Name: b, Op: Create}, nextEvent(t, w))
+	select {
+	case path := <-evicted:
+		assert.Equal(t, a, path)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for eviction")
+	}
+	assert.True(t, w.Degraded())
+	require.NoError(t, ioutil.WriteFile(aTarget, []byte("hello"), 0600))
+	assert.Equal(t, Event{Name: a, Op: Write}, nextEvent(t, w))
+}
+
+func TestPollIntervalInvalid(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		w, err := NewWatcher(PollInterval(d))
+		require.NoError(t, err)
+		assert.Equal(t, defaultPollInterval, w.pollInterval)
+		_ = w.Close()
+	}
+}
@@ -0,0 +1,44 @@
+package symnotify
+
+import "sync/atomic"
+
+// defaultMaxPending is the default limit on events held inside the Watcher, see MaxPending.
+const defaultMaxPending = 10000
+
+// MaxPending limits the events held inside the Watcher, so memory stays bounded under heavy churn.
+// Events delayed by Coalesce are delivered early when n are pending.
+// Names waiting for a Rescan event, see MaxEventAge, are replaced by a single Overflow event
+// when there are more than n, as are Create events waiting for delivery by Snapshot.
+// The consumer should then rescan everything it watches.
+// The default is 10000, n <= 0 means no limit.
+func MaxPending(n int) Option { return func(w *Watcher) { w.maxPending = n } }
+
+// Depth is the number of events held inside a Watcher.
+type Depth struct {
+	Coalesced int // Events delayed by Coalesce.
+	Rescans   int // Names waiting for a Rescan event, see MaxEventAge.
+	Buffered  int // Events waiting for the consumer, see Buffer.
+}
+
+// depths are updated by the run goroutine and read by Depth.
+type depths struct {
+	coalesced, rescans int64
+}
+
+// Depth returns the number of events currently held inside the Watcher.
+func (w *Watcher) Depth() Depth {
+	return Depth{
+		Coalesced: int(atomic.LoadInt64(&w.depths.coalesced)),
+		Rescans:   int(atomic.LoadInt64(&w.depths.rescans)),
+		Buffered:  len(w.events),
+	}
+}
+
+// full returns true if n pending events reach the MaxPending limit.
+func (w *Watcher) full(n int) bool { return w.maxPending > 0 && n >= w.maxPending }
+
+// setDepths records the depths of the run goroutine's queues.
+func (w *Watcher) setDepths(c *coalescer) {
+	atomic.StoreInt64(&w.depths.coalesced, int64(len(c.pending)))
+	atomic.StoreInt64(&w.depths.rescans, int64(len(w.stale.names)))
+}
@@ -0,0 +1,106 @@
+package symnotify
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxPendingCoalesce(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	w, err := NewWatcher(Coalesce(time.Hour), MaxPending(2), NoFileInfo())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	require.NoError(t, w.Add(dir, Create))
+
+	log0, log1 := filepath.Join(dir, "0"), filepath.Join(dir, "1")
+	require.NoError(t, ioutil.WriteFile(log0, nil, 0600))
+	for i := 0; i < 100 && w.Depth().Coalesced < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, Depth{Coalesced: 1}, w.Depth())
+	// The limit is reached, events are delivered without waiting for the window.
+	require.NoError(t, ioutil.WriteFile(log1, nil, 0600))
+	assert.Equal(t, Event{Name: log0, Op: Create}, nextEvent(t, w))
+	assert.Equal(t, Event{Name: log1, Op: Create}, nextEvent(t, w))
+	assert.Equal(t, Depth{}, w.Depth())
+}
+
+func TestMaxPendingRescans(t *testing.T) {
+	s := staleness{maxAge: time.Minute, max: 2}
+	s.record("a")
+	s.record("b")
+	s.record("a")
+	assert.Equal(t, []Event{{Name: "a", Op: Rescan}, {Name: "b", Op: Rescan}}, s.rescans())
+	for _, name := range []string{"a", "b", "c", "d"} {
+		s.record(name)
+	}
+	assert.Equal(t, []Event{{Op: Overflow}}, s.rescans())
+	assert.Nil(t, s.rescans())
+}
+
+func TestErrors(t *testing.T) {
+	w, err := NewWatcher(NoFileInfo())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	backend := w.watcher.(fsnotifyBackend).Errors
+	next := func() error {
+		select {
+		case err := <-w.Errors():
+			return err
+		case <-time.After(time.Second):
+			return nil
+		}
+	}
+
+	backend <- errors.New("first")
+	assert.EqualError(t, next(), "first")
+
+	// Errors nobody reads are buffered, then dropped.
+	for i := 0; i < errorBuffer+4; i++ {
+		backend <- fmt.Errorf("error %v", i)
+	}
+	// Overflow is delivered as an event after the errors are handled.
+	backend <- fsnotify.ErrEventOverflow
+	select {
+	case e := <-w.Events():
+		assert.Equal(t, Overflow, e.Op)
+	case <-time.After(time.Second):
+		t.Fatal("no overflow event")
+	}
+	for i := 0; i < errorBuffer; i++ {
+		assert.EqualError(t, next(), fmt.Sprintf("error %v", i))
+	}
+	backend <- errors.New("last")
+	assert.EqualError(t, next(), "last")
+}
+
+func TestMaxPendingSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	for _, name := range []string{"0", "1", "2"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+	w, err := NewWatcher(Snapshot(), MaxPending(2), NoFileInfo())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	// Too many existing entries are replaced by an Overflow event.
+	require.NoError(t, w.Add(dir))
+	e, err := w.EventTimeout(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, Overflow, e.Op)
+	_, err = w.EventTimeout(50 * time.Millisecond)
+	assert.Equal(t, os.ErrDeadlineExceeded, err)
+}
@@ -0,0 +1,227 @@
+package symnotify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ViaQ/logerr/log"
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
+)
+
+// RemountCheck checks every interval that each path passed to Add is still the directory that
+// was watched, and watches it again if it was replaced, for example by a volume mounted over it,
+// which is not reported by inotify. The directories of watched symlink targets are checked the same way,
+// the added path containing the symlinks is watched again. An interval <= 0 disables the check.
+//
+// Watches are always re-established when the file system of a watched path, or of a watched symlink target,
+// is unmounted, for example when a volume is remounted. A Resync event is delivered for the added path.
+func RemountCheck(interval time.Duration) Option {
+	return func(w *Watcher) { w.remounts.interval = interval }
+}
+
+// remountDelay is the time from an unmount to watching again, so a remount in progress can complete.
+const remountDelay = time.Second
+
+// remounts tracks the identity of added paths, to re-establish their watches after a remount.
+type remounts struct {
+	interval time.Duration
+	ticker   *time.Ticker
+	tick     <-chan time.Time         // Ticks of ticker, nil without RemountCheck.
+	ids      map[string]fsinfo.FileID // Identity of each added path when it was watched, guarded by Watcher.mu.
+	dirs     map[string]fsinfo.FileID // Identity of directories of symlink targets at the last check, used only by run.
+	pending  map[string]bool          // Added paths that were unmounted, used only by run.
+	timer    <-chan time.Time         // Expires remountDelay after the first pending unmount.
+}
+
+// start the ticker for RemountCheck.
+func (r *remounts) start() {
+	r.ids = map[string]fsinfo.FileID{}
+	if r.interval > 0 {
+		r.ticker = time.NewTicker(r.interval)
+		r.tick = r.ticker.C
+	}
+}
+
+// stop the ticker.
+func (r *remounts) stop() {
+	if r.ticker != nil {
+		r.ticker.Stop()
+	}
+}
+
+// statID returns the identity of the file at path, following symlinks.
+func statID(path string) (fsinfo.FileID, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fsinfo.FileID{}, false
+	}
+	return fsinfo.ID(info)
+}
+
+// identify records the identity of added path name, forgets it if name can't be examined.
+func (w *Watcher) identify(name string) {
+	id, ok := w.fileID(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if ok {
+		w.remounts.ids[name] = id
+	} else {
+		delete(w.remounts.ids, name)
+	}
+}
+
+// within returns true if path is dir or is under dir.
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// rootsOf returns the added paths containing any of paths.
+// Must be called with w.mu locked.
+func (w *Watcher) rootsOf(paths []string) (roots []string) {
+	for added := range w.added {
+		for _, path := range paths {
+			if within(added, path) {
+				roots = append(roots, added)
+				break
+			}
+		}
+	}
+	return roots
+}
+
+// unmounted records that the file system of watched path name was unmounted, its watch is gone.
+// The added paths containing name are watched again after remountDelay, see unmountedRoots.
+func (w *Watcher) unmounted(name string) {
+	if w.remounts.pending == nil {
+		w.remounts.pending = map[string]bool{}
+	}
+	for _, added := range w.unmountedRoots(name) {
+		w.remounts.pending[added] = true
+	}
+	log.V(2).Info("Watched path unmounted...", "path", name)
+	if len(w.remounts.pending) > 0 && w.remounts.timer == nil {
+		w.remounts.timer = time.After(remountDelay)
+	}
+}
+
+// unmountedRoots returns the added paths containing watched path name. If name is the resolved target
+// of watched symlinks, or a directory in their chains, returns the added paths containing the symlinks.
+func (w *Watcher) unmountedRoots(name string) []string {
+	paths := append([]string{name}, w.targets.linksWithin(name)...)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for link, chain := range w.chains {
+		for _, l := range chain {
+			if within(name, filepath.Dir(l)) {
+				paths = append(paths, link)
+				break
+			}
+		}
+	}
+	return w.rootsOf(paths)
+}
+
+// unmountedPaths returns and clears the added paths recorded by unmounted.
+func (w *Watcher) unmountedPaths() (names []string) {
+	for name := range w.remounts.pending {
+		names = append(names, name)
+	}
+	w.remounts.pending, w.remounts.timer = nil, nil
+	return names
+}
+
+// remounted returns the added paths that are not the directory that was watched, see RemountCheck,
+// and the added paths containing symlinks whose target directory was replaced since the last check.
+// A path that could not be watched again after an earlier remount is also returned, to retry.
+func (w *Watcher) remounted() (names []string) {
+	w.mu.Lock()
+	var added, links []string
+	for name := range w.added {
+		added = append(added, name)
+	}
+	for link := range w.links {
+		links = append(links, link)
+	}
+	w.mu.Unlock()
+	replaced := w.replacedTargets(links)
+	for _, name := range added {
+		id, ok := w.fileID(name)
+		if !ok {
+			continue // Gone or not supported, nothing to watch.
+		}
+		w.mu.Lock()
+		old, known := w.remounts.ids[name]
+		w.mu.Unlock()
+		if !known || id != old {
+			names = append(names, name)
+		}
+	}
+	if len(replaced) > 0 {
+		found := map[string]bool{}
+		for _, name := range names {
+			found[name] = true
+		}
+		w.mu.Lock()
+		for _, root := range w.rootsOf(replaced) {
+			if !found[root] {
+				names = append(names, root)
+			}
+		}
+		w.mu.Unlock()
+	}
+	return names
+}
+
+// replacedTargets returns the symlinks in links whose target directory is not the one seen at the last check,
+// for example because a volume was mounted over it. The watch of the old target is not notified.
+func (w *Watcher) replacedTargets(links []string) (replaced []string) {
+	byDir := map[string][]string{}
+	for _, link := range links {
+		if target, err := filepath.EvalSymlinks(link); err == nil {
+			dir := filepath.Dir(target)
+			byDir[dir] = append(byDir[dir], link)
+		}
+	}
+	dirs := map[string]fsinfo.FileID{}
+	for dir, links := range byDir {
+		id, ok := w.fileID(dir)
+		if !ok {
+			continue
+		}
+		dirs[dir] = id
+		if old, known := w.remounts.dirs[dir]; known && old != id {
+			replaced = append(replaced, links...)
+		}
+	}
+	w.remounts.dirs = dirs
+	return replaced
+}
+
+// resync watches added paths names again, releasing their old watches.
+// Returns a Resync event for each, or an Error event if it could not be watched.
+// The path stays added after an error, RemountCheck retries it.
+func (w *Watcher) resync(names []string) (events []Event) {
+	for _, name := range names {
+		w.mu.Lock()
+		mask, ok := w.added[name]
+		w.mu.Unlock()
+		if !ok {
+			continue // Removed since.
+		}
+		log.Info("Warning: file system of a watched path was unmounted or replaced, watching it again", "path", name)
+		// May fail if the kernel already dropped the watch.
+		_ = w.Remove(name)
+		if err := w.Add(name, mask); err != nil {
+			log.Error(err, "Error watching path again after remount", "path", name)
+			w.mu.Lock()
+			w.added[name] = mask
+			w.mu.Unlock()
+			events = append(events, Event{Name: name, Op: Error, Err: err})
+			continue
+		}
+		events = append(events, Event{Name: name, Op: Resync})
+	}
+	return events
+}
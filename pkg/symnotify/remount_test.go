@@ -0,0 +1,46 @@
+package symnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRemountTarget checks that remounting the target of a watched symlink re-watches the added path.
+func TestRemountTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	logs, targets, other := filepath.Join(dir, "logs"), filepath.Join(dir, "targets"), filepath.Join(dir, "other")
+	for _, d := range []string{logs, targets, other} {
+		require.NoError(t, os.Mkdir(d, 0700))
+	}
+	target := filepath.Join(targets, "t")
+	require.NoError(t, ioutil.WriteFile(target, nil, 0600))
+	require.NoError(t, os.Symlink(target, filepath.Join(logs, "a")))
+
+	w, err := NewWatcher()
+	require.NoError(t, err)
+	defer w.Close()
+	w.resolvesLinks = true
+	require.NoError(t, w.Add(logs))
+
+	// Unmounting the target's file system removes the target watch.
+	assert.Empty(t, w.unmountedRoots(other), "unrelated")
+	assert.Equal(t, []string{logs}, w.unmountedRoots(target))
+	assert.Equal(t, []string{logs}, w.unmountedRoots(targets))
+	assert.Equal(t, []string{logs}, w.unmountedRoots(filepath.Join(logs, "a")))
+
+	// A directory mounted over the target directory is not seen by the old target watch.
+	assert.Empty(t, w.remounted())
+	require.NoError(t, os.Rename(targets, filepath.Join(dir, "old")))
+	require.NoError(t, os.Mkdir(targets, 0700))
+	require.NoError(t, ioutil.WriteFile(target, nil, 0600))
+	assert.Equal(t, []string{logs}, w.remounted())
+	assert.Equal(t, []Event{{Name: logs, Op: Resync}}, w.resync([]string{logs}))
+	assert.Empty(t, w.remounted())
+}
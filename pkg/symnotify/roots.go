@@ -0,0 +1,131 @@
+package symnotify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ViaQ/logerr/log"
+)
+
+// root is a path passed to Add that is a symlink, for example /var/log/containers linked to
+// another disk. The resolved target is watched, and event names are translated back to the root.
+// The directories of the root and of the symlinks in its chain are watched, so that if the root
+// is re-pointed its new target is watched instead, and a Rescan event is delivered for the root.
+type root struct {
+	target string   // Resolved target, "" if the root is dangling.
+	links  []string // The root and the symlinks after it in its chain.
+}
+
+// resolveRoot returns the path to watch for Add(name), the resolved target if name is a symlink.
+func resolveRoot(name string) (string, error) {
+	if info, err := os.Lstat(name); err != nil || !isSymlink(info) {
+		return name, nil // Not a symlink, errors are reported by the watch.
+	}
+	return filepath.EvalSymlinks(name)
+}
+
+// rootLinks returns the root and the symlinks in its chain.
+func (w *Watcher) rootLinks(name string) []string {
+	links, _ := chain(name, w.maxLinkDepth)
+	return append([]string{name}, links...)
+}
+
+// setRoot records root name with resolved target, and watches the directories of its chain.
+// Releases the directories of the previous chain, returns the previous target.
+func (w *Watcher) setRoot(name, target string) (old string) {
+	links := w.rootLinks(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, link := range links {
+		if err := w.refDir(filepath.Dir(link)); err != nil {
+			log.V(3).Info("Can't watch symlinked root directory...", "root", name, "dir", filepath.Dir(link), "err", err)
+		}
+	}
+	if r := w.roots[name]; r != nil {
+		old = r.target
+		for _, link := range r.links {
+			w.unrefDir(filepath.Dir(link))
+		}
+	}
+	w.roots[name] = &root{target: target, links: links}
+	return old
+}
+
+// removeRoot forgets root name if it is one. Returns the path watched for name:
+// the resolved target of a root, or name itself if it is not a root.
+func (w *Watcher) removeRoot(name string) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r := w.roots[name]
+	if r == nil {
+		return name
+	}
+	for _, link := range r.links {
+		w.unrefDir(filepath.Dir(link))
+	}
+	delete(w.roots, name)
+	return r.target
+}
+
+// fromRoot translates a name under the resolved target of a root to the same name under the root.
+func (w *Watcher) fromRoot(name string) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for root, r := range w.roots {
+		if r.target == "" {
+			continue
+		}
+		if name == r.target {
+			return root
+		}
+		if rest := strings.TrimPrefix(name, r.target+string(filepath.Separator)); rest != name {
+			return filepath.Join(root, rest)
+		}
+	}
+	return name
+}
+
+// reroot watches the new target of roots whose chain goes through e.Name if it changed,
+// returns Rescan events for them.
+func (w *Watcher) reroot(e Event) (events []Event) {
+	if e.Op&(Create|Remove|Rename|Chmod) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	var roots []string
+	for root, r := range w.roots {
+		for _, link := range r.links {
+			if link == e.Name {
+				roots = append(roots, root)
+				break
+			}
+		}
+	}
+	w.mu.Unlock()
+	for _, root := range roots {
+		target, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			target = ""
+		}
+		old := w.setRoot(root, target)
+		if old == target {
+			continue
+		}
+		log.V(2).Info("Symlinked root changed...", "root", root, "old", old, "new", target)
+		w.removeTree(root)
+		if old != "" && !w.unpoll(old) {
+			// May fail if the kernel already dropped the watch.
+			_ = w.unwatch(old)
+		}
+		if target != "" {
+			if err := w.watch(target); err != nil {
+				log.Error(err, "Can't watch new target of symlinked root", "root", root, "target", target)
+			} else {
+				w.scan(root, false)
+			}
+		}
+		events = append(events, Event{Name: root, Op: Rescan})
+	}
+	return events
+}
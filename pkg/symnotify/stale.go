@@ -0,0 +1,80 @@
+package symnotify
+
+import "time"
+
+// MaxEventAge drops events that are older than age when they would be delivered,
+// because the consumer has fallen behind. Instead a single Rescan event is delivered for
+// each name that had events dropped, when a later event is delivered in time, or at most
+// age after the first drop. This bounds the time to catch up after a pause, for example
+// when the process is CPU throttled. The age of an event counts from its Time,
+// so it includes Coalesce delays. An age <= 0 disables dropping.
+// Overflow events are never dropped.
+func MaxEventAge(age time.Duration) Option { return func(w *Watcher) { w.stale.maxAge = age } }
+
+// staleness tracks events dropped by MaxEventAge. Used only by the run goroutine.
+type staleness struct {
+	maxAge   time.Duration
+	max      int             // Maximum length of names, see MaxPending.
+	names    []string        // Names with dropped events, in order of the first drop.
+	seen     map[string]bool // Names in names.
+	overflow bool            // Too many names, deliver an Overflow event instead.
+	timer    <-chan time.Time
+}
+
+// droppable returns true if e can be dropped for its age.
+func (s *staleness) droppable(e Event) bool {
+	return s.maxAge > 0 && !e.Time.IsZero() && e.Op != Overflow
+}
+
+// deadline returns a timer that expires when e is too old to deliver, nil if it never is.
+func (s *staleness) deadline(e Event) *time.Timer {
+	if !s.droppable(e) {
+		return nil
+	}
+	return time.NewTimer(time.Until(e.Time.Add(s.maxAge)))
+}
+
+// drop returns true if e is too old to deliver at now, and records its name for a Rescan.
+func (s *staleness) drop(e Event, now time.Time) bool {
+	if !s.droppable(e) || now.Sub(e.Time) <= s.maxAge {
+		return false
+	}
+	s.record(e.Name)
+	return true
+}
+
+// record name for a Rescan.
+func (s *staleness) record(name string) {
+	if s.seen == nil {
+		s.seen = map[string]bool{}
+	}
+	switch {
+	case s.overflow || s.seen[name]:
+	case s.max > 0 && len(s.names) >= s.max:
+		s.names, s.seen, s.overflow = nil, map[string]bool{}, true
+	default:
+		s.seen[name] = true
+		s.names = append(s.names, name)
+	}
+	if s.timer == nil {
+		s.timer = time.After(s.maxAge)
+	}
+}
+
+// rescans returns a Rescan event for each name with dropped events, or a single Overflow event
+// if there were too many, and resets.
+func (s *staleness) rescans() []Event {
+	if s.overflow {
+		s.names, s.seen, s.timer, s.overflow = nil, nil, nil, false
+		return []Event{{Op: Overflow}}
+	}
+	if len(s.names) == 0 {
+		return nil
+	}
+	events := make([]Event, len(s.names))
+	for i, name := range s.names {
+		events[i] = Event{Name: name, Op: Rescan}
+	}
+	s.names, s.seen, s.timer = nil, nil, nil
+	return events
+}
@@ -0,0 +1,33 @@
+package symnotify
+
+import (
+	"os"
+	"time"
+)
+
+// StatRetry retries a failed stat of a path for an event up to retries times, waiting backoff
+// before the first retry and doubling it for each retry, before the error is reported to
+// Hooks.StatError and the ErrorPolicy. During pod teardown a path often fails with another error
+// before it is gone, for example while a directory on its path is being removed.
+// A path that does not exist is not retried. Retries block the Watcher, so backoff should be short.
+func StatRetry(retries int, backoff time.Duration) Option {
+	return func(w *Watcher) { w.statRetries, w.statBackoff = retries, backoff }
+}
+
+// lstat is os.Lstat with StatRetry.
+func (w *Watcher) lstat(name string) (os.FileInfo, error) { return w.retryStat(name, w.fs.Lstat) }
+
+// stat is os.Stat with StatRetry.
+func (w *Watcher) stat(name string) (os.FileInfo, error) { return w.retryStat(name, w.fs.Stat) }
+
+// retryStat calls stat for name until it succeeds, name does not exist or the retries are used up.
+func (w *Watcher) retryStat(name string, stat func(string) (os.FileInfo, error)) (os.FileInfo, error) {
+	info, err := stat(name)
+	delay := w.statBackoff
+	for i := 0; i < w.statRetries && err != nil && !os.IsNotExist(err); i++ {
+		time.Sleep(delay)
+		delay *= 2
+		info, err = stat(name)
+	}
+	return info, err
+}
@@ -0,0 +1,80 @@
+package symnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyFS fails stats of a path with ESTALE the given number of times.
+type flakyFS struct {
+	FS
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (f *flakyFS) fail(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures[filepath.Base(name)] > 0 {
+		f.failures[filepath.Base(name)]--
+		return &os.PathError{Op: "stat", Path: name, Err: syscall.ESTALE}
+	}
+	return nil
+}
+
+func (f *flakyFS) Lstat(name string) (os.FileInfo, error) {
+	if err := f.fail(name); err != nil {
+		return nil, err
+	}
+	return f.FS.Lstat(name)
+}
+
+func (f *flakyFS) Stat(name string) (os.FileInfo, error) {
+	if err := f.fail(name); err != nil {
+		return nil, err
+	}
+	return f.FS.Stat(name)
+}
+
+func TestStatRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fs := &flakyFS{FS: OS, failures: map[string]int{"retried": 2, "failed": 4}}
+	var mu sync.Mutex
+	var errs []string
+	w, err := NewWatcher(StatRetry(3, time.Millisecond), func(w *Watcher) { w.fs = fs }, WithHooks(Hooks{
+		StatError: func(path string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, filepath.Base(path))
+		},
+	}))
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Add(dir))
+
+	retried := filepath.Join(dir, "retried")
+	require.NoError(t, ioutil.WriteFile(retried, nil, 0600))
+	e, err := w.EventTimeout(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, Event{Name: retried, Op: Create}, Event{Name: e.Name, Op: e.Op})
+	assert.NotNil(t, e.Info, "stat succeeded after retries")
+
+	failed := filepath.Join(dir, "failed")
+	require.NoError(t, ioutil.WriteFile(failed, nil, 0600))
+	e, err = w.EventTimeout(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, failed, e.Name)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"failed"}, errs, "only reported when the retries are used up")
+}
@@ -1,106 +1,857 @@
 // package symnotify provides a file system watcher that notifies events for symlink targets.
 //
+// It uses inotify on Linux, kqueue on macOS and BSD, and ReadDirectoryChangesW on Windows,
+// events for symlinks are the same on all of them.
+//
 package symnotify
 
 import (
+	"context"
+	"fmt"
 	"github.com/ViaQ/logerr/log"
 	"github.com/fsnotify/fsnotify"
+	"github.com/log-file-metric-exporter/pkg/fsinfo"
 	"io"
 	"io/ioutil"
-	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
-type Event = fsnotify.Event
 type Op = fsnotify.Op
 
+// Event is a file system event.
+type Event struct {
+	Name string
+	Op   Op
+	// Info is the result of os.Stat for Name, following symlinks, when the event was read.
+	// Events may be delayed, see Coalesce, so Info may be out of date when the event is received.
+	// It is nil if Name did not exist, or if the Watcher was created with NoFileInfo.
+	Info os.FileInfo
+	// OldName is the previous name of a Moved file, see Moves.
+	OldName string
+	// Raw is the fsnotify event that caused this event, with RawEvents. Events found while handling
+	// an fsnotify event have it too, for example Create events for the entries of a new directory
+	// and Remove events for vanished symlinks. It is nil without RawEvents, and for events not caused
+	// by an fsnotify event, for example Snapshot, poll, Resync and Rescan events.
+	Raw *fsnotify.Event
+	// Time is when the event was received from the kernel or found by polling, before it was
+	// processed, coalesced or buffered. Use it to measure the delay in handling file activity.
+	// Events made by the Watcher, for example Rescan, Overflow and Snapshot events, have the time
+	// they were made.
+	Time time.Time
+	// Err is the error for an Error event, nil for other events.
+	Err error
+}
+
+func (e Event) String() string {
+	if e.Op == Moved {
+		return fmt.Sprintf("%q -> %q: MOVED", e.OldName, e.Name)
+	}
+	return fmt.Sprintf("%q: %v", e.Name, e.Op)
+}
+
 const (
 	Create Op = fsnotify.Create
 	Write     = fsnotify.Write
 	Remove    = fsnotify.Remove
 	Rename    = fsnotify.Rename
 	Chmod     = fsnotify.Chmod
+	// Overflow means events were lost, the Event has no Name. Consumers should rescan everything they watch.
+	Overflow Op = 1 << 5
+	// Moved means OldName was renamed to Name, see Moves.
+	Moved Op = 1 << 6
+	// Rescan means events for Name were dropped, consumers should examine it again, see MaxEventAge.
+	Rescan Op = 1 << 7
+	// Error means Name could not be examined to update watches, the error is in Err, see WithErrorPolicy.
+	Error Op = 1 << 8
+	// Resync means Name, a path passed to Add, is watched again after its file system was unmounted
+	// or replaced, see RemountCheck. Events were lost, consumers should examine everything under Name again.
+	Resync Op = 1 << 9
 )
 
+// errorBuffer is the number of errors buffered for Event and Errors, errors are dropped when it is full.
+const errorBuffer = 16
+
+// backend delivers file events from the kernel, fsnotify unless Fanotify is set.
+type backend interface {
+	Add(name string) error
+	Remove(name string) error
+	Close() error
+	events() <-chan fsnotify.Event
+	errors() <-chan error
+}
+
+// fsnotifyBackend is the default backend.
+type fsnotifyBackend struct{ *fsnotify.Watcher }
+
+func (b fsnotifyBackend) events() <-chan fsnotify.Event { return b.Events }
+func (b fsnotifyBackend) errors() <-chan error          { return b.Errors }
+
+// Interface is the API of a Watcher, so consumers can be tested with a Fake.
+type Interface interface {
+	Add(name string, ops ...Op) error
+	AddFile(name string, ops ...Op) error
+	Remove(name string) error
+	Events() <-chan Event
+	Errors() <-chan error
+	WatchList() []string
+	Degraded() bool
+	Depth() Depth
+	Close() error
+}
+
+var _ Interface = &Watcher{}
+
 // Watcher is like fsnotify.Watcher but also notifies on changes to symlink targets
 type Watcher struct {
-	watcher *fsnotify.Watcher
+	watcher   backend
+	events    chan Event
+	errors    chan error
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	drain     chan struct{} // Closed by CloseDrain to flush buffered events.
+	drainOnce sync.Once
+	stopped   chan struct{} // Closed when run has returned and events is closed.
+
+	fanotify      bool                   // See Fanotify.
+	ignoreHidden  bool                   // See IgnoreHidden.
+	ignore        func(name string) bool // See Ignore.
+	recursive     bool
+	snapshot      bool
+	snapshots     chan struct{} // Signals events in snapshotEvents.
+	fileInfo      bool
+	raw           bool
+	maxLinkDepth  int
+	coalesce      time.Duration
+	pollNetwork   bool
+	pollInterval  time.Duration
+	pollEvents    chan Event
+	pollOnce      sync.Once
+	addWatch      func(string) error // Add an fsnotify watch, replaced by tests.
+	resolvesLinks bool               // fsnotify watches resolved symlink targets, see targets.go.
+	targets       targets
+	fsType        func(string) (string, error)       // File system type of a path, replaced by tests.
+	fileID        func(string) (fsinfo.FileID, bool) // Identity of a path, replaced by tests.
+	fs            FS                                 // Stats for events, see StatRetry, replaced by tests.
+	statRetries   int
+	statBackoff   time.Duration
+	remounts      remounts
+	hooks         Hooks
+	moves         mover
+	stale         staleness
+	budget        watchBudget
+	maxPending    int
+	depths        *depths
+	policy        DropPolicy // See Buffer.
+	errorPolicy   ErrorPolicy
+	retryDelay    time.Duration
+	retryEvents   chan Event     // Events held by Retry, see onError.
+	attempts      map[string]int // Errors for held events by name, used only by run.
+	lost          bool           // Events were dropped by the Buffer policy, an Overflow event is due.
+
+	mu      sync.Mutex
+	added   map[string]Op      // Paths added by Add, with the Ops to deliver, 0 for all.
+	links   map[string]bool    // Symlinks watched for their targets.
+	subdirs map[string]bool    // Subdirectories watched in recursive mode.
+	polled  map[string]*polled // Paths polled because they could not be watched.
+
+	snapshotEvents []Event // Create events for existing entries waiting for run, see Snapshot.
+	snapshotLost   bool    // More than MaxPending snapshot events, deliver an Overflow event instead.
+
+	chains    map[string][]string        // Symlinks after each watched symlink in its chain, see MaxLinkDepth.
+	via       map[string]map[string]bool // Watched symlinks whose chain goes through each symlink.
+	files     map[string]Op              // Files added by AddFile, with the Ops to deliver, 0 for all.
+	innerDirs map[string]int             // Directories watched for chains or AddFile, with a reference count.
+	roots     map[string]*root           // Paths passed to Add that are symlinks, see roots.go.
 }
 
-func NewWatcher() (*Watcher, error) {
-	w, err := fsnotify.NewWatcher()
-	return &Watcher{watcher: w}, err
+// Option configures a Watcher.
+type Option func(*Watcher)
+
+// Recursive watches subdirectories of added directories, including those created later.
+// A Create event is delivered for each entry found in a new subdirectory,
+// since entries may be created before the subdirectory is watched.
+// This can duplicate Create events for entries created while the subdirectory is being added.
+func Recursive() Option { return func(w *Watcher) { w.recursive = true } }
+
+// Coalesce delays events for up to window, and drops an event if the last delayed event
+// for the same name has the same Op. The remaining events keep their order.
+func Coalesce(window time.Duration) Option { return func(w *Watcher) { w.coalesce = window } }
+
+// RawEvents sets Event.Raw to the underlying fsnotify event, for consumers that need
+// to know what actually happened. For example a Chmod on a watched symlink because
+// a symlink in its chain was replaced has a Raw event for the replaced symlink,
+// and with kqueue a Write on a watched symlink has a Raw event for the resolved target.
+// Coalesced events keep the Raw event of the first event.
+func RawEvents() Option { return func(w *Watcher) { w.raw = true } }
+
+// Snapshot makes Add deliver a Create event for each existing entry of an added directory,
+// and of its subdirectories in Recursive mode, and AddFile for an existing file, so consumers
+// can handle existing and new files in the same way. Entries created while a directory
+// is being added may get two Create events.
+func Snapshot() Option { return func(w *Watcher) { w.snapshot = true } }
+
+// NoFileInfo does not set Event.Info, saving a stat for each event if the consumer does not need it.
+func NoFileInfo() Option { return func(w *Watcher) { w.fileInfo = false } }
+
+func NewWatcher(opts ...Option) (*Watcher, error) {
+	w := &Watcher{
+		events:    make(chan Event),
+		errors:    make(chan error, errorBuffer),
+		done:      make(chan struct{}),
+		drain:     make(chan struct{}),
+		stopped:   make(chan struct{}),
+		snapshots: make(chan struct{}, 1),
+		added:     make(map[string]Op),
+		links:     make(map[string]bool),
+		subdirs:   make(map[string]bool),
+		polled:    make(map[string]*polled),
+
+		chains:    make(map[string][]string),
+		via:       make(map[string]map[string]bool),
+		files:     make(map[string]Op),
+		innerDirs: make(map[string]int),
+		roots:     make(map[string]*root),
+
+		fileInfo:     true,
+		maxLinkDepth: defaultMaxLinkDepth,
+		pollInterval: defaultPollInterval,
+		pollEvents:   make(chan Event),
+		retryDelay:   defaultRetryDelay,
+		retryEvents:  make(chan Event),
+
+		resolvesLinks: platformResolvesLinks,
+		maxPending:    defaultMaxPending,
+		depths:        &depths{},
+	}
+	w.fsType = fsinfo.Type
+	w.fileID = statID
+	w.fs = OS
+	for _, o := range opts {
+		o(w)
+	}
+	if w.fanotify {
+		fw, err := newFanotify()
+		if err != nil {
+			return nil, err
+		}
+		// Events are for resolved paths, like kqueue.
+		w.watcher, w.resolvesLinks = fw, true
+	} else {
+		fw, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		w.watcher = fsnotifyBackend{fw}
+	}
+	w.addWatch = w.watcher.Add
+	w.stale.max = w.maxPending
+	w.remounts.start()
+	go w.run()
+	return w, nil
 }
 
 // Event returns the next event.
 func (w *Watcher) Event() (e Event, err error) {
-	return w.EventTimeout(time.Duration(math.MaxInt64))
+	return w.EventContext(context.Background())
 }
 
 // EventTimeout returns the next event or os.ErrDeadlineExceeded if timeout is exceeded.
 func (w *Watcher) EventTimeout(timeout time.Duration) (e Event, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	e, err = w.EventContext(ctx)
+	if err == context.DeadlineExceeded {
+		err = os.ErrDeadlineExceeded
+	}
+	return e, err
+}
+
+// EventContext returns the next event, or ctx.Err() if ctx is done first.
+func (w *Watcher) EventContext(ctx context.Context) (e Event, err error) {
 	var ok bool
 	select {
-	case e, ok = <-w.watcher.Events:
-	case err, ok = <-w.watcher.Errors:
-	case <-time.After(timeout):
-		return Event{}, os.ErrDeadlineExceeded
+	case e, ok = <-w.events:
+	case err, ok = <-w.errors:
+	case <-ctx.Done():
+		return Event{}, ctx.Err()
 	}
-	switch {
-	case !ok:
+	if !ok {
 		return Event{}, io.EOF
+	}
+	return e, err
+}
+
+// Events returns a channel that delivers the same events as Event.
+// The channel is closed when the Watcher is closed.
+// Use it to select on events together with other channels.
+func (w *Watcher) Events() <-chan Event { return w.events }
+
+// Errors returns a channel that delivers errors from the underlying watcher.
+// Each error is delivered once, either by Event or on this channel.
+// Errors are buffered separately from events, reading them does not disturb event order.
+// An event queue overflow is not an error, it is delivered as an Overflow event.
+func (w *Watcher) Errors() <-chan error { return w.errors }
+
+// run reads fsnotify events, updates symlink watches and delivers events until closed.
+func (w *Watcher) run() {
+	defer close(w.stopped)
+	defer close(w.events)
+	defer w.remounts.stop()
+	defer func() {
+		select {
+		case <-w.done: // Closed without draining, discard buffered events, see Buffer.
+			for len(w.events) > 0 {
+				select {
+				case e := <-w.events:
+					w.dropped(DropClosed, e)
+				default:
+				}
+			}
+		default:
+		}
+	}()
+	var c coalescer
+	var flush <-chan time.Time
+	for {
+		w.setDepths(&c)
+		var events []Event
+		flushed := false
+		select {
+		case e, ok := <-w.watcher.events():
+			if !ok {
+				return
+			}
+			if e.Name == "" {
+				// Queued before its watch was removed, the path is no longer known.
+				w.dropped(DropUnknown, Event{Op: e.Op})
+				continue
+			}
+			if e.Op == 0 {
+				// fsnotify delivers IN_UNMOUNT with no Op, the watch is gone.
+				w.unmounted(w.fromRoot(e.Name))
+				continue
+			}
+			now := time.Now()
+			w.budget.touch(e.Name, now)
+			translated, reason := w.translate(Event{Name: w.fromRoot(e.Name), Op: e.Op})
+			if translated == nil {
+				w.dropped(reason, Event{Name: e.Name, Op: e.Op})
+				continue
+			}
+			for _, ev := range translated {
+				events = append(events, w.process(ev)...)
+			}
+			stamp(events, now)
+			if w.raw {
+				for i := range events {
+					events[i].Raw = &e
+				}
+			}
+			events = w.filter(w.moves.correlate(events))
+		case <-w.snapshots:
+			w.mu.Lock()
+			lost := w.snapshotLost
+			events, w.snapshotEvents, w.snapshotLost = w.snapshotEvents, nil, false
+			w.mu.Unlock()
+			if lost {
+				events = []Event{{Op: Overflow}}
+			}
+			stamp(events, time.Now())
+			events = w.filter(events)
+		case e := <-w.retryEvents:
+			events = w.process(e)
+			stamp(events, e.Time)
+			events = w.filter(w.moves.correlate(events))
+		case <-w.moves.timer:
+			events = w.filter(w.moves.expire())
+		case <-w.stale.timer:
+			events = w.stale.rescans()
+		case <-w.remounts.timer:
+			events = w.filter(w.resync(w.unmountedPaths()))
+		case <-w.remounts.tick:
+			events = w.filter(w.resync(w.remounted()))
+		case e := <-w.pollEvents:
+			e.Name = w.fromRoot(e.Name)
+			if w.inner(e.Name) {
+				w.dropped(DropInternal, e)
+			} else if w.ignored(e.Name) {
+				w.dropped(DropIgnored, e)
+			} else {
+				e.Time = time.Now()
+				events = w.filter([]Event{e})
+			}
+		case err, ok := <-w.watcher.errors():
+			if !ok {
+				return
+			}
+			if err == fsnotify.ErrEventOverflow {
+				log.Info("Warning: file event queue overflow, events were lost")
+				events = []Event{{Op: Overflow}}
+				break
+			}
+			select {
+			case w.errors <- err:
+			default:
+				log.Error(err, "Dropped watcher error, error buffer is full")
+			}
+			continue
+		case <-flush:
+			events, flush, flushed = c.flush(), nil, true
+		case <-w.drain:
+			// Deliver everything buffered, then stop.
+			events = append(c.flush(), w.filter(w.moves.expire())...)
+			w.deliver(append(events, w.stale.rescans()...))
+			return
+		case <-w.done:
+			return
+		}
+		if w.coalesce > 0 && !flushed {
+			w.dropped(DropCoalesced, c.add(events)...)
+			if !w.full(len(c.pending)) {
+				if flush == nil {
+					flush = time.After(w.coalesce)
+				}
+				continue
+			}
+			events, flush = c.flush(), nil // Deliver early, see MaxPending.
+		}
+		w.setDepths(&c)
+		if !w.deliver(events) {
+			return
+		}
+	}
+}
+
+// deliver sends events to the consumer, dropping events that become too old while waiting,
+// see MaxEventAge. Returns false if the Watcher was closed.
+func (w *Watcher) deliver(events []Event) bool {
+	for _, e := range events {
+		if w.stale.drop(e, time.Now()) {
+			w.dropped(DropStale, e)
+			continue
+		}
+		for _, e := range append(w.stale.rescans(), e) {
+			out := e
+			if out.Time.IsZero() {
+				out.Time = time.Now()
+			}
+			if w.policy != Block {
+				w.enqueue(out)
+				continue
+			}
+			timer := w.stale.deadline(e)
+			var expired <-chan time.Time
+			if timer != nil {
+				expired = timer.C
+			}
+			select {
+			case w.events <- out:
+				w.delivered(out)
+			case <-expired:
+				w.stale.record(e.Name)
+				w.dropped(DropStale, out)
+			case <-w.done:
+				return false
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	}
+	return true
+}
+
+// stamp sets the time events were received.
+func stamp(events []Event, now time.Time) {
+	for i := range events {
+		events[i].Time = now
+	}
+}
+
+// process updates watches for an event, returns the events to deliver for it before filtering.
+func (w *Watcher) process(e Event) []Event {
+	relinked := append(w.relink(e), w.reroot(e)...)
+	if w.inner(e.Name) {
+		w.dropped(DropInternal, e)
+		return relinked
+	}
+	if w.ignored(e.Name) {
+		w.dropped(DropIgnored, e)
+		return relinked
+	}
+	lstat, found, err := w.handle(e)
+	if err != nil {
+		held, surfaced := w.onError(e, err)
+		if held {
+			return relinked
+		}
+		found = append(found, surfaced...)
+	} else {
+		delete(w.attempts, e.Name)
+	}
+	e.Info = w.info(e.Name, lstat)
+	return append(append([]Event{e}, found...), relinked...)
+}
+
+// handle updates watches for symlinks and subdirectories affected by e.
+// Returns the Lstat of e.Name if it was needed, and Create events for entries found in a new subdirectory.
+// Returns an error if e.Name or its symlink target could not be examined, see ErrorPolicy.
+func (w *Watcher) handle(e Event) (lstat os.FileInfo, found []Event, err error) {
+	switch {
 	case e.Op == Create:
 		log.V(2).Info("Create Event Detected for file..", "e.Name", e.Name)
-		if info, err := os.Lstat(e.Name); err == nil {
-			if isSymlink(info) {
-				_ = w.watcher.Add(e.Name)
-			}
+		info, err := w.lstat(e.Name)
+		if err != nil {
+			w.statError(e.Name, err)
+			return nil, nil, err
+		}
+		if isSymlink(info) {
+			return info, nil, linkError(w.addLink(e.Name))
+		} else if info.IsDir() && w.recursive {
+			return info, w.addSubdir(e.Name, true), nil
 		}
+		return info, nil, nil
 	case e.Op == Remove:
 		log.V(2).Info("Remove Event Detected for file..", "e.Name", e.Name)
+		if _, err := w.lstat(e.Name); os.IsNotExist(err) {
+			// Symlink or subdirectory is gone, release its watches.
+			w.removeTree(e.Name)
+		}
 	case e.Op == Chmod || e.Op == Rename:
 		log.V(2).Info("Chmod or Rename Event Detected for file..", "e.Name", e.Name)
-		if info, err := os.Lstat(e.Name); err == nil {
+		if info, err := w.lstat(e.Name); err == nil {
 			if isSymlink(info) {
 				// Symlink target may have changed.
-				_ = w.watcher.Remove(e.Name)
-				_ = w.watcher.Add(e.Name)
+				_ = w.unwatch(e.Name)
+				return info, nil, linkError(w.addLink(e.Name))
 			}
+			return info, nil, nil
+		} else if os.IsNotExist(err) {
+			w.removeTree(e.Name)
+		} else {
+			w.statError(e.Name, err)
+			return nil, nil, err
 		}
 	}
-	return e, err
+	return nil, nil, nil
 }
 
-// Add dir,dir/files* to the watcher
-func (w *Watcher) Add(name string) error {
-	if err := w.watcher.Add(name); err != nil {
+// linkError returns an error from addLink for the ErrorPolicy.
+// ErrLinkDepth is not returned, retrying can't fix it and it is already logged.
+func linkError(err error) error {
+	if err == ErrLinkDepth {
+		return nil
+	}
+	return err
+}
+
+// info returns the Event.Info for name, using lstat if it is already known and not a symlink.
+// Returns nil with NoFileInfo.
+func (w *Watcher) info(name string, lstat os.FileInfo) os.FileInfo {
+	if !w.fileInfo {
+		return nil
+	}
+	if lstat != nil && !isSymlink(lstat) {
+		return lstat
+	}
+	info, err := w.stat(name)
+	if err != nil {
+		w.statError(name, err)
+		return nil
+	}
+	return info
+}
+
+// filter removes Ops that were not requested by Add for the nearest added path,
+// and drops events with no Ops left. Moved is kept if Rename was requested, otherwise it is a Create.
+// Rescan, Error and Resync events are always kept.
+func (w *Watcher) filter(events []Event) []Event {
+	var dropped []Event
+	w.mu.Lock()
+	kept := events[:0]
+	for _, e := range events {
+		mask := w.mask(e.Name)
+		if e.Op == Moved && mask != 0 && mask&Rename == 0 {
+			e.Op, e.OldName = Create, "" // Deliver the Create that was correlated.
+		}
+		if mask&Rename != 0 {
+			mask |= Moved
+		}
+		if mask != 0 {
+			mask |= Rescan | Error | Resync
+		}
+		if mask != 0 && e.Op&mask == 0 {
+			dropped = append(dropped, e)
+			continue
+		} else if mask != 0 {
+			e.Op &= mask
+		}
+		kept = append(kept, e)
+	}
+	w.mu.Unlock()
+	w.dropped(DropFiltered, dropped...)
+	return kept
+}
+
+// mask returns the Ops requested for a file added by AddFile, or for the nearest
+// added path at or above name, 0 for all.
+// Must be called with w.mu locked.
+func (w *Watcher) mask(name string) Op {
+	if mask, ok := w.files[name]; ok {
+		return mask
+	}
+	for {
+		if mask, ok := w.added[name]; ok {
+			return mask
+		}
+		parent := filepath.Dir(name)
+		if parent == name {
+			return 0
+		}
+		name = parent
+	}
+}
+
+// addLink watches the target of symlink name, and the symlinks in its chain.
+func (w *Watcher) addLink(name string) error {
+	links, err := chain(name, w.maxLinkDepth)
+	if err == ErrLinkDepth {
+		log.Info("Warning: not watching symlink, chain is too long or has a loop", "path", name, "limit", w.maxLinkDepth)
+		w.unchain(name)
 		return err
 	}
+	// Set the chain even if the watch fails, to retry when a missing target appears.
+	w.setChain(name, links)
+	if err := w.watch(linkWatch(name)); err != nil {
+		return err
+	}
+	w.setTarget(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.links[name] = true
+	return nil
+}
 
-	// Scan directories for existing symlinks, we wont' get a Create for those.
-	if infos, err := ioutil.ReadDir(name); err == nil {
-		for _, info := range infos {
-			if isSymlink(info) {
-				log.V(3).Info("Adding file to watcher ...", "filename", filepath.Join(name, info.Name()))
-				err := w.watcher.Add(filepath.Join(name, info.Name()))
-				log.V(3).Info("err return by watcher.Add call ...", "err", err)
+// removeLink stops watching the target of symlink name, if it is watched.
+func (w *Watcher) removeLink(name string) {
+	polled := w.unpoll(name)
+	w.unchain(name)
+	w.mu.Lock()
+	watched := w.links[name]
+	delete(w.links, name)
+	w.mu.Unlock()
+	if watched && !polled {
+		// May fail if the kernel already dropped the watch.
+		_ = w.unwatch(name)
+	}
+}
+
+// addSubdir watches subdirectory dir in recursive mode, see scan.
+func (w *Watcher) addSubdir(dir string, report bool) []Event {
+	if err := w.watch(dir); err != nil {
+		log.V(3).Info("err return by watcher.Add call ...", "err", err)
+		return nil
+	}
+	w.mu.Lock()
+	w.subdirs[dir] = true
+	w.mu.Unlock()
+	return w.scan(dir, report)
+}
+
+// removeTree releases watches for symlink or subdirectory name,
+// and for symlinks and subdirectories watched under name.
+func (w *Watcher) removeTree(name string) {
+	w.mu.Lock()
+	dirs := map[string]bool{}
+	prefix := name + string(filepath.Separator)
+	for dir := range w.subdirs {
+		if dir == name || strings.HasPrefix(dir, prefix) {
+			dirs[dir] = true
+			delete(w.subdirs, dir)
+		}
+	}
+	var links []string
+	for _, m := range []map[string]bool{w.links, w.chained()} {
+		for link := range m {
+			if dir := filepath.Dir(link); link == name || dir == name || dirs[dir] {
+				links = append(links, link)
 			}
 		}
 	}
+	w.mu.Unlock()
+	for _, link := range links {
+		w.removeLink(link)
+	}
+	for dir := range dirs {
+		if !w.unpoll(dir) {
+			// May fail if the kernel already dropped the watch.
+			_ = w.unwatch(dir)
+		}
+	}
+}
+
+// scan adds watches for symlinks in dir, and for subdirectories in recursive mode.
+// If report is true, returns Create events for the entries found.
+func (w *Watcher) scan(dir string, report bool) (found []Event) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		w.statError(dir, err)
+		return nil
+	}
+	for _, info := range infos {
+		name := filepath.Join(dir, info.Name())
+		if w.ignored(name) {
+			continue
+		}
+		w.moves.record(name, info)
+		if report {
+			found = append(found, Event{Name: name, Op: Create, Info: w.info(name, info)})
+		}
+		if isSymlink(info) {
+			log.V(3).Info("Adding file to watcher ...", "filename", name)
+			err := w.addLink(name)
+			log.V(3).Info("err return by watcher.Add call ...", "err", err)
+		} else if info.IsDir() && w.recursive {
+			found = append(found, w.addSubdir(name, report)...)
+		}
+	}
+	return found
+}
+
+// Add dir,dir/files* to the watcher
+// If ops are given, only events with those Ops are delivered for name and paths under it,
+// other Ops are still used to track symlinks. Overflow, Rescan, Error and Resync events are always delivered.
+//
+// If name is a symlink its resolved target is watched, events are still delivered for paths
+// under name. If name is re-pointed to another target, the new target is watched and a Rescan
+// event is delivered for name, the consumer should examine all of its entries again.
+func (w *Watcher) Add(name string, ops ...Op) error {
+	name = filepath.Clean(name)
+	target, err := resolveRoot(name)
+	if err != nil {
+		return err
+	}
+	if err := w.watch(target); err != nil {
+		return err
+	}
+	if target != name {
+		w.setRoot(name, target)
+	}
+	w.identify(name)
+	var mask Op
+	for _, op := range ops {
+		mask |= op
+	}
+	w.mu.Lock()
+	w.added[name] = mask
+	w.mu.Unlock()
+
+	// Scan directories for existing symlinks, we wont' get a Create for those.
+	w.queueSnapshot(w.scan(name, w.snapshot))
 	return nil
 }
 
-// Remove name from watcher
+// Remove name from watcher.
+// If name is a directory, also stop watching the targets of symlinks in it,
+// and subdirectories in recursive mode, releasing all the watches used for the directory.
 func (w *Watcher) Remove(name string) error {
-	//delete(w.added, name)
-	return w.watcher.Remove(name)
+	name = filepath.Clean(name)
+	w.mu.Lock()
+	delete(w.added, name)
+	delete(w.remounts.ids, name)
+	_, file := w.files[name]
+	w.mu.Unlock()
+	if file {
+		return w.removeFile(name)
+	}
+	w.removeTree(name)
+	watched := w.removeRoot(name)
+	if watched == "" || w.unpoll(watched) {
+		return nil
+	}
+	return w.unwatch(watched)
+}
+
+// WatchList returns the sorted list of watched or polled paths:
+// paths passed to Add or AddFile, symlinks whose targets are watched, and directories watched
+// for chained symlinks or AddFile.
+func (w *Watcher) WatchList() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seen := map[string]bool{}
+	for _, m := range []map[string]Op{w.added, w.files} {
+		for name := range m {
+			seen[name] = true
+		}
+	}
+	for name := range w.innerDirs {
+		seen[name] = true
+	}
+	for _, m := range []map[string]bool{w.links, w.subdirs} {
+		for name := range m {
+			seen[name] = true
+		}
+	}
+	list := make([]string, 0, len(seen))
+	for name := range seen {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Close stops watching and releases all watches.
+// Close is idempotent and safe to call concurrently with Event and other methods.
+// When it returns the Events channel is closed, and Event returns io.EOF,
+// including calls that were blocked waiting for an event. Buffered events are discarded,
+// see CloseDrain.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.closeErr = w.watcher.Close()
+	})
+	<-w.stopped
+	return w.closeErr
 }
 
-// Close watcher
-func (w *Watcher) Close() error { return w.watcher.Close() }
+// CloseDrain is like Close, but first stops watching and delivers buffered events,
+// for example events delayed by Coalesce or Moves. It waits up to timeout for
+// the consumer to receive them, then closes anyway.
+func (w *Watcher) CloseDrain(timeout time.Duration) error {
+	w.drainOnce.Do(func() { close(w.drain) })
+	select {
+	case <-w.stopped:
+	case <-time.After(timeout):
+	}
+	return w.Close()
+}
+
+// queueSnapshot passes Create events for existing entries to run without blocking,
+// since the consumer may be calling Add instead of receiving events.
+// Beyond MaxPending waiting events they are replaced by a single Overflow event.
+func (w *Watcher) queueSnapshot(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	w.mu.Lock()
+	if n := len(w.snapshotEvents) + len(events); w.snapshotLost || (w.maxPending > 0 && n > w.maxPending) {
+		w.snapshotEvents, w.snapshotLost = nil, true
+	} else {
+		w.snapshotEvents = append(w.snapshotEvents, events...)
+	}
+	w.mu.Unlock()
+	select {
+	case w.snapshots <- struct{}{}:
+	default: // Already signalled.
+	}
+}
 
 func isSymlink(info os.FileInfo) bool {
-	return (info.Mode() & os.ModeSymlink) == os.ModeSymlink
+	return info.Mode()&linkModes != 0
 }
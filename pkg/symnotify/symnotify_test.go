@@ -1,12 +1,17 @@
 package symnotify_test
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/log-file-metric-exporter/pkg/symnotify"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,7 +25,7 @@ type Fixture struct {
 	Watcher             *symnotify.Watcher
 }
 
-func NewFixture(t *testing.T) *Fixture {
+func NewFixture(t *testing.T, opts ...symnotify.Option) *Fixture {
 	t.Helper()
 	f := &Fixture{T: t}
 
@@ -34,7 +39,7 @@ func NewFixture(t *testing.T) *Fixture {
 	for _, dir := range []string{f.Logs, f.Targets} {
 		require.NoError(t, os.Mkdir(dir, os.ModePerm))
 	}
-	f.Watcher, err = symnotify.NewWatcher()
+	f.Watcher, err = symnotify.NewWatcher(opts...)
 	require.NoError(t, err)
 	t.Cleanup(func() { f.Watcher.Close() })
 	return f
@@ -56,10 +61,13 @@ func (f *Fixture) Link(name string) (string, *os.File) {
 	return link, file
 }
 
+// Event returns the next event without Info, so it can be compared with expected events.
 func (f *Fixture) Event() symnotify.Event {
 	f.T.Helper()
 	e, err := f.Watcher.EventTimeout(time.Second)
 	require.NoError(f.T, err)
+	assert.False(f.T, e.Time.IsZero(), "event without time: %v", e)
+	e.Info, e.Time = nil, time.Time{}
 	return e
 }
 
@@ -99,6 +107,215 @@ func TestWatchesRealFiles(t *testing.T) {
 	}
 }
 
+func TestIgnoreHidden(t *testing.T) {
+	var ignored []string
+	f := NewFixture(t, symnotify.IgnoreHidden(), symnotify.WithHooks(symnotify.Hooks{
+		EventDropped: func(e symnotify.Event, reason string) {
+			if reason == symnotify.DropIgnored {
+				ignored = append(ignored, e.Name)
+			}
+		},
+	}))
+	require.NoError(t, f.Watcher.Add(f.Logs))
+	hidden, _ := f.Create(Join(f.Logs, ".hidden"))
+	tmp, _ := f.Create(Join(f.Logs, "log.tmp"))
+	log := Join(f.Logs, "log")
+	require.NoError(t, os.Rename(tmp, log))
+	assert.Equal(t, symnotify.Event{Name: log, Op: symnotify.Create}, f.Event())
+	assert.Subset(t, ignored, []string{hidden, tmp})
+
+	for _, name := range []string{".x", "x.tmp", "x.swp", "x~", "/a/.b"} {
+		assert.True(t, symnotify.Hidden(name), name)
+	}
+	for _, name := range []string{"x", "x.log", ".", "/a/.b/c", "tmp"} {
+		assert.False(t, symnotify.Hidden(name), name)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	f := NewFixture(t, symnotify.Ignore(func(name string) bool { return filepath.Base(name) == "skip.log" }))
+	require.NoError(t, f.Watcher.Add(f.Logs))
+	_, _ = f.Create(Join(f.Logs, "skip.log"))
+	log, _ := f.Create(Join(f.Logs, "log"))
+	assert.Equal(t, symnotify.Event{Name: log, Op: symnotify.Create}, f.Event())
+}
+
+func TestRemountCheck(t *testing.T) {
+	f := NewFixture(t, symnotify.RemountCheck(10*time.Millisecond))
+	require.NoError(t, f.Watcher.Add(f.Logs, symnotify.Create))
+	// Replace the watched directory, like a volume mounted over it, the watch follows the old one.
+	require.NoError(t, os.Rename(f.Logs, Join(f.Root, "old")))
+	require.NoError(t, os.Mkdir(f.Logs, os.ModePerm))
+	assert.Equal(t, symnotify.Event{Name: f.Logs, Op: symnotify.Resync}, f.Event())
+	log, _ := f.Create(Join(f.Logs, "log"))
+	assert.Equal(t, symnotify.Event{Name: log, Op: symnotify.Create}, f.Event())
+	assert.Equal(t, []string{f.Logs}, f.Watcher.WatchList())
+}
+
+func TestMoves(t *testing.T) {
+	f := NewFixture(t, symnotify.Moves(100*time.Millisecond))
+	assert, require := assert.New(t), require.New(t)
+	log1, _ := f.Create(Join(f.Logs, "log1"))
+	link1, _ := f.Link("link1")
+	require.NoError(f.Watcher.Add(f.Logs))
+
+	// Rename within the directory is one Moved event.
+	log2 := Join(f.Logs, "log2")
+	require.NoError(os.Rename(log1, log2))
+	assert.Equal(symnotify.Event{Name: log2, Op: symnotify.Moved, OldName: log1}, f.Event())
+	link2 := Join(f.Logs, "link2")
+	require.NoError(os.Rename(link1, link2))
+	assert.Equal(symnotify.Event{Name: link2, Op: symnotify.Moved, OldName: link1}, f.Event())
+	// Rename out of the directory is a Rename after the window.
+	require.NoError(os.Rename(log2, Join(f.Targets, "log2")))
+	assert.Equal(symnotify.Event{Name: log2, Op: symnotify.Rename}, f.Event())
+	// A file created later is tracked.
+	log3, _ := f.Create(Join(f.Logs, "log3"))
+	assert.Equal(symnotify.Event{Name: log3, Op: symnotify.Create}, f.Event())
+	require.NoError(os.Rename(log3, log1))
+	assert.Equal(symnotify.Event{Name: log1, Op: symnotify.Moved, OldName: log3}, f.Event())
+}
+
+func TestMaxEventAge(t *testing.T) {
+	f := NewFixture(t, symnotify.MaxEventAge(50*time.Millisecond))
+	assert, require := assert.New(t), require.New(t)
+	log1, file1 := f.Create(Join(f.Logs, "log1"))
+	require.NoError(f.Watcher.Add(f.Logs))
+
+	// Events that wait too long for the consumer are replaced by a Rescan.
+	for i := 0; i < 3; i++ {
+		_, err := file1.Write([]byte("x"))
+		require.NoError(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(symnotify.Event{Name: log1, Op: symnotify.Rescan}, f.Event())
+	// Events delivered in time are not affected.
+	_, err := file1.Write([]byte("x"))
+	require.NoError(err)
+	e := f.Event()
+	for e.Op == symnotify.Rescan {
+		// Events read late, while the first Rescan was waiting, may also be stale.
+		e = f.Event()
+	}
+	assert.Equal(symnotify.Event{Name: log1, Op: symnotify.Write}, e)
+}
+
+func TestBufferDropNewest(t *testing.T) {
+	testBuffer(t, symnotify.DropNewest, 2, []string{"0", "1"}, "4")
+}
+
+func TestBufferDropOldest(t *testing.T) {
+	testBuffer(t, symnotify.DropOldest, 4, []string{"", "3"}, "")
+}
+
+// testBuffer creates 4 files with a buffer of 2 and waits for drops, then expects to receive want,
+// "" means Overflow. If created is not "" it creates another file and expects Overflow and its Create.
+func testBuffer(t *testing.T, policy symnotify.DropPolicy, wantDrops int, want []string, created string) {
+	t.Helper()
+	var mu sync.Mutex
+	drops := 0
+	f := NewFixture(t, symnotify.NoFileInfo(), symnotify.Buffer(2, policy), symnotify.WithHooks(symnotify.Hooks{
+		EventDropped: func(e symnotify.Event, reason string) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, symnotify.DropBuffer, reason)
+			drops++
+		},
+	}))
+	require.NoError(t, f.Watcher.Add(f.Logs, symnotify.Create))
+	for i := 0; i < 4; i++ {
+		f.Create(Join(f.Logs, fmt.Sprint(i)))
+	}
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := drops
+		mu.Unlock()
+		if n >= wantDrops {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	assert.Equal(t, wantDrops, drops)
+	mu.Unlock()
+	event := func(name string) symnotify.Event {
+		if name == "" {
+			return symnotify.Event{Op: symnotify.Overflow}
+		}
+		return symnotify.Event{Name: Join(f.Logs, name), Op: symnotify.Create}
+	}
+	for _, name := range want {
+		assert.Equal(t, event(name), f.Event())
+	}
+	if created != "" {
+		f.Create(Join(f.Logs, created))
+		assert.Equal(t, event(""), f.Event())
+		assert.Equal(t, event(created), f.Event())
+	}
+}
+
+func TestBufferDiscardedOnClose(t *testing.T) {
+	delivered := make(chan symnotify.Event, 1)
+	f := NewFixture(t, symnotify.Buffer(4, symnotify.Block), symnotify.WithHooks(symnotify.Hooks{
+		EventDelivered: func(e symnotify.Event) { delivered <- e },
+	}))
+	require.NoError(t, f.Watcher.Add(f.Logs, symnotify.Create))
+	f.Create(Join(f.Logs, "log"))
+	select {
+	case <-delivered: // Buffered, not received.
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event to be buffered")
+	}
+	require.NoError(t, f.Watcher.Close())
+	_, err := f.Watcher.Event()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestParseDropPolicy(t *testing.T) {
+	for _, p := range []symnotify.DropPolicy{symnotify.Block, symnotify.DropNewest, symnotify.DropOldest} {
+		got, err := symnotify.ParseDropPolicy(p.String())
+		assert.NoError(t, err)
+		assert.Equal(t, p, got)
+	}
+	_, err := symnotify.ParseDropPolicy("sometimes")
+	assert.Error(t, err)
+}
+
+func TestSnapshot(t *testing.T) {
+	f := NewFixture(t, symnotify.Snapshot(), symnotify.Recursive())
+	assert, require := assert.New(t), require.New(t)
+	log1, _ := f.Create(Join(f.Logs, "log1"))
+	link, _ := f.Link("link")
+	sub := Join(f.Logs, "sub")
+	require.NoError(os.Mkdir(sub, 0700))
+	log2, _ := f.Create(Join(sub, "log2"))
+	require.NoError(f.Watcher.Add(f.Logs))
+	for _, name := range []string{link, log1, sub, log2} {
+		assert.Equal(symnotify.Event{Name: name, Op: symnotify.Create}, f.Event())
+	}
+	// New files are reported as usual.
+	log3, _ := f.Create(Join(f.Logs, "log3"))
+	assert.Equal(symnotify.Event{Name: log3, Op: symnotify.Create}, f.Event())
+
+	file, _ := f.Create(Join(f.Targets, "file"))
+	require.NoError(f.Watcher.AddFile(file))
+	assert.Equal(symnotify.Event{Name: file, Op: symnotify.Create}, f.Event())
+}
+
+func TestEventTime(t *testing.T) {
+	const window = 100 * time.Millisecond
+	f := NewFixture(t, symnotify.Coalesce(window))
+	require.NoError(t, f.Watcher.Add(f.Logs))
+	before := time.Now()
+	_, _ = f.Create(Join(f.Logs, "log"))
+	e, err := f.Watcher.EventTimeout(time.Second)
+	require.NoError(t, err)
+	received := time.Now()
+	assert.False(t, e.Time.Before(before), "time %v before the file was created at %v", e.Time, before)
+	// The time is from the kernel event, before the Coalesce delay.
+	assert.True(t, received.Sub(e.Time) >= window, "time %v does not include the delay before %v", e.Time, received)
+}
+
 func TestWatchesSymlinks(t *testing.T) {
 	f := NewFixture(t)
 	assert, require := assert.New(t), require.New(t)
@@ -137,6 +354,61 @@ func TestWatchesSymlinks(t *testing.T) {
 	}
 }
 
+func TestFanotify(t *testing.T) {
+	w, err := symnotify.NewWatcher(symnotify.Fanotify())
+	if err != nil {
+		t.Skip("fanotify is not available:", err)
+	}
+	_ = w.Close()
+	f := NewFixture(t, symnotify.Fanotify())
+	assert, require := assert.New(t), require.New(t)
+	require.NoError(f.Watcher.Add(f.Logs))
+
+	log1, file1 := f.Create(Join(f.Logs, "log1"))
+	assert.Equal(symnotify.Event{Name: log1, Op: symnotify.Create}, f.Event())
+	_, err = file1.Write([]byte("hello"))
+	require.NoError(err)
+	assert.Equal(symnotify.Event{Name: log1, Op: symnotify.Write}, f.Event())
+
+	// Writes to symlink targets outside the watched directory are reported for the symlink.
+	link, target := f.Link("link")
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Create}, f.Event())
+	_, err = target.Write([]byte("hello"))
+	require.NoError(err)
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Write}, f.Event())
+
+	// Other files on the same file system are not reported.
+	_, other := f.Create(Join(f.Targets, "other"))
+	_, err = other.Write([]byte("hello"))
+	require.NoError(err)
+	require.NoError(os.Remove(log1))
+	assert.Equal(symnotify.Event{Name: log1, Op: symnotify.Remove}, f.Event())
+}
+
+func TestSymlinkedRoot(t *testing.T) {
+	f := NewFixture(t)
+	assert, require := assert.New(t), require.New(t)
+	root := Join(f.Root, "containers")
+	require.NoError(os.Symlink(f.Logs, root))
+	require.NoError(f.Watcher.Add(root, symnotify.Create))
+	assert.Equal([]string{f.Root, root}, f.Watcher.WatchList(), "watches the directory of the root")
+
+	f.Create(Join(f.Logs, "a"))
+	assert.Equal(symnotify.Event{Name: Join(root, "a"), Op: symnotify.Create}, f.Event())
+
+	// Re-point the root atomically.
+	tmp := Join(f.Root, "containers.tmp")
+	require.NoError(os.Symlink(f.Targets, tmp))
+	require.NoError(os.Rename(tmp, root))
+	assert.Equal(symnotify.Event{Name: root, Op: symnotify.Rescan}, f.Event())
+	f.Create(Join(f.Logs, "old"))
+	f.Create(Join(f.Targets, "b"))
+	assert.Equal(symnotify.Event{Name: Join(root, "b"), Op: symnotify.Create}, f.Event())
+
+	require.NoError(f.Watcher.Remove(root))
+	assert.Empty(f.Watcher.WatchList())
+}
+
 func TestWatchesSymlinkTargetsChanged(t *testing.T) {
 	f := NewFixture(t)
 	assert, require := assert.New(t), require.New(t)
@@ -157,3 +429,467 @@ func TestWatchesSymlinkTargetsChanged(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(string(got), "temp")
 }
+
+func TestAddOps(t *testing.T) {
+	f := NewFixture(t)
+	assert, require := assert.New(t), require.New(t)
+	require.NoError(f.Watcher.Add(f.Logs, symnotify.Create, symnotify.Write))
+	link, _ := f.Link("log")
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Create}, f.Event())
+
+	// Swapping the link target is not delivered as Chmod, but the new target is watched.
+	target := Join(f.Targets, "log")
+	tempname, tempfile := f.Create(Join(f.Targets, "temp"))
+	require.NoError(os.Rename(tempname, target))
+	// No event to wait for, write until the new target is watched.
+	var err error
+	for i := 0; i < 100; i++ {
+		_, err = tempfile.Write([]byte("temp"))
+		require.NoError(err)
+		var e symnotify.Event
+		if e, err = f.Watcher.EventTimeout(10 * time.Millisecond); err == nil {
+			assert.Equal(link, e.Name)
+			assert.Equal(symnotify.Write, e.Op)
+			break
+		}
+	}
+	require.NoError(err, "no Write event for the new target")
+	for e, err := f.Watcher.EventTimeout(10 * time.Millisecond); err == nil; e, err = f.Watcher.EventTimeout(10 * time.Millisecond) {
+		assert.Equal(symnotify.Write, e.Op)
+	}
+
+	require.NoError(os.Remove(link))
+	_, err = f.Watcher.EventTimeout(100 * time.Millisecond)
+	assert.Equal(os.ErrDeadlineExceeded, err, "Remove not delivered")
+}
+
+func TestFileInfo(t *testing.T) {
+	f := NewFixture(t)
+	assert, require := assert.New(t), require.New(t)
+	require.NoError(f.Watcher.Add(f.Logs))
+	link, file := f.Link("log")
+	next := func() symnotify.Event {
+		e, err := f.Watcher.EventTimeout(time.Second)
+		require.NoError(err)
+		return e
+	}
+	e := next()
+	assert.Equal(symnotify.Create, e.Op)
+	require.NotNil(e.Info)
+	assert.True(e.Info.Mode().IsRegular(), "Info is for the link target")
+	_, err := file.Write([]byte("hello"))
+	require.NoError(err)
+	e = next()
+	assert.Equal(symnotify.Write, e.Op)
+	require.NotNil(e.Info)
+	assert.Equal(int64(5), e.Info.Size())
+	require.NoError(os.Remove(link))
+	e = next()
+	assert.Equal(symnotify.Remove, e.Op)
+	assert.Nil(e.Info)
+
+	g := NewFixture(t, symnotify.NoFileInfo())
+	require.NoError(g.Watcher.Add(g.Logs))
+	g.Create(Join(g.Logs, "log"))
+	e, err = g.Watcher.EventTimeout(time.Second)
+	require.NoError(err)
+	assert.Equal(symnotify.Create, e.Op)
+	assert.Nil(e.Info)
+}
+
+func TestChainedSymlinks(t *testing.T) {
+	f := NewFixture(t)
+	assert, require := assert.New(t), require.New(t)
+	// Kubernetes layout: logs/x.log -> pods/0.log -> targets/x.log
+	pods := Join(f.Root, "pods")
+	require.NoError(os.Mkdir(pods, os.ModePerm))
+	_, file := f.Create(Join(f.Targets, "x.log"))
+	mid := Join(pods, "0.log")
+	require.NoError(os.Symlink(Join(f.Targets, "x.log"), mid))
+	link := Join(f.Logs, "x.log")
+	require.NoError(os.Symlink(mid, link))
+	require.NoError(f.Watcher.Add(f.Logs))
+	assert.Contains(f.Watcher.WatchList(), pods)
+
+	_, err := file.Write([]byte("hello"))
+	require.NoError(err)
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Write}, f.Event())
+
+	// Point the middle of the chain to a new file.
+	_, file2 := f.Create(Join(f.Targets, "y.log"))
+	tmp := Join(pods, "tmp")
+	require.NoError(os.Symlink(Join(f.Targets, "y.log"), tmp))
+	require.NoError(os.Rename(tmp, mid))
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Chmod}, f.Event())
+	_, err = file2.Write([]byte("world"))
+	require.NoError(err)
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Write}, f.Event())
+	_, err = f.Watcher.EventTimeout(100 * time.Millisecond)
+	assert.Equal(os.ErrDeadlineExceeded, err, "no events for the chain directory")
+
+	require.NoError(os.Remove(link))
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Remove}, f.Event())
+	assert.NotContains(f.Watcher.WatchList(), pods)
+}
+
+func TestRawEvents(t *testing.T) {
+	f := NewFixture(t, symnotify.RawEvents())
+	assert, require := assert.New(t), require.New(t)
+	// logs/x.log -> pods/0.log -> targets/x.log
+	pods := Join(f.Root, "pods")
+	require.NoError(os.Mkdir(pods, os.ModePerm))
+	f.Create(Join(f.Targets, "x.log"))
+	mid := Join(pods, "0.log")
+	require.NoError(os.Symlink(Join(f.Targets, "x.log"), mid))
+	link := Join(f.Logs, "x.log")
+	require.NoError(os.Symlink(mid, link))
+	require.NoError(f.Watcher.Add(f.Logs))
+
+	// The Chmod caused by replacing the middle of the chain has the replacement as its Raw event.
+	f.Create(Join(f.Targets, "y.log"))
+	tmp := Join(pods, "tmp")
+	require.NoError(os.Symlink(Join(f.Targets, "y.log"), tmp))
+	require.NoError(os.Rename(tmp, mid))
+	e := f.Event()
+	assert.Equal(link, e.Name)
+	assert.Equal(symnotify.Chmod, e.Op)
+	require.NotNil(e.Raw)
+	assert.Equal(fsnotify.Event{Name: mid, Op: fsnotify.Create}, *e.Raw)
+
+	// A direct event has itself as its Raw event.
+	log, _ := f.Create(Join(f.Logs, "log"))
+	e = f.Event()
+	assert.Equal(symnotify.Event{Name: log, Op: symnotify.Create, Raw: &fsnotify.Event{Name: log, Op: fsnotify.Create}}, e)
+}
+
+func TestMaxLinkDepth(t *testing.T) {
+	f := NewFixture(t, symnotify.MaxLinkDepth(2))
+	assert, require := assert.New(t), require.New(t)
+	require.NoError(f.Watcher.Add(f.Logs))
+	// Chain of 3 symlinks, and a loop.
+	_, file := f.Create(Join(f.Targets, "x.log"))
+	require.NoError(os.Symlink(Join(f.Targets, "x.log"), Join(f.Targets, "a")))
+	require.NoError(os.Symlink(Join(f.Targets, "a"), Join(f.Targets, "b")))
+	link := Join(f.Logs, "x.log")
+	require.NoError(os.Symlink(Join(f.Targets, "b"), link))
+	loop := Join(f.Logs, "loop")
+	require.NoError(os.Symlink(loop, loop))
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Create}, f.Event())
+	assert.Equal(symnotify.Event{Name: loop, Op: symnotify.Create}, f.Event())
+	assert.Equal([]string{f.Logs}, f.Watcher.WatchList())
+
+	_, err := file.Write([]byte("hello"))
+	require.NoError(err)
+	_, err = f.Watcher.EventTimeout(100 * time.Millisecond)
+	assert.Equal(os.ErrDeadlineExceeded, err, "chain too long, not watched")
+}
+
+func TestAddFile(t *testing.T) {
+	f := NewFixture(t)
+	assert, require := assert.New(t), require.New(t)
+	audit, file := f.Create(Join(f.Logs, "audit.log"))
+	_, other := f.Create(Join(f.Logs, "other.log"))
+	link, target := f.Link("link.log")
+	require.NoError(f.Watcher.AddFile(audit))
+	require.NoError(f.Watcher.AddFile(link))
+	assert.Equal([]string{f.Logs, audit, link}, f.Watcher.WatchList())
+
+	for _, file := range []*os.File{other, file, target} {
+		_, err := file.Write([]byte("hello"))
+		require.NoError(err)
+	}
+	assert.Equal(symnotify.Event{Name: audit, Op: symnotify.Write}, f.Event())
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Write}, f.Event())
+
+	// Replaced file.
+	require.NoError(os.Remove(audit))
+	assert.Equal(symnotify.Event{Name: audit, Op: symnotify.Remove}, f.Event())
+	f.Create(audit)
+	assert.Equal(symnotify.Event{Name: audit, Op: symnotify.Create}, f.Event())
+	f.Create(Join(f.Logs, "new.log"))
+	_, err := f.Watcher.EventTimeout(100 * time.Millisecond)
+	assert.Equal(os.ErrDeadlineExceeded, err, "no events for other files")
+
+	require.NoError(f.Watcher.Remove(audit))
+	require.NoError(f.Watcher.Remove(link))
+	assert.Empty(f.Watcher.WatchList())
+}
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	record := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, fmt.Sprintf(format, args...))
+	}
+	f := NewFixture(t, symnotify.WithHooks(symnotify.Hooks{
+		WatchAdded:     func(path string) { record("added %v", filepath.Base(path)) },
+		WatchRemoved:   func(path string) { record("removed %v", filepath.Base(path)) },
+		EventDelivered: func(e symnotify.Event) { record("delivered %v %v", filepath.Base(e.Name), e.Op) },
+		EventDropped: func(e symnotify.Event, reason string) {
+			record("dropped %v %v %v", filepath.Base(e.Name), e.Op, reason)
+		},
+	}))
+	assert, require := assert.New(t), require.New(t)
+	require.NoError(f.Watcher.Add(f.Logs, symnotify.Create, symnotify.Write))
+	log, _ := f.Create(Join(f.Logs, "log"))
+	assert.Equal(symnotify.Event{Name: log, Op: symnotify.Create}, f.Event())
+	require.NoError(os.Remove(log))
+	require.NoError(os.Mkdir(Join(f.Logs, "dir"), 0700))
+	assert.Equal(symnotify.Event{Name: Join(f.Logs, "dir"), Op: symnotify.Create}, f.Event())
+	// EventDelivered is called after the event is received, wait for it.
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n >= 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(f.Watcher.Remove(f.Logs))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([]string{
+		"added logs",
+		"delivered log CREATE",
+		"dropped log REMOVE filtered",
+		"delivered dir CREATE",
+		"removed logs",
+	}, got)
+}
+
+func TestEventsChannel(t *testing.T) {
+	f := NewFixture(t, symnotify.NoFileInfo())
+	require.NoError(t, f.Watcher.Add(f.Logs))
+	link, file := f.Link("log")
+	next := func() symnotify.Event {
+		t.Helper()
+		select {
+		case e := <-f.Watcher.Events():
+			e.Time = time.Time{}
+			return e
+		case <-time.After(time.Second):
+			require.FailNow(t, "timeout waiting for event")
+			return symnotify.Event{}
+		}
+	}
+	assert.Equal(t, symnotify.Event{Name: link, Op: symnotify.Create}, next())
+	_, err := file.Write([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, symnotify.Event{Name: link, Op: symnotify.Write}, next())
+
+	require.NoError(t, f.Watcher.Close())
+	select {
+	case _, ok := <-f.Watcher.Events():
+		assert.False(t, ok, "expected closed channel")
+	case <-time.After(time.Second):
+		assert.Fail(t, "channel not closed")
+	}
+}
+
+func TestEventContext(t *testing.T) {
+	f := NewFixture(t, symnotify.NoFileInfo())
+	require.NoError(t, f.Watcher.Add(f.Logs))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := f.Watcher.EventContext(ctx)
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "EventContext not cancelled")
+	}
+
+	// Watcher still works after a cancelled wait.
+	log, _ := f.Create(Join(f.Logs, "log"))
+	e, err := f.Watcher.EventContext(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, symnotify.Event{Name: log, Op: symnotify.Create}, symnotify.Event{Name: e.Name, Op: e.Op})
+
+	_, err = f.Watcher.EventTimeout(time.Millisecond)
+	assert.Equal(t, os.ErrDeadlineExceeded, err)
+}
+
+func TestClose(t *testing.T) {
+	f := NewFixture(t)
+	require.NoError(t, f.Watcher.Add(f.Logs))
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := f.Watcher.Event()
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond) // Let the goroutines block.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() { defer wg.Done(); assert.NoError(t, f.Watcher.Close()) }()
+	}
+	wg.Wait()
+	for i := 0; i < cap(errs); i++ {
+		assert.Equal(t, io.EOF, <-errs)
+	}
+	_, ok := <-f.Watcher.Events()
+	assert.False(t, ok, "events closed")
+	assert.NoError(t, f.Watcher.Close())
+}
+
+func TestCloseDrain(t *testing.T) {
+	f := NewFixture(t, symnotify.Coalesce(time.Hour))
+	require.NoError(t, f.Watcher.Add(f.Logs))
+	log, _ := f.Create(Join(f.Logs, "log"))
+	time.Sleep(10 * time.Millisecond) // Let the event be buffered.
+	done := make(chan error)
+	go func() { done <- f.Watcher.CloseDrain(time.Second) }()
+	assert.Equal(t, symnotify.Event{Name: log, Op: symnotify.Create}, f.Event())
+	assert.NoError(t, <-done)
+	_, err := f.Watcher.Event()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRemoveDirectory(t *testing.T) {
+	f := NewFixture(t)
+	assert, require := assert.New(t), require.New(t)
+	_, file1 := f.Link("log1")
+	require.NoError(f.Watcher.Add(f.Logs))
+	link2, file2 := f.Link("log2")
+	assert.Equal(symnotify.Event{Name: link2, Op: symnotify.Create}, f.Event())
+
+	require.NoError(f.Watcher.Remove(f.Logs))
+	for _, file := range []*os.File{file1, file2} {
+		_, err := file.Write([]byte("hello"))
+		require.NoError(err)
+	}
+	f.Create(Join(f.Logs, "log3"))
+	_, err := f.Watcher.EventTimeout(100 * time.Millisecond)
+	assert.Equal(os.ErrDeadlineExceeded, err)
+}
+
+func TestWatchList(t *testing.T) {
+	f := NewFixture(t)
+	assert, require := assert.New(t), require.New(t)
+	link1, _ := f.Link("log1")
+	require.NoError(f.Watcher.Add(f.Logs))
+	assert.Equal([]string{f.Logs, link1}, f.Watcher.WatchList())
+
+	link2, _ := f.Link("log2")
+	assert.Equal(symnotify.Event{Name: link2, Op: symnotify.Create}, f.Event())
+	assert.Equal([]string{f.Logs, link1, link2}, f.Watcher.WatchList())
+
+	require.NoError(os.Remove(link1))
+	assert.Equal(symnotify.Event{Name: link1, Op: symnotify.Remove}, f.Event())
+	assert.Equal([]string{f.Logs, link2}, f.Watcher.WatchList())
+
+	require.NoError(f.Watcher.Remove(f.Logs))
+	assert.Empty(f.Watcher.WatchList())
+}
+
+func TestRecursive(t *testing.T) {
+	f := NewFixture(t, symnotify.Recursive())
+	assert, require := assert.New(t), require.New(t)
+	// Existing subdirectory
+	pod1 := Join(f.Logs, "pod1")
+	require.NoError(os.MkdirAll(Join(pod1, "foo"), os.ModePerm))
+	log1, file1 := f.Create(Join(pod1, "foo", "0.log"))
+	require.NoError(f.Watcher.Add(f.Logs))
+	_, err := file1.Write([]byte("hello"))
+	require.NoError(err)
+	assert.Equal(symnotify.Event{Name: log1, Op: symnotify.Write}, f.Event())
+
+	// New subdirectory tree, created before the watch on it is added.
+	pod2 := Join(f.Logs, "pod2")
+	require.NoError(os.MkdirAll(Join(pod2, "bar"), os.ModePerm))
+	assert.Equal(symnotify.Event{Name: pod2, Op: symnotify.Create}, f.Event())
+	assert.Equal(symnotify.Event{Name: Join(pod2, "bar"), Op: symnotify.Create}, f.Event())
+	log2, file2 := f.Create(Join(pod2, "bar", "0.log"))
+	assert.Equal(symnotify.Event{Name: log2, Op: symnotify.Create}, f.Event())
+	_, err = file2.Write([]byte("hello"))
+	require.NoError(err)
+	assert.Equal(symnotify.Event{Name: log2, Op: symnotify.Write}, f.Event())
+	assert.Equal([]string{f.Logs, pod1, Join(pod1, "foo"), pod2, Join(pod2, "bar")}, f.Watcher.WatchList())
+
+	// Moving a subdirectory out releases its watches.
+	require.NoError(os.Rename(pod2, Join(f.Root, "pod2")))
+	assert.Equal(symnotify.Event{Name: pod2, Op: symnotify.Rename}, f.Event())
+	assert.Equal([]string{f.Logs, pod1, Join(pod1, "foo")}, f.Watcher.WatchList())
+	_, err = file2.Write([]byte("hello"))
+	require.NoError(err)
+	for {
+		// The moved directory may also report its own Rename, nothing else is expected.
+		e, err := f.Watcher.EventTimeout(100 * time.Millisecond)
+		if err != nil {
+			assert.Equal(os.ErrDeadlineExceeded, err)
+			break
+		}
+		assert.Equal(symnotify.Event{Name: pod2, Op: symnotify.Rename}, symnotify.Event{Name: e.Name, Op: e.Op})
+	}
+
+	require.NoError(f.Watcher.Remove(f.Logs))
+	assert.Empty(f.Watcher.WatchList())
+}
+
+func TestCoalesce(t *testing.T) {
+	f := NewFixture(t, symnotify.Coalesce(100*time.Millisecond))
+	assert, require := assert.New(t), require.New(t)
+	link, file := f.Link("log1")
+	require.NoError(f.Watcher.Add(f.Logs))
+	for i := 0; i < 100; i++ {
+		_, err := file.Write([]byte("hello\n"))
+		require.NoError(err)
+	}
+	assert.Equal(symnotify.Event{Name: link, Op: symnotify.Write}, f.Event())
+	_, err := f.Watcher.EventTimeout(200 * time.Millisecond)
+	assert.Equal(os.ErrDeadlineExceeded, err)
+
+	// Only consecutive events for the same name are merged.
+	log2, file2 := f.Create(Join(f.Logs, "log2"))
+	write := func() {
+		for _, s := range []string{"a", "b"} {
+			_, err := file2.Write([]byte(s))
+			require.NoError(err)
+		}
+	}
+	write()
+	require.NoError(os.Chmod(log2, 0600))
+	write()
+	for _, op := range []symnotify.Op{symnotify.Create, symnotify.Write, symnotify.Chmod, symnotify.Write} {
+		assert.Equal(symnotify.Event{Name: log2, Op: op}, f.Event())
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	if testing.Short() {
+		t.Skip("creates many files")
+	}
+	max, err := ioutil.ReadFile("/proc/sys/fs/inotify/max_queued_events")
+	if err != nil {
+		t.Skip("not inotify:", err)
+	}
+	f := NewFixture(t)
+	require.NoError(t, f.Watcher.Add(f.Logs))
+	// Don't read events until the kernel queue is full.
+	var n int
+	_, err = fmt.Sscan(string(max), &n)
+	require.NoError(t, err)
+	for i := 0; i < 2*n; i++ { // Some events are read before the watcher blocks.
+		file, err := os.Create(Join(f.Logs, fmt.Sprint(i)))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+	for {
+		e, err := f.Watcher.EventTimeout(time.Second)
+		require.NoError(t, err, "no overflow event")
+		if e.Op == symnotify.Overflow {
+			assert.Empty(t, e.Name)
+			break
+		}
+	}
+}
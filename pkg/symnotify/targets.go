@@ -0,0 +1,223 @@
+package symnotify
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The kqueue backend of fsnotify, on macOS and BSD, differs from inotify for symlinks:
+//   - A watch added for a symlink is kept for the resolved target path, events use the target path,
+//     and the watch can't be removed using the symlink path.
+//   - Entries of a watched directory are watched individually, following symlinks.
+//   - A Create event is repeated for each symlink in a directory whenever the directory changes.
+//   - Removing a directory entry is not notified, only removing or renaming the watched file is.
+//
+// The Windows backend watches the directory of a file for changes to its name,
+// a watch added for a symlink or NTFS junction does not see writes to the target.
+// On Windows the Watcher adds the watch for the resolved target instead, see linkWatch.
+//
+// When resolvesLinks is true the Watcher records the resolved target of each watched symlink,
+// translates target events back to symlink events, drops repeated Create events,
+// and checks for removed symlinks when a directory reports a Create after it was modified.
+// With kqueue, a symlink removed from a directory with no other symlinks is only noticed
+// when its target changes.
+
+// targets records the resolved target of watched symlinks.
+type targets struct {
+	mu    sync.Mutex
+	of    map[string]string          // Resolved target of each watched symlink.
+	links map[string]map[string]bool // Watched symlinks resolving to each target.
+	dirs  map[string]time.Time       // Modification time of each directory when it was last checked.
+}
+
+// modified returns true if dir was modified since the last call for dir.
+func (t *targets) modified(dir string) bool {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dirs == nil {
+		t.dirs = map[string]time.Time{}
+	}
+	if last, ok := t.dirs[dir]; ok && last.Equal(info.ModTime()) {
+		return false
+	}
+	t.dirs[dir] = info.ModTime()
+	return true
+}
+
+// set records the target of link, returns the previous target if it changed,
+// and whether another link still resolves to it.
+func (t *targets) set(link, target string) (old string, shared bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if prev, ok := t.of[link]; ok {
+		if prev == target {
+			return "", false
+		}
+		t.clear(link)
+		old, shared = prev, len(t.links[prev]) > 0
+	}
+	if t.of == nil {
+		t.of, t.links = map[string]string{}, map[string]map[string]bool{}
+	}
+	t.of[link] = target
+	if t.links[target] == nil {
+		t.links[target] = map[string]bool{}
+	}
+	t.links[target][link] = true
+	return old, shared
+}
+
+// remove forgets link, returns its target and whether another link still resolves to it.
+func (t *targets) remove(link string) (target string, ok, shared bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if target, ok = t.of[link]; ok {
+		t.clear(link)
+	}
+	return target, ok, len(t.links[target]) > 0
+}
+
+// clear forgets link. Must be called with t.mu locked.
+func (t *targets) clear(link string) {
+	target := t.of[link]
+	delete(t.of, link)
+	delete(t.links[target], link)
+	if len(t.links[target]) == 0 {
+		delete(t.links, target)
+	}
+}
+
+// resolved returns the target of link, if recorded.
+func (t *targets) resolved(link string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	target, ok := t.of[link]
+	return target, ok
+}
+
+// linksWithin returns the watched symlinks resolving to dir or to a path under it.
+func (t *targets) linksWithin(dir string) (links []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for link, target := range t.of {
+		if within(dir, target) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// linksTo returns the watched symlinks resolving to target.
+func (t *targets) linksTo(target string) (links []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for link := range t.links[target] {
+		links = append(links, link)
+	}
+	return links
+}
+
+// setTarget records the resolved target of watched symlink name,
+// releasing the watch on its previous target if it changed.
+func (w *Watcher) setTarget(name string) {
+	if !w.resolvesLinks {
+		return
+	}
+	target, err := filepath.EvalSymlinks(name)
+	if err != nil || target == name {
+		w.targets.remove(name)
+		return
+	}
+	if old, shared := w.targets.set(name, target); old != "" {
+		_ = w.release(old, shared)
+	}
+}
+
+// removeWatch removes the fsnotify watch for name. For a symlink with resolvesLinks
+// the watch is on the target, it is kept while the target is still needed.
+// Must not be called with w.mu locked for a symlink.
+func (w *Watcher) removeWatch(name string) error {
+	if !w.resolvesLinks {
+		return w.watcher.Remove(name)
+	}
+	target, ok, shared := w.targets.remove(name)
+	if !ok {
+		return w.watcher.Remove(name)
+	}
+	return w.release(target, shared)
+}
+
+// release removes the watch on a symlink target unless it is shared or watched in its own right.
+// Must not be called with w.mu locked.
+func (w *Watcher) release(target string, shared bool) error {
+	w.mu.Lock()
+	_, file := w.files[target]
+	needed := shared || file || w.ownWatch(filepath.Dir(target))
+	w.mu.Unlock()
+	if needed {
+		return nil
+	}
+	return w.watcher.Remove(target)
+}
+
+// translate returns the events for an fsnotify event: events on a resolved target are
+// delivered for the symlinks resolving to it, and for the target itself only if it is watched
+// in its own right. A Create may add Remove events for vanished symlinks in the same directory.
+// Returns nil if the event should be dropped, with the drop reason.
+func (w *Watcher) translate(e Event) (events []Event, reason string) {
+	if !w.resolvesLinks {
+		return []Event{e}, ""
+	}
+	if e.Op == Create {
+		if dir := filepath.Dir(e.Name); w.targets.modified(dir) {
+			events = w.vanished(dir)
+		}
+		if target, ok := w.targets.resolved(e.Name); ok {
+			if now, err := filepath.EvalSymlinks(e.Name); err == nil && now == target {
+				if len(events) == 0 {
+					return nil, DropDuplicate
+				}
+				return events, ""
+			}
+		}
+		return append([]Event{e}, events...), ""
+	}
+	for _, link := range w.targets.linksTo(e.Name) {
+		events = append(events, Event{Name: link, Op: e.Op})
+	}
+	if len(events) == 0 {
+		return []Event{e}, ""
+	}
+	w.mu.Lock()
+	_, file := w.files[e.Name]
+	own := file || w.ownWatch(filepath.Dir(e.Name))
+	w.mu.Unlock()
+	if own {
+		events = append([]Event{e}, events...)
+	}
+	return events, ""
+}
+
+// vanished returns Remove events for watched symlinks in dir that no longer exist.
+func (w *Watcher) vanished(dir string) (events []Event) {
+	w.mu.Lock()
+	var links []string
+	for link := range w.links {
+		if filepath.Dir(link) == dir {
+			links = append(links, link)
+		}
+	}
+	w.mu.Unlock()
+	for _, link := range links {
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			events = append(events, Event{Name: link, Op: Remove})
+		}
+	}
+	return events
+}
@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package symnotify
+
+import "os"
+
+// platformResolvesLinks is true if fsnotify reports symlink events on the resolved target, see targets.go.
+const platformResolvesLinks = true
+
+// linkModes are the file modes of paths treated as symlinks.
+const linkModes = os.ModeSymlink
+
+// linkWatch returns the path to watch for symlink name, kqueue resolves it.
+func linkWatch(name string) string { return name }
@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package symnotify
+
+import "os"
+
+// platformResolvesLinks is true if fsnotify reports symlink events on the resolved target, see targets.go.
+const platformResolvesLinks = false
+
+// linkModes are the file modes of paths treated as symlinks.
+const linkModes = os.ModeSymlink
+
+// linkWatch returns the path to watch for symlink name, inotify follows it.
+func linkWatch(name string) string { return name }
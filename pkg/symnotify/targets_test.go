@@ -0,0 +1,62 @@
+package symnotify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTranslate checks symlink target event translation, it can run on any platform.
+func TestTranslate(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	logs, targets := filepath.Join(dir, "logs"), filepath.Join(dir, "targets")
+	require.NoError(t, os.Mkdir(logs, 0700))
+	require.NoError(t, os.Mkdir(targets, 0700))
+	target, a, b, plain := filepath.Join(targets, "t"), filepath.Join(logs, "a"), filepath.Join(logs, "b"), filepath.Join(logs, "plain")
+	require.NoError(t, ioutil.WriteFile(target, nil, 0600))
+	require.NoError(t, ioutil.WriteFile(plain, nil, 0600))
+	require.NoError(t, os.Symlink(target, a))
+	require.NoError(t, os.Symlink(target, b))
+
+	w, err := NewWatcher()
+	require.NoError(t, err)
+	defer w.Close()
+	w.resolvesLinks = true
+	require.NoError(t, w.Add(logs))
+
+	// Target events are delivered for the symlinks, not for the unwatched target.
+	events, _ := w.translate(Event{Name: target, Op: Write})
+	assert.ElementsMatch(t, []Event{{Name: a, Op: Write}, {Name: b, Op: Write}}, events)
+	// Other events are unchanged.
+	events, _ = w.translate(Event{Name: plain, Op: Write})
+	assert.Equal(t, []Event{{Name: plain, Op: Write}}, events)
+	// Repeated Create for a known symlink is dropped.
+	events, reason := w.translate(Event{Name: a, Op: Create})
+	assert.Nil(t, events)
+	assert.Equal(t, DropDuplicate, reason)
+
+	// A Create after the directory changed reports removed symlinks.
+	require.NoError(t, os.Remove(b))
+	events, _ = w.translate(Event{Name: a, Op: Create})
+	assert.Equal(t, []Event{{Name: b, Op: Remove}}, events)
+	w.process(events[0])
+	// The target watch is kept while another symlink resolves to it.
+	assert.Equal(t, []string{a}, w.targets.linksTo(target))
+
+	// A replaced symlink is not a duplicate.
+	other := filepath.Join(targets, "other")
+	require.NoError(t, ioutil.WriteFile(other, nil, 0600))
+	require.NoError(t, os.Remove(a))
+	require.NoError(t, os.Symlink(other, a))
+	events, _ = w.translate(Event{Name: a, Op: Create})
+	assert.Equal(t, []Event{{Name: a, Op: Create}}, events)
+	w.process(events[0])
+	assert.Empty(t, w.targets.linksTo(target))
+	assert.Equal(t, []string{a}, w.targets.linksTo(other))
+}
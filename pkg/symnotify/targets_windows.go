@@ -0,0 +1,24 @@
+package symnotify
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// platformResolvesLinks is true if fsnotify reports symlink events on the resolved target, see targets.go.
+const platformResolvesLinks = true
+
+// linkModes are the file modes of paths treated as symlinks.
+// Depending on the Go version and GODEBUG=winsymlink, NTFS junctions are reported
+// as symlinks or as irregular files, both resolve with filepath.EvalSymlinks.
+const linkModes = os.ModeSymlink | os.ModeIrregular
+
+// linkWatch returns the path to watch for symlink name: its resolved target,
+// since a watch on the symlink only sees changes to the symlink itself.
+// Returns name if it can't be resolved, to notice when it is replaced.
+func linkWatch(name string) string {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		return target
+	}
+	return name
+}